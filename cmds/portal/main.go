@@ -18,6 +18,7 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
 	"cloudiac/portal/services/sshkey"
 	"cloudiac/portal/web"
 	"cloudiac/utils/kafka"
@@ -55,6 +56,9 @@ func main() {
 	{
 		db.Init(configs.Get().Mysql)
 		models.Init(true)
+		if err := logstorage.Init(configs.Get().LogStorage); err != nil {
+			panic(errors.Wrap(err, "init log storage"))
+		}
 
 		tx := db.Get().Begin()
 		defer func() {
@@ -222,6 +226,14 @@ func initSystemConfig(tx *db.Session) (err error) {
 			Name:        models.SysCfgNamePeriodOfLogSave,
 			Value:       "Permanent",
 			Description: "日志保存周期",
+		}, {
+			Name:        models.SysCfgNameMaxTasksPerOrg,
+			Value:       "0",
+			Description: "每个组织同时执行的最大任务数，0 表示不限制",
+		}, {
+			Name:        models.SysCfgNameMaxTasksPerProject,
+			Value:       "0",
+			Description: "每个项目同时执行的最大任务数，0 表示不限制",
 		},
 	}
 
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"cloudiac/runner"
 	v1 "cloudiac/runner/api/v1"
 	"cloudiac/utils"
 	"fmt"
@@ -48,6 +49,16 @@ func main() {
 	conf := configs.Get().Log
 	logs.Init(conf.LogLevel, conf.LogPath, conf.LogMaxDays)
 
+	go runner.StartWorkspaceGC()
+
+	// 拉取模式下 runner 主动连接 portal，不需要注册到 consul 及启动 api 服务
+	if configs.Get().Runner.IsPullMode() {
+		if err := runner.StartPullAgent(); err != nil {
+			logs.Get().Fatalln(err)
+		}
+		return
+	}
+
 	common.ReRegisterService(opt.ReRegister, "CT-Runner")
 	StartServer()
 }
@@ -67,6 +78,10 @@ func checkConfigs(c *configs.Config) error {
 			return fmt.Errorf("configuration '%s' is empty", c.name)
 		}
 	}
+
+	if c.Runner.Executor == runner.ExecutorLocal {
+		return runner.CheckLocalExecutor()
+	}
 	return nil
 }
 
@@ -17,6 +17,8 @@ type Option struct {
 	Version        common.VersionCommand `command:"version" description:"show version"`
 	InitDemo       InitDemo              `command:"init-demo" description:"init demo data with config file"`
 	Scan           ScanCmd               `command:"scan" description:"scan template with policy"`
+	StorageMigrate StorageMigrate        `command:"storage-migrate" description:"migrate task logs from database to the configured log storage"`
+	RunnerToken    RunnerToken           `command:"runner-token" description:"generate the access token of a pull mode runner"`
 }
 
 var (
@@ -0,0 +1,29 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package main
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/services"
+	"fmt"
+)
+
+// ./iac-tool runner-token --runner-id runner-01
+// 生成 pull 模式 runner 访问 portal 使用的 token，配置到 runner 的 runner.token
+
+type RunnerToken struct {
+	RunnerId string `long:"runner-id" description:"runner id (consul.id of the runner)" required:"true"`
+}
+
+func (*RunnerToken) Usage() string {
+	return ""
+}
+
+func (r *RunnerToken) Execute(args []string) error {
+	configs.Init(opt.Config)
+	if configs.Get().Portal.RunnerToken == "" {
+		return fmt.Errorf("portal.runner_token is not configured")
+	}
+	fmt.Println(services.RunnerAgentToken(r.RunnerId))
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package main
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ./iac-tool storage-migrate [--keep] [--dry-run]
+// 将 iac_storage 表中保存的任务日志及执行结果迁移到配置的日志存储(log_storage)中，
+// http state backend 的 state 固定保存在 iac_storage 表中，不会迁移。
+// 迁移后内容的修改时间为迁移的时间，日志保存周期从迁移时开始计算
+
+type StorageMigrate struct {
+	Keep   bool `long:"keep" description:"keep the migrated rows in iac_storage"`
+	DryRun bool `long:"dry-run" description:"only show the rows to be migrated"`
+}
+
+func (*StorageMigrate) Usage() string {
+	return ""
+}
+
+func (m *StorageMigrate) Execute(args []string) error {
+	configs.Init(opt.Config)
+	db.Init(configs.Get().Mysql)
+	models.Init(false)
+
+	cfg := configs.Get().LogStorage
+	if cfg.Type == "" || cfg.Type == logstorage.StorageTypeDB {
+		return fmt.Errorf("log storage type is '%s', nothing to migrate", logstorage.StorageTypeDB)
+	}
+	src, err := logstorage.New(configs.LogStorageConfig{Type: logstorage.StorageTypeDB})
+	if err != nil {
+		return err
+	}
+	dst, err := logstorage.New(cfg)
+	if err != nil {
+		return errors.Wrap(err, "init log storage")
+	}
+
+	var (
+		count int
+		size  int64
+	)
+	err = src.Walk(func(info logstorage.ObjectInfo) error {
+		if services.IsTfStateStoragePath(info.Path) {
+			return nil
+		}
+		count += 1
+		size += info.Size
+		if m.DryRun {
+			logger.Infof("%s (%d bytes)", info.Path, info.Size)
+			return nil
+		}
+
+		if err := copyStorage(src, dst, info.Path); err != nil {
+			return errors.Wrapf(err, "migrate '%s'", info.Path)
+		}
+		if !m.Keep {
+			if err := src.Delete(info.Path); err != nil {
+				return errors.Wrapf(err, "delete '%s'", info.Path)
+			}
+		}
+		logger.Debugf("migrated %s", info.Path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if m.DryRun {
+		logger.Infof("%d items (%d bytes) to be migrated to %s storage", count, size, cfg.Type)
+	} else {
+		logger.Infof("%d items (%d bytes) migrated to %s storage", count, size, cfg.Type)
+	}
+	return nil
+}
+
+func copyStorage(src, dst logstorage.LogStorage, path string) error {
+	reader, err := src.Reader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, err := dst.Writer(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		_ = writer.Abort()
+		return err
+	}
+	return writer.Close()
+}
@@ -14,6 +14,11 @@ const (
 	TaskTypeDestroy = "destroy" // 销毁，删除所有资源
 	TaskTypeScan    = "scan"    // 策略扫描，只执行策略扫描，不锈钢资源或配置
 	TaskTypeParse   = "parse"   // 策略扫描，只执行策略扫描，不锈钢资源或配置
+	TaskTypeDrift   = "drift"   // 漂移检测，执行 plan 对比实际资源与 state 的差异，不会修改资源
+	TaskTypeRestore = "restore" // 将环境 state 恢复为历史版本
+	TaskTypeUnlock  = "unlock"  // 强制释放环境 state 锁
+	TaskTypeImport  = "import"  // 将已有资源导入环境 state
+	TaskTypeStateOp = "stateop" // state 操作，执行 state mv/rm 及 taint
 
 	TaskPending   = "pending"
 	TaskRunning   = "running"
@@ -21,17 +26,22 @@ const (
 	TaskRejected  = "rejected"
 	TaskFailed    = "failed"
 	TaskComplete  = "complete"
+	TaskCancelled = "cancelled"
 
-	TaskStepInit     = "init"
-	TaskStepPlan     = "plan"
-	TaskStepApply    = "apply"
-	TaskStepDestroy  = "destroy"
-	TaskStepPlay     = "play"    // play playbook
-	TaskStepCommand  = "command" // run command
-	TaskStepCollect  = "collect" // 任务结束后的信息采集
-	TaskStepScanInit = "scaninit"
-	TaskStepTfParse  = "tfparse" // 云模板解析
-	TaskStepTfScan   = "tfscan"  // 云模板策略扫描
+	TaskStepInit      = "init"
+	TaskStepPlan      = "plan"
+	TaskStepApply     = "apply"
+	TaskStepDestroy   = "destroy"
+	TaskStepPlay      = "play"    // play playbook
+	TaskStepCommand   = "command" // run command
+	TaskStepCollect   = "collect" // 任务结束后的信息采集
+	TaskStepScanInit  = "scaninit"
+	TaskStepTfParse   = "tfparse"   // 云模板解析
+	TaskStepTfScan    = "tfscan"    // 云模板策略扫描
+	TaskStepStatePush = "statepush" // 将 state 文件写入 backend
+	TaskStepUnlock    = "unlock"    // 强制释放 state 锁
+	TaskStepImport    = "import"    // 执行 terraform import 导入资源
+	TaskStepStateOp   = "stateop"   // 执行 state 操作
 
 	CollectTaskStepIndex = -1
 
@@ -42,6 +52,7 @@ const (
 	TaskStepFailed    = "failed"
 	TaskStepComplete  = "complete"
 	TaskStepTimeout   = "timeout"
+	TaskStepCancelled = "cancelled"
 
 	TaskStepPolicyViolationExitCode = 3 // 合规检查不通过时的退出码
 
@@ -49,6 +60,11 @@ const (
 	TaskTypeApplyName   = "apply"
 	TaskTypeDestroyName = "destroy"
 	TaskTypeScanName    = "scan"
+	TaskTypeDriftName   = "drift"
+	TaskTypeRestoreName = "state restore"
+	TaskTypeUnlockName  = "state force-unlock"
+	TaskTypeImportName  = "import"
+	TaskTypeStateOpName = "state operation"
 
 	TaskStepTimeoutDuration = 600
 
@@ -44,12 +44,114 @@ type RunnerConfig struct {
 	AssetsPath      string `yaml:"assets_path"`
 	StoragePath     string `yaml:"storage_path"`
 	PluginCachePath string `yaml:"plugin_cache_path"`
+	// StatePath local state backend 保存 state 文件的目录，多个 runner 时需要使用共享存储
+	StatePath string `yaml:"state_path"`
+
+	// Mode 运行模式，默认为 push 模式，由 portal 调用 runner 接口执行任务；
+	// pull 模式下 runner 主动从 portal 拉取任务步骤并推送执行状态，适用于 portal 无法访问 runner 的网络环境
+	Mode          string `yaml:"mode"`
+	PortalAddress string `yaml:"portal_address"` // pull 模式下 portal 的地址
+	Token         string `yaml:"token"`          // pull 模式下 runner 访问 portal 使用的 token，通过 iac-tool runner-token 为每个 runner 生成
+
+	// AuthKeys 校验 portal 请求签名的密钥，配置多个时任一密钥签名的请求都可以通过校验(用于密钥轮换)，为空时不校验
+	AuthKeys []RunnerAuthKey `yaml:"auth_keys"`
+
+	// Executor 任务步骤执行器: docker(默认) 在容器中执行; local 在 runner 所在主机上以独立进程执行
+	Executor  string `yaml:"executor"`
+	LocalUser string `yaml:"local_user"` // local 执行器运行步骤进程使用的系统用户，为空时使用 runner 进程的用户，步骤进程不允许以 root 运行
+
+	// Resources 任务容器默认资源限制，MaxResources 为模板可以设置的资源限制上限，各项为 0 表示不限制
+	Resources    ResourceLimits `yaml:"resources"`
+	MaxResources ResourceLimits `yaml:"max_resources"`
+	Network      string         `yaml:"network"` // 任务容器使用的 docker 网络，为空时使用 docker 默认网络
+
+	// RegistryAuths 从私有镜像仓库拉取任务镜像使用的认证信息
+	RegistryAuths []RegistryAuth `yaml:"registry_auths"`
+
+	// WorkspaceRetention 任务结束后工作目录(代码、日志、执行结果等)的保存时间，为空时不清理
+	WorkspaceRetention yamlTimeDuration `yaml:"workspace_retention"`
+}
+
+// RegistryAuth 镜像仓库认证信息
+type RegistryAuth struct {
+	Registry string `yaml:"registry"` // 镜像仓库地址，如 registry.example.com，docker hub 为 docker.io
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// FindRegistryAuth 查找镜像仓库的认证信息，未配置时返回 nil
+func (c *RunnerConfig) FindRegistryAuth(registry string) *RegistryAuth {
+	for i := range c.RegistryAuths {
+		if c.RegistryAuths[i].Registry == registry {
+			return &c.RegistryAuths[i]
+		}
+	}
+	return nil
+}
+
+// ResourceLimits 任务容器资源限制
+type ResourceLimits struct {
+	Cpus   float64 `yaml:"cpus"`   // cpu 核数，可以为小数
+	Memory int64   `yaml:"memory"` // 内存(MB)
+	Pids   int64   `yaml:"pids"`   // 最大进程数
+}
+
+// RunnerAuthKey portal 调用 runner 接口时用于请求签名的密钥
+type RunnerAuthKey struct {
+	RunnerId string `yaml:"runner_id"` // 密钥所属 runner，"*" 表示所有 runner，只在 portal 配置中使用
+	KeyId    string `yaml:"key_id"`
+	Secret   string `yaml:"secret"`
+}
+
+// FindAuthKey 按 key id 查找密钥
+func (c *RunnerConfig) FindAuthKey(keyId string) *RunnerAuthKey {
+	for i := range c.AuthKeys {
+		if c.AuthKeys[i].KeyId == keyId && c.AuthKeys[i].Secret != "" {
+			return &c.AuthKeys[i]
+		}
+	}
+	return nil
+}
+
+const (
+	RunnerModePush = "push"
+	RunnerModePull = "pull"
+)
+
+func (c *RunnerConfig) IsPullMode() bool {
+	return c.Mode == RunnerModePull
 }
 
 type PortalConfig struct {
 	Address       string `yaml:"address"` // portal 对外提供服务的 url
 	SSHPrivateKey string `yaml:"ssh_private_key"`
 	SSHPublicKey  string `yaml:"ssh_public_key"`
+
+	DriftCheckInterval yamlTimeDuration `yaml:"drift_check_interval"` // 环境定期漂移检测间隔，默认 24h
+
+	// 生成 pull 模式 runner token 的密钥，每个 runner 使用该密钥对其 id 签名生成的 token，
+	// 为空时不允许 pull 模式 runner 接入
+	RunnerToken string `yaml:"runner_token"`
+
+	// 调用 runner 接口时的签名密钥，同一 runner 配置了多个密钥时使用第一个(用于密钥轮换)
+	RunnerAuthKeys []RunnerAuthKey `yaml:"runner_auth_keys"`
+}
+
+// RunnerAuthKey 获取调用指定 runner 时使用的签名密钥，优先使用 runner 专属的密钥，没有配置时返回 nil
+func (c *PortalConfig) RunnerAuthKey(runnerId string) *RunnerAuthKey {
+	var common *RunnerAuthKey
+	for i := range c.RunnerAuthKeys {
+		k := &c.RunnerAuthKeys[i]
+		if k.Secret == "" {
+			continue
+		}
+		if k.RunnerId == runnerId {
+			return k
+		} else if k.RunnerId == "*" && common == nil {
+			common = k
+		}
+	}
+	return common
 }
 
 func (c *RunnerConfig) mustAbs(path string) string {
@@ -80,10 +182,32 @@ func (c *RunnerConfig) AbsPluginCachePath() string {
 	return c.mustAbs(c.PluginCachePath)
 }
 
+func (c *RunnerConfig) AbsStatePath() string {
+	return c.mustAbs(c.StatePath)
+}
+
 func (c *RunnerConfig) AbsTfenvVersionsCachePath() string {
 	return c.mustAbs(filepath.Join(c.PluginCachePath, ".tfenv-versions"))
 }
 
+// LogStorageConfig 任务日志及执行结果(plan json、state json 等)的存储配置
+type LogStorageConfig struct {
+	Type string          `yaml:"type"` // 存储类型: db(默认) 保存在 iac_storage 表; fs 保存在本地目录; s3 保存在 s3 兼容的对象存储
+	Path string          `yaml:"path"` // fs 存储的目录，多个 portal 实例时需要使用共享存储
+	S3   S3StorageConfig `yaml:"s3"`
+}
+
+// S3StorageConfig s3 兼容对象存储的配置
+type S3StorageConfig struct {
+	Endpoint  string `yaml:"endpoint"` // 服务地址，如 https://s3.us-east-1.amazonaws.com
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"` // 对象 key 前缀
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	PathStyle bool   `yaml:"path_style"` // 使用 path style 地址({endpoint}/{bucket}/{key})，minio 等需要开启
+}
+
 type LogConfig struct {
 	LogLevel   string `yaml:"log_level"`
 	LogPath    string `yaml:"log_path"`
@@ -128,6 +252,7 @@ type Config struct {
 	SecretKey    string           `yaml:"secretKey"`
 	JwtSecretKey string           `yaml:"jwtSecretKey"`
 	Policy       PolicyConfig     `yaml:"policy"`
+	LogStorage   LogStorageConfig `yaml:"log_storage"`
 }
 
 var (
@@ -138,6 +263,8 @@ var (
 		Portal: PortalConfig{
 			SSHPrivateKey: "var/private_key",
 			SSHPublicKey:  "var/private_key.pub",
+
+			DriftCheckInterval: yamlTimeDuration{Duration: 24 * time.Hour},
 		},
 	}
 )
@@ -107,7 +107,7 @@ var Polices = []Policy{
 	{"approver", "envs", "*"},
 	{"approver", "tasks", "*"},
 	{"operator", "envs", "read/update/deploy/destroy"},
-	{"operator", "tasks", "read"},
+	{"operator", "tasks", "read/cancel/resume"},
 	{"guest", "envs", "read"},
 	{"guest", "tasks", "read"},
 
@@ -153,10 +153,30 @@ var Polices = []Policy{
 	{"operator", "runners", "read"},
 	{"guest", "runners", "read"},
 
+	// 任务队列
+	{"admin", "task_queue", "read"},
+	{"member", "task_queue", "read"},
+	{"manager", "task_queue", "read"},
+	{"approver", "task_queue", "read"},
+	{"operator", "task_queue", "read"},
+	{"guest", "task_queue", "read"},
+
 	// 密钥
 	{"admin", "keys", "*"},
 	{"member", "keys", "*"},
 
+	// state backend
+	{"admin", "state_backends", "*"},
+	{"member", "state_backends", "read"},
+
+	// 价格目录
+	{"admin", "resource_prices", "*"},
+	{"member", "resource_prices", "read"},
+
+	// 资源清单
+	{"admin", "inventory", "read"},
+	{"member", "inventory", "read"},
+
 	// 演示模式，当访问演示组织下的资源，进入受限模式
 	{"demo", "orgs", "read"},
 	{"demo", "users", "read"},
@@ -167,6 +187,10 @@ var Polices = []Policy{
 	{"demo", "vcs", "read"},
 	{"demo", "runners", "read"},
 	{"demo", "keys", "read"},
+	{"demo", "state_backends", "read"},
+	{"demo", "resource_prices", "read"},
+	{"demo", "inventory", "read"},
+	{"demo", "task_queue", "read"},
 	{"demo", "templates", "read"},
 	{"demo", "envs", "*"},
 	{"demo", "tasks", "*"},
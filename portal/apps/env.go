@@ -49,6 +49,13 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 	if !form.HasKey("playbook") {
 		form.Playbook = tpl.Playbook
 	}
+	if err := services.CheckTaskImage(c.DB(), c.OrgId, form.Image); err != nil {
+		return nil, err
+	}
+
+	if form.CostDeltaThreshold != nil && !hasApprovalRole(c) {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("approval role required"), http.StatusBadRequest)
+	}
 
 	if form.Timeout == 0 {
 		form.Timeout = common.TaskStepTimeoutDuration
@@ -84,11 +91,13 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		CreatorId: c.UserId,
 		TplId:     form.TplId,
 
-		Name:     form.Name,
-		RunnerId: form.RunnerId,
-		Status:   models.EnvStatusInactive,
-		OneTime:  form.OneTime,
-		Timeout:  form.Timeout,
+		Name:       form.Name,
+		RunnerId:   form.RunnerId,
+		RunnerTags: form.RunnerTags,
+		Image:      form.Image,
+		Status:     models.EnvStatusInactive,
+		OneTime:    form.OneTime,
+		Timeout:    form.Timeout,
 
 		// 模板参数
 		TfVarsFile:   form.TfVarsFile,
@@ -106,6 +115,9 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		RetryAble:   form.RetryAble,
 		RetryDelay:  form.RetryDelay,
 		RetryNumber: form.RetryNumber,
+		DriftCheck:  form.DriftCheck,
+
+		CostDeltaThreshold: form.CostDeltaThreshold,
 	})
 	if err != nil && err.Code() == e.EnvAlreadyExists {
 		_ = tx.Rollback()
@@ -184,6 +196,12 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 	return &envDetail, nil
 }
 
+// hasApprovalRole 用户是否有审批权限，修改自动审批、月费用增加限制等影响审批的设置需要该权限
+func hasApprovalRole(c *ctx.ServiceContext) bool {
+	return c.IsSuperAdmin || services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) ||
+		services.UserHasProjectRole(c.UserId, c.OrgId, c.ProjectId, consts.ProjectRoleManager)
+}
+
 // SearchEnv 环境查询
 func SearchEnv(c *ctx.ServiceContext, form *forms.SearchEnvForm) (interface{}, e.Error) {
 	if c.OrgId == "" || c.ProjectId == "" {
@@ -314,6 +332,15 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 	if form.HasKey("runnerId") {
 		attrs["runner_id"] = form.RunnerId
 	}
+	if form.HasKey("runnerTags") {
+		attrs["runner_tags"] = models.StrSlice(form.RunnerTags)
+	}
+	if form.HasKey("image") {
+		if err := services.CheckTaskImage(c.DB(), c.OrgId, form.Image); err != nil {
+			return nil, err
+		}
+		attrs["image"] = form.Image
+	}
 	if form.HasKey("retryAble") {
 		attrs["retryAble"] = form.RetryAble
 	}
@@ -323,6 +350,16 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 	if form.HasKey("retryDelay") {
 		attrs["retryDelay"] = form.RetryDelay
 	}
+	if form.HasKey("driftCheck") {
+		attrs["drift_check"] = form.DriftCheck
+	}
+	if form.HasKey("costDeltaThreshold") {
+		// 月费用增加限制会覆盖组织的设置，与自动审批一样需要审批权限
+		if !hasApprovalRole(c) {
+			return nil, e.New(e.PermissionDeny, fmt.Errorf("approval role required"), http.StatusBadRequest)
+		}
+		attrs["cost_delta_threshold"] = form.CostDeltaThreshold
+	}
 
 	if form.HasKey("autoApproval") {
 		if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) &&
@@ -429,7 +466,7 @@ func EnvDetail(c *ctx.ServiceContext, form forms.DetailEnvForm) (*models.EnvDeta
 }
 
 // EnvDeploy 创建新部署任务
-// 任务类型：plan, apply, destroy
+// 任务类型：plan, apply, destroy, import, stateop
 func EnvDeploy(c *ctx.ServiceContext, form *forms.DeployEnvForm) (*models.EnvDetail, e.Error) {
 	c.AddLogField("action", fmt.Sprintf("create env task %s", form.Id))
 	if c.OrgId == "" || c.ProjectId == "" {
@@ -529,6 +566,16 @@ func EnvDeploy(c *ctx.ServiceContext, form *forms.DeployEnvForm) (*models.EnvDet
 	if form.HasKey("runnerId") {
 		env.RunnerId = form.RunnerId
 	}
+	if form.HasKey("runnerTags") {
+		env.RunnerTags = form.RunnerTags
+	}
+	if form.HasKey("image") {
+		if err := services.CheckTaskImage(tx, c.OrgId, form.Image); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		env.Image = form.Image
+	}
 	if form.HasKey("timeout") {
 		env.Timeout = form.Timeout
 	}
@@ -578,6 +625,43 @@ func EnvDeploy(c *ctx.ServiceContext, form *forms.DeployEnvForm) (*models.EnvDet
 		targets = strings.Split(strings.TrimSpace(form.Targets), ",")
 	}
 
+	taskExtra := models.TaskExtra{}
+	taskFlow := models.TaskFlow{}
+	if form.TaskType == models.TaskTypeImport {
+		if len(form.Imports) == 0 {
+			_ = tx.Rollback()
+			return nil, e.New(e.BadParam, fmt.Errorf("imports is required"), http.StatusBadRequest)
+		}
+		for i, item := range form.Imports {
+			if strings.TrimSpace(item.Address) == "" || strings.TrimSpace(item.Id) == "" {
+				_ = tx.Rollback()
+				return nil, e.New(e.BadParam, fmt.Errorf("imports[%d]: address and id are required", i), http.StatusBadRequest)
+			}
+		}
+		taskExtra.Imports = form.Imports
+	} else if form.TaskType == models.TaskTypeStateOp {
+		if len(form.StateOps) == 0 {
+			_ = tx.Rollback()
+			return nil, e.New(e.BadParam, fmt.Errorf("stateOps is required"), http.StatusBadRequest)
+		}
+		for i, op := range form.StateOps {
+			if er := op.Validate(); er != nil {
+				_ = tx.Rollback()
+				return nil, e.New(e.BadParam, fmt.Errorf("stateOps[%d]: %v", i, er), http.StatusBadRequest)
+			}
+		}
+		taskExtra.StateOps = form.StateOps
+	}
+	if utils.StrInArray(form.TaskType, models.TaskTypeImport, models.TaskTypeStateOp) {
+		// import 及 state 操作任务固定使用默认流程，不读取仓库中定义的流程
+		flow, er := models.DefaultTaskFlow(form.TaskType)
+		if er != nil {
+			_ = tx.Rollback()
+			return nil, e.New(e.InternalError, er, http.StatusInternalServerError)
+		}
+		taskFlow = flow
+	}
+
 	// 创建任务
 	task, err := services.CreateTask(tx, tpl, env, models.Task{
 		Name:            models.Task{}.GetTaskNameByType(form.TaskType),
@@ -588,9 +672,10 @@ func EnvDeploy(c *ctx.ServiceContext, form *forms.DeployEnvForm) (*models.EnvDet
 		AutoApprove:     env.AutoApproval,
 		Revision:        env.Revision,
 		StopOnViolation: env.StopOnViolation,
+		Extra:           taskExtra,
 		BaseTask: models.BaseTask{
 			Type:        form.TaskType,
-			Flow:        models.TaskFlow{},
+			Flow:        taskFlow,
 			StepTimeout: form.Timeout,
 			RunnerId:    env.RunnerId,
 		},
@@ -731,18 +816,7 @@ func ResourceDetail(c *ctx.ServiceContext, form *forms.ResourceDetailForm) (*mod
 		c.Logger().Errorf("Environment ID and resource ID do not match")
 		return nil, e.New(e.DBError, err, http.StatusForbidden)
 	}
-	resultAttrs := resource.Attrs
-	if len(resource.SensitiveKeys) > 0 {
-		set := map[string]interface{}{}
-		for _, value := range resource.SensitiveKeys {
-			set[value] = nil
-		}
-		for k, _ := range resultAttrs {
-			// 如果state 中value 存在与sensitive 设置，展示时不展示详情
-			if _, ok := set[k]; ok {
-				resultAttrs[k] = "(sensitive value)"
-			}
-		}
-	}
+	// 如果 state 中 value 存在 sensitive 设置，展示时不展示详情
+	resultAttrs := services.RedactResourceAttrs(resource.Attrs, resource.SensitiveKeys)
 	return &resultAttrs, nil
 }
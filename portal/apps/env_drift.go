@@ -0,0 +1,99 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+type EnvDriftResp struct {
+	DriftCheck     bool                    `json:"driftCheck"`     // 是否开启定期漂移检测
+	DriftStatus    string                  `json:"driftStatus"`    // 漂移状态，为空表示未检测过
+	DriftCheckedAt *models.Time            `json:"driftCheckedAt"` // 最近一次漂移检测时间
+	TaskId         models.Id               `json:"taskId"`         // 最近一次漂移检测任务 id
+	TaskStatus     string                  `json:"taskStatus"`     // 最近一次漂移检测任务状态
+	Resources      []*models.ResourceDrift `json:"resources"`      // 漂移资源列表
+}
+
+// EnvDrift 环境最近一次漂移检测结果
+func EnvDrift(c *ctx.ServiceContext, form *forms.EnvDriftForm) (interface{}, e.Error) {
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := EnvDriftResp{
+		DriftCheck:     env.DriftCheck,
+		DriftStatus:    env.DriftStatus,
+		DriftCheckedAt: env.DriftCheckedAt,
+		TaskId:         env.LastDriftTaskId,
+		Resources:      make([]*models.ResourceDrift, 0),
+	}
+	if env.LastDriftTaskId == "" {
+		return resp, nil
+	}
+
+	task, err := services.GetTaskById(c.DB(), env.LastDriftTaskId)
+	if err != nil && err.Code() != e.TaskNotExists {
+		c.Logger().Errorf("error get task, err %s", err)
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	} else if task != nil {
+		resp.TaskStatus = task.Status
+	}
+
+	if err := services.QueryResourceDrift(c.DB(), env.LastDriftTaskId).Find(&resp.Resources); err != nil {
+		c.Logger().Errorf("error query resource drift, err %s", err)
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return resp, nil
+}
+
+// CheckEnvDrift 手动发起环境漂移检测
+func CheckEnvDrift(c *ctx.ServiceContext, form *forms.EnvDriftForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("check env drift %s", form.Id))
+
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+	if env.Status != models.EnvStatusActive {
+		return nil, e.New(e.EnvNotActive, http.StatusBadRequest)
+	}
+	if busy, er := services.IsEnvBusy(c.DB(), env.Id); er != nil {
+		return nil, e.New(e.DBError, er, http.StatusInternalServerError)
+	} else if busy {
+		return nil, e.New(e.EnvDeploying, http.StatusBadRequest)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	task, err := services.CreateDriftTask(tx, env, c.UserId, "")
+	if err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error create drift task, err %s", err)
+		if err.Code() == e.TemplateDisabled {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return task, nil
+}
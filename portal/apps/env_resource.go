@@ -0,0 +1,108 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// checkEnvTask 检查任务是否属于环境
+func checkEnvTask(c *ctx.ServiceContext, env *models.Env, taskId models.Id) e.Error {
+	task, err := services.GetTaskById(c.DB(), taskId)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get task, err %s", err)
+		return err
+	}
+	if task.EnvId != env.Id {
+		return e.New(e.TaskNotExists, fmt.Errorf("task %s not belongs to env %s", taskId, env.Id), http.StatusNotFound)
+	}
+	return nil
+}
+
+// EnvResourceDiff 对比环境两次任务统计的资源列表，未指定任务时对比开始时间及结束时间的资源列表
+func EnvResourceDiff(c *ctx.ServiceContext, form *forms.EnvResourceDiffForm) (interface{}, e.Error) {
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	fromTaskId, toTaskId := form.FromTaskId, form.ToTaskId
+	if fromTaskId != "" || toTaskId != "" {
+		if toTaskId == "" {
+			toTaskId = env.LastResTaskId
+		}
+		snapshots, err := services.GetEnvResourceSnapshots(c.DB(), env.Id)
+		if err != nil {
+			c.Logger().Errorf("error get env resource snapshots, err %s", err)
+			return nil, err
+		}
+		indexes := make(map[models.Id]int)
+		for _, id := range []models.Id{fromTaskId, toTaskId} {
+			if id == "" {
+				continue
+			}
+			if err := checkEnvTask(c, env, id); err != nil {
+				return nil, err
+			}
+			// plan、漂移检测及失败的任务等没有统计资源列表，对比结果没有意义
+			if indexes[id] = services.ResourceSnapshotIndex(snapshots, id); indexes[id] < 0 {
+				return nil, e.New(e.BadParam, fmt.Errorf("task %s has no resource snapshot", id), http.StatusBadRequest)
+			}
+		}
+		if fromTaskId != "" && toTaskId != "" && indexes[fromTaskId] > indexes[toTaskId] {
+			return nil, e.New(e.BadParam, fmt.Errorf("from task should end before to task"), http.StatusBadRequest)
+		}
+	} else {
+		to := form.To
+		if to.IsZero() {
+			to = time.Now()
+		}
+		if !form.From.IsZero() && form.From.After(to) {
+			return nil, e.New(e.BadParam, fmt.Errorf("from should be before to"), http.StatusBadRequest)
+		}
+
+		snapshots, err := services.GetEnvResourceSnapshots(c.DB(), env.Id)
+		if err != nil {
+			c.Logger().Errorf("error get env resource snapshots, err %s", err)
+			return nil, err
+		}
+		// 未指定开始时间时与空的资源列表对比
+		if s := services.LastResourceSnapshotBefore(snapshots, form.From); !form.From.IsZero() && s != nil {
+			fromTaskId = s.TaskId
+		}
+		if s := services.LastResourceSnapshotBefore(snapshots, to); s != nil {
+			toTaskId = s.TaskId
+		}
+	}
+
+	diff, err := services.DiffTaskResources(c.DB(), fromTaskId, toTaskId)
+	if err != nil {
+		c.Logger().Errorf("error diff task resources, err %s", err)
+		return nil, err
+	}
+	return diff, nil
+}
+
+// EnvResourceTimeline 查询环境中资源在各次部署任务中的创建、修改及销毁记录
+func EnvResourceTimeline(c *ctx.ServiceContext, form *forms.EnvResourceTimelineForm) (interface{}, e.Error) {
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	events, err := services.GetResourceTimeline(c.DB(), env.Id, form.Address)
+	if err != nil {
+		c.Logger().Errorf("error get resource timeline, err %s", err)
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// getProjectEnv 查询当前项目下的环境
+func getProjectEnv(c *ctx.ServiceContext, envId models.Id) (*models.Env, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	envQuery := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	env, err := services.GetEnvById(envQuery, envId)
+	if err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get env, err %s", err)
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return env, nil
+}
+
+func getEnvSchedule(c *ctx.ServiceContext, envId, scheduleId models.Id) (*models.EnvSchedule, e.Error) {
+	query := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	schedule, err := services.GetEnvScheduleById(query.Where("env_id = ?", envId), scheduleId)
+	if err != nil {
+		if err.Code() == e.EnvScheduleNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get env schedule, err %s", err)
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return schedule, nil
+}
+
+func checkScheduleTaskType(taskType string) e.Error {
+	if !utils.StrInArray(taskType, models.TaskTypePlan, models.TaskTypeApply, models.TaskTypeDestroy) {
+		return e.New(e.BadParam, fmt.Errorf("invalid task type '%s'", taskType), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// scheduleVariables 将表单中的变量转换为任务变量，敏感变量加密保存
+func scheduleVariables(vars []forms.ScheduleVariable) (models.TaskVariables, e.Error) {
+	rs := make(models.TaskVariables, 0, len(vars))
+	for _, v := range vars {
+		if !utils.StrInArray(v.Type, consts.VarTypeEnv, consts.VarTypeTerraform, consts.VarTypeAnsible) {
+			return nil, e.New(e.BadParam, fmt.Errorf("invalid variable type '%s'", v.Type), http.StatusBadRequest)
+		}
+		value := v.Value
+		if v.Sensitive && value != "" {
+			encrypted, err := utils.AesEncrypt(value)
+			if err != nil {
+				return nil, e.New(e.InternalError, fmt.Errorf("error encrypt variable"), http.StatusInternalServerError)
+			}
+			value = encrypted
+		}
+		rs = append(rs, models.VariableBody{
+			Scope:     consts.ScopeEnv,
+			Type:      v.Type,
+			Name:      v.Name,
+			Value:     value,
+			Sensitive: v.Sensitive,
+		})
+	}
+	return rs, nil
+}
+
+// hideScheduleSensitiveVars 返回数据中不展示敏感变量的值
+func hideScheduleSensitiveVars(schedule *models.EnvSchedule) *models.EnvSchedule {
+	for i := range schedule.Variables {
+		if schedule.Variables[i].Sensitive {
+			schedule.Variables[i].Value = ""
+		}
+	}
+	return schedule
+}
+
+// SearchEnvSchedule 环境定时任务列表
+func SearchEnvSchedule(c *ctx.ServiceContext, form *forms.SearchEnvScheduleForm) (interface{}, e.Error) {
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.QueryEnvSchedule(c.DB()).Where("env_id = ?", env.Id)
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC")
+	} else {
+		query = form.Order(query)
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	schedules := make([]*models.EnvSchedule, 0)
+	if err := p.Scan(&schedules); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, schedule := range schedules {
+		hideScheduleSensitiveVars(schedule)
+	}
+
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     schedules,
+	}, nil
+}
+
+// CreateEnvSchedule 创建环境定时任务
+func CreateEnvSchedule(c *ctx.ServiceContext, form *forms.CreateEnvScheduleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create env schedule %s", form.Name))
+
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheduleTaskType(form.TaskType); err != nil {
+		return nil, err
+	}
+
+	nextRunAt, err := services.EnvScheduleNextRunAt(form.Cron, form.Timezone, time.Now())
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	vars, err := scheduleVariables(form.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := true
+	if form.HasKey("enabled") {
+		enabled = form.Enabled
+	}
+	if !enabled {
+		nextRunAt = nil
+	}
+
+	schedule, err := services.CreateEnvSchedule(c.DB(), models.EnvSchedule{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		EnvId:     env.Id,
+		CreatorId: c.UserId,
+		Name:      form.Name,
+		Cron:      form.Cron,
+		Timezone:  form.Timezone,
+		TaskType:  form.TaskType,
+		Enabled:   enabled,
+		Variables: vars,
+		NextRunAt: nextRunAt,
+	})
+	if err != nil {
+		c.Logger().Errorf("error create env schedule, err %s", err)
+		return nil, e.AutoNew(err, e.DBError)
+	}
+	return hideScheduleSensitiveVars(schedule), nil
+}
+
+// UpdateEnvSchedule 修改环境定时任务
+func UpdateEnvSchedule(c *ctx.ServiceContext, form *forms.UpdateEnvScheduleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update env schedule %s", form.ScheduleId))
+
+	if _, err := getProjectEnv(c, form.Id); err != nil {
+		return nil, err
+	}
+	schedule, err := getEnvSchedule(c, form.Id, form.ScheduleId)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("taskType") {
+		if err := checkScheduleTaskType(form.TaskType); err != nil {
+			return nil, err
+		}
+		attrs["task_type"] = form.TaskType
+	}
+	if form.HasKey("cron") {
+		schedule.Cron = form.Cron
+		attrs["cron"] = form.Cron
+	}
+	if form.HasKey("timezone") {
+		schedule.Timezone = form.Timezone
+		attrs["timezone"] = form.Timezone
+	}
+	if form.HasKey("enabled") {
+		schedule.Enabled = form.Enabled
+		attrs["enabled"] = form.Enabled
+	}
+	if form.HasKey("variables") {
+		vars, err := scheduleVariables(form.Variables)
+		if err != nil {
+			return nil, err
+		}
+		attrs["variables"] = vars
+	}
+
+	// 执行计划变化后重新计算下次执行时间
+	if form.HasKey("cron") || form.HasKey("timezone") || form.HasKey("enabled") {
+		nextRunAt, err := services.EnvScheduleNextRunAt(schedule.Cron, schedule.Timezone, time.Now())
+		if err != nil {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		if !schedule.Enabled {
+			nextRunAt = nil
+		}
+		attrs["next_run_at"] = nextRunAt
+	}
+
+	schedule, err = services.UpdateEnvSchedule(c.DB(), schedule.Id, attrs)
+	if err != nil {
+		c.Logger().Errorf("error update env schedule, err %s", err)
+		return nil, err
+	}
+	return hideScheduleSensitiveVars(schedule), nil
+}
+
+// DetailEnvSchedule 环境定时任务详情
+func DetailEnvSchedule(c *ctx.ServiceContext, form *forms.DetailEnvScheduleForm) (interface{}, e.Error) {
+	if _, err := getProjectEnv(c, form.Id); err != nil {
+		return nil, err
+	}
+	schedule, err := getEnvSchedule(c, form.Id, form.ScheduleId)
+	if err != nil {
+		return nil, err
+	}
+	return hideScheduleSensitiveVars(schedule), nil
+}
+
+// DeleteEnvSchedule 删除环境定时任务
+func DeleteEnvSchedule(c *ctx.ServiceContext, form *forms.DeleteEnvScheduleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete env schedule %s", form.ScheduleId))
+
+	if _, err := getProjectEnv(c, form.Id); err != nil {
+		return nil, err
+	}
+	schedule, err := getEnvSchedule(c, form.Id, form.ScheduleId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err := services.DeleteEnvSchedule(tx, schedule.Id); err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error delete env schedule, err %s", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return nil, nil
+}
+
+// SearchEnvScheduleRun 环境定时任务执行记录
+func SearchEnvScheduleRun(c *ctx.ServiceContext, form *forms.SearchEnvScheduleRunForm) (interface{}, e.Error) {
+	if _, err := getProjectEnv(c, form.Id); err != nil {
+		return nil, err
+	}
+	schedule, err := getEnvSchedule(c, form.Id, form.ScheduleId)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.QueryEnvScheduleRun(c.DB(), schedule.Id)
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC")
+	}
+	return getPage(query, form, models.EnvScheduleRun{})
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"io"
+	"net/http"
+)
+
+// GetInventoryFilter 生成资源清单查询条件，指定了项目时只查询该项目，
+// 否则非组织管理员只能查询自己参与的项目
+func GetInventoryFilter(c *ctx.ServiceContext, form *forms.InventoryFilterForm) (*services.InventoryFilter, e.Error) {
+	filter := services.InventoryFilter{
+		OrgId:    c.OrgId,
+		EnvId:    form.EnvId,
+		Provider: form.Provider,
+		Type:     form.Type,
+		Module:   form.Module,
+		Q:        form.Q,
+	}
+	for _, s := range form.Attrs {
+		attr, err := services.ParseInventoryAttrFilter(s)
+		if err != nil {
+			return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+		}
+		filter.Attrs = append(filter.Attrs, attr)
+	}
+
+	if c.ProjectId != "" {
+		filter.ProjectIds = []models.Id{c.ProjectId}
+	} else if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) {
+		projectIds, err := services.GetProjectsByUserOrg(c.DB(), c.UserId, c.OrgId)
+		if err != nil {
+			c.Logger().Errorf("error get projects, err %s", err)
+			return nil, e.New(e.DBError, err)
+		}
+		filter.ProjectIds = projectIds
+	}
+	return &filter, nil
+}
+
+// SearchInventory 查询组织的资源清单，只包含各环境最后一次部署的资源，敏感属性值会被隐藏
+func SearchInventory(c *ctx.ServiceContext, form *forms.SearchInventoryForm) (interface{}, e.Error) {
+	filter, err := GetInventoryFilter(c, &form.InventoryFilterForm)
+	if err != nil {
+		return nil, err
+	}
+	if filter.ProjectIds != nil && len(filter.ProjectIds) == 0 {
+		return getEmptyListResult(form)
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), nil)
+	rs, total, err := services.SearchInventory(c.DB(), filter, (p.Page-1)*p.Size, p.Size)
+	if err != nil {
+		c.Logger().Errorf("error search inventory, err %s", err)
+		return nil, err
+	}
+	return page.PageResp{
+		Total:    total,
+		PageSize: p.Size,
+		List:     rs,
+	}, nil
+}
+
+// InventoryStats 按资源类型及 provider 统计资源清单中的资源数量
+func InventoryStats(c *ctx.ServiceContext, form *forms.InventoryStatsForm) (interface{}, e.Error) {
+	filter, err := GetInventoryFilter(c, &form.InventoryFilterForm)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := services.GetInventoryStats(c.DB(), filter)
+	if err != nil {
+		c.Logger().Errorf("error get inventory stats, err %s", err)
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ExportInventory 以 csv 格式导出资源清单中的全部资源
+func ExportInventory(c *ctx.ServiceContext, filter *services.InventoryFilter, w io.Writer) e.Error {
+	c.AddLogField("action", "export inventory")
+	if err := services.WriteInventoryCSV(w, c.DB(), filter); err != nil {
+		c.Logger().Errorf("error export inventory, err %s", err)
+		return err
+	}
+	return nil
+}
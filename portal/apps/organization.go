@@ -99,6 +99,24 @@ func UpdateOrganization(c *ctx.ServiceContext, form *forms.UpdateOrganizationFor
 		attrs["runner_id"] = form.RunnerId
 	}
 
+	if form.HasKey("taskWeight") {
+		if !c.IsSuperAdmin {
+			return nil, e.New(e.PermissionDeny, fmt.Errorf("super admin required"), http.StatusForbidden)
+		}
+		if form.TaskWeight < 1 {
+			return nil, e.New(e.BadParam, fmt.Errorf("taskWeight must be greater than 0"), http.StatusBadRequest)
+		}
+		attrs["task_weight"] = form.TaskWeight
+	}
+
+	if form.HasKey("taskImages") {
+		attrs["task_images"] = models.StrSlice(services.NormalizeTaskImages(form.TaskImages))
+	}
+
+	if form.HasKey("costDeltaThreshold") {
+		attrs["cost_delta_threshold"] = form.CostDeltaThreshold
+	}
+
 	// 变更组织状态
 	if form.HasKey("status") {
 		if _, err := ChangeOrgStatus(c, &forms.DisableOrganizationForm{Id: form.Id, Status: form.Status}); err != nil {
@@ -0,0 +1,207 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// 价格目录文件大小限制
+const maxPriceCatalogSize = 10 * 1024 * 1024
+
+func getResourcePrice(c *ctx.ServiceContext, id models.Id) (*models.ResourcePrice, e.Error) {
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	price, err := services.GetResourcePriceById(query, id)
+	if err != nil {
+		if err.Code() == e.ResourcePriceNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get resource price, err %s", err)
+		return nil, err
+	}
+	return price, nil
+}
+
+// SearchResourcePrice 价格目录查询
+func SearchResourcePrice(c *ctx.ServiceContext, form *forms.SearchResourcePriceForm) (interface{}, e.Error) {
+	query := services.QueryResourcePrice(services.QueryWithOrgId(c.DB(), c.OrgId))
+	if form.Q != "" {
+		query = query.Where("resource_type LIKE ? OR value LIKE ?", "%"+form.Q+"%", "%"+form.Q+"%")
+	}
+	if form.ResourceType != "" {
+		query = query.Where("resource_type = ?", form.ResourceType)
+	}
+	if form.SortField() == "" {
+		query = query.Order("resource_type, attribute, value")
+	} else {
+		query = form.Order(query)
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	prices := make([]*models.ResourcePrice, 0)
+	if err := p.Scan(&prices); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     prices,
+	}, nil
+}
+
+// CreateResourcePrice 创建价格配置
+func CreateResourcePrice(c *ctx.ServiceContext, form *forms.CreateResourcePriceForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create resource price %s", form.ResourceType))
+
+	price := models.ResourcePrice{
+		OrgId:        c.OrgId,
+		ResourceType: form.ResourceType,
+		Attribute:    form.Attribute,
+		Value:        form.Value,
+		Unit:         form.Unit,
+		Price:        form.Price,
+		Description:  form.Description,
+	}
+	if price.Unit == "" {
+		price.Unit = models.PriceUnitMonth
+	}
+	if err := price.Validate(); err != nil {
+		return nil, e.New(e.ResourcePriceInvalid, err, http.StatusBadRequest)
+	}
+
+	rs, err := services.CreateResourcePrice(c.DB(), price)
+	if err != nil {
+		if err.Code() == e.ResourcePriceAlreadyExists {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		c.Logger().Errorf("error create resource price, err %s", err)
+		return nil, err
+	}
+	return rs, nil
+}
+
+// UpdateResourcePrice 修改价格配置，资源类型及计费属性不允许修改
+func UpdateResourcePrice(c *ctx.ServiceContext, form *forms.UpdateResourcePriceForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update resource price %s", form.Id))
+
+	price, err := getResourcePrice(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("unit") {
+		attrs["unit"] = form.Unit
+	}
+	if form.HasKey("price") {
+		attrs["price"] = form.Price
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+
+	rs, err := services.UpdateResourcePrice(c.DB(), price.Id, attrs)
+	if err != nil {
+		c.Logger().Errorf("error update resource price, err %s", err)
+		return nil, err
+	}
+	return rs, nil
+}
+
+// DeleteResourcePrice 删除价格配置
+func DeleteResourcePrice(c *ctx.ServiceContext, form *forms.DeleteResourcePriceForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete resource price %s", form.Id))
+
+	price, err := getResourcePrice(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.DeleteResourcePrice(c.DB(), price.Id); err != nil {
+		c.Logger().Errorf("error delete resource price, err %s", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// DetailResourcePrice 价格配置详情
+func DetailResourcePrice(c *ctx.ServiceContext, form *forms.DetailResourcePriceForm) (interface{}, e.Error) {
+	return getResourcePrice(c, form.Id)
+}
+
+type ImportResourcePriceResp struct {
+	Created int `json:"created"` // 新增的价格配置数量
+	Updated int `json:"updated"` // 更新的价格配置数量
+}
+
+// readPriceCatalog 读取上传的价格目录文件或请求中的价格目录内容，返回格式及内容
+func readPriceCatalog(form *forms.ImportResourcePriceForm) (string, []byte, error) {
+	format := form.Format
+	if form.File == nil {
+		if form.Content == "" {
+			return "", nil, fmt.Errorf("file or content is required")
+		}
+		return format, []byte(form.Content), nil
+	}
+
+	if form.File.Size > maxPriceCatalogSize {
+		return "", nil, fmt.Errorf("file size exceeds %d bytes", maxPriceCatalogSize)
+	}
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(form.File.Filename)), ".")
+	}
+	fp, err := form.File.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer fp.Close()
+	content, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return "", nil, err
+	}
+	return format, content, nil
+}
+
+// ImportResourcePrice 从 csv 或 yaml 文件导入价格目录
+func ImportResourcePrice(c *ctx.ServiceContext, form *forms.ImportResourcePriceForm) (interface{}, e.Error) {
+	c.AddLogField("action", "import resource prices")
+
+	format, content, err := readPriceCatalog(form)
+	if err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+	prices, err := services.ParsePriceCatalog(format, content)
+	if err != nil {
+		return nil, e.New(e.ResourcePriceInvalid, err, http.StatusBadRequest)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	resp := ImportResourcePriceResp{}
+	var er e.Error
+	if resp.Created, resp.Updated, er = services.ImportResourcePrices(tx, c.OrgId, prices, form.Replace); er != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error import resource prices, err %s", er)
+		return nil, er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/runner"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	runnerAgentMaxWait      = 30 * time.Second
+	runnerAgentPollInterval = time.Second
+)
+
+// CheckRunnerAgentAuth 校验拉取模式 runner 的 token 是否与 runner id 匹配
+func CheckRunnerAgentAuth(runnerId string, token string) bool {
+	return services.CheckRunnerToken(runnerId, token)
+}
+
+// RunnerAgentRegister 拉取模式 runner 启动时注册
+func RunnerAgentRegister(c *ctx.ServiceContext, runnerId string, form *forms.RunnerAgentRegisterForm) (interface{}, e.Error) {
+	c.AddLogField("runnerId", runnerId)
+	r, err := services.RegisterPullRunner(c.DB(), runnerId, form.Tags, form.Version)
+	if err != nil {
+		c.Logger().Errorf("register pull runner error: %v", err)
+		return nil, err
+	}
+	c.Logger().Infof("pull runner registered, tags: %v, version: %s", form.Tags, form.Version)
+	return r, nil
+}
+
+// RunnerAgentJobs 拉取 runner 待执行的任务步骤及取消请求，没有任务时最多等待 form.Wait 秒
+func RunnerAgentJobs(rctx context.Context, c *ctx.ServiceContext, runnerId string, form *forms.RunnerAgentJobsForm) (interface{}, e.Error) {
+	wait := time.Duration(form.Wait) * time.Second
+	if wait > runnerAgentMaxWait {
+		wait = runnerAgentMaxWait
+	}
+	deadline := time.Now().Add(wait)
+
+	for {
+		if registered, err := services.TouchPullRunner(c.DB(), runnerId); err != nil {
+			return nil, err
+		} else if !registered {
+			return nil, e.New(e.ObjectNotExists, http.StatusNotFound)
+		}
+
+		jobs, cancels, err := services.AcquireRunnerJobs(c.DB(), runnerId)
+		if err != nil {
+			c.Logger().Errorf("acquire runner jobs error: %v", err)
+			return nil, err
+		}
+		if len(jobs) > 0 || len(cancels) > 0 || !time.Now().Before(deadline) {
+			return runnerJobsResp(jobs, cancels)
+		}
+
+		select {
+		case <-rctx.Done():
+			return runnerJobsResp(nil, nil)
+		case <-time.After(runnerAgentPollInterval):
+		}
+	}
+}
+
+func runnerJobsResp(jobs, cancels []*models.RunnerJob) (*runner.PullJobsResp, e.Error) {
+	resp := runner.PullJobsResp{
+		Jobs:    make([]runner.PullJob, 0, len(jobs)),
+		Cancels: make([]runner.PullJob, 0, len(cancels)),
+	}
+	for _, job := range jobs {
+		req := runner.RunTaskReq{}
+		if err := json.Unmarshal(job.Request, &req); err != nil {
+			return nil, e.New(e.JSONParseError, err)
+		}
+		resp.Jobs = append(resp.Jobs, newPullJob(job, &req))
+	}
+	for _, job := range cancels {
+		resp.Cancels = append(resp.Cancels, newPullJob(job, nil))
+	}
+	return &resp, nil
+}
+
+func newPullJob(job *models.RunnerJob, req *runner.RunTaskReq) runner.PullJob {
+	return runner.PullJob{
+		Id:      job.Id.String(),
+		EnvId:   job.EnvId.String(),
+		TaskId:  job.TaskId.String(),
+		Step:    job.Step,
+		Request: req,
+	}
+}
+
+// RunnerAgentJobStatus runner 上报任务步骤状态，步骤退出时附带全量日志及执行结果文件
+func RunnerAgentJobStatus(c *ctx.ServiceContext, runnerId string, form *forms.RunnerAgentJobStatusForm) (interface{}, e.Error) {
+	job, err := services.GetRunnerJobById(c.DB(), runnerId, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == models.RunnerJobExited {
+		return nil, nil
+	}
+	if err := services.UpdateRunnerJobStatus(c.DB(), job, &form.TaskStatusMessage); err != nil {
+		c.Logger().Errorf("update runner job status error: %v", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// RunnerAgentJobLog runner 推送任务步骤增量日志
+func RunnerAgentJobLog(c *ctx.ServiceContext, runnerId string, form *forms.RunnerAgentJobLogForm) (interface{}, e.Error) {
+	job, err := services.GetRunnerJobById(c.DB(), runnerId, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := services.AppendRunnerJobLog(c.DB(), job, form.Offset, form.Content)
+	if err != nil {
+		c.Logger().Errorf("append runner job log error: %v", err)
+		return nil, err
+	}
+	return runner.PullJobLogResp{Offset: offset}, nil
+}
+
+// RunnerAgentKeepTasks 拉取模式 runner 清理过期工作目录前获取需要保留工作目录的任务
+func RunnerAgentKeepTasks(c *ctx.ServiceContext, runnerId string) (interface{}, e.Error) {
+	taskIds, err := services.GetRunnerKeepTaskIds(c.DB(), runnerId)
+	if err != nil {
+		c.Logger().Errorf("get keep tasks error: %v", err)
+		return nil, err
+	}
+	return runner.WorkspaceKeepTasks{TaskIds: taskIds}, nil
+}
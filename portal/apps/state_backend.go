@@ -0,0 +1,193 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+func getStateBackend(c *ctx.ServiceContext, id models.Id) (*models.StateBackend, e.Error) {
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	backend, err := services.GetStateBackendById(query, id)
+	if err != nil {
+		if err.Code() == e.StateBackendNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get state backend, err %s", err)
+		return nil, err
+	}
+	return backend, nil
+}
+
+// checkStateBackendScope 检查 backend 作用域，项目和云模板需要属于当前组织
+func checkStateBackendScope(c *ctx.ServiceContext, projectId, tplId models.Id) e.Error {
+	if projectId != "" && tplId != "" {
+		return e.New(e.BadParam, fmt.Errorf("only one of projectId and tplId can be set"), http.StatusBadRequest)
+	}
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	if projectId != "" {
+		if _, err := services.GetProjectsById(query, projectId); err != nil {
+			return e.New(e.ProjectNotExists, err, http.StatusBadRequest)
+		}
+	}
+	if tplId != "" {
+		if _, err := services.GetTemplateById(query, tplId); err != nil {
+			return e.New(e.TemplateNotExists, err, http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// SearchStateBackend state backend 列表
+func SearchStateBackend(c *ctx.ServiceContext, form *forms.SearchStateBackendForm) (interface{}, e.Error) {
+	query := services.QueryStateBackend(services.QueryWithOrgId(c.DB(), c.OrgId))
+	if form.Q != "" {
+		query = query.Where("name LIKE ?", "%"+form.Q+"%")
+	}
+	if form.ProjectId != "" {
+		query = query.Where("project_id = ?", form.ProjectId)
+	}
+	if form.TplId != "" {
+		query = query.Where("tpl_id = ?", form.TplId)
+	}
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC")
+	} else {
+		query = form.Order(query)
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	backends := make([]*models.StateBackend, 0)
+	if err := p.Scan(&backends); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, backend := range backends {
+		services.HideStateBackendSecrets(backend)
+	}
+
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     backends,
+	}, nil
+}
+
+// CreateStateBackend 创建 state backend 配置
+func CreateStateBackend(c *ctx.ServiceContext, form *forms.CreateStateBackendForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create state backend %s", form.Name))
+
+	if err := checkStateBackendScope(c, form.ProjectId, form.TplId); err != nil {
+		return nil, err
+	}
+
+	backend := models.StateBackend{
+		OrgId:       c.OrgId,
+		ProjectId:   form.ProjectId,
+		TplId:       form.TplId,
+		Name:        form.Name,
+		Type:        form.Type,
+		Config:      form.Config,
+		Description: form.Description,
+		CreatorId:   c.UserId,
+	}
+	if err := backend.Validate(); err != nil {
+		return nil, e.New(e.StateBackendInvalid, err, http.StatusBadRequest)
+	}
+	if err := services.EncryptStateBackendConfig(&backend.Config); err != nil {
+		return nil, e.New(e.InternalError, fmt.Errorf("error encrypt state backend config"), http.StatusInternalServerError)
+	}
+
+	rs, err := services.CreateStateBackend(c.DB(), backend)
+	if err != nil {
+		if err.Code() == e.StateBackendAlreadyExists {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		c.Logger().Errorf("error create state backend, err %s", err)
+		return nil, err
+	}
+	return services.HideStateBackendSecrets(rs), nil
+}
+
+// UpdateStateBackend 修改 state backend 配置。
+// backend 类型及作用域不允许修改，配置修改只影响之后创建的任务
+func UpdateStateBackend(c *ctx.ServiceContext, form *forms.UpdateStateBackendForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update state backend %s", form.Id))
+
+	backend, err := getStateBackend(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+	if form.HasKey("config") {
+		cfg := form.Config
+		if er := services.EncryptStateBackendConfig(&cfg); er != nil {
+			return nil, e.New(e.InternalError, fmt.Errorf("error encrypt state backend config"), http.StatusInternalServerError)
+		}
+		// 认证信息不返回给前端，未传值时保持不变
+		if cfg.AccessKey == "" {
+			cfg.AccessKey = backend.Config.AccessKey
+		}
+		if cfg.SecretKey == "" {
+			cfg.SecretKey = backend.Config.SecretKey
+		}
+		if cfg.Password == "" {
+			cfg.Password = backend.Config.Password
+		}
+		backend.Config = cfg
+		if er := backend.Validate(); er != nil {
+			return nil, e.New(e.StateBackendInvalid, er, http.StatusBadRequest)
+		}
+		attrs["config"] = cfg
+	}
+
+	rs, err := services.UpdateStateBackend(c.DB(), backend.Id, attrs)
+	if err != nil {
+		if err.Code() == e.StateBackendAlreadyExists {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		c.Logger().Errorf("error update state backend, err %s", err)
+		return nil, err
+	}
+	return services.HideStateBackendSecrets(rs), nil
+}
+
+// DeleteStateBackend 删除 state backend 配置
+func DeleteStateBackend(c *ctx.ServiceContext, form *forms.DeleteStateBackendForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete state backend %s", form.Id))
+
+	backend, err := getStateBackend(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.DeleteStateBackend(c.DB(), backend.Id); err != nil {
+		if err.Code() == e.StateBackendInUse {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		c.Logger().Errorf("error delete state backend, err %s", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// DetailStateBackend state backend 详情
+func DetailStateBackend(c *ctx.ServiceContext, form *forms.DetailStateBackendForm) (interface{}, e.Error) {
+	backend, err := getStateBackend(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return services.HideStateBackendSecrets(backend), nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// 锁 ID 会作为 terraform force-unlock 的参数，只允许常见的 uuid/session id 字符
+var stateLockIdRegex = regexp.MustCompile(`^[\w.:-]+$`)
+
+// EnvStateLock 查询环境 state 锁
+func EnvStateLock(c *ctx.ServiceContext, form *forms.EnvStateLockForm) (interface{}, e.Error) {
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := services.GetEnvStateLock(c.DB(), env)
+	if err != nil {
+		c.Logger().Errorf("error get env state lock, err %s", err)
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return lock, nil
+}
+
+// UnlockEnvState 强制释放环境 state 锁，解锁通过 unlock 任务执行
+func UnlockEnvState(c *ctx.ServiceContext, form *forms.EnvStateUnlockForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("force unlock env %s state", form.Id))
+
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+
+	lockId := form.LockId
+	if lockId == "" {
+		lock, err := services.GetEnvStateLock(c.DB(), env)
+		if err != nil {
+			c.Logger().Errorf("error get env state lock, err %s", err)
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		if !lock.Supported {
+			return nil, e.New(e.BadParam, fmt.Errorf("lockId is required for '%s' backend", lock.Backend), http.StatusBadRequest)
+		}
+		if !lock.Locked {
+			return nil, e.New(e.StateNotLocked, http.StatusBadRequest)
+		}
+		if lock.LockId == "" {
+			return nil, e.New(e.BadParam, fmt.Errorf("lock info not found, lockId is required"), http.StatusBadRequest)
+		}
+		lockId = lock.LockId
+	}
+	if !stateLockIdRegex.MatchString(lockId) {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid lockId"), http.StatusBadRequest)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	task, err := services.CreateStateUnlockTask(tx, env, lockId, models.OperationLog{
+		UserID:   c.UserId,
+		Username: c.Username,
+		UserAddr: c.UserIpAddr,
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error create state unlock task, err %s", err)
+		if err.Status() != 0 {
+			return nil, err
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return task, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+type StateVersionResp struct {
+	models.StateVersion
+	TaskName   string `json:"taskName"`   // 产生该版本的任务名称
+	TaskType   string `json:"taskType"`   // 产生该版本的任务类型
+	TaskStatus string `json:"taskStatus"` // 产生该版本的任务状态
+}
+
+func getEnvStateVersion(c *ctx.ServiceContext, envId, versionId models.Id) (*models.Env, *models.StateVersion, e.Error) {
+	env, err := getProjectEnv(c, envId)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err := services.GetStateVersionById(services.QueryStateVersion(c.DB(), env.Id), versionId)
+	if err != nil {
+		if err.Code() == e.StateVersionNotExists {
+			return nil, nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get state version, err %s", err)
+		return nil, nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return env, version, nil
+}
+
+// SearchEnvState 环境 state 版本列表
+func SearchEnvState(c *ctx.ServiceContext, form *forms.SearchEnvStateForm) (interface{}, e.Error) {
+	env, err := getProjectEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.QueryStateVersion(c.DB(), env.Id).
+		Joins("LEFT JOIN iac_task ON iac_task.id = iac_state_version.task_id").
+		LazySelectAppend("iac_state_version.*, iac_task.name AS task_name, " +
+			"iac_task.type AS task_type, iac_task.status AS task_status")
+	if form.SortField() == "" {
+		query = query.Order("iac_state_version.created_at DESC")
+	} else {
+		query = form.Order(query)
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	versions := make([]*StateVersionResp, 0)
+	if err := p.Scan(&versions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     versions,
+	}, nil
+}
+
+// EnvStateContent 下载 state 版本内容
+func EnvStateContent(c *ctx.ServiceContext, form *forms.EnvStateVersionForm) (*models.StateVersion, []byte, e.Error) {
+	_, version, err := getEnvStateVersion(c, form.Id, form.VersionId)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := services.GetStateVersionContent(version)
+	if err != nil {
+		if err.Code() == e.StateVersionNotExists {
+			return nil, nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error read state version, err %s", err)
+		return nil, nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return version, content, nil
+}
+
+// RestoreEnvState 将环境 state 恢复为指定版本，恢复通过 restore 任务执行
+func RestoreEnvState(c *ctx.ServiceContext, form *forms.EnvStateVersionForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("restore env %s state to %s", form.Id, form.VersionId))
+
+	env, version, err := getEnvStateVersion(c, form.Id, form.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	task, err := services.CreateStateRestoreTask(tx, env, version, c.UserId)
+	if err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error create state restore task, err %s", err)
+		if err.Status() != 0 {
+			return nil, err
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return task, nil
+}
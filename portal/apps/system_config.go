@@ -9,6 +9,8 @@ import (
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
 	"fmt"
+	"net/http"
+	"time"
 )
 
 type SearchSystemConfigResp struct {
@@ -57,3 +59,11 @@ func UpdateSystemConfig(c *ctx.ServiceContext, form *forms.UpdateSystemConfigFor
 
 	return nil, nil
 }
+
+// DataRetentionReport 按日志保存周期统计将要清理的过期数据(不执行清理)
+func DataRetentionReport(c *ctx.ServiceContext) (*services.RetentionReport, e.Error) {
+	if !c.IsSuperAdmin {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("super admin required"), http.StatusForbidden)
+	}
+	return services.PurgeExpiredData(c.DB(), time.Now(), true)
+}
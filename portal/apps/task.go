@@ -10,6 +10,7 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
+	"context"
 	"fmt"
 	"github.com/gin-contrib/sse"
 	"io"
@@ -51,7 +52,8 @@ func SearchTask(c *ctx.ServiceContext, form *forms.SearchTaskForm) (interface{},
 
 type taskDetailResp struct {
 	models.Task
-	Creator string `json:"creator" example:"超级管理员"`
+	Creator string          `json:"creator" example:"超级管理员"`
+	Flow    models.TaskFlow `json:"flow"` // 任务实际执行的流程
 }
 
 // TaskDetail 任务信息详情
@@ -92,6 +94,7 @@ func TaskDetail(c *ctx.ServiceContext, form forms.DetailTaskForm) (*taskDetailRe
 	var o = taskDetailResp{
 		Task:    *task,
 		Creator: user.Name,
+		Flow:    task.Flow,
 	}
 
 	return &o, nil
@@ -137,6 +140,7 @@ func LastTask(c *ctx.ServiceContext, form *forms.LastTaskForm) (*taskDetailResp,
 	var t = taskDetailResp{
 		Task:    *task,
 		Creator: user.Name,
+		Flow:    task.Flow,
 	}
 
 	return &t, nil
@@ -192,8 +196,110 @@ func ApproveTask(c *ctx.ServiceContext, form *forms.ApproveTaskForm) (interface{
 	return nil, nil
 }
 
+// CancelTask 取消任务
+func CancelTask(c *ctx.ServiceContext, form *forms.CancelTaskForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("cancel task %s", form.Id))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	taskQuery := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	task, err := services.GetTask(taskQuery, form.Id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get task, err %s", err)
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+
+	if err := services.CancelTask(c.DB(), task, c.UserId); err != nil {
+		c.Logger().Errorf("error cancel task, err %s", err)
+		return nil, err
+	}
+	return task, nil
+}
+
+// ResumeTask 从失败或被取消的步骤恢复执行任务
+func ResumeTask(c *ctx.ServiceContext, form *forms.ResumeTaskForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("resume task %s", form.Id))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	taskQuery := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	task, err := services.GetTask(taskQuery, form.Id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		c.Logger().Errorf("error get task, err %s", err)
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+
+	var fromStep *int
+	if form.HasKey("fromStep") {
+		fromStep = &form.FromStep
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err := services.ResumeTask(tx, task, c.UserId, fromStep); err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error resume task, err %s", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	task, err = services.GetTask(c.DB(), task.Id)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return task, nil
+}
+
+// SearchTaskResume 任务恢复执行记录
+func SearchTaskResume(c *ctx.ServiceContext, form *forms.SearchTaskResumeForm) (interface{}, e.Error) {
+	taskQuery := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	task, err := services.GetTask(taskQuery, form.Id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+
+	query := services.QueryTaskResume(c.DB(), task.Id)
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC")
+	}
+	return getPage(query, form, models.TaskResume{})
+}
+
 func FollowTaskLog(c *ctx.GinRequest, form forms.TaskLogForm) e.Error {
-	logger := c.Logger().WithField("func", "FollowTaskLog").WithField("taskId", form.Id)
+	return followTaskOutput(c, form, "FollowTaskLog", services.FetchTaskLog)
+}
+
+// FollowTaskEvents 任务步骤的 terraform 事件流，每条消息为一个 TaskStepEvent json
+func FollowTaskEvents(c *ctx.GinRequest, form forms.TaskLogForm) e.Error {
+	return followTaskOutput(c, form, "FollowTaskEvents", services.FetchTaskEvents)
+}
+
+type fetchTaskOutputFunc func(ctx context.Context, task models.Tasker, stepType string, writer io.WriteCloser) error
+
+// followTaskOutput 通过 sse 按行推送 fetch 获取到的任务内容
+func followTaskOutput(c *ctx.GinRequest, form forms.TaskLogForm, funcName string, fetch fetchTaskOutputFunc) e.Error {
+	logger := c.Logger().WithField("func", funcName).WithField("taskId", form.Id)
 	sc := c.Service()
 	rCtx := c.Context.Request.Context()
 
@@ -215,8 +321,8 @@ func FollowTaskLog(c *ctx.GinRequest, form forms.TaskLogForm) e.Error {
 
 	pr, pw := io.Pipe()
 	go func() {
-		if err := services.FetchTaskLog(rCtx, tasker, form.StepType, pw); err != nil {
-			logger.Errorf("fetch task log: %v", err)
+		if err := fetch(rCtx, tasker, form.StepType, pw); err != nil {
+			logger.Errorf("fetch task output: %v", err)
 		}
 	}()
 
@@ -311,3 +417,32 @@ func SearchTaskResources(c *ctx.ServiceContext, form *forms.SearchTaskResourceFo
 		List:     rs,
 	}, nil
 }
+
+// SearchTaskChanges 查询任务 plan 得到的资源变更
+func SearchTaskChanges(c *ctx.ServiceContext, form *forms.SearchTaskChangesForm) (interface{}, e.Error) {
+	task, err := services.GetTaskById(c.DB(), form.Id)
+	if err != nil && err.Code() == e.TaskNotExists {
+		return nil, e.New(err.Code(), err, http.StatusNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	if task.OrgId != c.OrgId || task.ProjectId != c.ProjectId {
+		return nil, e.New(e.TaskNotExists, http.StatusNotFound)
+	}
+
+	query := services.QueryTaskResourceChanges(c.DB(), task.Id, form.Action, form.Type)
+	if form.SortField() == "" {
+		query = query.Order("address")
+	}
+
+	rs := make([]models.ResourceChange, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&rs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     rs,
+	}, nil
+}
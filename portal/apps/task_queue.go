@@ -0,0 +1,46 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+)
+
+// SearchTaskQueue 查询组织下等待执行的任务，返回任务在全局队列中的位置及等待原因
+func SearchTaskQueue(c *ctx.ServiceContext, form *forms.SearchTaskQueueForm) (interface{}, e.Error) {
+	tasks, err := services.GetTaskQueue(c.DB(), nil)
+	if err != nil {
+		c.Logger().Errorf("error get task queue, err %s", err)
+		return nil, e.New(e.DBError, err)
+	}
+
+	projectId := form.ProjectId
+	if c.ProjectId != "" {
+		projectId = c.ProjectId
+	}
+	// 非组织管理员只能查看有权限的项目下的任务
+	var projectIds map[models.Id]bool
+	if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) {
+		projectIds = make(map[models.Id]bool)
+		for _, id := range services.UserProjectIds(c.UserId, c.OrgId) {
+			projectIds[id] = true
+		}
+	}
+
+	queue := make([]*services.QueueTask, 0)
+	for _, t := range tasks {
+		if t.OrgId != c.OrgId ||
+			(projectId != "" && t.ProjectId != projectId) ||
+			(form.EnvId != "" && t.EnvId != form.EnvId) ||
+			(projectIds != nil && !projectIds[t.ProjectId]) {
+			continue
+		}
+		queue = append(queue, t)
+	}
+	return queue, nil
+}
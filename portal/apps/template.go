@@ -56,6 +56,9 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 	if er != nil {
 		return nil, e.New(e.DBError, fmt.Errorf("get repo failed: %v", er))
 	}
+	if err := services.CheckTaskImage(c.DB(), c.OrgId, form.Image); err != nil {
+		return nil, err
+	}
 
 	tx := c.Tx()
 	defer func() {
@@ -78,6 +81,14 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 		PlayVarsFile: form.PlayVarsFile,
 		TfVarsFile:   form.TfVarsFile,
 		TfVersion:    form.TfVersion,
+		FlowFile:     form.FlowFile,
+		RunnerTags:   form.RunnerTags,
+
+		ContainerCpus:   form.ContainerCpus,
+		ContainerMemory: form.ContainerMemory,
+		ContainerPids:   form.ContainerPids,
+
+		Image: form.Image,
 	})
 
 	if err != nil {
@@ -150,6 +161,27 @@ func UpdateTemplate(c *ctx.ServiceContext, form *forms.UpdateTemplateForm) (*mod
 	if form.HasKey("tfVersion") {
 		attrs["tfVersion"] = form.TfVersion
 	}
+	if form.HasKey("flowFile") {
+		attrs["flowFile"] = form.FlowFile
+	}
+	if form.HasKey("runnerTags") {
+		attrs["runnerTags"] = models.StrSlice(form.RunnerTags)
+	}
+	if form.HasKey("image") {
+		if err := services.CheckTaskImage(c.DB(), c.OrgId, form.Image); err != nil {
+			return nil, err
+		}
+		attrs["image"] = form.Image
+	}
+	if form.HasKey("containerCpus") {
+		attrs["containerCpus"] = form.ContainerCpus
+	}
+	if form.HasKey("containerMemory") {
+		attrs["containerMemory"] = form.ContainerMemory
+	}
+	if form.HasKey("containerPids") {
+		attrs["containerPids"] = form.ContainerPids
+	}
 	if form.HasKey("repoRevision") {
 		attrs["repoRevision"] = form.RepoRevision
 	}
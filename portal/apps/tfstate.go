@@ -0,0 +1,118 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+/*
+portal 提供的 terraform http state backend，协议参考:
+https://www.terraform.io/docs/language/settings/backends/http.html
+*/
+
+// tfLockInfo terraform 提交的锁信息，只解析需要的字段
+type tfLockInfo struct {
+	ID string `json:"ID"`
+}
+
+// CheckTfStateAuth 校验 http state backend 的认证信息
+func CheckTfStateAuth(envId models.Id, username, password string) bool {
+	return username == services.StateHttpUsername &&
+		hmac.Equal([]byte(password), []byte(services.StateHttpPassword(envId)))
+}
+
+func getTfStateEnv(c *ctx.ServiceContext, envId models.Id) (*models.Env, e.Error) {
+	env, err := services.GetEnvById(c.DB(), envId)
+	if err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return env, nil
+}
+
+// GetTfState 读取 state，state 不存在时返回 nil
+func GetTfState(c *ctx.ServiceContext, envId models.Id) ([]byte, e.Error) {
+	env, err := getTfStateEnv(c, envId)
+	if err != nil {
+		return nil, err
+	}
+	return services.GetTfState(c.DB(), env.StatePath)
+}
+
+// UpdateTfState 保存 state，state 被锁定时只有持有锁的请求可以写入
+func UpdateTfState(c *ctx.ServiceContext, envId models.Id, lockId string, content []byte) e.Error {
+	env, err := getTfStateEnv(c, envId)
+	if err != nil {
+		return err
+	}
+
+	lock, err := services.GetTfStateLock(c.DB(), env.StatePath)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.LockId != lockId {
+		return e.New(e.StateLocked, fmt.Errorf("state locked by %s", lock.LockId), http.StatusConflict)
+	}
+	return services.SaveTfState(c.DB(), env.StatePath, content)
+}
+
+func DeleteTfState(c *ctx.ServiceContext, envId models.Id) e.Error {
+	env, err := getTfStateEnv(c, envId)
+	if err != nil {
+		return err
+	}
+	return services.DeleteTfState(c.DB(), env.StatePath)
+}
+
+// LockTfState 对 state 加锁，加锁失败时返回当前锁信息
+func LockTfState(c *ctx.ServiceContext, envId models.Id, info []byte) ([]byte, e.Error) {
+	env, err := getTfStateEnv(c, envId)
+	if err != nil {
+		return nil, err
+	}
+
+	li := tfLockInfo{}
+	if er := json.Unmarshal(info, &li); er != nil || li.ID == "" {
+		return nil, e.New(e.BadRequest, fmt.Errorf("invalid lock info"), http.StatusBadRequest)
+	}
+	lock, err := services.LockTfState(c.DB(), env.StatePath, li.ID, string(info))
+	if err != nil {
+		if err.Code() == e.StateLocked {
+			return []byte(lock.Info), e.New(err.Code(), http.StatusLocked)
+		}
+		return nil, err
+	}
+	return []byte(lock.Info), nil
+}
+
+// UnlockTfState 释放 state 锁，请求中没有锁信息时(terraform force-unlock)强制释放
+func UnlockTfState(c *ctx.ServiceContext, envId models.Id, info []byte) e.Error {
+	env, err := getTfStateEnv(c, envId)
+	if err != nil {
+		return err
+	}
+
+	li := tfLockInfo{}
+	if len(info) > 0 {
+		if er := json.Unmarshal(info, &li); er != nil {
+			return e.New(e.BadRequest, fmt.Errorf("invalid lock info"), http.StatusBadRequest)
+		}
+	}
+	if err := services.UnlockTfState(c.DB(), env.StatePath, li.ID); err != nil {
+		if err.Code() == e.StateLocked {
+			return e.New(err.Code(), http.StatusConflict)
+		}
+		return err
+	}
+	return nil
+}
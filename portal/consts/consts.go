@@ -15,10 +15,15 @@ const (
 	DefaultPageSize = 15   // 默认分页大小
 	MaxPageSize     = 5000 // 同时是 csv 最大导出条数
 
-	MaxLogContentSize = 1024 * 1024 // 最大日志文件大小，超限会被截断
+	MaxLogContentSize = 1024 * 1024 // db 存储的最大日志大小，超限会被截断(保留最新内容)
 
 	RunnerConnectTimeout = time.Second * 5
+	// RunnerRunTaskTimeout 调用 runner 启动任务步骤的超时时间，runner 启动步骤时可能需要拉取镜像(最长 10 分钟)
+	RunnerRunTaskTimeout = time.Minute * 11
 	DbTaskPollInterval   = time.Second // 轮询 db 任务状态的间隔
+	DataPurgeInterval    = time.Hour   // 按日志保存周期清理过期数据的间隔
+	// WorkspaceKeepReportInterval 向 runner 上报需要保留工作目录的任务的间隔
+	WorkspaceKeepReportInterval = time.Minute * 30
 
 	DefaultAdminEmail = "admin@example.com"
 
@@ -44,6 +49,8 @@ const (
 	Env                    = "env"
 	TerraformVar           = "TF_VAR_"
 	WorkFlow               = "workflow"
+	TaskSourceSchedule     = "schedule" // 定时任务创建的任务
+	TaskSourceDriftCheck   = "drift"    // 定期漂移检测创建的任务
 
 	GitTypeGitLab = "gitlab"
 	GitTypeGitEA  = "gitea"
@@ -106,6 +113,8 @@ const (
 	EventTaskRunning   = "task.running"
 	EventTaskApproving = "task.approving"
 	EventTaskRejected  = "task.rejected"
+	EventTaskCancelled = "task.cancelled"
+	EventEnvDrifted    = "env.drifted"
 
 	DefaultTfMirror   = "https://releases.hashicorp.com/terraform"
 	HttpClientTimeout = 20
@@ -118,11 +127,12 @@ var (
 	EnvScopeOrg     = []string{ScopeOrg}
 
 	StatusTranslation = map[string]string{
-		"complete": "成功",
-		"failed":   "失败",
-		"running":  "运行中",
-		"timeout":  "超时",
-		"pending":  "排队中",
+		"complete":  "成功",
+		"failed":    "失败",
+		"running":   "运行中",
+		"timeout":   "超时",
+		"pending":   "排队中",
+		"cancelled": "已取消",
 	}
 	TerraformVersions = []string{
 		"0.11.15",
@@ -139,5 +149,6 @@ var (
 		common.TaskRunning:   EventTaskRunning,
 		common.TaskApproving: EventTaskApproving,
 		common.TaskRejected:  EventTaskFailed,
+		common.TaskCancelled: EventTaskCancelled,
 	}
 )
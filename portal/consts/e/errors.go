@@ -127,6 +127,11 @@ const (
 	EnvArchived            = 30813
 	EnvCannotArchiveActive = 30814
 	EnvDeploying           = 30815
+	EnvNotActive           = 30816
+
+	EnvScheduleNotExists       = 30820
+	EnvScheduleInvalidCron     = 30821
+	EnvScheduleInvalidTimezone = 30822
 
 	//// task 309
 
@@ -135,6 +140,10 @@ const (
 	TaskApproveNotPending = 30913
 	TaskStepNotExists     = 30914
 	TaskNotHaveStep       = 30916
+	TaskCannotCancel      = 30917
+	TaskFlowInvalid       = 30918
+	TaskCannotResume      = 30919
+	TaskImageNotAllowed   = 30920
 
 	//// ssh key 310
 
@@ -167,6 +176,28 @@ const (
 	/// terraform 313
 
 	InvalidTfVersion = 31300
+
+	//// state 314
+
+	StateBackendAlreadyExists = 31410
+	StateBackendNotExists     = 31411
+	StateBackendInUse         = 31412
+	StateBackendInvalid       = 31413
+	StateLocked               = 31420
+	StateNotLocked            = 31421
+	StateVersionNotExists     = 31430
+
+	//// runner 315
+
+	RunnerJobNotExists = 31510
+
+	//// cost 316
+
+	ResourcePriceNotExists     = 31610
+	ResourcePriceAlreadyExists = 31611
+	ResourcePriceInvalid       = 31612
+	CostDeltaExceeded          = 31620
+	CostEstimateFailed         = 31621
 )
 
 var errorMsgs = map[int]map[string]string{
@@ -323,6 +354,18 @@ var errorMsgs = map[int]map[string]string{
 	TaskNotHaveStep: {
 		"zh-cn": "任务无步骤",
 	},
+	TaskCannotCancel: {
+		"zh-cn": "任务已结束，无法取消",
+	},
+	TaskFlowInvalid: {
+		"zh-cn": "任务流程文件格式错误",
+	},
+	TaskCannotResume: {
+		"zh-cn": "任务无法恢复执行",
+	},
+	TaskImageNotAllowed: {
+		"zh-cn": "任务镜像不在组织允许的镜像列表中",
+	},
 	TemplateAlreadyExists: {
 		"zh-cn": "模板名称重复",
 	},
@@ -379,6 +422,18 @@ var errorMsgs = map[int]map[string]string{
 	EnvDeploying: {
 		"zh-cn": "环境正在部署中，请不要重复发起",
 	},
+	EnvNotActive: {
+		"zh-cn": "环境未部署或部署失败，无法执行该操作",
+	},
+	EnvScheduleNotExists: {
+		"zh-cn": "定时任务不存在",
+	},
+	EnvScheduleInvalidCron: {
+		"zh-cn": "无效的 cron 表达式",
+	},
+	EnvScheduleInvalidTimezone: {
+		"zh-cn": "无效的时区",
+	},
 	TaskAlreadyExists: {
 		"zh-cn": "任务已经存在",
 	},
@@ -415,6 +470,45 @@ var errorMsgs = map[int]map[string]string{
 	InvalidTfVersion: {
 		"zh-cn": "自动选择版本失败",
 	},
+	StateBackendAlreadyExists: {
+		"zh-cn": "该作用域已存在 state backend 配置",
+	},
+	StateBackendNotExists: {
+		"zh-cn": "state backend 配置不存在",
+	},
+	StateBackendInUse: {
+		"zh-cn": "state backend 正在被环境使用，无法删除",
+	},
+	StateBackendInvalid: {
+		"zh-cn": "state backend 配置无效",
+	},
+	StateLocked: {
+		"zh-cn": "state 已被锁定",
+	},
+	StateNotLocked: {
+		"zh-cn": "state 未被锁定",
+	},
+	StateVersionNotExists: {
+		"zh-cn": "state 版本不存在",
+	},
+	RunnerJobNotExists: {
+		"zh-cn": "runner 任务不存在",
+	},
+	ResourcePriceNotExists: {
+		"zh-cn": "价格配置不存在",
+	},
+	ResourcePriceAlreadyExists: {
+		"zh-cn": "相同资源类型及属性的价格配置已存在",
+	},
+	ResourcePriceInvalid: {
+		"zh-cn": "价格配置无效",
+	},
+	CostDeltaExceeded: {
+		"zh-cn": "预估月费用增加超过限制",
+	},
+	CostEstimateFailed: {
+		"zh-cn": "配置了月费用增加限制，但无法估算任务的费用",
+	},
 
 	PolicyAlreadyExist: {
 		"zh-cn": "策略已存在",
@@ -61,7 +61,8 @@ var IacTaskCompleteTpl = `
 <p>	环境名称：{{.EnvName}}</p>
 <p>	执行结果：成功</p>
 <p>	资源数量：{{.ResAdded}}+ {{.ResChanged}}~ {{.ResDestroyed}}-</p>
-<br />	
+{{if .Cost}}<p>	预估月费用：{{.Cost}}</p>
+{{end}}<br />	
 <p>	更多详情请点击：{{.Addr}}</p>
 <br />	
 <p>	-----该邮件由系统自动发出，请勿回复-----</p>
@@ -105,6 +106,49 @@ var IacTaskApprovingTpl = `
 <p>	环境名称：{{.EnvName}}</p>
 <p>	执行结果：审批中</p>
 <p>	失败原因：{{.Message}}</p>
+{{if .Cost}}<p>	预估月费用：{{.Cost}}</p>
+{{end}}<br />	
+<p>	更多详情请点击：{{.Addr}}</p>
+<br />	
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
+var IacTaskCancelledTpl = `
+<html>
+<body>
+<p>尊敬的CloudIaC用户：</p>
+<br />
+<p>	【{{.Creator}}】在CloudIaC平台发起的部署任务已被取消，详情如下：</p> 
+<br />	
+<p>	所属组织：{{.OrgName}}</p>
+<p>	所属项目：{{.ProjectName}}</p>
+<p>	云模板：{{.TemplateName}}</p>
+<p>	分支/tag：{{.Revision}}</p>
+<p>	环境名称：{{.EnvName}}</p>
+<p>	执行结果：已取消</p>
+<br />	
+<p>	更多详情请点击：{{.Addr}}</p>
+<br />	
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
+var IacEnvDriftedTpl = `
+<html>
+<body>
+<p>尊敬的CloudIaC用户：</p>
+<br />
+<p>	CloudIaC平台检测到环境资源发生漂移，详情如下：</p> 
+<br />	
+<p>	所属组织：{{.OrgName}}</p>
+<p>	所属项目：{{.ProjectName}}</p>
+<p>	云模板：{{.TemplateName}}</p>
+<p>	分支/tag：{{.Revision}}</p>
+<p>	环境名称：{{.EnvName}}</p>
+<p>	漂移资源：{{.Message}}</p>
 <br />	
 <p>	更多详情请点击：{{.Addr}}</p>
 <br />	
@@ -153,7 +197,9 @@ const (
 
 	失败原因：{{.Message}}
 
-	更多详情请点击：{{.Addr}}
+{{if .Cost}}	预估月费用：{{.Cost}}
+
+{{end}}	更多详情请点击：{{.Addr}}
 
 	-----该消息由系统自动发出，请勿回复-----
 `
@@ -201,6 +247,50 @@ const (
 
 	资源数量：{{.ResAdded}}+ {{.ResChanged}}~ {{.ResDestroyed}}-
 
+{{if .Cost}}	预估月费用：{{.Cost}}
+
+{{end}}	更多详情请点击：{{.Addr}}
+
+	-----该消息由系统自动发出，请勿回复-----
+`
+	IacTaskCancelledMarkdown = `
+尊敬的CloudIaC用户：
+
+	【{{.Creator}}】在CloudIaC平台发起的部署任务已被取消，详情如下：
+
+	所属组织：{{.OrgName}}
+
+	所属项目：{{.ProjectName}}
+
+	云模板：{{.TemplateName}}
+
+	分支/tag：{{.Revision}}
+
+	环境名称：{{.EnvName}}
+
+	执行结果：已取消
+
+	更多详情请点击：{{.Addr}}
+
+	-----该消息由系统自动发出，请勿回复-----
+`
+	IacEnvDriftedMarkdown = `
+尊敬的CloudIaC用户：
+
+	CloudIaC平台检测到环境资源发生漂移，详情如下：
+
+	所属组织：{{.OrgName}}
+
+	所属项目：{{.ProjectName}}
+
+	云模板：{{.TemplateName}}
+
+	分支/tag：{{.Revision}}
+
+	环境名称：{{.EnvName}}
+
+	漂移资源：{{.Message}}
+
 	更多详情请点击：{{.Addr}}
 
 	-----该消息由系统自动发出，请勿回复-----
@@ -6,4 +6,6 @@ const (
 	RunnerRunTaskURL       = "/api/v1/task/run"
 	RunnerTaskStateURL     = "/api/v1/task/status"
 	RunnerTaskLogFollowURL = "/api/v1/task/log/follow"
+	RunnerTaskCancelURL    = "/api/v1/task/cancel"
+	RunnerWorkspaceKeepURL = "/api/v1/workspace/keep"
 )
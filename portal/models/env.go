@@ -18,6 +18,12 @@ const (
 	//EnvStatusApproving = "approving" // 等待审批
 )
 
+const (
+	EnvDriftStatusNone    = "none"    // 未发现漂移
+	EnvDriftStatusDrifted = "drifted" // 资源发生漂移
+	EnvDriftStatusFailed  = "failed"  // 漂移检测任务执行失败
+)
+
 var (
 	EnvStatus     = []string{EnvStatusActive, EnvStatusFailed, EnvStatusInactive}
 	EnvTaskStatus = []string{TaskRunning, TaskApproving} // 环境 taskStatus 有效值
@@ -41,6 +47,8 @@ type Env struct {
 	Deploying  bool   `json:"deploying" gorm:"not null;default:false"` // 是否正在执行部署
 
 	StatePath string `json:"statePath" gorm:"not null" swaggerignore:"true"` // Terraform tfstate 文件路径（内部）
+	// state backend 在环境创建时确定，为空表示使用 consul(包括升级前创建的环境)
+	StateBackendId Id `json:"stateBackendId" gorm:"size:32;not null;default:''"`
 
 	// 环境可以覆盖模板中的 vars file 配置，具体说明见 Template model
 	TfVarsFile   string `json:"tfVarsFile" gorm:"default:''"`   // Terraform tfvars 变量文件路径
@@ -52,6 +60,14 @@ type Env struct {
 	Revision string `json:"revision" gorm:"size:64;default:'master'"` // Vcs仓库分支/标签
 	KeyId    Id     `json:"keyId" gorm:"size32"`                      // 部署密钥ID
 
+	// 部署通道标签选择器，设置后任务在执行时选择包含所有标签的健康 runner，优先于 RunnerId
+	RunnerTags StrSlice `json:"runnerTags" gorm:"type:json"`
+
+	Image string `json:"image" gorm:"default:''"` // 任务镜像，为空时使用模板设置的镜像
+
+	// 部署任务 plan 估算的月费用增加超过该值时中止部署，为空时使用组织的设置
+	CostDeltaThreshold *float64 `json:"costDeltaThreshold" gorm:"type:decimal(20,6)"`
+
 	LastTaskId    Id `json:"lastTaskId" gorm:"size:32"`    // 最后一次部署或销毁任务的 id(plan 任务不记录)
 	LastResTaskId Id `json:"lastResTaskId" gorm:"size:32"` // 最后一次进行了资源列表统计的部署任务的 id
 
@@ -73,6 +89,12 @@ type Env struct {
 	RetryNumber int  `json:"retryNumber" gorm:"size:32;default:3"` // 任务重试次数
 	RetryDelay  int  `json:"retryDelay" gorm:"size:32;default:5"`  // 任务重试时间，单位为秒
 	RetryAble   bool `json:"retryAble" gorm:"default:false"`       // 是否允许任务进行重试
+
+	// 漂移检测
+	DriftCheck      bool   `json:"driftCheck" gorm:"default:false"`                                                                            // 是否开启定期漂移检测
+	DriftStatus     string `json:"driftStatus" gorm:"type:enum('','none','drifted','failed');default:''" enums:"'','none','drifted','failed'"` // 漂移状态，为空表示未检测过
+	DriftCheckedAt  *Time  `json:"driftCheckedAt" gorm:"type:datetime"`                                                                        // 最近一次漂移检测时间
+	LastDriftTaskId Id     `json:"lastDriftTaskId" gorm:"size:32;default:''"`                                                                  // 最近一次漂移检测任务 id
 }
 
 func (Env) TableName() string {
@@ -0,0 +1,51 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+const (
+	EnvScheduleRunCreated = "created" // 己创建任务
+	EnvScheduleRunSkipped = "skipped" // 环境有任务在执行或环境不可部署，跳过本次执行
+	EnvScheduleRunFailed  = "failed"  // 创建任务失败
+)
+
+// EnvSchedule 环境定时任务，按 cron 表达式定期创建 plan/apply/destroy 任务
+type EnvSchedule struct {
+	TimedModel
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`       // 组织ID
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`   // 项目ID
+	EnvId     Id `json:"envId" gorm:"size:32;not null;index"` // 环境ID
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`   // 创建人ID
+
+	Name     string `json:"name" gorm:"not null"`                                                                          // 定时任务名称
+	Cron     string `json:"cron" gorm:"size:64;not null" example:"0 2 * * *"`                                              // cron 表达式(分 时 日 月 周)
+	Timezone string `json:"timezone" gorm:"size:64;default:''" example:"Asia/Shanghai"`                                    // 时区，为空使用服务器时区
+	TaskType string `json:"taskType" gorm:"type:enum('plan','apply','destroy');not null" enums:"'plan','apply','destroy'"` // 任务类型
+	Enabled  bool   `json:"enabled" gorm:"default:true"`                                                                   // 是否启用
+
+	// 创建任务时覆盖环境的变量
+	Variables TaskVariables `json:"variables" gorm:"type:json"`
+
+	NextRunAt  *Time `json:"nextRunAt" gorm:"type:datetime;index"` // 下次执行时间，禁用时为空
+	LastRunAt  *Time `json:"lastRunAt" gorm:"type:datetime"`       // 最近一次执行时间
+	LastTaskId Id    `json:"lastTaskId" gorm:"size:32;default:''"` // 最近一次创建的任务 id
+}
+
+func (EnvSchedule) TableName() string {
+	return "iac_env_schedule"
+}
+
+// EnvScheduleRun 定时任务执行记录
+type EnvScheduleRun struct {
+	TimedModel
+	ScheduleId Id `json:"scheduleId" gorm:"size:32;not null;index"` // 定时任务ID
+	EnvId      Id `json:"envId" gorm:"size:32;not null"`            // 环境ID
+	TaskId     Id `json:"taskId" gorm:"size:32;default:''"`         // 创建的任务ID
+
+	ScheduledAt Time   `json:"scheduledAt" gorm:"type:datetime"`                                                           // 计划执行时间
+	Status      string `json:"status" gorm:"type:enum('created','skipped','failed')" enums:"'created','skipped','failed'"` // 执行结果
+	Message     string `json:"message" gorm:"type:text"`                                                                   // 跳过或失败原因
+}
+
+func (EnvScheduleRun) TableName() string {
+	return "iac_env_schedule_run"
+}
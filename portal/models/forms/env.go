@@ -4,6 +4,7 @@ package forms
 
 import (
 	"cloudiac/portal/models"
+	"time"
 )
 
 type envTtlForm struct {
@@ -20,13 +21,15 @@ type CreateEnvForm struct {
 	OneTime  bool      `form:"oneTime" json:"oneTime" binding:""`                // 一次性环境标识
 	Triggers []string  `form:"triggers" json:"triggers" binding:""`              // 启用触发器，触发器：commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 
-	AutoApproval    bool   `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
-	StopOnViolation bool   `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`       // 合规不通过是否中止任务
-	TaskType        string `form:"taskType" json:"taskType" binding:"required" enums:"plan,apply"`  // 环境创建后触发的任务步骤，plan计划,apply部署
-	Targets         string `form:"targets" json:"targets" binding:""`                               // Terraform target 参数列表，多个参数用 , 进行分隔
-	RunnerId        string `form:"runnerId" json:"runnerId" binding:""`                             // 环境默认部署通道
-	Revision        string `form:"revision" json:"revision" binding:""`                             // 分支/标签
-	Timeout         int    `form:"timeout" json:"timeout" binding:""`                               // 部署超时时间（单位：秒）
+	AutoApproval    bool     `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
+	StopOnViolation bool     `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`       // 合规不通过是否中止任务
+	TaskType        string   `form:"taskType" json:"taskType" binding:"required" enums:"plan,apply"`  // 环境创建后触发的任务步骤，plan计划,apply部署
+	Targets         string   `form:"targets" json:"targets" binding:""`                               // Terraform target 参数列表，多个参数用 , 进行分隔
+	RunnerId        string   `form:"runnerId" json:"runnerId" binding:""`                             // 环境默认部署通道
+	RunnerTags      []string `form:"runnerTags" json:"runnerTags" binding:""`                         // 部署通道标签，设置后按标签选择 runner
+	Image           string   `form:"image" json:"image" binding:""`                                   // 任务镜像，为空时使用模板设置的镜像
+	Revision        string   `form:"revision" json:"revision" binding:""`                             // 分支/标签
+	Timeout         int      `form:"timeout" json:"timeout" binding:""`                               // 部署超时时间（单位：秒）
 
 	Variables []Variables `form:"variables" json:"variables" binding:""` // 自定义变量列表，该变量列表会覆盖现有的变量
 
@@ -39,6 +42,9 @@ type CreateEnvForm struct {
 	RetryDelay  int  `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
 	RetryAble   bool `form:"retryAble" json:"retryAble" binding:""`     // 是否允许任务进行重试
 
+	DriftCheck bool `form:"driftCheck" json:"driftCheck" binding:"" enums:"true,false"` // 是否开启定期漂移检测
+
+	CostDeltaThreshold *float64 `form:"costDeltaThreshold" json:"costDeltaThreshold" binding:"omitempty,min=0"` // 部署任务月费用增加限制，为空时使用组织的设置，需要审批权限
 }
 
 type UpdateEnvForm struct {
@@ -51,6 +57,8 @@ type UpdateEnvForm struct {
 	Description string    `form:"description" json:"description" binding:"max=255"` // 环境描述
 	KeyId       models.Id `form:"keyId" json:"keyId" binding:""`                    // 部署密钥ID
 	RunnerId    string    `form:"runnerId" json:"runnerId" binding:""`              // 环境默认部署通道
+	RunnerTags  []string  `form:"runnerTags" json:"runnerTags" binding:""`          // 部署通道标签，设置后按标签选择 runner
+	Image       string    `form:"image" json:"image" binding:""`                    // 任务镜像，为空时使用模板设置的镜像
 	Archived    bool      `form:"archived" json:"archived" enums:"true,false"`      // 归档状态，默认返回未归档环境
 
 	AutoApproval    bool `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
@@ -60,6 +68,10 @@ type UpdateEnvForm struct {
 	RetryNumber int      `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay  int      `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
 	RetryAble   bool     `form:"retryAble" json:"retryAble" binding:""`     // 是否允许任务进行重试
+
+	DriftCheck bool `form:"driftCheck" json:"driftCheck" binding:"" enums:"true,false"` // 是否开启定期漂移检测
+
+	CostDeltaThreshold *float64 `form:"costDeltaThreshold" json:"costDeltaThreshold" binding:"omitempty,min=0"` // 部署任务月费用增加限制，传 null 时使用组织的设置，需要审批权限
 }
 
 type DeployEnvForm struct {
@@ -73,11 +85,16 @@ type DeployEnvForm struct {
 	AutoApproval    bool     `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
 	StopOnViolation bool     `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`       // 合规不通过是否中止任务
 
-	TaskType string `form:"taskType" json:"taskType" binding:"required" enums:"plan,apply,destroy"` // 环境创建后触发的任务步骤，plan计划,apply部署,destroy销毁资源
-	Targets  string `form:"targets" json:"targets" binding:""`                                      // Terraform target 参数列表
-	RunnerId string `form:"runnerId" json:"runnerId" binding:""`                                    // 环境默认部署通道
-	Revision string `form:"revision" json:"revision" binding:""`                                    // 分支/标签
-	Timeout  int    `form:"timeout" json:"timeout" binding:""`                                      // 部署超时时间（单位：秒）
+	TaskType   string   `form:"taskType" json:"taskType" binding:"required" enums:"plan,apply,destroy,import,stateop"` // 环境创建后触发的任务步骤，plan计划,apply部署,destroy销毁资源,import导入资源,stateop state操作
+	Targets    string   `form:"targets" json:"targets" binding:""`                                                     // Terraform target 参数列表
+	RunnerId   string   `form:"runnerId" json:"runnerId" binding:""`                                                   // 环境默认部署通道
+	RunnerTags []string `form:"runnerTags" json:"runnerTags" binding:""`                                               // 部署通道标签，设置后按标签选择 runner
+	Image      string   `form:"image" json:"image" binding:""`                                                         // 任务镜像，为空时使用模板设置的镜像
+	Revision   string   `form:"revision" json:"revision" binding:""`                                                   // 分支/标签
+	Timeout    int      `form:"timeout" json:"timeout" binding:""`                                                     // 部署超时时间（单位：秒）
+
+	Imports  []models.TaskImportItem  `form:"imports" json:"imports" binding:""`   // 要导入的资源列表，taskType 为 import 时必填
+	StateOps []models.TaskStateOpItem `form:"stateOps" json:"stateOps" binding:""` // state 操作列表，按顺序执行，taskType 为 stateop 时必填
 
 	RetryNumber int  `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay  int  `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
@@ -133,6 +150,23 @@ type SearchEnvResourceForm struct {
 	Q  string    `form:"q" json:"q" binding:""`            // 资源名称，支持模糊查询
 }
 
+type EnvResourceDiffForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                     // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	FromTaskId models.Id `form:"fromTaskId" json:"fromTaskId"`                         // 对比的起始任务ID，为空时与空的资源列表对比，需要是统计了资源列表的部署任务
+	ToTaskId   models.Id `form:"toTaskId" json:"toTaskId"`                             // 对比的目标任务ID，为空时使用环境最后一次统计资源的任务，不能早于起始任务
+	From       time.Time `form:"from" json:"from" example:"2006-01-02T15:04:05Z07:00"` // 开始时间，未指定任务时对比开始及结束时间的资源列表
+	To         time.Time `form:"to" json:"to" example:"2006-01-02T15:04:05Z07:00"`     // 结束时间，默认为当前时间
+}
+
+type EnvResourceTimelineForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`          // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Address string    `form:"address" json:"address" binding:"required"` // 资源地址，如 module.vpc.alicloud_vpc.default
+}
+
 type DestroyEnvForm struct {
 	BaseForm
 
@@ -144,3 +178,35 @@ type SearchEnvVariableForm struct {
 
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
 }
+
+type EnvDriftForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SearchEnvStateForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type EnvStateVersionForm struct {
+	BaseForm
+
+	Id        models.Id `uri:"id" json:"id" swaggerignore:"true"`               // 环境ID
+	VersionId models.Id `uri:"versionId" json:"versionId" swaggerignore:"true"` // state 版本ID
+}
+
+type EnvStateLockForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID
+}
+
+type EnvStateUnlockForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID
+	LockId string    `json:"lockId" form:"lockId"`             // 锁 ID，为空时使用当前查询到的锁，backend 不支持查询锁信息时必须指定
+}
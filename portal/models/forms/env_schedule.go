@@ -0,0 +1,66 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type ScheduleVariable struct {
+	Type      string `json:"type" form:"type" binding:"required" enums:"environment,terraform,ansible"` // 类型
+	Name      string `json:"name" form:"name" binding:"required"`                                       // 名称
+	Value     string `json:"value" form:"value"`                                                        // 值
+	Sensitive bool   `json:"sensitive" form:"sensitive"`                                                // 是否加密
+}
+
+type CreateEnvScheduleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+
+	Name      string             `json:"name" form:"name" binding:"required"`                                    // 定时任务名称
+	Cron      string             `json:"cron" form:"cron" binding:"required" example:"0 2 * * *"`                // cron 表达式(分 时 日 月 周)
+	Timezone  string             `json:"timezone" form:"timezone" example:"Asia/Shanghai"`                       // 时区，为空使用服务器时区
+	TaskType  string             `json:"taskType" form:"taskType" binding:"required" enums:"plan,apply,destroy"` // 任务类型
+	Enabled   bool               `json:"enabled" form:"enabled"`                                                 // 是否启用
+	Variables []ScheduleVariable `json:"variables" form:"variables"`                                             // 覆盖环境的变量
+}
+
+type UpdateEnvScheduleForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	ScheduleId models.Id `uri:"scheduleId" json:"scheduleId" swaggerignore:"true"` // 定时任务ID
+
+	Name      string             `json:"name" form:"name"`                                    // 定时任务名称
+	Cron      string             `json:"cron" form:"cron" example:"0 2 * * *"`                // cron 表达式(分 时 日 月 周)
+	Timezone  string             `json:"timezone" form:"timezone" example:"Asia/Shanghai"`    // 时区，为空使用服务器时区
+	TaskType  string             `json:"taskType" form:"taskType" enums:"plan,apply,destroy"` // 任务类型
+	Enabled   bool               `json:"enabled" form:"enabled"`                              // 是否启用
+	Variables []ScheduleVariable `json:"variables" form:"variables"`                          // 覆盖环境的变量
+}
+
+type SearchEnvScheduleForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type DetailEnvScheduleForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID
+	ScheduleId models.Id `uri:"scheduleId" json:"scheduleId" swaggerignore:"true"` // 定时任务ID
+}
+
+type DeleteEnvScheduleForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID
+	ScheduleId models.Id `uri:"scheduleId" json:"scheduleId" swaggerignore:"true"` // 定时任务ID
+}
+
+type SearchEnvScheduleRunForm struct {
+	PageForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID
+	ScheduleId models.Id `uri:"scheduleId" json:"scheduleId" swaggerignore:"true"` // 定时任务ID
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type InventoryFilterForm struct {
+	EnvId    models.Id `form:"envId" json:"envId"`       // 环境ID
+	Provider string    `form:"provider" json:"provider"` // provider 全称或简称，如 alicloud
+	Type     string    `form:"type" json:"type"`         // 资源类型
+	Module   string    `form:"module" json:"module"`     // 资源所在模块
+	Attrs    []string  `form:"attrs" json:"attrs"`       // 资源属性过滤条件，格式为 path=value，如 instance_type=ecs.g6.xlarge，可指定多个
+	Q        string    `form:"q" json:"q"`               // 对资源地址及属性值进行全文搜索，不匹配敏感属性
+}
+
+type SearchInventoryForm struct {
+	PageForm
+	InventoryFilterForm
+}
+
+type InventoryStatsForm struct {
+	BaseForm
+	InventoryFilterForm
+}
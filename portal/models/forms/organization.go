@@ -19,6 +19,11 @@ type UpdateOrganizationForm struct {
 	Description string `form:"description" json:"description" binding:"max=255"` // 组织描述
 	RunnerId    string `form:"runnerId" json:"runnerId" binding:""`              // 组织默认部署通道
 	Status      string `form:"status" json:"status" enums:"enable,disable"`      // 组织状态
+	TaskWeight  int    `form:"taskWeight" json:"taskWeight" binding:"min=0"`     // 任务调度权重，仅平台管理员可修改
+
+	TaskImages []string `form:"taskImages" json:"taskImages" binding:""` // 组织允许使用的任务镜像，以 * 结尾的项按前缀匹配
+
+	CostDeltaThreshold *float64 `form:"costDeltaThreshold" json:"costDeltaThreshold" binding:"omitempty,min=0"` // 部署任务月费用增加限制，传 null 表示不限制
 }
 
 type SearchOrganizationForm struct {
@@ -0,0 +1,57 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package forms
+
+import (
+	"cloudiac/portal/models"
+	"mime/multipart"
+)
+
+type CreateResourcePriceForm struct {
+	BaseForm
+
+	ResourceType string  `json:"resourceType" form:"resourceType" binding:"required"`                      // 资源类型，如 alicloud_instance
+	Attribute    string  `json:"attribute" form:"attribute"`                                               // 计费属性，为空表示按资源数量计费
+	Value        string  `json:"value" form:"value"`                                                       // 计费属性的值，为空表示按属性的数值计费
+	Unit         string  `json:"unit" form:"unit" binding:"omitempty,oneof=hour month" enums:"hour,month"` // 计费周期，默认为 month
+	Price        float64 `json:"price" form:"price" binding:"min=0"`                                       // 单价
+	Description  string  `json:"description" form:"description"`                                           // 描述
+}
+
+type UpdateResourcePriceForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 价格ID
+
+	Unit        string  `json:"unit" form:"unit" binding:"omitempty,oneof=hour month" enums:"hour,month"` // 计费周期
+	Price       float64 `json:"price" form:"price" binding:"min=0"`                                       // 单价
+	Description string  `json:"description" form:"description"`                                           // 描述
+}
+
+type SearchResourcePriceForm struct {
+	PageForm
+
+	Q            string `form:"q" json:"q"`                       // 资源类型或属性值，支持模糊搜索
+	ResourceType string `form:"resourceType" json:"resourceType"` // 资源类型
+}
+
+type DetailResourcePriceForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 价格ID
+}
+
+type DeleteResourcePriceForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 价格ID
+}
+
+type ImportResourcePriceForm struct {
+	BaseForm
+
+	File    *multipart.FileHeader `form:"file" json:"-" swaggerignore:"true"`                                           // 价格目录文件，格式由文件扩展名确定
+	Content string                `form:"content" json:"content"`                                                       // 价格目录内容，未上传文件时使用
+	Format  string                `form:"format" json:"format" binding:"omitempty,oneof=csv yaml yml" enums:"csv,yaml"` // 价格目录格式
+	Replace bool                  `form:"replace" json:"replace"`                                                       // 是否删除现有的全部价格配置后导入
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package forms
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+)
+
+type RunnerAgentRegisterForm struct {
+	BaseForm
+
+	Tags    []string `json:"tags" form:"tags"`       // runner 标签
+	Version string   `json:"version" form:"version"` // runner 版本
+}
+
+type RunnerAgentJobsForm struct {
+	BaseForm
+
+	Wait int `json:"wait" form:"wait"` // 没有待执行任务时最长等待时间(秒)，最大 30 秒
+}
+
+type RunnerAgentJobStatusForm struct {
+	BaseForm
+	runner.TaskStatusMessage
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // job ID
+}
+
+type RunnerAgentJobLogForm struct {
+	BaseForm
+	runner.PullJobLogReq
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // job ID
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type CreateStateBackendForm struct {
+	BaseForm
+
+	ProjectId   models.Id                 `json:"projectId" form:"projectId"`                                       // 项目ID，为空表示组织级别配置
+	TplId       models.Id                 `json:"tplId" form:"tplId"`                                               // 云模板ID，为空表示组织或项目级别配置
+	Name        string                    `json:"name" form:"name" binding:"required"`                              // 名称
+	Type        string                    `json:"type" form:"type" binding:"required" enums:"consul,s3,local,http"` // backend 类型
+	Config      models.StateBackendConfig `json:"config" form:"config"`                                             // backend 配置
+	Description string                    `json:"description" form:"description"`                                   // 描述
+}
+
+type UpdateStateBackendForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // state backend ID
+
+	Name        string                    `json:"name" form:"name"`               // 名称
+	Config      models.StateBackendConfig `json:"config" form:"config"`           // backend 配置，认证信息为空时保持不变
+	Description string                    `json:"description" form:"description"` // 描述
+}
+
+type SearchStateBackendForm struct {
+	PageForm
+
+	Q         string    `form:"q" json:"q"`                 // 名称，支持模糊搜索
+	ProjectId models.Id `form:"projectId" json:"projectId"` // 项目ID
+	TplId     models.Id `form:"tplId" json:"tplId"`         // 云模板ID
+}
+
+type DetailStateBackendForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // state backend ID
+}
+
+type DeleteStateBackendForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // state backend ID
+}
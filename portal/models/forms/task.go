@@ -66,6 +66,25 @@ type ApproveTaskForm struct {
 	Action string    `form:"action" json:"action" binding:"required" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
 }
 
+type CancelTaskForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type ResumeTaskForm struct {
+	BaseForm
+
+	Id       models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	FromStep int       `json:"fromStep" form:"fromStep"`         // 从该步骤开始重新执行，默认为失败的步骤，只能指定失败步骤及之前的步骤
+}
+
+type SearchTaskResumeForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
 type SearchEnvTasksForm struct {
 	PageForm
 
@@ -79,9 +98,24 @@ type SearchTaskResourceForm struct {
 	Q  string    `form:"q" json:"q" binding:""`            // 资源名称，支持模糊查询
 }
 
+type SearchTaskChangesForm struct {
+	PageForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`                                                 // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Action string    `form:"action" json:"action" binding:"omitempty,oneof=create update delete replace read"` // 变更类型
+	Type   string    `form:"type" json:"type" binding:""`                                                      // 资源类型，如 aws_instance
+}
+
 type ResourceDetailForm struct {
 	BaseForm
 
 	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID，swagger 参数通过 param path 指定，这里忽略
 	ResourceId models.Id `uri:"resourceId" json:"resourceId" swaggerignore:"true"` // 部署成功后后资源ID
 }
+
+type SearchTaskQueueForm struct {
+	BaseForm
+
+	ProjectId models.Id `json:"projectId" form:"projectId"` // 项目ID
+	EnvId     models.Id `json:"envId" form:"envId"`         // 环境ID
+}
@@ -30,6 +30,15 @@ type CreateTemplateForm struct {
 	DeleteVariablesId []string    `json:"deleteVariablesId" form:"deleteVariablesId" ` //变量id
 	ProjectId         []models.Id `form:"projectId" json:"projectId"`                  // 项目ID
 	TfVersion         string      `form:"tfVersion" json:"tfVersion"`                  // 模版使用terraform版本号
+	FlowFile          string      `form:"flowFile" json:"flowFile"`                    // 任务流程文件路径，如 .cloudiac-flow.yml
+	RunnerTags        []string    `form:"runnerTags" json:"runnerTags"`                // 部署通道标签，环境未设置时按该标签选择 runner
+
+	// 任务容器资源限制，为 0 时使用 runner 的默认配置
+	ContainerCpus   float64 `form:"containerCpus" json:"containerCpus" binding:"gte=0"`     // cpu 核数
+	ContainerMemory int64   `form:"containerMemory" json:"containerMemory" binding:"gte=0"` // 内存(MB)
+	ContainerPids   int64   `form:"containerPids" json:"containerPids" binding:"gte=0"`     // 最大进程数
+
+	Image string `form:"image" json:"image" binding:""` // 任务镜像，为空时使用 runner 默认镜像
 }
 
 type SearchTemplateForm struct {
@@ -57,6 +66,15 @@ type UpdateTemplateForm struct {
 	VcsId             models.Id   `form:"vcsId" json:"vcsId" binding:""`
 	RepoId            string      `form:"repoId" json:"repoId" binding:""`
 	TfVersion         string      `form:"tfVersion" json:"tfVersion" binding:""`
+	FlowFile          string      `form:"flowFile" json:"flowFile" binding:""` // 任务流程文件路径，如 .cloudiac-flow.yml
+	RunnerTags        []string    `form:"runnerTags" json:"runnerTags"`        // 部署通道标签，环境未设置时按该标签选择 runner
+
+	// 任务容器资源限制，为 0 时使用 runner 的默认配置
+	ContainerCpus   float64 `form:"containerCpus" json:"containerCpus" binding:"gte=0"`     // cpu 核数
+	ContainerMemory int64   `form:"containerMemory" json:"containerMemory" binding:"gte=0"` // 内存(MB)
+	ContainerPids   int64   `form:"containerPids" json:"containerPids" binding:"gte=0"`     // 最大进程数
+
+	Image string `form:"image" json:"image" binding:""` // 任务镜像，为空时使用 runner 默认镜像
 }
 
 type DeleteTemplateForm struct {
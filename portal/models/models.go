@@ -178,14 +178,25 @@ func Init(migrate bool) {
 	autoMigrate(&Vcs{}, sess)
 	autoMigrate(&Template{}, sess)
 	autoMigrate(&Env{}, sess)
+	autoMigrate(&EnvSchedule{}, sess)
+	autoMigrate(&EnvScheduleRun{}, sess)
 	autoMigrate(&Resource{}, sess)
+	autoMigrate(&ResourceDrift{}, sess)
+	autoMigrate(&ResourceChange{}, sess)
 
 	autoMigrate(&Variable{}, sess)
 
 	autoMigrate(&Task{}, sess)
 	autoMigrate(&ScanTask{}, sess)
 	autoMigrate(&TaskStep{}, sess)
+	autoMigrate(&TaskResume{}, sess)
 	autoMigrate(&DBStorage{}, sess)
+	autoMigrate(&StateBackend{}, sess)
+	autoMigrate(&ResourcePrice{}, sess)
+	autoMigrate(&StateLock{}, sess)
+	autoMigrate(&StateVersion{}, sess)
+	autoMigrate(&PullRunner{}, sess)
+	autoMigrate(&RunnerJob{}, sess)
 
 	autoMigrate(&User{}, sess)
 	autoMigrate(&UserOrg{}, sess)
@@ -20,7 +20,14 @@ type Organization struct {
 	Description string `json:"description" gorm:"type:text;comment:组织描述" example:"示例公司 IaC 研发部"`                                                  // 组织描述
 	Status      string `json:"status" gorm:"type:enum('enable','disable');default:'enable';comment:组织状态" example:"enable" enums:"enable,disable"` // 组织状态
 	CreatorId   Id     `json:"creatorId" gorm:"size:32;not null;comment:创建人" example:"u-c3ek0co6n88ldvq1n6ag"`                                    //创建人ID
-	RunnerId    string `json:"runnerId" gorm:"not null" example:"runner-01"`                                                            // 组织默认部署通道
+	RunnerId    string `json:"runnerId" gorm:"not null" example:"runner-01"`                                                                      // 组织默认部署通道
+	TaskWeight  int    `json:"taskWeight" gorm:"default:1;comment:任务调度权重" example:"1"`                                                            // 任务调度权重，同优先级任务按组织权重公平调度
+
+	// 组织允许使用的任务镜像，以 * 结尾的项按前缀匹配(如 registry.example.com/iac/*)，为空时只能使用 runner 默认镜像
+	TaskImages StrSlice `json:"taskImages" gorm:"type:json"`
+
+	// 部署任务 plan 估算的月费用增加超过该值时中止部署，为空表示不限制，环境可单独设置
+	CostDeltaThreshold *float64 `json:"costDeltaThreshold" gorm:"type:decimal(20,6)"`
 
 	IsDemo bool `json:"isDemo,omitempty" gorm:"default:false"` // 是否演示组织
 }
@@ -0,0 +1,57 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// PullRunner 拉取模式的 runner，runner 主动连接 portal 注册并领取任务，不需要 portal 能访问到 runner
+type PullRunner struct {
+	TimedModel
+
+	RunnerId   string   `json:"runnerId" gorm:"size:64;not null"` // runner 配置中的 consul.id
+	Tags       StrSlice `json:"tags" gorm:"type:text"`
+	Version    string   `json:"version" gorm:"size:64;default:''"`
+	LastSeenAt *Time    `json:"lastSeenAt" gorm:"type:datetime"` // 最近一次请求 portal 的时间
+}
+
+func (PullRunner) TableName() string {
+	return "iac_pull_runner"
+}
+
+func (r PullRunner) Migrate(sess *db.Session) error {
+	return r.AddUniqueIndex(sess, "unique__runner_id", "runner_id")
+}
+
+const (
+	RunnerJobPending = "pending" // 等待 runner 领取
+	RunnerJobRunning = "running" // runner 己领取并开始执行
+	RunnerJobExited  = "exited"  // 执行结束，执行结果保存在 ResultPath
+)
+
+// RunnerJob 下发给拉取模式 runner 的任务步骤
+type RunnerJob struct {
+	TimedModel
+
+	RunnerId string `json:"runnerId" gorm:"size:64;not null;index"`
+	TaskId   Id     `json:"taskId" gorm:"size:32;not null"`
+	EnvId    Id     `json:"envId" gorm:"size:32;not null"`
+	Step     int    `json:"step" gorm:"not null"`
+	Request  JSON   `json:"request" gorm:"type:longtext"` // runner.RunTaskReq
+
+	Status          string `json:"status" gorm:"type:enum('pending','running','exited');default:'pending'"`
+	ExitCode        int    `json:"exitCode" gorm:"default:0"`
+	CancelRequested bool   `json:"cancelRequested" gorm:"default:false"` // portal 请求取消步骤执行
+	CancelSent      bool   `json:"cancelSent" gorm:"default:false"`      // 取消请求己下发给 runner
+	Log             string `json:"-" gorm:"type:longtext"`               // runner 执行过程中推送的增量日志(己替换敏感信息)
+	LogOffset       int    `json:"-" gorm:"default:0"`                   // 己保存的增量日志在 runner 日志文件中的长度
+	ResultPath      string `json:"-" gorm:"default:''"`                  // 执行结束后 runner 上报的状态及结果文件保存路径
+	HeartbeatAt     *Time  `json:"heartbeatAt" gorm:"type:datetime"`     // runner 最近一次上报状态的时间
+}
+
+func (RunnerJob) TableName() string {
+	return "iac_runner_job"
+}
+
+func (j RunnerJob) Migrate(sess *db.Session) error {
+	return j.AddUniqueIndex(sess, "unique__task__step", "task_id", "step")
+}
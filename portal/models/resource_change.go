@@ -0,0 +1,59 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+import "database/sql/driver"
+
+const (
+	ResourceChangeCreate  = "create"
+	ResourceChangeUpdate  = "update"
+	ResourceChangeDelete  = "delete"
+	ResourceChangeReplace = "replace"
+	ResourceChangeRead    = "read"
+)
+
+// ResourceChangeAttr 资源属性变更前后的值
+type ResourceChangeAttr struct {
+	Before        interface{} `json:"before"`
+	After         interface{} `json:"after"`
+	Sensitive     bool        `json:"sensitive,omitempty"`     // 是否为敏感值，敏感值不会记录实际的值
+	Unknown       bool        `json:"unknown,omitempty"`       // 变更后的值需要 apply 后才能确定
+	ForcesReplace bool        `json:"forcesReplace,omitempty"` // 该属性的变更导致资源需要重建
+}
+
+type ResourceChangeAttrs map[string]ResourceChangeAttr
+
+func (v ResourceChangeAttrs) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *ResourceChangeAttrs) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// ResourceChange plan 步骤生成的资源变更计划
+type ResourceChange struct {
+	BaseModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"`
+
+	Address  string `json:"address" gorm:"not null"`
+	Module   string `json:"module" gorm:"not null;default:''"`
+	Provider string `json:"provider" gorm:"not null;default:''"`
+	Mode     string `json:"mode" gorm:"not null;default:''"`
+	Type     string `json:"type" gorm:"not null"`
+	Name     string `json:"name" gorm:"not null"`
+	Index    string `json:"index" gorm:"not null;default:''"`
+
+	Action       string              `json:"action" gorm:"not null" enums:"create,update,delete,replace,read"`
+	ActionReason string              `json:"actionReason" gorm:"not null;default:''" example:"replace_because_cannot_update"` // terraform 给出的变更原因(terraform 1.2 开始支持)
+	ReplacePaths StrSlice            `json:"replacePaths" gorm:"type:json"`                                                   // 导致资源重建的属性
+	Changes      ResourceChangeAttrs `json:"changes" gorm:"type:json"`                                                        // 发生变更的属性
+}
+
+func (ResourceChange) TableName() string {
+	return "iac_resource_change"
+}
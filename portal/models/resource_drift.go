@@ -0,0 +1,43 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+import "database/sql/driver"
+
+// DriftAttr 资源属性漂移前后的值
+type DriftAttr struct {
+	Before interface{} `json:"before"` // state 中记录的值
+	After  interface{} `json:"after"`  // 实际资源的值
+}
+
+type DriftAttrs map[string]DriftAttr
+
+func (v DriftAttrs) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *DriftAttrs) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// ResourceDrift 漂移检测任务发现的漂移资源
+type ResourceDrift struct {
+	BaseModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"`
+
+	Address string     `json:"address" gorm:"not null"`
+	Mode    string     `json:"mode" gorm:"not null;default:''"`
+	Type    string     `json:"type" gorm:"not null"`
+	Name    string     `json:"name" gorm:"not null"`
+	Index   string     `json:"index" gorm:"not null;default:''"`
+	Action  string     `json:"action" gorm:"not null;default:''" example:"update"` // 漂移类型，update: 属性被修改，delete: 资源已被删除
+	Changes DriftAttrs `json:"changes" gorm:"type:json"`                           // 发生漂移的属性
+}
+
+func (ResourceDrift) TableName() string {
+	return "iac_resource_drift"
+}
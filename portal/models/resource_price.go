@@ -0,0 +1,69 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"fmt"
+)
+
+const (
+	PriceUnitHour  = "hour"
+	PriceUnitMonth = "month"
+
+	// HoursPerMonth 按小时计费的价格换算为月费用时使用的小时数(365*24/12)
+	HoursPerMonth = 730
+)
+
+// ResourcePrice 组织价格目录中的一项，用于估算 plan 的月费用。
+// 价格按以下方式匹配资源:
+//   - Attribute 为空: 资源每个实例按 Price 计费
+//   - Attribute、Value 都不为空: 资源属性值等于 Value 时按 Price 计费，如按实例规格计费
+//   - Value 为空: 按资源属性的数值乘以 Price 计费，如按磁盘大小(GB)、带宽(Mbps)计费
+type ResourcePrice struct {
+	TimedModel
+
+	OrgId        Id      `json:"orgId" gorm:"size:32;not null"`
+	ResourceType string  `json:"resourceType" gorm:"size:128;not null" example:"alicloud_instance"`                 // 资源类型
+	Attribute    string  `json:"attribute" gorm:"size:128;not null;default:''" example:"instance_type"`             // 计费属性，嵌套属性使用 . 分隔，如 root_block_device.0.volume_size
+	Value        string  `json:"value" gorm:"size:255;not null;default:''" example:"ecs.g6.large"`                  // 计费属性的值
+	Unit         string  `json:"unit" gorm:"type:enum('hour','month');not null;default:'month'" enums:"hour,month"` // 计费周期
+	Price        float64 `json:"price" gorm:"type:decimal(20,6);not null" example:"0.5"`                            // 单价
+	Description  string  `json:"description" gorm:"type:text"`
+}
+
+func (ResourcePrice) TableName() string {
+	return "iac_resource_price"
+}
+
+func (p ResourcePrice) Migrate(sess *db.Session) (err error) {
+	if err = p.AddUniqueIndex(sess, "unique__org__price", "org_id", "resource_type", "attribute", "value"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate 检查价格配置是否有效
+func (p *ResourcePrice) Validate() error {
+	if p.ResourceType == "" {
+		return fmt.Errorf("resource type is required")
+	}
+	if p.Value != "" && p.Attribute == "" {
+		return fmt.Errorf("attribute is required when value is set")
+	}
+	if p.Unit != PriceUnitHour && p.Unit != PriceUnitMonth {
+		return fmt.Errorf("unsupported price unit '%s'", p.Unit)
+	}
+	if p.Price < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+	return nil
+}
+
+// MonthlyPrice 返回换算为月费用的单价
+func (p *ResourcePrice) MonthlyPrice() float64 {
+	if p.Unit == PriceUnitHour {
+		return p.Price * HoursPerMonth
+	}
+	return p.Price
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"cloudiac/portal/libs/db"
 	"cloudiac/runner"
 	"path"
 )
@@ -9,7 +10,7 @@ type BaseTask struct {
 	SoftDeleteModel
 
 	/* 通用任务参数 */
-	Type string `json:"type" gorm:"not null;enum('plan','apply','destroy','scan'')" enums:"'plan','apply','destroy','scan'"` // 任务类型。1. plan: 计划 2. apply: 部署 3. destroy: 销毁
+	Type string `json:"type" gorm:"not null;enum('plan','apply','destroy','scan','drift','restore','unlock','import','stateop'')" enums:"'plan','apply','destroy','scan','drift','restore','unlock','import','stateop'"` // 任务类型。1. plan: 计划 2. apply: 部署 3. destroy: 销毁 4. drift: 漂移检测 5. restore: state 恢复 6. unlock: state 强制解锁 7. import: 导入资源 8. stateop: state 操作
 
 	Flow     TaskFlow `json:"-" gorm:"type:text"`        // 执行流程
 	CurrStep int      `json:"currStep" gorm:"default:0"` // 当前在执行的流程步骤
@@ -19,7 +20,10 @@ type BaseTask struct {
 
 	RunnerId string `json:"runnerId" gorm:"not null"` // 部署通道
 
-	Status  string `json:"status" gorm:"type:enum('pending','running','approving','rejected','failed','complete','timeout');default:'pending'" enums:"'pending','running','approving','rejected','failed','complete','timeout'"`
+	// 调度优先级，值越大越先执行，同优先级的任务在组织间按权重公平调度
+	Priority int `json:"priority" gorm:"default:0;comment:调度优先级"`
+
+	Status  string `json:"status" gorm:"type:enum('pending','running','approving','rejected','failed','complete','timeout','cancelled');default:'pending'" enums:"'pending','running','approving','rejected','failed','complete','timeout','cancelled'"`
 	Message string `json:"message" gorm:"type:text"` // 任务的状态描述信息，如失败原因等
 
 	StartAt *Time `json:"startAt" gorm:"type:datetime;comment:任务开始时间"` // 任务开始时间
@@ -57,6 +61,13 @@ type ScanTask struct {
 func (ScanTask) TableName() string {
 	return "iac_scan_task"
 }
+
+func (t *ScanTask) Migrate(sess *db.Session) (err error) {
+	if err := sess.ModifyModelColumn(t, "status"); err != nil {
+		return err
+	}
+	return nil
+}
 func (t *ScanTask) TfParseJsonPath() string {
 	if t.EnvId != "" {
 		return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TerrascanJsonFile)
@@ -0,0 +1,113 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+	"fmt"
+)
+
+const (
+	StateBackendConsul = "consul"
+	StateBackendS3     = "s3"
+	StateBackendLocal  = "local"
+	StateBackendHttp   = "http"
+)
+
+var StateBackendTypes = []string{StateBackendConsul, StateBackendS3, StateBackendLocal, StateBackendHttp}
+
+// StateBackendConfig state backend 配置，不同类型的 backend 使用不同的字段。
+// 认证信息(secretKey、password 等)加密保存
+type StateBackendConfig struct {
+	// consul
+	Address string `json:"address,omitempty"` // consul 地址，为空时使用 runner 配置的 consul；http backend 的 state 地址，为空时使用 portal 提供的 http backend
+	Scheme  string `json:"scheme,omitempty"`
+
+	// s3
+	Bucket         string `json:"bucket,omitempty"`
+	Region         string `json:"region,omitempty"`
+	Endpoint       string `json:"endpoint,omitempty"` // 使用 minio 等 s3 兼容存储时需要设置
+	ForcePathStyle bool   `json:"forcePathStyle,omitempty"`
+	AccessKey      string `json:"accessKey,omitempty"`
+	SecretKey      string `json:"secretKey,omitempty"`
+
+	// http
+	LockAddress   string `json:"lockAddress,omitempty"`
+	UnlockAddress string `json:"unlockAddress,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+}
+
+func (v StateBackendConfig) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *StateBackendConfig) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// StateBackend terraform state 存储配置。
+// 可以在组织、项目或者云模板级别设置，创建环境时按 云模板 > 项目 > 组织 的优先级选择，
+// 都未设置时使用 consul。环境创建后 backend 不再变化
+type StateBackend struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null;default:''"` // 项目ID，为空表示组织级别配置
+	TplId     Id `json:"tplId" gorm:"size:32;not null;default:''"`     // 云模板ID，为空表示组织或项目级别配置
+
+	Name        string             `json:"name" gorm:"not null"`
+	Type        string             `json:"type" gorm:"type:enum('consul','s3','local','http');not null" enums:"'consul','s3','local','http'"`
+	Config      StateBackendConfig `json:"config" gorm:"type:json"`
+	Description string             `json:"description" gorm:"type:text"`
+	CreatorId   Id                 `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (StateBackend) TableName() string {
+	return "iac_state_backend"
+}
+
+func (b StateBackend) Migrate(sess *db.Session) (err error) {
+	// 每个作用域只能有一个 backend 配置
+	if err = b.AddUniqueIndex(sess, "unique__org__project__tpl", "org_id", "project_id", "tpl_id"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate 检查 backend 类型及必需的配置项
+func (b *StateBackend) Validate() error {
+	c := b.Config
+	switch b.Type {
+	case StateBackendConsul, StateBackendLocal:
+	case StateBackendS3:
+		if c.Bucket == "" || c.Region == "" {
+			return fmt.Errorf("s3 backend requires bucket and region")
+		}
+		if (c.AccessKey == "") != (c.SecretKey == "") {
+			return fmt.Errorf("s3 backend requires both accessKey and secretKey")
+		}
+	case StateBackendHttp:
+		if (c.LockAddress == "") != (c.UnlockAddress == "") {
+			return fmt.Errorf("http backend requires both lockAddress and unlockAddress")
+		}
+	default:
+		return fmt.Errorf("unsupported state backend type '%s'", b.Type)
+	}
+	return nil
+}
+
+// StateLock portal 提供的 http state backend 的锁信息
+type StateLock struct {
+	AbstractModel
+
+	Path      string `json:"path" gorm:"primary_key;size:255"` // state 路径
+	LockId    string `json:"lockId" gorm:"size:64;not null"`
+	Info      string `json:"info" gorm:"type:text"` // terraform 提交的锁信息(json)
+	CreatedAt Time   `json:"createdAt" gorm:"type:datetime"`
+}
+
+func (StateLock) TableName() string {
+	return "iac_state_lock"
+}
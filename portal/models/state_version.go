@@ -0,0 +1,25 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+// StateVersion 环境的 terraform state 历史版本，每次部署类任务执行结束后采集一份
+type StateVersion struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null;index"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"` // 产生该版本的任务
+
+	Serial           int    `json:"serial" gorm:"default:0"` // state 中的 serial
+	Lineage          string `json:"lineage" gorm:"size:64;default:''"`
+	TerraformVersion string `json:"terraformVersion" gorm:"size:32;default:''"`
+	Size             int    `json:"size" gorm:"default:0"`          // state 文件大小(字节)
+	Md5              string `json:"md5" gorm:"size:32;default:''"`  // state 内容 md5
+	Path             string `json:"-" gorm:"not null"`              // state 文件保存路径
+	ResourceCount    int    `json:"resourceCount" gorm:"default:0"` // state 中的资源数量
+}
+
+func (StateVersion) TableName() string {
+	return "iac_state_version"
+}
@@ -7,8 +7,10 @@ import (
 )
 
 const (
-	SysCfgNameMaxJobsPerRunner = "MAX_JOBS_PER_RUNNER"
-	SysCfgNamePeriodOfLogSave  = "PERIOD_OF_LOG_SAVE"
+	SysCfgNameMaxJobsPerRunner   = "MAX_JOBS_PER_RUNNER"
+	SysCfgNamePeriodOfLogSave    = "PERIOD_OF_LOG_SAVE"
+	SysCfgNameMaxTasksPerOrg     = "MAX_TASKS_PER_ORG"     // 每个组织并发执行的任务数量限制，0 表示不限制
+	SysCfgNameMaxTasksPerProject = "MAX_TASKS_PER_PROJECT" // 每个项目并发执行的任务数量限制，0 表示不限制
 )
 
 type SystemCfg struct {
@@ -10,6 +10,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"path"
+	"strings"
 )
 
 type TaskVariables []VariableBody
@@ -28,6 +29,43 @@ type TaskResult struct {
 	ResDestroyed *int `json:"resDestroyed"`
 
 	Outputs map[string]interface{} `json:"outputs"`
+
+	Imports []TaskImportResult `json:"imports,omitempty"` // import 任务每个资源的导入结果
+
+	Cost *TaskCost `json:"cost,omitempty"` // 基于组织价格目录估算的月费用，未配置价格时为 nil
+}
+
+// TaskCost plan 变更前后的月费用估算
+type TaskCost struct {
+	MonthlyBefore float64 `json:"monthlyBefore"` // 变更前的月费用
+	MonthlyAfter  float64 `json:"monthlyAfter"`  // 变更后的月费用
+	MonthlyDelta  float64 `json:"monthlyDelta"`  // 月费用变化，为负数表示费用减少
+
+	Unpriced        int            `json:"unpriced"`        // 没有价格配置的资源数量，这些资源不计入费用
+	UnpricedChanges int            `json:"unpricedChanges"` // 没有价格配置且可能增加费用(新建、修改或替换)的资源数量
+	Resources       []ResourceCost `json:"resources"`       // 有价格配置的资源的费用
+}
+
+// Summary 返回费用估算的可读文本，如 "100.00 -> 150.00 (+50.00)"，cost 为 nil 时返回空字符串
+func (c *TaskCost) Summary() string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f -> %.2f (%+.2f)", c.MonthlyBefore, c.MonthlyAfter, c.MonthlyDelta)
+}
+
+type ResourceCost struct {
+	Address       string  `json:"address"`
+	Type          string  `json:"type"`
+	Action        string  `json:"action,omitempty"` // 资源的变更类型，无变更时为空
+	MonthlyBefore float64 `json:"monthlyBefore"`
+	MonthlyAfter  float64 `json:"monthlyAfter"`
+}
+
+type TaskImportResult struct {
+	TaskImportItem
+	Success  bool `json:"success"`  // 是否导入成功
+	ExitCode int  `json:"exitCode"` // terraform import 退出码，步骤未执行到该资源时为 -1
 }
 
 func (v TaskResult) Value() (driver.Value, error) {
@@ -41,6 +79,49 @@ func (v *TaskResult) Scan(value interface{}) error {
 type TaskExtra struct {
 	Source       string `json:"source,omitempty"`
 	TransitionId string `json:"transitionId,omitempty"`
+
+	StateVersionId Id     `json:"stateVersionId,omitempty"` // state 恢复任务要恢复的版本
+	LockId         string `json:"lockId,omitempty"`         // state 解锁任务要释放的锁 ID
+
+	Imports  []TaskImportItem  `json:"imports,omitempty"`  // import 任务要导入的资源列表
+	StateOps []TaskStateOpItem `json:"stateOps,omitempty"` // state 操作任务要执行的操作列表
+}
+
+// 任务调度优先级，值越大越先执行
+const (
+	TaskPriorityLow    = 10 // 定时 plan、漂移检测及合规扫描任务
+	TaskPriorityNormal = 20
+	TaskPriorityHigh   = 30 // destroy 及 state 解锁任务
+)
+
+const (
+	StateOpMove    = "mv"      // terraform state mv
+	StateOpRemove  = "rm"      // terraform state rm
+	StateOpReplace = "replace" // terraform taint，下次部署时重建资源
+)
+
+type TaskStateOpItem struct {
+	Op          string `json:"op" form:"op" enums:"mv,rm,replace"`       // 操作类型
+	Address     string `json:"address" form:"address"`                   // 资源地址
+	Destination string `json:"destination,omitempty" form:"destination"` // mv 操作的目标地址
+}
+
+func (o TaskStateOpItem) Validate() error {
+	if !utils.StrInArray(o.Op, StateOpMove, StateOpRemove, StateOpReplace) {
+		return fmt.Errorf("unknown state operation '%s'", o.Op)
+	}
+	if strings.TrimSpace(o.Address) == "" {
+		return fmt.Errorf("address is required")
+	}
+	if o.Op == StateOpMove && strings.TrimSpace(o.Destination) == "" {
+		return fmt.Errorf("destination is required for mv operation")
+	}
+	return nil
+}
+
+type TaskImportItem struct {
+	Address string `json:"address" form:"address"` // 资源在 terraform 配置中的地址，如 aws_instance.web
+	Id      string `json:"id" form:"id"`           // 资源在云平台中的 ID
 }
 
 func (v TaskExtra) Value() (driver.Value, error) {
@@ -56,6 +137,11 @@ const (
 	TaskTypeApply   = common.TaskTypeApply
 	TaskTypeDestroy = common.TaskTypeDestroy
 	TaskTypeScan    = common.TaskTypeScan
+	TaskTypeDrift   = common.TaskTypeDrift
+	TaskTypeRestore = common.TaskTypeRestore
+	TaskTypeUnlock  = common.TaskTypeUnlock
+	TaskTypeImport  = common.TaskTypeImport
+	TaskTypeStateOp = common.TaskTypeStateOp
 	TaskTypeParse   = common.TaskTypeParse
 
 	TaskPending   = common.TaskPending
@@ -64,6 +150,7 @@ const (
 	TaskRejected  = common.TaskRejected
 	TaskFailed    = common.TaskFailed
 	TaskComplete  = common.TaskComplete
+	TaskCancelled = common.TaskCancelled
 )
 
 type Tasker interface {
@@ -102,9 +189,17 @@ type Task struct {
 	PlayVarsFile string   `json:"playVarsFile" gorm:"default:''"`
 	Targets      StrSlice `json:"targets" gorm:"type:json"` // 指定 terraform target 参数
 
+	Image string `json:"image" gorm:"default:''"` // 任务镜像，创建任务时从环境或模板确定，为空表示使用 runner 默认镜像
+
 	Variables TaskVariables `json:"variables" gorm:"type:json"` // 本次执行使用的所有变量(继承、覆盖计算之后的)
 
 	StatePath string `json:"statePath" gorm:"not null"`
+	// 任务使用的 state backend，创建任务时从环境复制
+	StateBackendId Id `json:"stateBackendId" gorm:"size:32;not null;default:''"`
+
+	// 部署通道标签选择器，不为空时由 task manager 在执行时选择匹配标签的 runner，
+	// runner 不可用时首个步骤会切换到其他匹配的 runner 执行
+	RunnerTags StrSlice `json:"runnerTags" gorm:"type:json"`
 
 	// 扩展属性，包括 source, transitionId 等
 	Extra TaskExtra `json:"extra" gorm:"type:json"` // 扩展属性
@@ -119,6 +214,13 @@ type Task struct {
 	RetryNumber int  `json:"retryNumber" gorm:"size:32;default:0"` // 任务重试次数
 	RetryDelay  int  `json:"retryDelay" gorm:"size:32;default:0"`  // 每次任务重试时间，单位为秒
 	RetryAble   bool `json:"retryAble" gorm:"default:false"`
+
+	// 执行中的任务被取消时先设置取消标识，由 task manager 停止步骤执行后再更新任务状态
+	CancelRequested bool `json:"cancelRequested" gorm:"default:false"`
+	CancelerId      Id   `json:"cancelerId" gorm:"size:32;default:''"` // 取消任务的用户 ID
+
+	// 失败的任务可以从失败步骤恢复执行，恢复记录见 TaskResume
+	ResumeCount int `json:"resumeCount" gorm:"default:0"` // 恢复执行次数
 }
 
 func (Task) TableName() string {
@@ -151,20 +253,24 @@ func (t *BaseTask) Started() bool {
 
 func (BaseTask) IsStartedStatus(status string) bool {
 	// 注意：approving 状态的任务我们也认为其 started
-	return !utils.InArrayStr([]string{TaskPending}, status)
+	// cancelled 状态可能由 pending 直接转换而来，不认为其 started (已开始执行的任务 StartAt 已被设置)
+	return !utils.InArrayStr([]string{TaskPending, TaskCancelled}, status)
 }
 
 func (BaseTask) IsExitedStatus(status string) bool {
-	return utils.InArrayStr([]string{TaskFailed, TaskRejected, TaskComplete}, status)
+	return utils.InArrayStr([]string{TaskFailed, TaskRejected, TaskComplete, TaskCancelled}, status)
 }
 
 func (t *BaseTask) IsEffectTask() bool {
 	return t.IsEffectTaskType(t.Type)
 }
 
+// EffectTaskTypes 产生实际数据变动的任务类型
+var EffectTaskTypes = []string{TaskTypeApply, TaskTypeDestroy, TaskTypeRestore, TaskTypeImport, TaskTypeStateOp}
+
 // IsEffectTaskType 是否产生实际数据变动的任务类型
 func (BaseTask) IsEffectTaskType(typ string) bool {
-	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy)
+	return utils.StrInArray(typ, EffectTaskTypes...)
 }
 
 func (BaseTask) GetTaskNameByType(typ string) string {
@@ -177,6 +283,16 @@ func (BaseTask) GetTaskNameByType(typ string) string {
 		return common.TaskTypeDestroyName
 	case TaskTypeScan:
 		return common.TaskTypeScanName
+	case TaskTypeDrift:
+		return common.TaskTypeDriftName
+	case TaskTypeRestore:
+		return common.TaskTypeRestoreName
+	case TaskTypeUnlock:
+		return common.TaskTypeUnlockName
+	case TaskTypeImport:
+		return common.TaskTypeImportName
+	case TaskTypeStateOp:
+		return common.TaskTypeStateOpName
 	case TaskTypeParse:
 		return common.TaskTypeParse
 	default:
@@ -187,6 +303,10 @@ func (t *Task) StateJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFStateJsonFile)
 }
 
+func (t *Task) TfStatePath() string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFStateFile)
+}
+
 func (t *Task) ProviderSchemaJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFProviderSchema)
 }
@@ -203,6 +323,14 @@ func (t *Task) TfResultJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TerrascanResultFile)
 }
 
+func (t *Task) TfStateBackupPath() string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFStateBackupFile)
+}
+
+func (t *Task) TfImportResultPath() string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFImportResultFile)
+}
+
 func (t *Task) HideSensitiveVariable() {
 	for index, v := range t.Variables {
 		if v.Sensitive {
@@ -219,22 +347,26 @@ func (t *Task) Migrate(sess *db.Session) (err error) {
 }
 
 type TaskStepBody struct {
-	Type string   `json:"type" yaml:"type" gorm:"type:enum('init','plan','apply','play','command','destroy','scaninit','tfscan','tfparse','scan')"`
+	Type string   `json:"type" yaml:"type" gorm:"type:enum('init','plan','apply','play','command','destroy','scaninit','tfscan','tfparse','scan','statepush','unlock','import','stateop')"`
 	Name string   `json:"name,omitempty" yaml:"name" gorm:"size:32;not null"`
 	Args StrSlice `json:"args,omitempty" yaml:"args" gorm:"type:text"`
 }
 
 const (
-	TaskStepInit     = common.TaskStepInit
-	TaskStepPlan     = common.TaskStepPlan
-	TaskStepApply    = common.TaskStepApply
-	TaskStepDestroy  = common.TaskStepDestroy
-	TaskStepPlay     = common.TaskStepPlay
-	TaskStepCommand  = common.TaskStepCommand
-	TaskStepCollect  = common.TaskStepCollect
-	TaskStepTfParse  = common.TaskStepTfParse
-	TaskStepTfScan   = common.TaskStepTfScan
-	TaskStepScanInit = common.TaskStepScanInit
+	TaskStepInit      = common.TaskStepInit
+	TaskStepPlan      = common.TaskStepPlan
+	TaskStepApply     = common.TaskStepApply
+	TaskStepDestroy   = common.TaskStepDestroy
+	TaskStepPlay      = common.TaskStepPlay
+	TaskStepCommand   = common.TaskStepCommand
+	TaskStepCollect   = common.TaskStepCollect
+	TaskStepTfParse   = common.TaskStepTfParse
+	TaskStepTfScan    = common.TaskStepTfScan
+	TaskStepScanInit  = common.TaskStepScanInit
+	TaskStepStatePush = common.TaskStepStatePush
+	TaskStepUnlock    = common.TaskStepUnlock
+	TaskStepImport    = common.TaskStepImport
+	TaskStepStateOp   = common.TaskStepStateOp
 
 	TaskStepPending   = common.TaskStepPending
 	TaskStepApproving = common.TaskStepApproving
@@ -243,6 +375,7 @@ const (
 	TaskStepFailed    = common.TaskStepFailed
 	TaskStepComplete  = common.TaskStepComplete
 	TaskStepTimeout   = common.TaskStepTimeout
+	TaskStepCancelled = common.TaskStepCancelled
 )
 
 type TaskStep struct {
@@ -255,7 +388,7 @@ type TaskStep struct {
 	TaskId    Id     `json:"taskId" gorm:"size:32;not null"`
 	NextStep  Id     `json:"nextStep" gorm:"size:32;default:''"`
 	Index     int    `json:"index" gorm:"size:32;not null"`
-	Status    string `json:"status" gorm:"type:enum('pending','approving','rejected','running','failed','complete','timeout')"`
+	Status    string `json:"status" gorm:"type:enum('pending','approving','rejected','running','failed','complete','timeout','cancelled')"`
 	ExitCode  int    `json:"exitCode" gorm:"default:0"` // 执行退出码，status 为 failed 时才有意义
 	Message   string `json:"message" gorm:"type:text"`
 	StartAt   *Time  `json:"startAt" gorm:"type:datetime"`
@@ -277,23 +410,27 @@ func (t *TaskStep) Migrate(sess *db.Session) (err error) {
 	if err := sess.ModifyModelColumn(t, "type"); err != nil {
 		return err
 	}
+	if err := sess.ModifyModelColumn(t, "status"); err != nil {
+		return err
+	}
 	return nil
 }
 
 func (s *TaskStep) IsStarted() bool {
-	return !utils.StrInArray(s.Status, TaskStepPending, TaskStepApproving)
+	return !utils.StrInArray(s.Status, TaskStepPending, TaskStepApproving, TaskStepCancelled)
 }
 
 func (s *TaskStep) IsExited() bool {
-	return utils.StrInArray(s.Status, TaskStepRejected, TaskStepComplete, TaskStepFailed, TaskStepTimeout)
+	return utils.StrInArray(s.Status, TaskStepRejected, TaskStepComplete, TaskStepFailed, TaskStepTimeout,
+		TaskStepCancelled)
 }
 
 func (s *TaskStep) IsApproved() bool {
 	if s.Status == TaskStepRejected {
 		return false
 	}
-	// 只有 apply 和 destroy 步骤需要审批
-	if utils.StrInArray(s.Type, TaskStepApply, TaskStepDestroy) && len(s.ApproverId) == 0 {
+	// 只有 apply、destroy、import 和 stateop 步骤需要审批
+	if utils.StrInArray(s.Type, TaskStepApply, TaskStepDestroy, TaskStepImport, TaskStepStateOp) && len(s.ApproverId) == 0 {
 		return false
 	}
 	return true
@@ -303,6 +440,15 @@ func (s *TaskStep) IsRejected() bool {
 	return s.Status == TaskStepRejected
 }
 
+func (s *TaskStep) IsCancelled() bool {
+	return s.Status == TaskStepCancelled
+}
+
+// EventsPath 步骤 terraform 事件的保存路径
+func (s *TaskStep) EventsPath() string {
+	return path.Join(path.Dir(s.LogPath), runner.TaskStepEventsName)
+}
+
 func (s *TaskStep) GenLogPath() string {
 	return path.Join(
 		s.ProjectId.String(),
@@ -5,6 +5,7 @@ package models
 import (
 	"bytes"
 	"cloudiac/common"
+	"cloudiac/utils"
 	"database/sql/driver"
 	"fmt"
 	"gopkg.in/yaml.v2"
@@ -17,6 +18,11 @@ type TaskFlows struct {
 	Destroy TaskFlow `json:"destroy" yaml:"destroy"`
 	Scan    TaskFlow `json:"scan" yaml:"scan"`
 	Parse   TaskFlow `json:"parse" yaml:"parse"`
+	Drift   TaskFlow `json:"drift" yaml:"drift"`
+	Restore TaskFlow `json:"restore" yaml:"restore"`
+	Unlock  TaskFlow `json:"unlock" yaml:"unlock"`
+	Import  TaskFlow `json:"import" yaml:"import"`
+	StateOp TaskFlow `json:"stateop" yaml:"stateop"`
 }
 
 type TaskFlow struct {
@@ -51,6 +57,31 @@ destroy:
     - type: plan
       args: ["-destroy"]
     - type: destroy
+
+drift:
+  steps:
+    - type: init
+    - type: plan
+
+restore:
+  steps:
+    - type: init
+    - type: statepush
+
+unlock:
+  steps:
+    - type: init
+    - type: unlock
+
+import:
+  steps:
+    - type: init
+    - type: import
+
+stateop:
+  steps:
+    - type: init
+    - type: stateop
 `
 
 const taskFlowsWithScanContent = `
@@ -85,6 +116,31 @@ parse:
   steps:
     - type: scaninit
     - type: tfparse
+
+drift:
+  steps:
+    - type: init
+    - type: plan
+
+restore:
+  steps:
+    - type: init
+    - type: statepush
+
+unlock:
+  steps:
+    - type: init
+    - type: unlock
+
+import:
+  steps:
+    - type: init
+    - type: import
+
+stateop:
+  steps:
+    - type: init
+    - type: stateop
 `
 
 const defaultTaskFlowsContent = taskFlowsWithScanContent
@@ -103,6 +159,16 @@ func GetTaskFlow(flows *TaskFlows, typ string) (TaskFlow, error) {
 		return flows.Scan, nil
 	case common.TaskTypeParse:
 		return flows.Parse, nil
+	case common.TaskTypeDrift:
+		return flows.Drift, nil
+	case common.TaskTypeRestore:
+		return flows.Restore, nil
+	case common.TaskTypeUnlock:
+		return flows.Unlock, nil
+	case common.TaskTypeImport:
+		return flows.Import, nil
+	case common.TaskTypeStateOp:
+		return flows.StateOp, nil
 	default:
 		return TaskFlow{}, fmt.Errorf("unknown task type: %v", typ)
 	}
@@ -116,6 +182,81 @@ func DefaultTaskFlows(version string) TaskFlows {
 	return defaultTaskFlows
 }
 
+// 任务流程文件支持的版本
+var taskFlowsVersions = []string{"0.1", "0.2"}
+
+// 仓库流程文件中可以定义流程的任务类型，及各类型任务流程中可以使用的步骤类型。
+// plan、drift 任务不需要审批(偏移检测任务自动执行)，不能包含变更资源的步骤
+var taskFlowStepTypes = map[string][]string{
+	common.TaskTypePlan: {common.TaskStepInit, common.TaskStepPlan, common.TaskStepCommand, common.TaskStepTfScan},
+	common.TaskTypeApply: {common.TaskStepInit, common.TaskStepPlan, common.TaskStepApply,
+		common.TaskStepPlay, common.TaskStepCommand, common.TaskStepTfScan},
+	common.TaskTypeDestroy: {common.TaskStepInit, common.TaskStepPlan, common.TaskStepDestroy,
+		common.TaskStepPlay, common.TaskStepCommand, common.TaskStepTfScan},
+	common.TaskTypeDrift: {common.TaskStepInit, common.TaskStepPlan, common.TaskStepCommand, common.TaskStepTfScan},
+}
+
+// 部署和销毁流程必须包含的步骤，否则无法正确更新环境状态
+var taskFlowRequiredSteps = map[string]string{
+	common.TaskTypePlan:    common.TaskStepPlan,
+	common.TaskTypeApply:   common.TaskStepApply,
+	common.TaskTypeDestroy: common.TaskStepDestroy,
+	common.TaskTypeDrift:   common.TaskStepPlan,
+}
+
+// IsCustomizableTaskFlow 任务类型是否可以使用仓库中定义的流程，
+// 其他类型的任务(如 restore、unlock 等内部任务)总是使用默认流程
+func IsCustomizableTaskFlow(typ string) bool {
+	_, ok := taskFlowStepTypes[typ]
+	return ok
+}
+
+// ParseTaskFlows 解析并校验仓库中定义的任务流程文件
+func ParseTaskFlows(content []byte) (*TaskFlows, error) {
+	flows := TaskFlows{}
+	if err := yaml.Unmarshal(content, &flows); err != nil {
+		return nil, fmt.Errorf("decode task flows: %v", err)
+	}
+	if err := flows.Validate(); err != nil {
+		return nil, err
+	}
+	return &flows, nil
+}
+
+// Validate 校验任务流程，未定义的任务类型(steps 为空)及不能自定义流程的任务类型使用默认流程，不做校验
+func (f *TaskFlows) Validate() error {
+	if f.Version != "" && !utils.StrInArray(f.Version, taskFlowsVersions...) {
+		return fmt.Errorf("unsupported task flows version '%s'", f.Version)
+	}
+
+	for _, typ := range []string{common.TaskTypePlan, common.TaskTypeApply, common.TaskTypeDestroy, common.TaskTypeDrift} {
+		flow, _ := GetTaskFlow(f, typ)
+		if len(flow.Steps) == 0 {
+			continue
+		}
+
+		found := false
+		for i, step := range flow.Steps {
+			if !utils.StrInArray(step.Type, taskFlowStepTypes[typ]...) {
+				return fmt.Errorf("%s: step type '%s' is not allowed at step %d", typ, step.Type, i)
+			}
+			if len(step.Name) > 32 {
+				return fmt.Errorf("%s: step %d name is too long", typ, i)
+			}
+			if step.Type == common.TaskStepCommand && len(step.Args) == 0 {
+				return fmt.Errorf("%s: command step %d has no commands", typ, i)
+			}
+			if step.Type == taskFlowRequiredSteps[typ] {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: missing '%s' step", typ, taskFlowRequiredSteps[typ])
+		}
+	}
+	return nil
+}
+
 func decodeTaskFlow(taskFlowContent string) TaskFlows {
 	taskFlows := TaskFlows{}
 	buffer := bytes.NewBufferString(taskFlowContent)
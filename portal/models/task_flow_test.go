@@ -0,0 +1,50 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+import (
+	"cloudiac/common"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTaskFlows(t *testing.T) {
+	flows, err := ParseTaskFlows([]byte(`
+version: 0.2
+apply:
+  steps:
+    - type: init
+    - type: command
+      name: tflint
+      args: ["tflint"]
+    - type: plan
+    - type: apply
+    - type: command
+      name: smoke test
+      args: ["./smoke-test.sh"]
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, flows.Apply.Steps, 5)
+	assert.Len(t, flows.Plan.Steps, 0)
+	assert.True(t, IsCustomizableTaskFlow(common.TaskTypeDrift))
+	assert.False(t, IsCustomizableTaskFlow(common.TaskTypeRestore))
+
+	cases := []string{
+		"version: 9.9\n",
+		"plan:\n  steps:\n    - type: unknown\n",
+		"plan:\n  steps:\n    - type: init\n",
+		"apply:\n  steps:\n    - type: plan\n    - type: command\n    - type: apply\n",
+		"apply: [",
+		// plan、drift 流程不能包含变更资源的步骤
+		"plan:\n  steps:\n    - type: plan\n    - type: apply\n",
+		"drift:\n  steps:\n    - type: plan\n    - type: destroy\n",
+		"drift:\n  steps:\n    - type: plan\n    - type: statepush\n",
+	}
+	for _, c := range cases {
+		_, err := ParseTaskFlows([]byte(c))
+		assert.Error(t, err, c)
+	}
+}
@@ -11,7 +11,7 @@ type DBStorage struct {
 
 	Id        uint   `gorm:"primary_key" json:"-"`
 	Path      string `gorm:"NOT NULL;UNIQUE"`
-	Content   []byte `gorm:"type:MEDIUMBLOB"` // MEDIUMBLOB 支持最大长度约 16M
+	Content   []byte `gorm:"type:LONGBLOB"` // 单条内容大小受 mysql max_allowed_packet 限制，任务日志超长时会被截断，大量日志建议使用 fs 或 s3 存储
 	CreatedAt Time   `gorm:"type:datetime"`
 }
 
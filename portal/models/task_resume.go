@@ -0,0 +1,16 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package models
+
+// TaskResume 失败任务的恢复执行记录
+type TaskResume struct {
+	TimedModel
+	TaskId   Id     `json:"taskId" gorm:"size:32;not null;index"` // 任务ID
+	UserId   Id     `json:"userId" gorm:"size:32;not null"`       // 发起恢复执行的用户ID
+	FromStep int    `json:"fromStep" gorm:"not null"`             // 从该步骤开始重新执行
+	Message  string `json:"message" gorm:"type:text"`             // 恢复前任务的失败信息
+}
+
+func (TaskResume) TableName() string {
+	return "iac_task_resume"
+}
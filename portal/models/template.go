@@ -34,6 +34,20 @@ type Template struct {
 	LastScanTaskId Id `json:"lastScanTaskId" gorm:"size:32"` // 最后一次策略扫描任务 id
 
 	TfVersion string `json:"tfVersion" gorm:"default:''"` // 模版使用的terraform版本号
+
+	// 部署通道标签选择器，环境未设置部署通道标签时使用
+	RunnerTags StrSlice `json:"runnerTags" gorm:"type:json"`
+
+	// 仓库中定义任务流程的文件(基于仓库根目录的相对路径)，为空或文件不存在时使用默认流程
+	FlowFile string `json:"flowFile" gorm:"default:''" example:".cloudiac-flow.yml"`
+
+	// 任务镜像，为空时使用 runner 默认镜像，需要在组织允许的任务镜像列表中
+	Image string `json:"image" gorm:"default:''" example:"registry.example.com/iac/worker-k8s:latest"`
+
+	// 任务容器资源限制，为 0 时使用 runner 的默认配置，runner 会将其限制在 runner 配置的上限内
+	ContainerCpus   float64 `json:"containerCpus" gorm:"default:0"`   // cpu 核数
+	ContainerMemory int64   `json:"containerMemory" gorm:"default:0"` // 内存(MB)
+	ContainerPids   int64   `json:"containerPids" gorm:"default:0"`   // 最大进程数
 }
 
 func (Template) TableName() string {
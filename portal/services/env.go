@@ -6,6 +6,7 @@ import (
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
+	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"fmt"
 	"time"
@@ -24,6 +25,14 @@ func CreateEnv(tx *db.Session, env models.Env) (*models.Env, e.Error) {
 	if env.StatePath == "" {
 		env.StatePath = env.DefaultStatPath()
 	}
+	if env.StateBackendId == "" {
+		backend, err := ResolveStateBackend(tx, env.OrgId, env.ProjectId, env.TplId)
+		if err != nil {
+			return nil, err
+		} else if backend != nil {
+			env.StateBackendId = backend.Id
+		}
+	}
 	if err := models.Create(tx, &env); err != nil {
 		if e.IsDuplicate(err) {
 			return nil, e.New(e.EnvAlreadyExists, err)
@@ -134,10 +143,24 @@ func ChangeEnvStatusWithTaskAndStep(tx *db.Session, id models.Id, task *models.T
 		case models.TaskRejected:
 			// 任务驳回，环境状态不变
 			break
+		case models.TaskCancelled:
+			if task.StartAt == nil {
+				// 任务在 pending 状态被取消，未进行过部署，不修改环境状态
+				return nil
+			}
+			// 资源变更步骤执行过程中被取消时资源可能只完成了部分变更，环境置为失败状态；
+			// 其他步骤被取消则环境状态不变
+			if step != nil && step.StartAt != nil &&
+				utils.StrInArray(step.Type, models.TaskStepApply, models.TaskStepDestroy, models.TaskStepPlay) {
+				envStatus = models.EnvStatusFailed
+			}
 		case models.TaskFailed:
-			envStatus = models.EnvStatusFailed
+			// state 写入、资源导入或 state 操作失败时不会修改实际资源，环境状态不变
+			if !utils.StrInArray(task.Type, models.TaskTypeRestore, models.TaskTypeImport, models.TaskTypeStateOp) {
+				envStatus = models.EnvStatusFailed
+			}
 		case models.TaskComplete:
-			if task.Type == models.TaskTypeApply {
+			if task.Type == models.TaskTypeApply || task.Type == models.TaskTypeImport {
 				envStatus = models.EnvStatusActive
 			} else if task.Type == models.TaskTypeDestroy {
 				envStatus = models.EnvStatusInactive
@@ -0,0 +1,260 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/notificationrc"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+)
+
+const driftSensitiveValue = "(sensitive value)"
+
+// terraform 从 0.15.4 版本开始在 plan json 中输出 resource_drift
+var tfResourceDriftVersion = semver.MustParse("0.15.4")
+
+// CreateDriftTask 为环境创建漂移检测任务，任务只执行 init 和 plan，不会修改资源
+func CreateDriftTask(tx *db.Session, env *models.Env, creatorId models.Id, source string) (*models.Task, e.Error) {
+	tpl, err := GetTemplateById(tx, env.TplId)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.Status == models.Disable {
+		return nil, e.New(e.TemplateDisabled)
+	}
+
+	vars, err, _ := GetValidVariables(tx, consts.ScopeEnv, env.OrgId, env.ProjectId, env.TplId, env.Id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := CreateTask(tx, tpl, env, models.Task{
+		Name:        models.Task{}.GetTaskNameByType(models.TaskTypeDrift),
+		CreatorId:   creatorId,
+		KeyId:       env.KeyId,
+		Variables:   GetVariableBody(vars),
+		AutoApprove: true,
+		Revision:    env.Revision,
+		Extra:       models.TaskExtra{Source: source},
+		BaseTask: models.BaseTask{
+			Type:        models.TaskTypeDrift,
+			Flow:        models.TaskFlow{},
+			StepTimeout: env.Timeout,
+			RunnerId:    env.RunnerId,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := models.Time(time.Now())
+	if _, err := UpdateEnv(tx, env.Id, models.Attrs{
+		"drift_checked_at":   &now,
+		"last_drift_task_id": task.Id,
+	}); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// GetTfPlanDrift 获取 plan 中 state 与实际资源存在差异的资源。
+// terraform 0.15.4 之前的版本不输出 resource_drift，使用 resource_changes 中有变更的资源代替
+func GetTfPlanDrift(plan *TfPlan) []TfPlanResource {
+	if v, err := semver.NewVersion(plan.TerraformVersion); err == nil && !v.LessThan(tfResourceDriftVersion) {
+		return plan.ResourceDrift
+	}
+
+	rs := make([]TfPlanResource, 0)
+	for _, r := range plan.ResourceChanges {
+		if r.Mode != "managed" {
+			continue
+		}
+		if len(r.Change.Actions) == 0 || (len(r.Change.Actions) == 1 && r.Change.Actions[0] == "no-op") {
+			continue
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// isSensitiveAttr 判断 before_sensitive/after_sensitive 中的属性是否为敏感值
+func isSensitiveAttr(sensitive interface{}, key string) bool {
+	if b, ok := sensitive.(bool); ok {
+		return b
+	}
+	if m, ok := sensitive.(map[string]interface{}); ok {
+		// 嵌套结构中存在敏感值时整体隐藏
+		return hasSensitiveValue(m[key])
+	}
+	return false
+}
+
+func hasSensitiveValue(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case map[string]interface{}:
+		for _, sv := range val {
+			if hasSensitiveValue(sv) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, sv := range val {
+			if hasSensitiveValue(sv) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetDriftAttrs 对比资源的 before 和 after 得到发生漂移的属性，敏感值会被隐藏
+func GetDriftAttrs(change TfPlanResourceChange) models.DriftAttrs {
+	before, _ := change.Before.(map[string]interface{})
+	after, _ := change.After.(map[string]interface{})
+
+	keys := make([]string, 0)
+	keySet := make(map[string]struct{})
+	for _, m := range []map[string]interface{}{before, after} {
+		for k := range m {
+			if _, ok := keySet[k]; !ok {
+				keySet[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	attrs := models.DriftAttrs{}
+	for _, k := range keys {
+		b, a := before[k], after[k]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		if isSensitiveAttr(change.BeforeSensitive, k) {
+			b = driftSensitiveValue
+		}
+		if isSensitiveAttr(change.AfterSensitive, k) {
+			a = driftSensitiveValue
+		}
+		attrs[k] = models.DriftAttr{Before: b, After: a}
+	}
+	return attrs
+}
+
+func driftAction(actions []string) string {
+	for _, a := range actions {
+		if a == "delete" || a == "create" {
+			return a
+		}
+	}
+	if len(actions) > 0 {
+		return actions[0]
+	}
+	return ""
+}
+
+// SaveEnvDrift 保存漂移检测结果并更新环境的漂移状态，返回发生漂移的资源
+func SaveEnvDrift(tx *db.Session, task *models.Task, plan *TfPlan) ([]*models.ResourceDrift, e.Error) {
+	drifts := make([]*models.ResourceDrift, 0)
+	for _, r := range GetTfPlanDrift(plan) {
+		drifts = append(drifts, &models.ResourceDrift{
+			OrgId:     task.OrgId,
+			ProjectId: task.ProjectId,
+			EnvId:     task.EnvId,
+			TaskId:    task.Id,
+			Address:   r.Address,
+			Mode:      r.Mode,
+			Type:      r.Type,
+			Name:      r.Name,
+			Index:     planResourceIndex(r),
+			Action:    driftAction(r.Change.Actions),
+			Changes:   GetDriftAttrs(r.Change),
+		})
+	}
+
+	if _, err := tx.Where("task_id = ?", task.Id).Delete(&models.ResourceDrift{}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	bq := utils.NewBatchSQL(1024, "INSERT INTO", models.ResourceDrift{}.TableName(),
+		"id", "org_id", "project_id", "env_id", "task_id",
+		"address", "mode", "type", "name", "index", "action", "changes")
+	for _, d := range drifts {
+		d.Id = models.NewId("rd")
+		if err := bq.AddRow(d.Id, d.OrgId, d.ProjectId, d.EnvId, d.TaskId,
+			d.Address, d.Mode, d.Type, d.Name, d.Index, d.Action, d.Changes); err != nil {
+			return nil, e.New(e.InternalError, err)
+		}
+	}
+	for bq.HasNext() {
+		sql, args := bq.Next()
+		if _, err := tx.Exec(sql, args...); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+
+	status := models.EnvDriftStatusNone
+	if len(drifts) > 0 {
+		status = models.EnvDriftStatusDrifted
+	}
+	if err := UpdateEnvDriftStatus(tx, task, status); err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+// UpdateEnvDriftStatus 更新环境漂移状态，只处理环境最近一次的漂移检测任务
+func UpdateEnvDriftStatus(tx *db.Session, task *models.Task, status string) e.Error {
+	now := models.Time(time.Now())
+	if _, err := tx.Model(&models.Env{}).Where("id = ? AND last_drift_task_id = ?", task.EnvId, task.Id).
+		UpdateAttrs(models.Attrs{
+			"drift_status":     status,
+			"drift_checked_at": &now,
+		}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func QueryResourceDrift(query *db.Session, taskId models.Id) *db.Session {
+	return query.Model(&models.ResourceDrift{}).Where("task_id = ?", taskId).Order("address")
+}
+
+// EnvDriftedSendMessage 发送环境资源漂移通知
+func EnvDriftedSendMessage(task *models.Task, drifts []*models.ResourceDrift) {
+	addrs := make([]string, 0, len(drifts))
+	for _, d := range drifts {
+		addrs = append(addrs, d.Address)
+	}
+
+	dbSess := db.Get()
+	env, _ := GetEnv(dbSess, task.EnvId)
+	tpl, _ := GetTemplateById(dbSess, task.TplId)
+	project, _ := GetProjectsById(dbSess, task.ProjectId)
+	org, _ := GetOrganizationById(dbSess, task.OrgId)
+	ns := notificationrc.NewNotificationService(&notificationrc.NotificationOptions{
+		OrgId:     task.OrgId,
+		ProjectId: task.ProjectId,
+		Tpl:       tpl,
+		Project:   project,
+		Org:       org,
+		Env:       env,
+		Task:      task,
+		EventType: consts.EventEnvDrifted,
+		Message:   strings.Join(addrs, ", "),
+	})
+
+	logs.Get().WithField("taskId", task.Id).Infof("new event: %s", ns.EventType)
+	ns.SendMessage()
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDriftPlanJson = `
+{
+    "format_version": "0.2",
+    "terraform_version": "1.0.6",
+    "resource_drift": [
+        {
+            "address": "alicloud_instance.web[\"a\"]",
+            "mode": "managed",
+            "type": "alicloud_instance",
+            "name": "web",
+            "index": "a",
+            "change": {
+                "actions": ["update"],
+                "before": {"instance_name": "web", "password": "old", "tags": {"env": "dev"}},
+                "after": {"instance_name": "web-changed", "password": "new", "tags": {"env": "dev"}},
+                "before_sensitive": {"password": true},
+                "after_sensitive": {"password": true}
+            }
+        }
+    ],
+    "resource_changes": [
+        {
+            "address": "alicloud_vpc.vpc",
+            "mode": "managed",
+            "type": "alicloud_vpc",
+            "name": "vpc",
+            "change": {"actions": ["create"], "before": null, "after": {"cidr_block": "10.0.0.0/8"}}
+        }
+    ]
+}
+`
+
+func TestGetTfPlanDrift(t *testing.T) {
+	plan, err := UnmarshalPlanJson([]byte(testDriftPlanJson))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	drifts := GetTfPlanDrift(plan)
+	if !assert.Len(t, drifts, 1) {
+		return
+	}
+	assert.Equal(t, "a", drifts[0].Index)
+
+	attrs := GetDriftAttrs(drifts[0].Change)
+	assert.Len(t, attrs, 2)
+	assert.Equal(t, "web-changed", attrs["instance_name"].After)
+	assert.Equal(t, driftSensitiveValue, attrs["password"].Before)
+	assert.Equal(t, driftSensitiveValue, attrs["password"].After)
+
+	// 低版本 terraform 不输出 resource_drift，使用 resource_changes 判断
+	plan.TerraformVersion = "0.14.11"
+	drifts = GetTfPlanDrift(plan)
+	if assert.Len(t, drifts, 1) {
+		assert.Equal(t, "alicloud_vpc.vpc", drifts[0].Address)
+	}
+}
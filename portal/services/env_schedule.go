@@ -0,0 +1,131 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/cron"
+	"fmt"
+	"time"
+)
+
+func CreateEnvSchedule(tx *db.Session, schedule models.EnvSchedule) (*models.EnvSchedule, e.Error) {
+	if schedule.Id == "" {
+		schedule.Id = models.NewId("es")
+	}
+	if err := models.Create(tx, &schedule); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &schedule, nil
+}
+
+func UpdateEnvSchedule(tx *db.Session, id models.Id, attrs models.Attrs) (*models.EnvSchedule, e.Error) {
+	schedule := &models.EnvSchedule{}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.EnvSchedule{}, attrs); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvScheduleNotExists)
+		}
+		return nil, e.New(e.DBError, fmt.Errorf("update env schedule error: %v", err))
+	}
+	if err := tx.Where("id = ?", id).First(schedule); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvScheduleNotExists)
+		}
+		return nil, e.New(e.DBError, fmt.Errorf("query env schedule error: %v", err))
+	}
+	return schedule, nil
+}
+
+func DeleteEnvSchedule(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.EnvSchedule{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete env schedule error: %v", err))
+	}
+	if _, err := tx.Where("schedule_id = ?", id).Delete(&models.EnvScheduleRun{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete env schedule runs error: %v", err))
+	}
+	return nil
+}
+
+func QueryEnvSchedule(query *db.Session) *db.Session {
+	return query.Model(&models.EnvSchedule{})
+}
+
+func GetEnvScheduleById(query *db.Session, id models.Id) (*models.EnvSchedule, e.Error) {
+	schedule := models.EnvSchedule{}
+	if err := query.Model(&models.EnvSchedule{}).Where("id = ?", id).First(&schedule); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvScheduleNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &schedule, nil
+}
+
+func QueryEnvScheduleRun(query *db.Session, scheduleId models.Id) *db.Session {
+	return query.Model(&models.EnvScheduleRun{}).Where("schedule_id = ?", scheduleId)
+}
+
+func CreateEnvScheduleRun(tx *db.Session, run models.EnvScheduleRun) (*models.EnvScheduleRun, e.Error) {
+	if run.Id == "" {
+		run.Id = models.NewId("esr")
+	}
+	if err := models.Create(tx, &run); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &run, nil
+}
+
+// EnvScheduleNextRunAt 计算定时任务在 after 之后的下一次执行时间
+func EnvScheduleNextRunAt(cronExpr string, timezone string, after time.Time) (*models.Time, e.Error) {
+	sched, err := cron.Parse(cronExpr)
+	if err != nil {
+		return nil, e.New(e.EnvScheduleInvalidCron, err)
+	}
+
+	loc := time.Local
+	if timezone != "" {
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, e.New(e.EnvScheduleInvalidTimezone, err)
+		}
+	}
+
+	next := sched.Next(after.In(loc))
+	if next.IsZero() {
+		return nil, e.New(e.EnvScheduleInvalidCron, fmt.Errorf("cron '%s' will never run", cronExpr))
+	}
+	t := models.Time(next)
+	return &t, nil
+}
+
+// IsEnvBusy 环境下是否有未结束的任务
+func IsEnvBusy(dbSess *db.Session, envId models.Id) (bool, error) {
+	return dbSess.Model(&models.Task{}).Where("env_id = ? AND status IN (?)", envId, EnvBusyTaskStatus).Exists()
+}
+
+// EnvBusyTaskStatus 环境有这些状态的任务时认为环境正忙
+var EnvBusyTaskStatus = []string{models.TaskPending, models.TaskRunning, models.TaskApproving}
+
+// MergeTaskVariables 使用 overrides 覆盖 vars 中同名同类型的变量
+func MergeTaskVariables(vars []models.VariableBody, overrides []models.VariableBody) []models.VariableBody {
+	key := func(v models.VariableBody) string {
+		return fmt.Sprintf("%s%s", v.Name, v.Type)
+	}
+
+	rs := make([]models.VariableBody, 0, len(vars)+len(overrides))
+	indexes := make(map[string]int)
+	for _, v := range vars {
+		indexes[key(v)] = len(rs)
+		rs = append(rs, v)
+	}
+	for _, v := range overrides {
+		if idx, ok := indexes[key(v)]; ok {
+			rs[idx] = v
+		} else {
+			indexes[key(v)] = len(rs)
+			rs = append(rs, v)
+		}
+	}
+	return rs
+}
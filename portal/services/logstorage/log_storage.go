@@ -3,14 +3,49 @@
 package logstorage
 
 import (
+	"bytes"
+	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/libs/db"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"sync"
+	"time"
 )
 
+const (
+	StorageTypeDB = "db"
+	StorageTypeFS = "fs"
+	StorageTypeS3 = "s3"
+)
+
+// ObjectInfo 存储内容的基本信息
+type ObjectInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Writer 写入的内容在 Close() 成功后才会被保存，写入出错时调用 Abort() 放弃已写入的内容
+type Writer interface {
+	io.WriteCloser
+	Abort() error
+}
+
 type LogStorage interface {
 	Write(path string, content []byte) error
 	Read(path string) ([]byte, error)
+
+	// Writer 返回写入 path 的 Writer
+	Writer(path string) (Writer, error)
+	// Reader 返回读取 path 的 reader，内容不存在时返回 os.ErrNotExist
+	Reader(path string) (io.ReadCloser, error)
+
+	// Delete 删除 path，内容不存在时不返回错误
+	Delete(path string) error
+	// Walk 遍历存储的所有内容，fn 返回错误时停止遍历并返回该错误
+	Walk(fn func(info ObjectInfo) error) error
 }
 
 var (
@@ -18,6 +53,30 @@ var (
 	initOnce   = sync.Once{}
 )
 
+// New 基于配置创建 LogStorage
+func New(cfg configs.LogStorageConfig) (LogStorage, error) {
+	switch cfg.Type {
+	case "", StorageTypeDB:
+		return &dBLogStorage{db: db.Get()}, nil
+	case StorageTypeFS:
+		return newFsLogStorage(cfg.Path)
+	case StorageTypeS3:
+		return newS3LogStorage(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown log storage type '%s'", cfg.Type)
+	}
+}
+
+// Init 使用配置的存储，未调用时默认使用 db 存储
+func Init(cfg configs.LogStorageConfig) error {
+	s, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	logStorage = s
+	return nil
+}
+
 func Get() LogStorage {
 	initOnce.Do(func() {
 		if logStorage == nil {
@@ -27,11 +86,69 @@ func Get() LogStorage {
 	return logStorage
 }
 
-// CutLogContent 判断内容日志长度是否超限，若超限则截断(保留最新内容)
+// LogWriter 返回写入任务日志的 Writer。db 存储单条内容受 mysql max_allowed_packet 限制，
+// 日志超过 consts.MaxLogContentSize 时只保存最新的内容
+func LogWriter(path string) (Writer, error) {
+	s := Get()
+	if dbStorage, ok := s.(*dBLogStorage); ok {
+		return &dbWriter{storage: dbStorage, path: path, limit: consts.MaxLogContentSize}, nil
+	}
+	return s.Writer(path)
+}
+
+// WriteLog 通过 LogWriter() 写入任务日志
+func WriteLog(path string, content []byte) error {
+	w, err := LogWriter(path)
+	if err != nil {
+		return err
+	}
+	return writeTo(w, content)
+}
+
+// CutLogContent db 存储时截断超长的日志(保留最新内容)，用于日志需要与其他内容一起保存的场景
 func CutLogContent(content []byte) []byte {
-	size := len(content)
-	if size > consts.MaxLogContentSize {
-		content = content[size-consts.MaxLogContentSize:]
+	if _, ok := Get().(*dBLogStorage); !ok {
+		return content
+	}
+	return cutLogContent(content, consts.MaxLogContentSize)
+}
+
+// cutLogContent 内容超过 limit 时只保留最后 limit 字节，并去掉开头不完整的行
+func cutLogContent(content []byte, limit int) []byte {
+	if len(content) <= limit {
+		return content
+	}
+	content = content[len(content)-limit:]
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		content = content[i+1:]
 	}
 	return content
 }
+
+// readAll 通过 Reader() 读取全部内容
+func readAll(s LogStorage, path string) ([]byte, error) {
+	r, err := s.Reader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// writeAll 通过 Writer() 写入全部内容
+func writeAll(s LogStorage, path string, content []byte) error {
+	w, err := s.Writer(path)
+	if err != nil {
+		return err
+	}
+	return writeTo(w, content)
+}
+
+// writeTo 将全部内容写入 w，出错时放弃写入
+func writeTo(w Writer, content []byte) error {
+	if _, err := w.Write(content); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
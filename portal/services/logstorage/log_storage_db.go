@@ -3,12 +3,18 @@
 package logstorage
 
 import (
+	"bytes"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
+	"io"
+	"io/ioutil"
 	"os"
+	"time"
 )
 
+const dbWalkBatchSize = 500
+
 type dBLogStorage struct {
 	db *db.Session
 }
@@ -28,3 +34,88 @@ func (s *dBLogStorage) Read(path string) ([]byte, error) {
 	}
 	return dbLog.Content, nil
 }
+
+// Writer db 存储不支持流式写入，内容缓存在内存中，Close() 时写入
+func (s *dBLogStorage) Writer(path string) (Writer, error) {
+	return &dbWriter{storage: s, path: path}, nil
+}
+
+func (s *dBLogStorage) Reader(path string) (io.ReadCloser, error) {
+	content, err := s.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (s *dBLogStorage) Delete(path string) error {
+	_, err := s.db.Where("path = ?", path).Delete(&models.DBStorage{})
+	return err
+}
+
+type dbObjectInfo struct {
+	Id        uint
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+func (s *dBLogStorage) Walk(fn func(info ObjectInfo) error) error {
+	lastId := uint(0)
+	for {
+		items := make([]dbObjectInfo, 0, dbWalkBatchSize)
+		if err := s.db.Model(&models.DBStorage{}).
+			Select("id, path, LENGTH(content) AS size, created_at").
+			Where("id > ?", lastId).Order("id").Limit(dbWalkBatchSize).Scan(&items); err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		lastId = items[len(items)-1].Id
+
+		for _, item := range items {
+			if err := fn(ObjectInfo{Path: item.Path, Size: item.Size, ModTime: item.CreatedAt}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type dbWriter struct {
+	storage *dBLogStorage
+	path    string
+	limit   int // 大于 0 时只保存最后 limit 字节(见 LogWriter)
+	buf     bytes.Buffer
+	closed  bool
+}
+
+func (w *dbWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := w.buf.Write(p)
+	if w.limit > 0 && w.buf.Len() > 2*w.limit {
+		// 多保留一个字节，保证 Close() 时能判断出内容己被截断
+		w.buf.Next(w.buf.Len() - w.limit - 1)
+	}
+	return n, err
+}
+
+func (w *dbWriter) Close() error {
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	content := w.buf.Bytes()
+	if w.limit > 0 {
+		content = cutLogContent(content, w.limit)
+	}
+	return w.storage.Write(w.path, content)
+}
+
+func (w *dbWriter) Abort() error {
+	w.closed = true
+	w.buf.Reset()
+	return nil
+}
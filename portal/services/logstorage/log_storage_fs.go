@@ -0,0 +1,163 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package logstorage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fs 存储写入时先写临时文件，完成后再重命名，避免读到不完整的内容
+const fsTempFilePrefix = ".tmp-"
+
+type fsLogStorage struct {
+	root string
+}
+
+func newFsLogStorage(root string) (*fsLogStorage, error) {
+	if root == "" {
+		return nil, fmt.Errorf("log storage path is required")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &fsLogStorage{root: root}, nil
+}
+
+// filePath 返回 path 对应的文件路径，不允许访问 root 之外的文件
+func (s *fsLogStorage) filePath(p string) (string, error) {
+	cleaned := path.Clean("/" + p)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid storage path '%s'", p)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *fsLogStorage) Write(path string, content []byte) error {
+	return writeAll(s, path, content)
+}
+
+func (s *fsLogStorage) Read(path string) ([]byte, error) {
+	return readAll(s, path)
+}
+
+func (s *fsLogStorage) Writer(path string) (Writer, error) {
+	name, err := s.filePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	fp, err := ioutil.TempFile(filepath.Dir(name), fsTempFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &fsWriter{fp: fp, name: name}, nil
+}
+
+func (s *fsLogStorage) Reader(path string) (io.ReadCloser, error) {
+	name, err := s.filePath(path)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return fp, nil
+}
+
+// Delete 删除文件，同时删除因此变为空的目录
+func (s *fsLogStorage) Delete(path string) error {
+	name, err := s.filePath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(name); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		// 目录非空时删除失败
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fsLogStorage) Walk(fn func(info ObjectInfo) error) error {
+	return filepath.WalkDir(s.root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 遍历期间被删除
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), fsTempFilePrefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+type fsWriter struct {
+	fp   *os.File
+	name string
+	err  error
+}
+
+func (w *fsWriter) Write(p []byte) (int, error) {
+	n, err := w.fp.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Close 写入成功时将临时文件重命名为目标文件，否则删除临时文件
+func (w *fsWriter) Close() error {
+	err := w.fp.Close()
+	if err == nil && w.err == nil {
+		if err = os.Chmod(w.fp.Name(), 0644); err == nil {
+			err = os.Rename(w.fp.Name(), w.name)
+		}
+	}
+	if err != nil || w.err != nil {
+		_ = os.Remove(w.fp.Name())
+	}
+	if err == nil {
+		err = w.err
+	}
+	return err
+}
+
+func (w *fsWriter) Abort() error {
+	_ = w.fp.Close()
+	return os.Remove(w.fp.Name())
+}
@@ -0,0 +1,326 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package logstorage
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3DateFormat      = "20060102T150405Z"
+	s3RequestTimeout  = 10 * time.Minute
+)
+
+// s3LogStorage s3 兼容对象存储，使用 AWS Signature Version 4 签名请求
+type s3LogStorage struct {
+	conf     configs.S3StorageConfig
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func newS3LogStorage(conf configs.S3StorageConfig) (*s3LogStorage, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+	endpoint, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint '%s'", conf.Endpoint)
+	}
+	return &s3LogStorage{
+		conf:     conf,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: s3RequestTimeout},
+	}, nil
+}
+
+// bucketURL 返回 bucket 的地址，key 不为空时返回对象的地址
+func (s *s3LogStorage) bucketURL(key string) *url.URL {
+	u := *s.endpoint
+	u.RawQuery = ""
+	p := strings.TrimSuffix(u.Path, "/")
+	if s.conf.PathStyle {
+		p += "/" + s.conf.Bucket
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+	}
+	u.Path = p + "/" + key
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+func (s *s3LogStorage) objectKey(path string) string {
+	return s.conf.Prefix + strings.TrimPrefix(path, "/")
+}
+
+func (s *s3LogStorage) do(method string, u *url.URL, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			// ContentLength 为 0 且 Body 不为空时会使用 chunked 编码发送，s3 不支持
+			req.Body = http.NoBody
+		}
+	}
+	s3SignRequest(req, s.conf, payloadHash, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", method, u.Path, resp.Status, msg)
+}
+
+func (s *s3LogStorage) Write(path string, content []byte) error {
+	sum := sha256.Sum256(content)
+	resp, err := s.do(http.MethodPut, s.bucketURL(s.objectKey(path)),
+		bytes.NewReader(content), int64(len(content)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3LogStorage) Read(path string) ([]byte, error) {
+	return readAll(s, path)
+}
+
+// Writer 内容先写入临时文件，Close() 时上传
+func (s *s3LogStorage) Writer(path string) (Writer, error) {
+	fp, err := ioutil.TempFile("", "iac-s3-upload-")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{storage: s, path: path, fp: fp}, nil
+}
+
+func (s *s3LogStorage) Reader(path string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, s.bucketURL(s.objectKey(path)), nil, 0, s3UnsignedPayload)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3LogStorage) Delete(path string) error {
+	resp, err := s.do(http.MethodDelete, s.bucketURL(s.objectKey(path)), nil, 0, s3UnsignedPayload)
+	if err != nil {
+		if err == os.ErrNotExist {
+			return nil
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func (s *s3LogStorage) Walk(fn func(info ObjectInfo) error) error {
+	token := ""
+	for {
+		u := s.bucketURL("")
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if s.conf.Prefix != "" {
+			query.Set("prefix", s.conf.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = s3EscapeQuery(query)
+
+		resp, err := s.do(http.MethodGet, u, nil, 0, s3UnsignedPayload)
+		if err != nil {
+			return err
+		}
+		result := s3ListResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("decode s3 list result: %v", err)
+		}
+
+		for _, c := range result.Contents {
+			info := ObjectInfo{
+				Path:    strings.TrimPrefix(c.Key, s.conf.Prefix),
+				Size:    c.Size,
+				ModTime: c.LastModified,
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+type s3Writer struct {
+	storage *s3LogStorage
+	path    string
+	fp      *os.File
+	size    int64
+	err     error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	n, err := w.fp.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *s3Writer) Close() error {
+	defer os.Remove(w.fp.Name())
+	defer w.fp.Close()
+
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.fp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	resp, err := w.storage.do(http.MethodPut, w.storage.bucketURL(w.storage.objectKey(w.path)),
+		w.fp, w.size, s3UnsignedPayload)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (w *s3Writer) Abort() error {
+	_ = w.fp.Close()
+	return os.Remove(w.fp.Name())
+}
+
+// s3Escape 按 aws 签名规则编码，只保留 RFC 3986 中的非保留字符
+func s3Escape(s string, encodeSlash bool) string {
+	buf := strings.Builder{}
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func s3EscapePath(p string) string {
+	return s3Escape(p, false)
+}
+
+func s3EscapeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vs := append([]string{}, query[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3SignRequest 使用 AWS Signature Version 4 签名请求，请求中已设置的 header 都会参与签名
+func s3SignRequest(req *http.Request, conf configs.S3StorageConfig, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(s3DateFormat)
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(vs, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := strings.Builder{}
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3EscapeQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, conf.Region, "s3", "aws4_request"}, "/")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(crHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+conf.SecretKey), date)
+	key = hmacSHA256(key, conf.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		conf.AccessKey, scope, signedHeaders, signature))
+}
@@ -10,7 +10,11 @@ import (
 	"cloudiac/utils/logs"
 )
 
-var runnerMax int
+var (
+	runnerMax       int
+	orgTasksMax     int // 每个组织并发任务数量限制，0 表示不限制
+	projectTasksMax int // 每个项目并发任务数量限制，0 表示不限制
+)
 
 func GetRunnerMax() int {
 	return runnerMax
@@ -20,6 +24,22 @@ func UpdateRunnerMax(max int) {
 	runnerMax = max
 }
 
+func GetOrgTasksMax() int {
+	return orgTasksMax
+}
+
+func UpdateOrgTasksMax(max int) {
+	orgTasksMax = max
+}
+
+func GetProjectTasksMax() int {
+	return projectTasksMax
+}
+
+func UpdateProjectTasksMax(max int) {
+	projectTasksMax = max
+}
+
 func MaintenanceRunnerPerMax() {
 	logger := logs.Get().WithField("action", "MaintenanceRunnerPerMax")
 	systemCfg := models.SystemCfg{}
@@ -31,4 +51,19 @@ func MaintenanceRunnerPerMax() {
 	if utils.Str2int(systemCfg.Value) > 0 {
 		UpdateRunnerMax(utils.Str2int(systemCfg.Value))
 	}
+
+	for name, update := range map[string]func(int){
+		models.SysCfgNameMaxTasksPerOrg:     UpdateOrgTasksMax,
+		models.SysCfgNameMaxTasksPerProject: UpdateProjectTasksMax,
+	} {
+		cfg := models.SystemCfg{}
+		if err := db.Get().Table(models.SystemCfg{}.TableName()).
+			Where("name = ?", name).First(&cfg); err != nil {
+			if !e.IsRecordNotFound(err) {
+				logger.Debugf("db err: %v", err)
+			}
+			continue
+		}
+		update(utils.Str2int(cfg.Value))
+	}
 }
@@ -20,6 +20,7 @@ type NotificationService struct {
 	Env       *models.Env          `json:"env" form:"env" `
 	Task      *models.Task         `json:"task" form:"task" `
 	EventType string               `json:"eventType" form:"eventType" `
+	Message   string               `json:"message" form:"message" ` // 消息内容，为空时使用任务的 message
 }
 
 type NotificationOptions struct {
@@ -31,6 +32,7 @@ type NotificationOptions struct {
 	Env       *models.Env          `json:"env" form:"env" `
 	Task      *models.Task         `json:"task" form:"task" `
 	EventType string               `json:"eventType" form:"eventType" `
+	Message   string               `json:"message" form:"message" ` // 消息内容，为空时使用任务的 message
 }
 
 func NewNotificationService(options *NotificationOptions) NotificationService {
@@ -43,6 +45,7 @@ func NewNotificationService(options *NotificationOptions) NotificationService {
 		Project:   options.Project,
 		Org:       options.Org,
 		EventType: options.EventType,
+		Message:   options.Message,
 	}
 }
 
@@ -69,6 +72,11 @@ func (ns *NotificationService) SyncSendMessage() {
 		return
 	}
 
+	message := ns.Task.Message
+	if ns.Message != "" {
+		message = ns.Message
+	}
+
 	data := struct {
 		Creator      string
 		OrgName      string
@@ -81,6 +89,7 @@ func (ns *NotificationService) SyncSendMessage() {
 		ResChanged   *int
 		ResDestroyed *int
 		Message      string
+		Cost         string // 预估月费用，未估算时为空
 	}{
 		Creator:      u.Name,
 		OrgName:      ns.Org.Name,
@@ -93,7 +102,8 @@ func (ns *NotificationService) SyncSendMessage() {
 		ResAdded:     ns.Task.Result.ResAdded,
 		ResChanged:   ns.Task.Result.ResChanged,
 		ResDestroyed: ns.Task.Result.ResDestroyed,
-		Message:      ns.Task.Message,
+		Message:      message,
+		Cost:         ns.Task.Result.Cost.Summary(),
 	}
 
 	// 获取消息通知模板
@@ -194,6 +204,12 @@ func (ns *NotificationService) FindNotificationsAndMessageTpl() ([]models.Notifi
 	case consts.EventTaskComplete:
 		tplNotificationTemplate = consts.IacTaskCompleteTpl
 		markdownNotificationTemplate = consts.IacTaskCompleteMarkdown
+	case consts.EventTaskCancelled:
+		tplNotificationTemplate = consts.IacTaskCancelledTpl
+		markdownNotificationTemplate = consts.IacTaskCancelledMarkdown
+	case consts.EventEnvDrifted:
+		tplNotificationTemplate = consts.IacEnvDriftedTpl
+		markdownNotificationTemplate = consts.IacEnvDriftedMarkdown
 	default:
 		return nil, "", "", fmt.Errorf("unknown event type '%s'", ns.EventType)
 	}
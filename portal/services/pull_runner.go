@@ -0,0 +1,384 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+const (
+	// PullRunnerOnlineTimeout 拉取模式 runner 超过该时间没有请求 portal 则认为离线
+	PullRunnerOnlineTimeout = time.Minute
+	// RunnerJobResultName runner 上报的步骤执行结果文件名，保存在步骤日志同目录下
+	RunnerJobResultName = "runner_result.json"
+)
+
+// RunnerAgentToken 生成拉取模式 runner 使用的 token。
+// token 由 portal 的 runner_token 对 runner id 签名生成，每个 runner 的 token 不同，
+// 泄露的 token 无法用于冒充其他 runner
+func RunnerAgentToken(runnerId string) string {
+	mac := hmac.New(sha256.New, []byte(configs.Get().Portal.RunnerToken))
+	mac.Write([]byte("runner:" + runnerId))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckRunnerToken 检查拉取模式 runner 使用的 token 是否为该 runner 的 token，
+// portal 未配置 runner_token 时不允许接入
+func CheckRunnerToken(runnerId string, token string) bool {
+	if configs.Get().Portal.RunnerToken == "" || runnerId == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(RunnerAgentToken(runnerId)), []byte(token))
+}
+
+// RegisterPullRunner 注册拉取模式 runner，己注册时更新其标签及版本
+func RegisterPullRunner(sess *db.Session, runnerId string, tags []string, version string) (*models.PullRunner, e.Error) {
+	now := models.Time(time.Now())
+	r := models.PullRunner{}
+	if err := sess.Where("runner_id = ?", runnerId).First(&r); err != nil {
+		if !e.IsRecordNotFound(err) {
+			return nil, e.New(e.DBError, err)
+		}
+		r = models.PullRunner{
+			RunnerId:   runnerId,
+			Tags:       tags,
+			Version:    version,
+			LastSeenAt: &now,
+		}
+		if err := models.Create(sess, &r); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		return &r, nil
+	}
+
+	r.Tags = tags
+	r.Version = version
+	r.LastSeenAt = &now
+	if _, err := sess.Model(&models.PullRunner{}).Where("id = ?", r.Id).UpdateAttrs(models.Attrs{
+		"tags":         r.Tags,
+		"version":      r.Version,
+		"last_seen_at": r.LastSeenAt,
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// TouchPullRunner 更新 runner 最近请求时间，runner 未注册时返回 false
+func TouchPullRunner(sess *db.Session, runnerId string) (bool, e.Error) {
+	n, err := sess.Model(&models.PullRunner{}).Where("runner_id = ?", runnerId).
+		UpdateColumn("last_seen_at", models.Time(time.Now()))
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	if n > 0 {
+		return true, nil
+	}
+	// 同一秒内重复请求时更新行数为 0，需要再确认一下是否存在
+	exists, err := sess.Model(&models.PullRunner{}).Where("runner_id = ?", runnerId).Exists()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return exists, nil
+}
+
+// ListPullRunners 查询己注册的拉取模式 runner，超过 PullRunnerOnlineTimeout 未请求 portal 的 runner 为不健康状态
+func ListPullRunners(sess *db.Session) ([]*RunnerInfo, e.Error) {
+	pullRunners := make([]models.PullRunner, 0)
+	if err := sess.Model(&models.PullRunner{}).Order("runner_id").Find(&pullRunners); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	runners := make([]*RunnerInfo, 0, len(pullRunners))
+	for _, r := range pullRunners {
+		runners = append(runners, &RunnerInfo{
+			Id:      r.RunnerId,
+			Tags:    r.Tags,
+			Healthy: IsPullRunnerOnline(&r),
+		})
+	}
+	return runners, nil
+}
+
+// GetPullRunner 查询拉取模式 runner，runner 不是拉取模式时返回 nil
+func GetPullRunner(sess *db.Session, runnerId string) (*models.PullRunner, e.Error) {
+	r := models.PullRunner{}
+	if err := sess.Where("runner_id = ?", runnerId).First(&r); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// IsPullRunnerOnline 拉取模式 runner 是否在线
+func IsPullRunnerOnline(r *models.PullRunner) bool {
+	return r.LastSeenAt != nil && time.Since(time.Time(*r.LastSeenAt)) < PullRunnerOnlineTimeout
+}
+
+// CreateRunnerJob 创建下发给拉取模式 runner 的任务步骤，
+// 步骤重新下发(如 runner 故障切换)时会替换之前创建的 job
+func CreateRunnerJob(sess *db.Session, req runner.RunTaskReq, step *models.TaskStep) (*models.RunnerJob, e.Error) {
+	reqJson, err := json.Marshal(req)
+	if err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+
+	if _, err := sess.Where("task_id = ? AND step = ?", step.TaskId, step.Index).
+		Delete(&models.RunnerJob{}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	job := models.RunnerJob{
+		RunnerId:   req.RunnerId,
+		TaskId:     step.TaskId,
+		EnvId:      step.EnvId,
+		Step:       step.Index,
+		Request:    reqJson,
+		Status:     models.RunnerJobPending,
+		ResultPath: path.Join(path.Dir(step.LogPath), RunnerJobResultName),
+	}
+	job.Id = models.NewId("rj")
+	if err := models.Create(sess, &job); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &job, nil
+}
+
+func GetRunnerJob(sess *db.Session, taskId models.Id, step int) (*models.RunnerJob, e.Error) {
+	job := models.RunnerJob{}
+	if err := sess.Where("task_id = ? AND step = ?", taskId, step).First(&job); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RunnerJobNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &job, nil
+}
+
+func GetRunnerJobById(sess *db.Session, runnerId string, id models.Id) (*models.RunnerJob, e.Error) {
+	job := models.RunnerJob{}
+	if err := sess.Where("id = ? AND runner_id = ?", id, runnerId).First(&job); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RunnerJobNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &job, nil
+}
+
+// AcquireRunnerJobs 领取 runner 等待执行的 job 及待下发的取消请求
+func AcquireRunnerJobs(sess *db.Session, runnerId string) (jobs []*models.RunnerJob, cancels []*models.RunnerJob, er e.Error) {
+	pending := make([]*models.RunnerJob, 0)
+	if err := sess.Model(&models.RunnerJob{}).
+		Where("runner_id = ? AND status = ? AND cancel_requested = ?", runnerId, models.RunnerJobPending, false).
+		Order("created_at").Find(&pending); err != nil {
+		return nil, nil, e.New(e.DBError, err)
+	}
+	jobs = make([]*models.RunnerJob, 0, len(pending))
+	for _, job := range pending {
+		// 通过状态条件更新保证同一 job 只被领取一次
+		n, err := sess.Model(&models.RunnerJob{}).
+			Where("id = ? AND status = ?", job.Id, models.RunnerJobPending).
+			UpdateAttrs(models.Attrs{"status": models.RunnerJobRunning, "heartbeat_at": models.Time(time.Now())})
+		if err != nil {
+			return nil, nil, e.New(e.DBError, err)
+		}
+		if n > 0 {
+			job.Status = models.RunnerJobRunning
+			jobs = append(jobs, job)
+		}
+	}
+
+	cancelling := make([]*models.RunnerJob, 0)
+	if err := sess.Model(&models.RunnerJob{}).
+		Where("runner_id = ? AND status = ? AND cancel_requested = ? AND cancel_sent = ?",
+			runnerId, models.RunnerJobRunning, true, false).Find(&cancelling); err != nil {
+		return nil, nil, e.New(e.DBError, err)
+	}
+	cancels = make([]*models.RunnerJob, 0, len(cancelling))
+	for _, job := range cancelling {
+		n, err := sess.Model(&models.RunnerJob{}).Where("id = ? AND cancel_sent = ?", job.Id, false).
+			UpdateColumn("cancel_sent", true)
+		if err != nil {
+			return nil, nil, e.New(e.DBError, err)
+		}
+		if n > 0 {
+			cancels = append(cancels, job)
+		}
+	}
+	return jobs, cancels, nil
+}
+
+// AppendRunnerJobLog 替换敏感信息后追加 runner 推送的步骤日志，offset 为 content 在 runner 日志文件中的起始位置。
+// 只保存到 content 的最后一个换行符，之后的内容可能只包含敏感值的一部分，由 runner 与后续日志一起重新推送。
+// offset 与己保存的日志长度不一致时不追加，返回当前己保存的日志长度，由 runner 从该位置重新推送
+func AppendRunnerJobLog(sess *db.Session, job *models.RunnerJob, offset int, content []byte) (int, e.Error) {
+	if n := utils.SecretMaskBoundary(content); n > 0 {
+		masked, er := maskRunnerJobLog(sess, job, content[:n])
+		if er != nil {
+			return 0, er
+		}
+		rows, err := sess.Exec("UPDATE iac_runner_job SET log = CONCAT(IFNULL(log, ''), ?), log_offset = log_offset + ? "+
+			"WHERE id = ? AND log_offset = ?", string(masked), n, job.Id, offset)
+		if err != nil {
+			return 0, e.New(e.DBError, err)
+		}
+		if rows > 0 {
+			return offset + n, nil
+		}
+	}
+
+	var length int
+	if err := sess.Raw("SELECT log_offset FROM iac_runner_job WHERE id = ?", job.Id).
+		Row().Scan(&length); err != nil {
+		return 0, e.New(e.DBError, err)
+	}
+	return length, nil
+}
+
+// UpdateRunnerJobStatus 保存 runner 上报的步骤状态，步骤退出时将状态消息(包含全量日志及结果文件)写入存储
+func UpdateRunnerJobStatus(sess *db.Session, job *models.RunnerJob, msg *runner.TaskStatusMessage) e.Error {
+	attrs := models.Attrs{"heartbeat_at": models.Time(time.Now())}
+	if msg.Exited {
+		if len(msg.LogContent) > 0 {
+			logContent, er := maskRunnerJobLog(sess, job, msg.LogContent)
+			if er != nil {
+				return er
+			}
+			masked := *msg
+			// 结果与日志保存为同一条内容，db 存储时需要截断超长的日志
+			masked.LogContent = logstorage.CutLogContent(logContent)
+			msg = &masked
+		}
+		if err := writeRunnerJobResult(job.ResultPath, msg); err != nil {
+			return e.New(e.InternalError, fmt.Errorf("write runner job result: %v", err))
+		}
+		attrs["status"] = models.RunnerJobExited
+		attrs["exit_code"] = msg.ExitCode
+	}
+	if _, err := sess.Model(&models.RunnerJob{}).Where("id = ?", job.Id).UpdateAttrs(attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// writeRunnerJobResult 将步骤状态消息编码后写入存储
+func writeRunnerJobResult(path string, msg *runner.TaskStatusMessage) error {
+	w, err := logstorage.Get().Writer(path)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// maskRunnerJobLog 替换步骤日志中的敏感信息
+func maskRunnerJobLog(sess *db.Session, job *models.RunnerJob, content []byte) ([]byte, e.Error) {
+	var task models.Tasker
+	task, er := GetTask(sess, job.TaskId)
+	if er != nil && er.Code() == e.TaskNotExists {
+		task, er = GetScanTaskById(sess, job.TaskId)
+	}
+	if er != nil {
+		return nil, er
+	}
+	content, err := MaskTaskLog(sess, task, content)
+	if err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+	return content, nil
+}
+
+// GetRunnerJobResult 读取 runner 上报的步骤执行结果
+func GetRunnerJobResult(job *models.RunnerJob) (*runner.TaskStatusMessage, e.Error) {
+	r, err := logstorage.Get().Reader(job.ResultPath)
+	if err != nil {
+		return nil, e.New(e.InternalError, fmt.Errorf("read runner job result: %v", err))
+	}
+	defer r.Close()
+	msg := runner.TaskStatusMessage{}
+	if err := json.NewDecoder(r).Decode(&msg); err != nil {
+		return nil, e.New(e.JSONParseError, err)
+	}
+	return &msg, nil
+}
+
+// RequestCancelRunnerJob 请求取消拉取模式 runner 正在执行的步骤，取消请求在 runner 下次拉取任务时下发。
+// 步骤还未被 runner 领取时直接置为退出状态
+func RequestCancelRunnerJob(sess *db.Session, taskId models.Id, step int) e.Error {
+	job, err := GetRunnerJob(sess, taskId, step)
+	if err != nil {
+		if err.Code() == e.RunnerJobNotExists {
+			return nil
+		}
+		return err
+	}
+	if job.Status == models.RunnerJobPending {
+		return UpdateRunnerJobStatus(sess, job, &runner.TaskStatusMessage{
+			Exited:     true,
+			ExitCode:   1,
+			LogContent: utils.TaskLogMsgBytes("Task step cancelled before started"),
+		})
+	}
+
+	if _, err := sess.Model(&models.RunnerJob{}).
+		Where("task_id = ? AND step = ? AND status != ?", taskId, step, models.RunnerJobExited).
+		UpdateColumn("cancel_requested", true); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// fetchPullRunnerTaskStepLog 从 db 读取拉取模式 runner 推送的步骤日志，直到步骤结束
+func fetchPullRunnerTaskStepLog(ctx context.Context, step *models.TaskStep, writer io.Writer) error {
+	ticker := time.NewTicker(consts.DbTaskPollInterval)
+	defer ticker.Stop()
+
+	offset := 0
+	for {
+		job, err := GetRunnerJob(db.Get(), step.TaskId, step.Index)
+		if err != nil {
+			if err.Code() == e.RunnerJobNotExists {
+				return ErrRunnerTaskNotExists
+			}
+			return err
+		}
+		if len(job.Log) > offset {
+			if _, er := io.WriteString(writer, job.Log[offset:]); er != nil {
+				if er == io.ErrClosedPipe {
+					return nil
+				}
+				return er
+			}
+			offset = len(job.Log)
+		}
+		if job.Status == models.RunnerJobExited {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,3 +1,360 @@
 // Copyright 2021 CloudJ Company Limited. All rights reserved.
 
 package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 资源清单遍历时每批查询的资源数量
+const inventoryBatchSize = 500
+
+// InventoryAttrFilter 资源属性过滤条件，Path 为 . 分隔的属性路径，路径中的数字表示列表下标
+type InventoryAttrFilter struct {
+	Path  string
+	Value string
+}
+
+// InventoryFilter 资源清单查询条件，只查询各环境最后一次统计的资源
+type InventoryFilter struct {
+	OrgId      models.Id
+	ProjectIds []models.Id // 限制查询的项目，为 nil 表示不限制
+	EnvId      models.Id
+	Provider   string // provider 全称或简称，如 registry.terraform.io/aliyun/alicloud 或 alicloud
+	Type       string
+	Module     string
+	Attrs      []InventoryAttrFilter
+	Q          string // 对资源地址及属性值进行全文搜索，不匹配敏感属性
+}
+
+type InventoryResource struct {
+	models.Resource
+	EnvName     string `json:"envName" form:"envName"`
+	ProjectName string `json:"projectName" form:"projectName"`
+}
+
+type InventoryCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type InventoryStats struct {
+	Total      int64            `json:"total"`
+	ByType     []InventoryCount `json:"byType"`
+	ByProvider []InventoryCount `json:"byProvider"`
+}
+
+// ParseInventoryAttrFilter 解析 path=value 格式的属性过滤条件
+func ParseInventoryAttrFilter(s string) (InventoryAttrFilter, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return InventoryAttrFilter{}, fmt.Errorf("invalid attribute filter '%s', expected path=value", s)
+	}
+	f := InventoryAttrFilter{Path: strings.TrimSpace(kv[0]), Value: kv[1]}
+	if _, err := attrJsonPath(f.Path); err != nil {
+		return InventoryAttrFilter{}, err
+	}
+	return f, nil
+}
+
+// attrJsonPath 将 . 分隔的属性路径转换为 mysql 的 json path，如 tags.Name 转换为 $."tags"."Name"
+func attrJsonPath(path string) (string, error) {
+	b := strings.Builder{}
+	b.WriteString("$")
+	for i, key := range strings.Split(path, ".") {
+		if key == "" || strings.ContainsAny(key, `"\`) {
+			return "", fmt.Errorf("invalid attribute path '%s'", path)
+		}
+		if idx, err := strconv.Atoi(key); err == nil && i > 0 && idx >= 0 {
+			b.WriteString(fmt.Sprintf("[%d]", idx))
+		} else {
+			b.WriteString(fmt.Sprintf(`."%s"`, key))
+		}
+	}
+	return b.String(), nil
+}
+
+func attrTopKey(path string) string {
+	return strings.SplitN(path, ".", 2)[0]
+}
+
+// queryInventory 按查询条件生成资源清单的查询，全文搜索只做粗略过滤，结果需要再使用 matchInventoryResource 过滤
+func queryInventory(query *db.Session, filter *InventoryFilter) (*db.Session, e.Error) {
+	resTable := models.Resource{}.TableName()
+	envTable := models.Env{}.TableName()
+
+	query = query.Model(&models.Resource{}).
+		Joins(fmt.Sprintf("JOIN %s ON %s.id = %s.env_id AND %s.last_res_task_id = %s.task_id AND %s.deleted_at_t = 0",
+			envTable, envTable, resTable, envTable, resTable, envTable)).
+		Joins(fmt.Sprintf("LEFT JOIN %s ON %s.id = %s.project_id",
+			models.Project{}.TableName(), models.Project{}.TableName(), resTable)).
+		Where(fmt.Sprintf("%s.org_id = ?", resTable), filter.OrgId)
+
+	if filter.ProjectIds != nil {
+		query = query.Where(fmt.Sprintf("%s.project_id IN (?)", resTable), filter.ProjectIds)
+	}
+	if filter.EnvId != "" {
+		query = query.Where(fmt.Sprintf("%s.env_id = ?", resTable), filter.EnvId)
+	}
+	if filter.Provider != "" {
+		query = query.Where(fmt.Sprintf("%s.provider = ? OR %s.provider LIKE ?", resTable, resTable),
+			filter.Provider, "%/"+filter.Provider)
+	}
+	if filter.Type != "" {
+		query = query.Where(fmt.Sprintf("%s.type = ?", resTable), filter.Type)
+	}
+	if filter.Module != "" {
+		query = query.Where(fmt.Sprintf("%s.module = ?", resTable), filter.Module)
+	}
+	for _, attr := range filter.Attrs {
+		jsonPath, err := attrJsonPath(attr.Path)
+		if err != nil {
+			return nil, e.New(e.BadParam, err)
+		}
+		// 敏感属性不允许作为过滤条件，否则可以通过过滤结果推断出属性值
+		query = query.Where(fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s.attrs, ?)) = ? AND "+
+			"COALESCE(JSON_CONTAINS(%s.sensitive_keys, JSON_QUOTE(?)), 0) = 0",
+			resTable, resTable), jsonPath, attr.Value, attrTopKey(attr.Path))
+	}
+	// 包含需要转义的字符时无法直接匹配 json 文本，只能在查询后过滤
+	if filter.Q != "" && !strings.ContainsAny(filter.Q, `"\`) {
+		q := fmt.Sprintf("%%%s%%", filter.Q)
+		query = query.Where(fmt.Sprintf("%s.address LIKE ? OR CONVERT(%s.attrs USING utf8mb4) LIKE ?",
+			resTable, resTable), q, q)
+	}
+	return query, nil
+}
+
+func selectInventory(query *db.Session) *db.Session {
+	return query.LazySelectAppend(
+		fmt.Sprintf("%s.*", models.Resource{}.TableName()),
+		fmt.Sprintf("%s.name AS env_name", models.Env{}.TableName()),
+		fmt.Sprintf("%s.name AS project_name", models.Project{}.TableName()),
+	)
+}
+
+// RedactResourceAttrs 返回隐藏了敏感属性值的资源属性
+func RedactResourceAttrs(attrs models.ResAttrs, sensitiveKeys []string) models.ResAttrs {
+	if len(sensitiveKeys) == 0 || attrs == nil {
+		return attrs
+	}
+	set := make(map[string]struct{}, len(sensitiveKeys))
+	for _, k := range sensitiveKeys {
+		set[k] = struct{}{}
+	}
+	rs := make(models.ResAttrs, len(attrs))
+	for k, v := range attrs {
+		if _, ok := set[k]; ok {
+			v = driftSensitiveValue
+		}
+		rs[k] = v
+	}
+	return rs
+}
+
+// attrsContain 判断属性值中是否包含 q (q 需为小写)
+func attrsContain(v interface{}, q string) bool {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, item := range val {
+			if attrsContain(item, q) {
+				return true
+			}
+		}
+	case models.ResAttrs:
+		return attrsContain(map[string]interface{}(val), q)
+	case []interface{}:
+		for _, item := range val {
+			if attrsContain(item, q) {
+				return true
+			}
+		}
+	case string:
+		return strings.Contains(strings.ToLower(val), q)
+	case float64:
+		return strings.Contains(strconv.FormatFloat(val, 'f', -1, 64), q)
+	case bool:
+		return strings.Contains(strconv.FormatBool(val), q)
+	}
+	return false
+}
+
+// matchInventoryResource 判断资源地址或隐藏敏感值后的属性是否匹配全文搜索条件
+func matchInventoryResource(r *InventoryResource, q string) bool {
+	if q == "" {
+		return true
+	}
+	q = strings.ToLower(q)
+	return strings.Contains(strings.ToLower(r.Address), q) || attrsContain(r.Attrs, q)
+}
+
+// WalkInventory 按资源 id 顺序分批遍历资源清单，返回的资源属性已隐藏敏感值
+func WalkInventory(query *db.Session, filter *InventoryFilter, fn func(r *InventoryResource) error) e.Error {
+	query, er := queryInventory(query, filter)
+	if er != nil {
+		return er
+	}
+	query = selectInventory(query)
+
+	lastId := models.Id("")
+	for {
+		rs := make([]*InventoryResource, 0, inventoryBatchSize)
+		if err := query.Where(fmt.Sprintf("%s.id > ?", models.Resource{}.TableName()), lastId).
+			Order(fmt.Sprintf("%s.id", models.Resource{}.TableName())).
+			Limit(inventoryBatchSize).Scan(&rs); err != nil {
+			return e.New(e.DBError, err)
+		}
+		for _, r := range rs {
+			r.Attrs = RedactResourceAttrs(r.Attrs, r.SensitiveKeys)
+			if !matchInventoryResource(r, filter.Q) {
+				continue
+			}
+			if err := fn(r); err != nil {
+				return e.AutoNew(err, e.InternalError)
+			}
+		}
+		if len(rs) < inventoryBatchSize {
+			return nil
+		}
+		lastId = rs[len(rs)-1].Id
+	}
+}
+
+// SearchInventory 分页查询资源清单，返回当前页的资源及总数。
+// 有全文搜索条件时需要遍历候选资源过滤敏感属性，按资源 id 排序，否则按环境及资源地址排序
+func SearchInventory(query *db.Session, filter *InventoryFilter, offset, limit int) ([]*InventoryResource, int64, e.Error) {
+	if filter.Q != "" {
+		rs := make([]*InventoryResource, 0)
+		total := int64(0)
+		er := WalkInventory(query, filter, func(r *InventoryResource) error {
+			if total >= int64(offset) && len(rs) < limit {
+				rs = append(rs, r)
+			}
+			total += 1
+			return nil
+		})
+		if er != nil {
+			return nil, 0, er
+		}
+		return rs, total, nil
+	}
+
+	query, er := queryInventory(query, filter)
+	if er != nil {
+		return nil, 0, er
+	}
+	total, err := query.Count()
+	if err != nil {
+		return nil, 0, e.New(e.DBError, err)
+	}
+	rs := make([]*InventoryResource, 0)
+	if err := selectInventory(query).Order(fmt.Sprintf("%s.name, %s.address", models.Env{}.TableName(), models.Resource{}.TableName())).
+		Limit(limit).Offset(offset).Scan(&rs); err != nil {
+		return nil, 0, e.New(e.DBError, err)
+	}
+	for _, r := range rs {
+		r.Attrs = RedactResourceAttrs(r.Attrs, r.SensitiveKeys)
+	}
+	return rs, total, nil
+}
+
+func countInventoryBy(query *db.Session, column string) ([]InventoryCount, error) {
+	rs := make([]InventoryCount, 0)
+	err := query.Group(column).
+		LazySelectAppend(fmt.Sprintf("%s AS name", column), "COUNT(*) AS count").
+		Order("count DESC, name").Scan(&rs)
+	return rs, err
+}
+
+// sortInventoryCounts 按数量逆序、名称顺序排序
+func sortInventoryCounts(counts map[string]int64) []InventoryCount {
+	rs := make([]InventoryCount, 0, len(counts))
+	for name, count := range counts {
+		rs = append(rs, InventoryCount{Name: name, Count: count})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Count != rs[j].Count {
+			return rs[i].Count > rs[j].Count
+		}
+		return rs[i].Name < rs[j].Name
+	})
+	return rs
+}
+
+// GetInventoryStats 统计资源清单中各资源类型及 provider 的资源数量
+func GetInventoryStats(query *db.Session, filter *InventoryFilter) (*InventoryStats, e.Error) {
+	if filter.Q != "" {
+		types, providers := make(map[string]int64), make(map[string]int64)
+		stats := InventoryStats{}
+		er := WalkInventory(query, filter, func(r *InventoryResource) error {
+			stats.Total += 1
+			types[r.Type] += 1
+			providers[r.Provider] += 1
+			return nil
+		})
+		if er != nil {
+			return nil, er
+		}
+		stats.ByType, stats.ByProvider = sortInventoryCounts(types), sortInventoryCounts(providers)
+		return &stats, nil
+	}
+
+	query, er := queryInventory(query, filter)
+	if er != nil {
+		return nil, er
+	}
+	var (
+		err   error
+		stats = InventoryStats{}
+	)
+	if stats.Total, err = query.Count(); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	resTable := models.Resource{}.TableName()
+	if stats.ByType, err = countInventoryBy(query, fmt.Sprintf("%s.type", resTable)); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if stats.ByProvider, err = countInventoryBy(query, fmt.Sprintf("%s.provider", resTable)); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &stats, nil
+}
+
+var inventoryCSVHeader = []string{"project", "env", "address", "provider", "module", "type", "name", "index", "attrs"}
+
+// WriteInventoryCSV 以 csv 格式导出资源清单，属性以 json 格式输出且已隐藏敏感值
+func WriteInventoryCSV(w io.Writer, query *db.Session, filter *InventoryFilter) e.Error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(inventoryCSVHeader); err != nil {
+		return e.New(e.InternalError, err)
+	}
+	er := WalkInventory(query, filter, func(r *InventoryResource) error {
+		return writeInventoryCSVRecord(cw, r)
+	})
+	if er != nil {
+		return er
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return e.New(e.InternalError, err)
+	}
+	return nil
+}
+
+func writeInventoryCSVRecord(cw *csv.Writer, r *InventoryResource) error {
+	attrs, err := json.Marshal(r.Attrs)
+	if err != nil {
+		return err
+	}
+	return cw.Write([]string{r.ProjectName, r.EnvName, r.Address, r.Provider, r.Module,
+		r.Type, r.Name, r.Index, string(attrs)})
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ResourceDiff 资源在两次任务之间的差异
+type ResourceDiff struct {
+	Address  string                     `json:"address"`
+	Module   string                     `json:"module,omitempty"`
+	Provider string                     `json:"provider"`
+	Type     string                     `json:"type"`
+	Name     string                     `json:"name"`
+	Index    string                     `json:"index"`
+	Action   string                     `json:"action" enums:"create,update,replace,delete"`
+	Changes  models.ResourceChangeAttrs `json:"changes,omitempty"` // 发生变更的属性，只在资源被修改时有值
+}
+
+// TaskResourceDiff 两次任务统计的资源列表之间的差异
+type TaskResourceDiff struct {
+	FromTaskId models.Id      `json:"fromTaskId"` // 为空表示与空的资源列表对比
+	ToTaskId   models.Id      `json:"toTaskId"`
+	Added      []ResourceDiff `json:"added"`
+	Removed    []ResourceDiff `json:"removed"`
+	Changed    []ResourceDiff `json:"changed"`
+}
+
+// ResourceSnapshot 统计了资源列表的任务
+type ResourceSnapshot struct {
+	TaskId   models.Id    `json:"taskId"`
+	TaskName string       `json:"taskName"`
+	TaskType string       `json:"taskType"`
+	EndAt    *models.Time `json:"endAt"`
+}
+
+// ResourceEvent 资源在某次任务中发生的变化
+type ResourceEvent struct {
+	ResourceSnapshot
+	ResourceId models.Id                  `json:"resourceId,omitempty"` // 任务统计的资源记录 id，资源被销毁时为空
+	Action     string                     `json:"action" enums:"create,update,replace,delete"`
+	Changes    models.ResourceChangeAttrs `json:"changes,omitempty"` // 发生变更的属性，只在资源被修改时有值
+}
+
+func GetTaskResources(query *db.Session, taskId models.Id) ([]models.Resource, e.Error) {
+	rs := make([]models.Resource, 0)
+	if taskId == "" {
+		return rs, nil
+	}
+	if err := query.Model(&models.Resource{}).Where("task_id = ?", taskId).Find(&rs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return rs, nil
+}
+
+func newResourceDiff(r *models.Resource, action string) ResourceDiff {
+	return ResourceDiff{
+		Address:  r.Address,
+		Module:   r.Module,
+		Provider: r.Provider,
+		Type:     r.Type,
+		Name:     r.Name,
+		Index:    r.Index,
+		Action:   action,
+	}
+}
+
+// diffResourceAttrs 对比资源的属性，任一记录中标记为敏感的属性都会被隐藏。
+// 资源 id 发生变化时认为资源被重建
+func diffResourceAttrs(before, after *models.Resource) (string, models.ResourceChangeAttrs) {
+	sensitiveKeys := append(append([]string{}, before.SensitiveKeys...), after.SensitiveKeys...)
+	attrs := GetResourceChangeAttrs(TfPlanResourceChange{
+		Before: map[string]interface{}(before.Attrs),
+		After:  map[string]interface{}(after.Attrs),
+	}, sensitiveKeys)
+	if len(attrs) == 0 {
+		return "", nil
+	}
+	if id, ok := attrs["id"]; ok && id.Before != nil && id.After != nil {
+		return models.ResourceChangeReplace, attrs
+	}
+	return models.ResourceChangeUpdate, attrs
+}
+
+// DiffResources 按资源地址对比两个资源列表，结果按资源地址排序
+func DiffResources(from, to []models.Resource) *TaskResourceDiff {
+	diff := TaskResourceDiff{
+		Added:   make([]ResourceDiff, 0),
+		Removed: make([]ResourceDiff, 0),
+		Changed: make([]ResourceDiff, 0),
+	}
+
+	fromMap := make(map[string]*models.Resource, len(from))
+	for i := range from {
+		fromMap[from[i].Address] = &from[i]
+	}
+	for i := range to {
+		r := &to[i]
+		before, ok := fromMap[r.Address]
+		if !ok {
+			diff.Added = append(diff.Added, newResourceDiff(r, models.ResourceChangeCreate))
+			continue
+		}
+		delete(fromMap, r.Address)
+		if action, attrs := diffResourceAttrs(before, r); action != "" {
+			d := newResourceDiff(r, action)
+			d.Changes = attrs
+			diff.Changed = append(diff.Changed, d)
+		}
+	}
+	for _, r := range fromMap {
+		diff.Removed = append(diff.Removed, newResourceDiff(r, models.ResourceChangeDelete))
+	}
+
+	for _, ds := range [][]ResourceDiff{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(ds, func(i, j int) bool { return ds[i].Address < ds[j].Address })
+	}
+	return &diff
+}
+
+// DiffTaskResources 对比两次任务统计的资源列表，fromTaskId 为空时与空的资源列表对比
+func DiffTaskResources(query *db.Session, fromTaskId, toTaskId models.Id) (*TaskResourceDiff, e.Error) {
+	from, er := GetTaskResources(query, fromTaskId)
+	if er != nil {
+		return nil, er
+	}
+	to, er := GetTaskResources(query, toTaskId)
+	if er != nil {
+		return nil, er
+	}
+	diff := DiffResources(from, to)
+	diff.FromTaskId, diff.ToTaskId = fromTaskId, toTaskId
+	return diff, nil
+}
+
+// GetEnvResourceSnapshots 获取环境中统计了资源列表的部署任务，按任务结束时间排序。
+// 销毁全部资源的任务不会保存资源记录，成功的 destroy 任务也作为空的资源列表返回
+func GetEnvResourceSnapshots(query *db.Session, envId models.Id) ([]ResourceSnapshot, e.Error) {
+	tasks := make([]models.Task, 0)
+	err := query.Model(&models.Task{}).
+		Where("env_id = ? AND end_at IS NOT NULL", envId).
+		Where(fmt.Sprintf("id IN (SELECT DISTINCT task_id FROM %s WHERE env_id = ?) OR (type = ? AND status = ?)",
+			models.Resource{}.TableName()), envId, models.TaskTypeDestroy, models.TaskComplete).
+		Order("end_at, created_at").
+		Find(&tasks)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	snapshots := make([]ResourceSnapshot, 0, len(tasks))
+	for i := range tasks {
+		if !tasks[i].IsEffectTask() {
+			continue
+		}
+		snapshots = append(snapshots, ResourceSnapshot{
+			TaskId:   tasks[i].Id,
+			TaskName: tasks[i].Name,
+			TaskType: tasks[i].Type,
+			EndAt:    tasks[i].EndAt,
+		})
+	}
+	return snapshots, nil
+}
+
+// LastResourceSnapshotBefore 返回在 t 及之前结束的最后一次资源统计，不存在时返回 nil
+func LastResourceSnapshotBefore(snapshots []ResourceSnapshot, t time.Time) *ResourceSnapshot {
+	var last *ResourceSnapshot
+	for i := range snapshots {
+		if snapshots[i].EndAt == nil || time.Time(*snapshots[i].EndAt).After(t) {
+			break
+		}
+		last = &snapshots[i]
+	}
+	return last
+}
+
+// ResourceSnapshotIndex 返回任务在 snapshots 中的位置，任务没有统计资源列表时返回 -1
+func ResourceSnapshotIndex(snapshots []ResourceSnapshot, taskId models.Id) int {
+	for i := range snapshots {
+		if snapshots[i].TaskId == taskId {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetResourceTimeline 获取环境中指定地址的资源在各次部署任务中的创建、修改及销毁记录
+func GetResourceTimeline(query *db.Session, envId models.Id, address string) ([]ResourceEvent, e.Error) {
+	snapshots, er := GetEnvResourceSnapshots(query, envId)
+	if er != nil {
+		return nil, er
+	}
+	rs := make([]models.Resource, 0)
+	if err := query.Model(&models.Resource{}).
+		Where("env_id = ? AND address = ?", envId, address).Find(&rs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return BuildResourceTimeline(snapshots, rs), nil
+}
+
+// BuildResourceTimeline 按资源统计的顺序对比资源记录，生成资源的变化记录
+func BuildResourceTimeline(snapshots []ResourceSnapshot, rs []models.Resource) []ResourceEvent {
+	taskResources := make(map[models.Id]*models.Resource, len(rs))
+	for i := range rs {
+		taskResources[rs[i].TaskId] = &rs[i]
+	}
+
+	events := make([]ResourceEvent, 0)
+	var prev *models.Resource
+	for _, s := range snapshots {
+		cur := taskResources[s.TaskId]
+		event := ResourceEvent{ResourceSnapshot: s}
+		switch {
+		case prev == nil && cur == nil:
+			continue
+		case prev == nil:
+			event.ResourceId, event.Action = cur.Id, models.ResourceChangeCreate
+		case cur == nil:
+			event.Action = models.ResourceChangeDelete
+		default:
+			if event.Action, event.Changes = diffResourceAttrs(prev, cur); event.Action == "" {
+				prev = cur
+				continue
+			}
+			event.ResourceId = cur.Id
+		}
+		events = append(events, event)
+		prev = cur
+	}
+	return events
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testResource(taskId models.Id, address string, attrs models.ResAttrs, sensitiveKeys ...string) models.Resource {
+	r := models.Resource{TaskId: taskId, Address: address, Type: "alicloud_instance", Attrs: attrs}
+	r.Id = models.Id(string(taskId) + "-" + address)
+	r.SensitiveKeys = sensitiveKeys
+	return r
+}
+
+func TestDiffResources(t *testing.T) {
+	from := []models.Resource{
+		testResource("t1", "alicloud_instance.a", models.ResAttrs{"id": "i-1", "instance_type": "ecs.g6.large"}),
+		testResource("t1", "alicloud_instance.b", models.ResAttrs{"id": "i-2", "password": "old"}, "password"),
+		testResource("t1", "alicloud_instance.c", models.ResAttrs{"id": "i-3"}),
+		testResource("t1", "alicloud_instance.d", models.ResAttrs{"id": "i-4"}),
+	}
+	to := []models.Resource{
+		testResource("t2", "alicloud_instance.a", models.ResAttrs{"id": "i-1", "instance_type": "ecs.g6.xlarge"}),
+		testResource("t2", "alicloud_instance.b", models.ResAttrs{"id": "i-2", "password": "new"}, "password"),
+		testResource("t2", "alicloud_instance.d", models.ResAttrs{"id": "i-5"}),
+		testResource("t2", "alicloud_instance.e", models.ResAttrs{"id": "i-6"}),
+	}
+
+	diff := DiffResources(from, to)
+	assert.Equal(t, []ResourceDiff{{Address: "alicloud_instance.e", Type: "alicloud_instance",
+		Action: models.ResourceChangeCreate}}, diff.Added)
+	assert.Equal(t, []ResourceDiff{{Address: "alicloud_instance.c", Type: "alicloud_instance",
+		Action: models.ResourceChangeDelete}}, diff.Removed)
+
+	if !assert.Len(t, diff.Changed, 3) {
+		return
+	}
+	assert.Equal(t, models.ResourceChangeUpdate, diff.Changed[0].Action)
+	assert.Equal(t, models.ResourceChangeAttrs{"instance_type": {Before: "ecs.g6.large", After: "ecs.g6.xlarge"}},
+		diff.Changed[0].Changes)
+	// 敏感属性的变化只标记，不返回实际的值
+	assert.Equal(t, models.ResourceChangeAttrs{"password": {Before: driftSensitiveValue, After: driftSensitiveValue,
+		Sensitive: true}}, diff.Changed[1].Changes)
+	// 资源 id 变化表示资源被重建
+	assert.Equal(t, models.ResourceChangeReplace, diff.Changed[2].Action)
+}
+
+func TestBuildResourceTimeline(t *testing.T) {
+	at := func(h int) *models.Time {
+		v := models.Time(time.Date(2021, 10, 1, h, 0, 0, 0, time.UTC))
+		return &v
+	}
+	snapshots := []ResourceSnapshot{
+		{TaskId: "t1", TaskType: models.TaskTypeApply, EndAt: at(1)},
+		{TaskId: "t2", TaskType: models.TaskTypeApply, EndAt: at(2)},
+		{TaskId: "t3", TaskType: models.TaskTypeApply, EndAt: at(3)},
+		{TaskId: "t4", TaskType: models.TaskTypeApply, EndAt: at(4)},
+		{TaskId: "t5", TaskType: models.TaskTypeDestroy, EndAt: at(5)},
+		{TaskId: "t6", TaskType: models.TaskTypeApply, EndAt: at(6)},
+	}
+	address := "alicloud_instance.a"
+	rs := []models.Resource{
+		testResource("t2", address, models.ResAttrs{"id": "i-1", "instance_type": "ecs.g6.large"}),
+		testResource("t3", address, models.ResAttrs{"id": "i-1", "instance_type": "ecs.g6.large"}),
+		testResource("t4", address, models.ResAttrs{"id": "i-1", "instance_type": "ecs.g6.xlarge"}),
+	}
+
+	events := BuildResourceTimeline(snapshots, rs)
+	if !assert.Len(t, events, 3) {
+		return
+	}
+	assert.Equal(t, models.Id("t2"), events[0].TaskId)
+	assert.Equal(t, models.ResourceChangeCreate, events[0].Action)
+	assert.Equal(t, rs[0].Id, events[0].ResourceId)
+	assert.Equal(t, models.Id("t4"), events[1].TaskId)
+	assert.Equal(t, models.ResourceChangeUpdate, events[1].Action)
+	assert.Equal(t, models.ResourceChangeAttrs{"instance_type": {Before: "ecs.g6.large", After: "ecs.g6.xlarge"}},
+		events[1].Changes)
+	assert.Equal(t, models.Id("t5"), events[2].TaskId)
+	assert.Equal(t, models.ResourceChangeDelete, events[2].Action)
+	assert.Empty(t, events[2].ResourceId)
+
+	assert.Nil(t, LastResourceSnapshotBefore(snapshots, time.Date(2021, 10, 1, 0, 30, 0, 0, time.UTC)))
+	assert.Equal(t, models.Id("t3"), LastResourceSnapshotBefore(snapshots,
+		time.Date(2021, 10, 1, 3, 30, 0, 0, time.UTC)).TaskId)
+	assert.Equal(t, models.Id("t6"), LastResourceSnapshotBefore(snapshots, time.Now()).TaskId)
+
+	assert.Equal(t, 0, ResourceSnapshotIndex(snapshots, "t1"))
+	assert.Equal(t, -1, ResourceSnapshotIndex(snapshots, "plan-task"))
+}
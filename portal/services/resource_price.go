@@ -0,0 +1,235 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	PriceCatalogCSV  = "csv"
+	PriceCatalogYAML = "yaml"
+)
+
+func CreateResourcePrice(tx *db.Session, price models.ResourcePrice) (*models.ResourcePrice, e.Error) {
+	if price.Id == "" {
+		price.Id = models.NewId("price")
+	}
+	if err := models.Create(tx, &price); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ResourcePriceAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &price, nil
+}
+
+func UpdateResourcePrice(tx *db.Session, id models.Id, attrs models.Attrs) (*models.ResourcePrice, e.Error) {
+	price := &models.ResourcePrice{}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.ResourcePrice{}, attrs); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ResourcePriceAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, fmt.Errorf("update resource price error: %v", err))
+	}
+	if err := tx.Where("id = ?", id).First(price); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("query resource price error: %v", err))
+	}
+	return price, nil
+}
+
+func DeleteResourcePrice(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.ResourcePrice{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete resource price error: %v", err))
+	}
+	return nil
+}
+
+func QueryResourcePrice(query *db.Session) *db.Session {
+	return query.Model(&models.ResourcePrice{})
+}
+
+func GetResourcePriceById(query *db.Session, id models.Id) (*models.ResourcePrice, e.Error) {
+	price := models.ResourcePrice{}
+	if err := query.Model(&models.ResourcePrice{}).Where("id = ?", id).First(&price); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ResourcePriceNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &price, nil
+}
+
+// GetOrgResourcePrices 获取组织的全部价格配置
+func GetOrgResourcePrices(query *db.Session, orgId models.Id) ([]models.ResourcePrice, e.Error) {
+	prices := make([]models.ResourcePrice, 0)
+	if err := query.Model(&models.ResourcePrice{}).Where("org_id = ?", orgId).Find(&prices); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return prices, nil
+}
+
+// priceCatalogItem 价格目录文件中的一项
+type priceCatalogItem struct {
+	ResourceType string  `yaml:"resourceType"`
+	Attribute    string  `yaml:"attribute"`
+	Value        string  `yaml:"value"`
+	Unit         string  `yaml:"unit"`
+	Price        float64 `yaml:"price"`
+	Description  string  `yaml:"description"`
+}
+
+func (i priceCatalogItem) price() models.ResourcePrice {
+	unit := i.Unit
+	if unit == "" {
+		unit = models.PriceUnitMonth
+	}
+	return models.ResourcePrice{
+		ResourceType: strings.TrimSpace(i.ResourceType),
+		Attribute:    strings.TrimSpace(i.Attribute),
+		Value:        strings.TrimSpace(i.Value),
+		Unit:         strings.ToLower(strings.TrimSpace(unit)),
+		Price:        i.Price,
+		Description:  i.Description,
+	}
+}
+
+// ParsePriceCatalog 解析 csv 或 yaml 格式的价格目录。
+// csv 首行为列名，支持的列与 yaml 的字段相同: resourceType,attribute,value,unit,price,description，
+// yaml 内容为价格项的列表
+func ParsePriceCatalog(format string, content []byte) ([]models.ResourcePrice, error) {
+	items := make([]priceCatalogItem, 0)
+	switch strings.ToLower(format) {
+	case PriceCatalogCSV:
+		var err error
+		if items, err = parsePriceCatalogCSV(content); err != nil {
+			return nil, err
+		}
+	case PriceCatalogYAML, "yml":
+		if err := yaml.Unmarshal(content, &items); err != nil {
+			return nil, fmt.Errorf("parse yaml: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported price catalog format '%s'", format)
+	}
+
+	prices := make([]models.ResourcePrice, 0, len(items))
+	for i, item := range items {
+		p := item.price()
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("item %d: %v", i+1, err)
+		}
+		prices = append(prices, p)
+	}
+	return prices, nil
+}
+
+func parsePriceCatalogCSV(content []byte) ([]priceCatalogItem, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("parse csv: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, h := range header {
+		// 忽略 utf-8 bom
+		columns[strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	if _, ok := columns["resourceType"]; !ok {
+		return nil, fmt.Errorf("csv column 'resourceType' is required")
+	}
+	if _, ok := columns["price"]; !ok {
+		return nil, fmt.Errorf("csv column 'price' is required")
+	}
+
+	items := make([]priceCatalogItem, 0)
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parse csv: %v", err)
+		}
+		get := func(col string) string {
+			if i, ok := columns[col]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		price, err := strconv.ParseFloat(get("price"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price '%s'", line, get("price"))
+		}
+		items = append(items, priceCatalogItem{
+			ResourceType: get("resourceType"),
+			Attribute:    get("attribute"),
+			Value:        get("value"),
+			Unit:         get("unit"),
+			Price:        price,
+			Description:  get("description"),
+		})
+	}
+	return items, nil
+}
+
+func resourcePriceKey(p *models.ResourcePrice) string {
+	return strings.Join([]string{p.ResourceType, p.Attribute, p.Value}, "\n")
+}
+
+// ImportResourcePrices 导入价格目录，已存在的价格项(资源类型、属性及属性值相同)会被更新。
+// replace 为 true 时先删除组织现有的全部价格配置
+func ImportResourcePrices(tx *db.Session, orgId models.Id, prices []models.ResourcePrice, replace bool) (created int, updated int, er e.Error) {
+	if replace {
+		if _, err := tx.Where("org_id = ?", orgId).Delete(&models.ResourcePrice{}); err != nil {
+			return 0, 0, e.New(e.DBError, err)
+		}
+	}
+
+	exists, er := GetOrgResourcePrices(tx, orgId)
+	if er != nil {
+		return 0, 0, er
+	}
+	existIds := make(map[string]models.Id, len(exists))
+	for i := range exists {
+		existIds[resourcePriceKey(&exists[i])] = exists[i].Id
+	}
+
+	for i := range prices {
+		p := prices[i]
+		p.OrgId = orgId
+		key := resourcePriceKey(&p)
+		if id, ok := existIds[key]; ok {
+			if _, er := UpdateResourcePrice(tx, id, models.Attrs{
+				"unit":        p.Unit,
+				"price":       p.Price,
+				"description": p.Description,
+			}); er != nil {
+				return 0, 0, er
+			}
+			updated += 1
+			continue
+		}
+		rp, er := CreateResourcePrice(tx, p)
+		if er != nil {
+			return 0, 0, er
+		}
+		existIds[key] = rp.Id
+		created += 1
+	}
+	return created, updated, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"cloudiac/portal/models"
+	"encoding/csv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInventoryAttrFilter(t *testing.T) {
+	f, err := ParseInventoryAttrFilter("instance_type=ecs.g6.xlarge")
+	assert.NoError(t, err)
+	assert.Equal(t, InventoryAttrFilter{Path: "instance_type", Value: "ecs.g6.xlarge"}, f)
+
+	f, err = ParseInventoryAttrFilter("tags.Name=a=b")
+	assert.NoError(t, err)
+	assert.Equal(t, InventoryAttrFilter{Path: "tags.Name", Value: "a=b"}, f)
+
+	for _, s := range []string{"instance_type", "=x", "tags..Name=x", `tags."Name=x`} {
+		_, err = ParseInventoryAttrFilter(s)
+		assert.Error(t, err, s)
+	}
+
+	cases := map[string]string{
+		"instance_type":           `$."instance_type"`,
+		"tags.Name":               `$."tags"."Name"`,
+		"network_interfaces.0.ip": `$."network_interfaces"[0]."ip"`,
+		"0":                       `$."0"`,
+		"security_groups.1":       `$."security_groups"[1]`,
+	}
+	for path, expected := range cases {
+		p, err := attrJsonPath(path)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, p, path)
+	}
+}
+
+func TestRedactResourceAttrs(t *testing.T) {
+	attrs := models.ResAttrs{
+		"password":   "Passw0rd",
+		"private_ip": "172.16.0.10",
+		"tags":       map[string]interface{}{"Name": "web"},
+	}
+	rs := RedactResourceAttrs(attrs, []string{"password"})
+	assert.Equal(t, driftSensitiveValue, rs["password"])
+	assert.Equal(t, "172.16.0.10", rs["private_ip"])
+	// 不修改原属性
+	assert.Equal(t, "Passw0rd", attrs["password"])
+
+	r := &InventoryResource{Resource: models.Resource{Address: "alicloud_instance.web", Attrs: rs}}
+	assert.True(t, matchInventoryResource(r, ""))
+	assert.True(t, matchInventoryResource(r, "172.16.0.10"))
+	assert.True(t, matchInventoryResource(r, "WEB"))
+	assert.False(t, matchInventoryResource(r, "passw0rd"))
+}
+
+func TestWriteInventoryCSV(t *testing.T) {
+	buf := bytes.Buffer{}
+	cw := csv.NewWriter(&buf)
+	assert.NoError(t, writeInventoryCSVRecord(cw, &InventoryResource{
+		Resource: models.Resource{
+			Provider: "registry.terraform.io/aliyun/alicloud",
+			Address:  "alicloud_instance.web",
+			Type:     "alicloud_instance",
+			Name:     "web",
+			Attrs:    RedactResourceAttrs(models.ResAttrs{"password": "Passw0rd"}, []string{"password"}),
+		},
+		EnvName:     "prod",
+		ProjectName: "demo",
+	}))
+	cw.Flush()
+	assert.Equal(t, "demo,prod,alicloud_instance.web,registry.terraform.io/aliyun/alicloud,,alicloud_instance,web,,"+
+		`"{""password"":""(sensitive value)""}"`+"\n", buf.String())
+
+	assert.Equal(t, []InventoryCount{{"b", 2}, {"a", 1}, {"c", 1}},
+		sortInventoryCounts(map[string]int64{"a": 1, "b": 2, "c": 1}))
+}
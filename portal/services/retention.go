@@ -0,0 +1,225 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+日志保存周期(系统配置 PERIOD_OF_LOG_SAVE)的清理逻辑:
+清理日志存储(logstorage)中超过保存周期的任务日志及执行结果(plan json、state json 等)，以及 pull runner 的任务记录。
+以下数据不会被清理:
+1. portal http state backend 保存的 state(tfstate/ 路径)
+2. state 版本引用的 state 文件
+3. 未结束的任务，以及环境、模板当前引用的任务(最后一次部署、资源统计、扫描任务)的数据
+*/
+
+const (
+	LogSavePermanent   = "Permanent"
+	retentionBatchSize = 500
+)
+
+// RetentionReport 过期数据清理结果，dryRun 时为将要清理的数据统计
+type RetentionReport struct {
+	Period      string       `json:"period"`      // 日志保存周期配置
+	Cutoff      *models.Time `json:"cutoff"`      // 早于该时间的数据会被清理，为空表示永久保存
+	DryRun      bool         `json:"dryRun"`      // 是否只统计不清理
+	Tasks       int          `json:"tasks"`       // 清理了数据的任务数量
+	Storages    int          `json:"storages"`    // 清理的日志及执行结果数量
+	StorageSize int64        `json:"storageSize"` // 清理的日志及执行结果大小(字节)
+	RunnerJobs  int          `json:"runnerJobs"`  // 清理的 pull runner 任务记录数量
+}
+
+// ParseLogSavePeriod 解析日志保存周期，配置为天数(如 30 或 30d)，为空或 Permanent 表示永久保存，返回 0
+func ParseLogSavePeriod(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, LogSavePermanent) {
+		return 0, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("invalid log save period '%s'", value)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// GetLogSavePeriod 获取日志保存周期配置
+func GetLogSavePeriod(sess *db.Session) (string, time.Duration, e.Error) {
+	cfg := models.SystemCfg{}
+	if err := QuerySystemConfig(sess).Where("name = ?", models.SysCfgNamePeriodOfLogSave).First(&cfg); err != nil {
+		if e.IsRecordNotFound(err) {
+			return "", 0, nil
+		}
+		return "", 0, e.New(e.DBError, err)
+	}
+	period, err := ParseLogSavePeriod(cfg.Value)
+	if err != nil {
+		return cfg.Value, 0, e.New(e.InternalError, err)
+	}
+	return cfg.Value, period, nil
+}
+
+// storageTaskId 从日志存储路径中解析任务 id，路径格式为 {projectId}/{envId}/{taskId}/... 或 {tplId}/{taskId}/...
+func storageTaskId(path string) models.Id {
+	for _, name := range strings.Split(path, "/") {
+		if strings.HasPrefix(name, "run-") {
+			return models.Id(name)
+		}
+	}
+	return ""
+}
+
+// retainedTaskIds 返回 ids 中数据需要保留的任务
+func retainedTaskIds(sess *db.Session, ids []models.Id) (map[models.Id]bool, error) {
+	retained := make(map[models.Id]bool)
+	exitedStatus := []string{models.TaskFailed, models.TaskRejected, models.TaskComplete, models.TaskCancelled}
+
+	var taskIds []models.Id
+	for _, m := range []interface{}{&models.Task{}, &models.ScanTask{}} {
+		taskIds = taskIds[:0]
+		if err := sess.Model(m).Where("id IN (?) AND status NOT IN (?)", ids, exitedStatus).
+			Pluck("id", &taskIds); err != nil {
+			return nil, err
+		}
+		for _, id := range taskIds {
+			retained[id] = true
+		}
+	}
+
+	var envs []models.Env
+	if err := sess.Model(&models.Env{}).
+		Select("last_task_id, last_res_task_id, last_scan_task_id").
+		Where("last_task_id IN (?) OR last_res_task_id IN (?) OR last_scan_task_id IN (?)", ids, ids, ids).
+		Find(&envs); err != nil {
+		return nil, err
+	}
+	for _, env := range envs {
+		retained[env.LastTaskId] = true
+		retained[env.LastResTaskId] = true
+		retained[env.LastScanTaskId] = true
+	}
+
+	taskIds = taskIds[:0]
+	if err := sess.Model(&models.Template{}).Where("last_scan_task_id IN (?)", ids).
+		Pluck("last_scan_task_id", &taskIds); err != nil {
+		return nil, err
+	}
+	for _, id := range taskIds {
+		retained[id] = true
+	}
+	return retained, nil
+}
+
+// purgeExpiredStorages 清理 cutoff 之前保存的任务日志及执行结果
+func purgeExpiredStorages(sess *db.Session, storage logstorage.LogStorage, cutoff time.Time, report *RetentionReport) error {
+	tasks := make(map[models.Id]bool)
+	items := make([]logstorage.ObjectInfo, 0, retentionBatchSize)
+	err := storage.Walk(func(info logstorage.ObjectInfo) error {
+		// db 存储中同时保存了 http state backend 的 state
+		if !info.ModTime.Before(cutoff) || IsTfStateStoragePath(info.Path) {
+			return nil
+		}
+		items = append(items, info)
+		if len(items) < retentionBatchSize {
+			return nil
+		}
+		err := purgeStorageItems(sess, storage, items, tasks, report)
+		items = items[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return purgeStorageItems(sess, storage, items, tasks, report)
+}
+
+func purgeStorageItems(sess *db.Session, storage logstorage.LogStorage, items []logstorage.ObjectInfo,
+	tasks map[models.Id]bool, report *RetentionReport) error {
+	paths := make([]string, 0, len(items))
+	taskIds := make([]models.Id, 0, len(items))
+	for _, item := range items {
+		paths = append(paths, item.Path)
+		if id := storageTaskId(item.Path); id != "" {
+			taskIds = append(taskIds, id)
+		}
+	}
+	if len(taskIds) == 0 {
+		return nil
+	}
+
+	retained, err := retainedTaskIds(sess, taskIds)
+	if err != nil {
+		return err
+	}
+	var versionPaths []string
+	if err := sess.Model(&models.StateVersion{}).Where("path IN (?)", paths).
+		Pluck("path", &versionPaths); err != nil {
+		return err
+	}
+	versionPathSet := make(map[string]bool, len(versionPaths))
+	for _, p := range versionPaths {
+		versionPathSet[p] = true
+	}
+
+	for _, item := range items {
+		taskId := storageTaskId(item.Path)
+		// 无法确定所属任务的数据不清理
+		if taskId == "" || retained[taskId] || versionPathSet[item.Path] {
+			continue
+		}
+		if !report.DryRun {
+			if err := storage.Delete(item.Path); err != nil {
+				return err
+			}
+		}
+		tasks[taskId] = true
+		report.Storages += 1
+		report.StorageSize += item.Size
+	}
+	report.Tasks = len(tasks)
+	return nil
+}
+
+// PurgeExpiredData 按日志保存周期清理过期数据，dryRun 为 true 时只统计不清理
+func PurgeExpiredData(sess *db.Session, now time.Time, dryRun bool) (*RetentionReport, e.Error) {
+	value, period, er := GetLogSavePeriod(sess)
+	if er != nil {
+		return nil, er
+	}
+	report := RetentionReport{Period: value, DryRun: dryRun}
+	if period <= 0 {
+		return &report, nil
+	}
+	cutoff := models.Time(now.Add(-period))
+	report.Cutoff = &cutoff
+
+	if err := purgeExpiredStorages(sess, logstorage.Get(), time.Time(cutoff), &report); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	// pull runner 任务记录中保存了任务请求(包含加密的变量)及日志，任务结束后不再需要
+	jobQuery := sess.Model(&models.RunnerJob{}).
+		Where("status = ? AND updated_at < ?", models.RunnerJobExited, time.Time(cutoff))
+	if dryRun {
+		count, err := jobQuery.Count()
+		if err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		report.RunnerJobs = int(count)
+	} else {
+		count, err := jobQuery.Delete(&models.RunnerJob{})
+		if err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		report.RunnerJobs = int(count)
+	}
+	return &report, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogSavePeriod(t *testing.T) {
+	cases := []struct {
+		value  string
+		expect time.Duration
+		hasErr bool
+	}{
+		{"", 0, false},
+		{"Permanent", 0, false},
+		{"30", 30 * 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"0", 0, true},
+		{"1m", 0, true},
+	}
+	for _, c := range cases {
+		period, err := ParseLogSavePeriod(c.value)
+		assert.Equal(t, c.hasErr, err != nil, c.value)
+		assert.Equal(t, c.expect, period, c.value)
+	}
+}
+
+func TestStorageTaskId(t *testing.T) {
+	assert.Equal(t, models.Id("run-c1"), storageTaskId("p-1/env-1/run-c1/step0/log.txt"))
+	assert.Equal(t, models.Id("run-c2"), storageTaskId("tpl-1/run-c2/tfscan.json"))
+	assert.Equal(t, models.Id(""), storageTaskId("tfstate/org/project/env/terraform.tfstate"))
+}
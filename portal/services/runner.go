@@ -0,0 +1,251 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/consul/api"
+)
+
+// RunnerInfo runner 状态及标签
+type RunnerInfo struct {
+	Id      string   `json:"id"`
+	Tags    []string `json:"tags"`
+	Healthy bool     `json:"healthy"` // consul 健康检查是否通过
+}
+
+// MatchTags runner 是否包含所有指定标签
+func (r *RunnerInfo) MatchTags(tags []string) bool {
+	for _, tag := range tags {
+		matched := false
+		for _, t := range r.Tags {
+			if t == tag {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// ListRunners 查询注册到 consul 的 runner 及拉取模式 runner 及其健康状态
+func ListRunners() ([]*RunnerInfo, e.Error) {
+	config := api.DefaultConfig()
+	config.Address = configs.Get().Consul.Address
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, e.New(e.ConsulConnError, err)
+	}
+
+	services, err := client.Agent().Services()
+	if err != nil {
+		return nil, e.New(e.ConsulConnError, err)
+	}
+	checks, err := client.Agent().Checks()
+	if err != nil {
+		return nil, e.New(e.ConsulConnError, err)
+	}
+	// 服务可能有多个检查项，全部通过才认为服务健康
+	unhealthy := make(map[string]bool)
+	for _, check := range checks {
+		if check.Status != api.HealthPassing {
+			unhealthy[check.ServiceID] = true
+		}
+	}
+
+	runners := make([]*RunnerInfo, 0)
+	for _, s := range services {
+		if !strings.Contains(strings.ToLower(s.Service), "runner") {
+			continue
+		}
+		runners = append(runners, &RunnerInfo{
+			Id:      s.ID,
+			Tags:    s.Tags,
+			Healthy: !unhealthy[s.ID],
+		})
+	}
+
+	pullRunners, er := ListPullRunners(db.Get())
+	if er != nil {
+		return nil, er
+	}
+	runners = append(runners, pullRunners...)
+	sort.Slice(runners, func(i, j int) bool {
+		return runners[i].Id < runners[j].Id
+	})
+	return runners, nil
+}
+
+// IsRunnerHealthy runner 是否存在且健康检查通过
+func IsRunnerHealthy(runnerId string) (bool, e.Error) {
+	runners, err := ListRunners()
+	if err != nil {
+		return false, err
+	}
+	for _, r := range runners {
+		if r.Id == runnerId {
+			return r.Healthy, nil
+		}
+	}
+	return false, nil
+}
+
+// SelectRunner 从 runners 中选择匹配标签、健康且未达并发限制(max 为 0 表示不限制)的 runner，
+// 优先选择执行中任务最少的 runner。exclude 中的 runner 不参与选择。
+// 没有匹配标签的健康 runner 时返回 (nil, false)，匹配的 runner 都已达并发限制时返回 (nil, true)
+func SelectRunner(runners []*RunnerInfo, tags []string, load map[string]int, max int, exclude ...string) (*RunnerInfo, bool) {
+	var (
+		selected *RunnerInfo
+		matched  bool
+	)
+	for _, r := range runners {
+		if !r.Healthy || !r.MatchTags(tags) || utils.StrInArray(r.Id, exclude...) {
+			continue
+		}
+		matched = true
+		if max > 0 && load[r.Id] >= max {
+			continue
+		}
+		if selected == nil || load[r.Id] < load[selected.Id] {
+			selected = r
+		}
+	}
+	return selected, matched
+}
+
+// ChangeTaskRunner 更新任务的执行 runner，用于按标签调度及 runner 故障时切换
+func ChangeTaskRunner(sess *db.Session, task *models.Task, runnerId string) e.Error {
+	if _, err := sess.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("runner_id", runnerId); err != nil {
+		return e.New(e.DBError, fmt.Errorf("update task runner: %v", err))
+	}
+	task.RunnerId = runnerId
+	return nil
+}
+
+// GetRunnerKeepTaskIds 查询 runner 上需要保留工作目录的任务:
+// 未结束的任务(包括等待审批的任务)及可以恢复执行的失败或被取消的任务(条件与 ResumeTask 一致)
+func GetRunnerKeepTaskIds(sess *db.Session, runnerId string) ([]string, e.Error) {
+	taskTable := models.Task{}.TableName()
+	ids := make([]string, 0)
+	err := sess.Model(&models.Task{}).
+		Joins(fmt.Sprintf("LEFT JOIN %s AS env ON env.id = %s.env_id", models.Env{}.TableName(), taskTable)).
+		Where(fmt.Sprintf("%s.runner_id = ?", taskTable), runnerId).
+		Where(fmt.Sprintf("%[1]s.status IN (?) OR (%[1]s.status IN (?) AND (%[1]s.type NOT IN (?) OR env.last_task_id = %[1]s.id))",
+			taskTable), []string{models.TaskPending, models.TaskRunning, models.TaskApproving},
+			ResumableTaskStatus, models.EffectTaskTypes).
+		Pluck(fmt.Sprintf("%s.id", taskTable), &ids)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return ids, nil
+}
+
+// ReportRunnerKeepTasks 向 runner 上报需要保留工作目录的任务，runner 清理过期工作目录时跳过这些任务
+func ReportRunnerKeepTasks(sess *db.Session, runnerId string) error {
+	taskIds, er := GetRunnerKeepTaskIds(sess, runnerId)
+	if er != nil {
+		return er
+	}
+	runnerAddr, err := GetRunnerAddress(runnerId)
+	if err != nil {
+		return err
+	}
+	respData, err := RunnerRequest(runnerId, runnerAddr, consts.RunnerWorkspaceKeepURL,
+		runner.WorkspaceKeepTasks{TaskIds: taskIds}, consts.RunnerConnectTimeout)
+	if err != nil {
+		return err
+	}
+	resp := runner.Response{}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return fmt.Errorf("unexpected response: %s", respData)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf(resp.Error)
+	}
+	return nil
+}
+
+// signRunnerRequest 配置了 runner 签名密钥时对请求签名，返回使用的密钥及请求签名
+func signRunnerRequest(runnerId string, header http.Header, method string, u *url.URL, body []byte) (*configs.RunnerAuthKey, string) {
+	key := configs.Get().Portal.RunnerAuthKey(runnerId)
+	if key == nil {
+		return nil, ""
+	}
+	return key, runner.SignRequest(header, key, method, u.Path, u.RawQuery, body)
+}
+
+// RunnerRequest 以 POST 方式调用 runner 接口，返回响应内容，timeout 为请求的超时时间。
+// 配置了 runner 签名密钥时对请求签名，并校验 runner 响应中的签名
+func RunnerRequest(runnerId string, runnerAddr string, urlPath string, data interface{}, timeout time.Duration) (
+	[]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, utils.JoinURL(runnerAddr, urlPath), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	key, sign := signRunnerRequest(runnerId, req.Header, req.Method, req.URL, body)
+
+	resp, respData, err := utils.HttpDo(req, int(consts.RunnerConnectTimeout.Seconds()), int(timeout.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("runner authentication failed: %s", respData)
+	}
+	if key != nil {
+		if err := runner.VerifyRunnerSignature(key, sign, resp.Header); err != nil {
+			return nil, err
+		}
+	}
+	return respData, nil
+}
+
+// RunnerWebsocketDail 连接 runner 的 websocket 接口，签名及校验规则同 RunnerRequest
+func RunnerWebsocketDail(runnerId string, runnerAddr string, urlPath string, params url.Values) (
+	*websocket.Conn, *http.Response, error) {
+	u, err := url.Parse(runnerAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Path = path.Join(u.Path, urlPath)
+	u.RawQuery = params.Encode()
+
+	header := http.Header{}
+	key, sign := signRunnerRequest(runnerId, header, http.MethodGet, u, nil)
+	wsConn, resp, err := utils.WebsocketDailWithHeader(runnerAddr, urlPath, params, header)
+	if err != nil {
+		return wsConn, resp, err
+	}
+	if key != nil {
+		if err := runner.VerifyRunnerSignature(key, sign, resp.Header); err != nil {
+			_ = wsConn.Close()
+			return nil, resp, err
+		}
+	}
+	return wsConn, resp, nil
+}
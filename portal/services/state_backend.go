@@ -0,0 +1,261 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// StateHttpUsername portal 提供的 http state backend 的认证用户名
+const StateHttpUsername = "cloudiac"
+
+// terraform backend 读取认证信息的环境变量
+const (
+	StateEnvAwsAccessKey = "AWS_ACCESS_KEY_ID"
+	StateEnvAwsSecretKey = "AWS_SECRET_ACCESS_KEY"
+	StateEnvHttpPassword = "TF_HTTP_PASSWORD"
+)
+
+func CreateStateBackend(tx *db.Session, backend models.StateBackend) (*models.StateBackend, e.Error) {
+	if backend.Id == "" {
+		backend.Id = models.NewId("sb")
+	}
+	if err := models.Create(tx, &backend); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.StateBackendAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &backend, nil
+}
+
+func UpdateStateBackend(tx *db.Session, id models.Id, attrs models.Attrs) (*models.StateBackend, e.Error) {
+	backend := &models.StateBackend{}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.StateBackend{}, attrs); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.StateBackendAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, fmt.Errorf("update state backend error: %v", err))
+	}
+	if err := tx.Where("id = ?", id).First(backend); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("query state backend error: %v", err))
+	}
+	return backend, nil
+}
+
+// DeleteStateBackend 删除 state backend 配置，已有环境使用的配置不允许删除
+func DeleteStateBackend(tx *db.Session, id models.Id) e.Error {
+	if inUse, err := tx.Model(&models.Env{}).Where("state_backend_id = ?", id).Exists(); err != nil {
+		return e.New(e.DBError, err)
+	} else if inUse {
+		return e.New(e.StateBackendInUse)
+	}
+	if _, err := tx.Where("id = ?", id).Delete(&models.StateBackend{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete state backend error: %v", err))
+	}
+	return nil
+}
+
+func QueryStateBackend(query *db.Session) *db.Session {
+	return query.Model(&models.StateBackend{})
+}
+
+func GetStateBackendById(query *db.Session, id models.Id) (*models.StateBackend, e.Error) {
+	backend := models.StateBackend{}
+	if err := query.Model(&models.StateBackend{}).Where("id = ?", id).First(&backend); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.StateBackendNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &backend, nil
+}
+
+// ResolveStateBackend 按 云模板 > 项目 > 组织 的优先级查找环境使用的 state backend，
+// 未配置时返回 nil，表示使用 consul
+func ResolveStateBackend(query *db.Session, orgId, projectId, tplId models.Id) (*models.StateBackend, e.Error) {
+	backends := make([]models.StateBackend, 0)
+	if err := query.Model(&models.StateBackend{}).Where("org_id = ?", orgId).
+		Where("((project_id = '' AND tpl_id = '') OR (project_id = ? AND tpl_id = '') OR (project_id = '' AND tpl_id = ?))",
+			projectId, tplId).Find(&backends); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	var (
+		found    *models.StateBackend
+		priority = -1
+	)
+	for i := range backends {
+		p := 0
+		if backends[i].TplId != "" {
+			p = 2
+		} else if backends[i].ProjectId != "" {
+			p = 1
+		}
+		if p > priority {
+			found, priority = &backends[i], p
+		}
+	}
+	return found, nil
+}
+
+// EncryptStateBackendConfig 加密 backend 配置中的认证信息
+func EncryptStateBackendConfig(cfg *models.StateBackendConfig) error {
+	for _, v := range []*string{&cfg.AccessKey, &cfg.SecretKey, &cfg.Password} {
+		if *v == "" {
+			continue
+		}
+		encrypted, err := utils.AesEncrypt(*v)
+		if err != nil {
+			return err
+		}
+		*v = encrypted
+	}
+	return nil
+}
+
+// HideStateBackendSecrets 返回数据中不展示认证信息
+func HideStateBackendSecrets(backend *models.StateBackend) *models.StateBackend {
+	backend.Config.AccessKey = ""
+	backend.Config.SecretKey = ""
+	backend.Config.Password = ""
+	return backend
+}
+
+// StateHttpPassword 生成访问 portal http state backend 的密码，每个环境的密码不同
+func StateHttpPassword(envId models.Id) string {
+	mac := hmac.New(sha256.New, []byte(configs.Get().SecretKey))
+	mac.Write([]byte("tfstate:" + envId.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StateHttpAddress portal 提供的 http state backend 地址
+func StateHttpAddress(envId models.Id) string {
+	return fmt.Sprintf("%s/api/v1/tfstate/%s", strings.TrimRight(configs.Get().Portal.Address, "/"), envId)
+}
+
+// encodeSecret 认证信息已经加密保存，直接编码为加密变量传递给 runner
+func encodeSecret(v string) string {
+	return utils.EncodeSecretVar(v, v != "")
+}
+
+// BuildStateStore 构建 runner 使用的 state 存储配置，backend 为 nil 时使用 consul。
+// 认证信息不包含在存储配置中，通过 BuildStateStoreEnv 以环境变量的形式传递
+func BuildStateStore(backend *models.StateBackend, envId models.Id, statePath string) (runner.StateStore, error) {
+	store := runner.StateStore{
+		Backend: runner.StateBackendConsul,
+		Scheme:  "http",
+		Path:    statePath,
+	}
+	if backend == nil {
+		return store, nil
+	}
+
+	cfg := backend.Config
+	store.Backend = backend.Type
+	switch backend.Type {
+	case models.StateBackendConsul:
+		store.Address = cfg.Address
+		if cfg.Scheme != "" {
+			store.Scheme = cfg.Scheme
+		}
+	case models.StateBackendS3:
+		store.S3 = &runner.S3StateBackend{
+			Bucket:         cfg.Bucket,
+			Region:         cfg.Region,
+			Endpoint:       cfg.Endpoint,
+			ForcePathStyle: cfg.ForcePathStyle,
+		}
+	case models.StateBackendLocal:
+	case models.StateBackendHttp:
+		if cfg.Address != "" {
+			store.Http = &runner.HttpStateBackend{
+				Address:       cfg.Address,
+				LockAddress:   cfg.LockAddress,
+				UnlockAddress: cfg.UnlockAddress,
+				Username:      cfg.Username,
+			}
+			break
+		}
+
+		// 未指定地址时使用 portal 提供的 http backend
+		addr := StateHttpAddress(envId)
+		store.Http = &runner.HttpStateBackend{
+			Address:       addr,
+			LockAddress:   addr,
+			UnlockAddress: addr,
+			Username:      StateHttpUsername,
+		}
+	default:
+		return store, fmt.Errorf("unsupported state backend type '%s'", backend.Type)
+	}
+	return store, nil
+}
+
+// stateBackendSecrets 返回 backend 的认证信息(加密保存的值)，key 为 terraform 读取该认证信息的环境变量
+func stateBackendSecrets(backend *models.StateBackend, envId models.Id) (map[string]string, error) {
+	secrets := make(map[string]string)
+	if backend == nil {
+		return secrets, nil
+	}
+
+	cfg := backend.Config
+	switch backend.Type {
+	case models.StateBackendS3:
+		if cfg.AccessKey != "" {
+			secrets[StateEnvAwsAccessKey] = cfg.AccessKey
+			secrets[StateEnvAwsSecretKey] = cfg.SecretKey
+		}
+	case models.StateBackendHttp:
+		if cfg.Address == "" {
+			password, err := utils.AesEncrypt(StateHttpPassword(envId))
+			if err != nil {
+				return nil, err
+			}
+			secrets[StateEnvHttpPassword] = password
+		} else if cfg.Password != "" {
+			secrets[StateEnvHttpPassword] = cfg.Password
+		}
+	}
+	return secrets, nil
+}
+
+// BuildStateStoreEnv 返回以加密变量形式传递给 runner 的 backend 认证信息环境变量。
+// 认证信息不写入生成的 tf 文件，避免明文保存在工作目录及 .terraform 目录中
+func BuildStateStoreEnv(backend *models.StateBackend, envId models.Id) (map[string]string, error) {
+	secrets, err := stateBackendSecrets(backend, envId)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range secrets {
+		secrets[k] = encodeSecret(v)
+	}
+	return secrets, nil
+}
+
+// GetStateBackendSecretValues 返回 backend 认证信息的明文，用于替换任务日志中的敏感信息
+func GetStateBackendSecretValues(backend *models.StateBackend, envId models.Id) ([]string, error) {
+	secrets, err := stateBackendSecrets(backend, envId)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(secrets))
+	for _, v := range secrets {
+		value, err := utils.AesDecrypt(v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
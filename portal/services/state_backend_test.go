@@ -0,0 +1,75 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildStateStore(t *testing.T) {
+	statePath := "org/project/env/terraform.tfstate"
+
+	store, err := BuildStateStore(nil, "env-1", statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, runner.StateBackendConsul, store.Backend)
+	assert.Equal(t, "http", store.Scheme)
+	assert.Equal(t, statePath, store.Path)
+
+	store, err = BuildStateStore(&models.StateBackend{
+		Type: models.StateBackendS3,
+		Config: models.StateBackendConfig{
+			Bucket:         "tfstate",
+			Region:         "us-east-1",
+			Endpoint:       "http://minio:9000",
+			ForcePathStyle: true,
+			AccessKey:      "encrypted-ak",
+			SecretKey:      "encrypted-sk",
+		},
+	}, "env-1", statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, runner.StateBackendS3, store.Backend)
+	assert.Equal(t, statePath, store.Path)
+	if assert.NotNil(t, store.S3) {
+		assert.Equal(t, "tfstate", store.S3.Bucket)
+		assert.True(t, store.S3.ForcePathStyle)
+	}
+	// 认证信息通过加密的环境变量传递
+	env, err := BuildStateStoreEnv(&models.StateBackend{
+		Type:   models.StateBackendS3,
+		Config: models.StateBackendConfig{AccessKey: "encrypted-ak", SecretKey: "encrypted-sk"},
+	}, "env-1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		StateEnvAwsAccessKey: "secret:encrypted-ak",
+		StateEnvAwsSecretKey: "secret:encrypted-sk",
+	}, env)
+
+	store, err = BuildStateStore(&models.StateBackend{
+		Type: models.StateBackendHttp,
+		Config: models.StateBackendConfig{
+			Address:  "https://state.example.com/env-1",
+			Username: "iac",
+		},
+	}, "env-1", statePath)
+	assert.NoError(t, err)
+	if assert.NotNil(t, store.Http) {
+		assert.Equal(t, "https://state.example.com/env-1", store.Http.Address)
+		assert.Equal(t, "", store.Http.LockAddress)
+	}
+	env, err = BuildStateStoreEnv(&models.StateBackend{
+		Type:   models.StateBackendHttp,
+		Config: models.StateBackendConfig{Address: "https://state.example.com/env-1", Username: "iac"},
+	}, "env-1")
+	assert.NoError(t, err)
+	assert.Empty(t, env)
+	env, err = BuildStateStoreEnv(nil, "env-1")
+	assert.NoError(t, err)
+	assert.Empty(t, env)
+
+	_, err = BuildStateStore(&models.StateBackend{Type: "unknown"}, "env-1", statePath)
+	assert.Error(t, err)
+}
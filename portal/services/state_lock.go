@@ -0,0 +1,246 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// terraform consul backend 的锁及锁信息保存在 state path 下的这两个 key 中
+const (
+	consulStateLockSuffix     = "/.lock"
+	consulStateLockInfoSuffix = "/.lockinfo"
+)
+
+// tfLockInfo terraform 写入 backend 的锁信息
+type tfLockInfo struct {
+	ID        string    `json:"ID"`
+	Operation string    `json:"Operation"`
+	Info      string    `json:"Info"`
+	Who       string    `json:"Who"`
+	Version   string    `json:"Version"`
+	Created   time.Time `json:"Created"`
+	Path      string    `json:"Path"`
+}
+
+type StateLockInfo struct {
+	Backend   string `json:"backend"`   // state backend 类型
+	Supported bool   `json:"supported"` // 是否支持查询锁信息，不支持时需要手动指定锁 ID 解锁
+	Locked    bool   `json:"locked"`    // 是否已加锁
+
+	LockId    string       `json:"lockId"`    // 锁 ID
+	Operation string       `json:"operation"` // 加锁的 terraform 操作
+	Who       string       `json:"who"`       // 持有者
+	Version   string       `json:"version"`   // terraform 版本
+	CreatedAt *models.Time `json:"createdAt"` // 加锁时间
+
+	TaskId   models.Id `json:"taskId"`   // 加锁时环境正在执行的任务
+	TaskName string    `json:"taskName"` // 加锁时环境正在执行的任务名称
+}
+
+func (l *StateLockInfo) setLockInfo(info *tfLockInfo) {
+	l.Locked = true
+	l.LockId = info.ID
+	l.Operation = info.Operation
+	l.Who = info.Who
+	l.Version = info.Version
+	if !info.Created.IsZero() {
+		t := models.Time(info.Created)
+		l.CreatedAt = &t
+	}
+}
+
+// GetEnvStateLock 查询环境 state 当前的锁。
+// 目前支持查询 consul 及 portal 内置 http backend 的锁，其他 backend 返回 Supported=false
+func GetEnvStateLock(sess *db.Session, env *models.Env) (*StateLockInfo, e.Error) {
+	var backend *models.StateBackend
+	if env.StateBackendId != "" {
+		var err e.Error
+		if backend, err = GetStateBackendById(sess, env.StateBackendId); err != nil {
+			return nil, err
+		}
+	}
+
+	lock := StateLockInfo{Backend: models.StateBackendConsul}
+	if backend != nil {
+		lock.Backend = backend.Type
+	}
+
+	switch {
+	case backend == nil || backend.Type == models.StateBackendConsul:
+		address := configs.Get().Consul.Address
+		if backend != nil && backend.Config.Address != "" {
+			address = backend.Config.Address
+		}
+		scheme := ""
+		if backend != nil {
+			scheme = backend.Config.Scheme
+		}
+		info, locked, err := getConsulStateLock(address, scheme, env.StatePath)
+		if err != nil {
+			return nil, err
+		}
+		lock.Supported = true
+		if info != nil {
+			lock.setLockInfo(info)
+		}
+		lock.Locked = locked
+	case backend.Type == models.StateBackendHttp && backend.Config.Address == "":
+		current, err := GetTfStateLock(sess, env.StatePath)
+		if err != nil {
+			return nil, err
+		}
+		lock.Supported = true
+		if current != nil {
+			info := tfLockInfo{ID: current.LockId, Created: time.Time(current.CreatedAt)}
+			// 锁信息解析失败时只返回锁 ID
+			_ = json.Unmarshal([]byte(current.Info), &info)
+			lock.setLockInfo(&info)
+		}
+	default:
+		return &lock, nil
+	}
+
+	if lock.Locked && lock.CreatedAt != nil {
+		task, err := getEnvTaskAt(sess, env.Id, *lock.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if task != nil {
+			lock.TaskId = task.Id
+			lock.TaskName = task.Name
+		}
+	}
+	return &lock, nil
+}
+
+// getConsulStateLock 读取 consul 中的锁信息，锁存在但无锁信息时返回 (nil, true, nil)
+func getConsulStateLock(address, scheme, statePath string) (*tfLockInfo, bool, e.Error) {
+	config := api.DefaultConfig()
+	config.Address = address
+	if scheme != "" {
+		config.Scheme = scheme
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, false, e.New(e.ConsulConnError, err)
+	}
+
+	kv := client.KV()
+	pair, _, err := kv.Get(statePath+consulStateLockSuffix, nil)
+	if err != nil {
+		return nil, false, e.New(e.ConsulConnError, err)
+	}
+	// 锁通过 consul session 持有，session 失效后 key 可能残留，但此时已不是锁定状态
+	if pair == nil || pair.Session == "" {
+		return nil, false, nil
+	}
+
+	pair, _, err = kv.Get(statePath+consulStateLockInfoSuffix, nil)
+	if err != nil {
+		return nil, true, e.New(e.ConsulConnError, err)
+	}
+	if pair == nil {
+		return nil, true, nil
+	}
+	info := tfLockInfo{}
+	if err := json.Unmarshal(pair.Value, &info); err != nil {
+		return nil, true, e.New(e.JSONParseError, fmt.Errorf("unmarshal lock info: %v", err))
+	}
+	return &info, true, nil
+}
+
+// getEnvTaskAt 查询环境在 t 时刻正在执行的任务
+func getEnvTaskAt(sess *db.Session, envId models.Id, t models.Time) (*models.Task, e.Error) {
+	task := models.Task{}
+	err := sess.Model(&models.Task{}).
+		Where("env_id = ? AND start_at <= ?", envId, t).
+		Where("end_at IS NULL OR end_at >= ?", t).
+		Order("start_at DESC").First(&task)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &task, nil
+}
+
+// CreateStateUnlockTask 创建强制解锁任务，只允许在环境没有执行中的任务时创建。
+// operator 为操作者信息(UserID/Username/UserAddr)，创建任务的同时记录操作日志
+func CreateStateUnlockTask(tx *db.Session, env *models.Env, lockId string, operator models.OperationLog) (*models.Task, e.Error) {
+	if busy, err := IsEnvBusy(tx, env.Id); err != nil {
+		return nil, e.New(e.DBError, err)
+	} else if busy {
+		return nil, e.New(e.EnvDeploying, http.StatusBadRequest)
+	}
+
+	tpl, err := GetTemplateById(tx, env.TplId)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.Status == models.Disable {
+		return nil, e.New(e.TemplateDisabled, http.StatusBadRequest)
+	}
+
+	// init 步骤需要初始化 backend，使用与部署任务相同的变量
+	vars, err, _ := GetValidVariables(tx, consts.ScopeEnv, env.OrgId, env.ProjectId, env.TplId, env.Id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	flow, er := models.DefaultTaskFlow(models.TaskTypeUnlock)
+	if er != nil {
+		return nil, e.New(e.InternalError, er)
+	}
+	task, err := CreateTask(tx, tpl, env, models.Task{
+		Name:        models.Task{}.GetTaskNameByType(models.TaskTypeUnlock),
+		CreatorId:   operator.UserID,
+		KeyId:       env.KeyId,
+		Variables:   GetVariableBody(vars),
+		AutoApprove: true,
+		Revision:    env.Revision,
+		Extra:       models.TaskExtra{LockId: lockId},
+		BaseTask: models.BaseTask{
+			Type:        models.TaskTypeUnlock,
+			Flow:        flow,
+			StepTimeout: env.Timeout,
+			RunnerId:    env.RunnerId,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	desc, _ := json.Marshal(map[string]interface{}{
+		"envId":     env.Id,
+		"statePath": env.StatePath,
+		"lockId":    lockId,
+		"taskId":    task.Id,
+	})
+	opLog := operator
+	opLog.OperationAt = models.Time(time.Now())
+	opLog.OperationType = "ForceUnlock"
+	opLog.OperationInfo = fmt.Sprintf("强制解锁环境%s的state, 锁ID为%s", env.Name, lockId)
+	opLog.Desc = models.JSON(desc)
+	if err := tx.Insert(&opLog); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return task, nil
+}
+
+// HasOtherRunningTask 环境中是否有除 taskId 外执行中的任务
+func HasOtherRunningTask(sess *db.Session, envId models.Id, taskId models.Id) (bool, error) {
+	return sess.Model(&models.Task{}).Where("env_id = ? AND id != ? AND status IN (?)", envId, taskId,
+		[]string{models.TaskRunning, models.TaskApproving}).Exists()
+}
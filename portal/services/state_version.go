@@ -0,0 +1,124 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// tfRawState terraform state 文件，只解析需要的字段
+type tfRawState struct {
+	Version          int               `json:"version"`
+	TerraformVersion string            `json:"terraform_version"`
+	Serial           int               `json:"serial"`
+	Lineage          string            `json:"lineage"`
+	Resources        []json.RawMessage `json:"resources"`
+}
+
+// CreateStateVersion 保存任务采集到的 state 版本，state 内容已保存在 path
+func CreateStateVersion(tx *db.Session, task *models.Task, path string, content []byte) (*models.StateVersion, e.Error) {
+	st := tfRawState{}
+	if err := json.Unmarshal(content, &st); err != nil {
+		return nil, e.New(e.JSONParseError, fmt.Errorf("unmarshal state: %v", err))
+	}
+
+	version := models.StateVersion{
+		OrgId:            task.OrgId,
+		ProjectId:        task.ProjectId,
+		EnvId:            task.EnvId,
+		TaskId:           task.Id,
+		Serial:           st.Serial,
+		Lineage:          st.Lineage,
+		TerraformVersion: st.TerraformVersion,
+		Size:             len(content),
+		Md5:              utils.Md5String(string(content)),
+		Path:             path,
+		ResourceCount:    len(st.Resources),
+	}
+	version.Id = models.NewId("sv")
+	if err := models.Create(tx, &version); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &version, nil
+}
+
+func QueryStateVersion(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.StateVersion{}).Where("iac_state_version.env_id = ?", envId)
+}
+
+func GetStateVersionById(query *db.Session, id models.Id) (*models.StateVersion, e.Error) {
+	version := models.StateVersion{}
+	if err := query.Model(&models.StateVersion{}).Where("id = ?", id).First(&version); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.StateVersionNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &version, nil
+}
+
+// GetStateVersionContent 读取 state 版本的内容
+func GetStateVersionContent(version *models.StateVersion) ([]byte, e.Error) {
+	content, err := logstorage.Get().Read(version.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, e.New(e.StateVersionNotExists, err)
+		}
+		return nil, e.New(e.InternalError, err)
+	}
+	return content, nil
+}
+
+// CreateStateRestoreTask 创建 state 恢复任务，任务将指定版本的 state 写入环境的 backend
+func CreateStateRestoreTask(tx *db.Session, env *models.Env, version *models.StateVersion, creatorId models.Id) (*models.Task, e.Error) {
+	if version.EnvId != env.Id {
+		return nil, e.New(e.StateVersionNotExists, http.StatusNotFound)
+	}
+	if busy, err := IsEnvBusy(tx, env.Id); err != nil {
+		return nil, e.New(e.DBError, err)
+	} else if busy {
+		return nil, e.New(e.EnvDeploying, http.StatusBadRequest)
+	}
+
+	tpl, err := GetTemplateById(tx, env.TplId)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.Status == models.Disable {
+		return nil, e.New(e.TemplateDisabled, http.StatusBadRequest)
+	}
+
+	vars, err, _ := GetValidVariables(tx, consts.ScopeEnv, env.OrgId, env.ProjectId, env.TplId, env.Id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	flow, er := models.DefaultTaskFlow(models.TaskTypeRestore)
+	if er != nil {
+		return nil, e.New(e.InternalError, er)
+	}
+	return CreateTask(tx, tpl, env, models.Task{
+		Name:        models.Task{}.GetTaskNameByType(models.TaskTypeRestore),
+		CreatorId:   creatorId,
+		KeyId:       env.KeyId,
+		Variables:   GetVariableBody(vars),
+		AutoApprove: true,
+		Revision:    env.Revision,
+		Extra:       models.TaskExtra{StateVersionId: version.Id},
+		BaseTask: models.BaseTask{
+			Type:        models.TaskTypeRestore,
+			Flow:        flow,
+			StepTimeout: env.Timeout,
+			RunnerId:    env.RunnerId,
+		},
+	})
+}
@@ -22,6 +22,22 @@ func UpdateSystemConfig(tx *db.Session, name string, attrs models.Attrs) (cfg *m
 		}
 		UpdateRunnerMax(runnerMax)
 	}
+	if name == models.SysCfgNameMaxTasksPerOrg || name == models.SysCfgNameMaxTasksPerProject {
+		max, err := strconv.Atoi(attrs["value"].(string))
+		if err != nil || max < 0 {
+			return nil, e.New(e.BadRequest, fmt.Errorf("%s update err: invalid value", name))
+		}
+		if name == models.SysCfgNameMaxTasksPerOrg {
+			UpdateOrgTasksMax(max)
+		} else {
+			UpdateProjectTasksMax(max)
+		}
+	}
+	if name == models.SysCfgNamePeriodOfLogSave {
+		if _, err := ParseLogSavePeriod(attrs["value"].(string)); err != nil {
+			return nil, e.New(e.BadRequest, fmt.Errorf("%s update err: %s", name, err))
+		}
+	}
 	cfg = &models.SystemCfg{}
 	if _, err := models.UpdateAttr(tx.Where("name = ?", name), &models.SystemCfg{}, attrs); err != nil {
 		return nil, e.New(e.DBError, fmt.Errorf("update sys config error: %v", err))
@@ -5,6 +5,7 @@ package services
 import (
 	"cloudiac/configs"
 	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
 	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/consul/api"
@@ -91,6 +92,22 @@ func RunnerSearch() ([]*api.AgentService, e.Error) {
 		}
 	}
 
+	// 拉取模式 runner 不注册到 consul，只返回在线的 runner
+	pullRunners, er := ListPullRunners(db.Get())
+	if er != nil {
+		return nil, er
+	}
+	for _, r := range pullRunners {
+		if r.Healthy {
+			resp = append(resp, &api.AgentService{
+				ID:      r.Id,
+				Service: "CT-Runner",
+				Tags:    r.Tags,
+				Meta:    map[string]string{"mode": configs.RunnerModePull},
+			})
+		}
+	}
+
 	return resp, nil
 }
 
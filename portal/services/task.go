@@ -3,6 +3,7 @@
 package services
 
 import (
+	"bytes"
 	"cloudiac/common"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
@@ -41,6 +42,16 @@ func GetTask(dbSess *db.Session, id models.Id) (*models.Task, e.Error) {
 	return &task, nil
 }
 
+// firstTags 返回第一个不为空的标签列表
+func firstTags(tagsList ...models.StrSlice) models.StrSlice {
+	for _, tags := range tagsList {
+		if len(tags) > 0 {
+			return tags
+		}
+	}
+	return nil
+}
+
 func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models.Task) (*models.Task, e.Error) {
 	logger := logs.Get().WithField("func", "CreateTask")
 
@@ -71,8 +82,12 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 		EnvId:     env.Id,
 		StatePath: env.StatePath,
 
+		StateBackendId: env.StateBackendId,
+		RunnerTags:     firstTags(pt.RunnerTags, env.RunnerTags, tpl.RunnerTags),
+
 		Workdir:   tpl.Workdir,
 		TfVersion: tpl.TfVersion,
+		Image:     firstVal(env.Image, tpl.Image),
 
 		// 以下值直接使用环境的配置(不继承模板的配置)
 		Playbook:     env.Playbook,
@@ -84,6 +99,7 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 			Flow:        pt.Flow,
 			StepTimeout: pt.StepTimeout,
 			RunnerId:    firstVal(pt.RunnerId, env.RunnerId),
+			Priority:    utils.FirstValueInt(pt.Priority, DefaultTaskPriority(pt.Type, pt.Extra.Source)),
 
 			Status:   models.TaskPending,
 			Message:  "",
@@ -94,11 +110,14 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 	task.Id = models.NewId("run")
 	logger = logger.WithField("taskId", task.Id)
 
-	if len(task.Flow.Steps) == 0 {
-		task.Flow, err = models.DefaultTaskFlow(task.Type)
-		if err != nil {
-			return nil, e.New(e.InternalError, err)
-		}
+	// 组织允许的镜像列表可能在模板或环境设置镜像后被修改，所以创建任务时需要再次检查
+	if er := CheckTaskImage(tx, task.OrgId, task.Image); er != nil {
+		return nil, er
+	}
+
+	if len(task.RunnerTags) > 0 {
+		// 按标签选择 runner 时在任务执行前由 task manager 确定 runner
+		task.RunnerId = ""
 	}
 
 	task.RepoAddr, task.CommitId, err = GetTaskRepoAddrAndCommitId(tx, tpl, task.Revision)
@@ -106,6 +125,14 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 		return nil, e.New(e.InternalError, err)
 	}
 
+	if len(task.Flow.Steps) == 0 {
+		var er e.Error
+		task.Flow, er = GetTemplateTaskFlow(tx, tpl, task.CommitId, task.Type)
+		if er != nil {
+			return nil, er
+		}
+	}
+
 	{ // 参数检查
 		if task.Playbook != "" && task.KeyId == "" {
 			return nil, e.New(e.BadParam, fmt.Errorf("'keyId' is required to run playbook"))
@@ -116,8 +143,8 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 		if task.CommitId == "" {
 			return nil, e.New(e.BadParam, fmt.Errorf("'commitId' is required"))
 		}
-		if task.RunnerId == "" {
-			return nil, e.New(e.BadParam, fmt.Errorf("'runnerId' is required"))
+		if task.RunnerId == "" && len(task.RunnerTags) == 0 {
+			return nil, e.New(e.BadParam, fmt.Errorf("'runnerId' or 'runnerTags' is required"))
 		}
 	}
 
@@ -185,6 +212,66 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 	return &task, nil
 }
 
+// GetTemplateTaskFlow 获取任务流程，优先使用模板仓库中定义的流程文件，
+// 文件不存在或未定义该类型任务的流程时使用默认流程
+func GetTemplateTaskFlow(tx *db.Session, tpl *models.Template, revision string, typ string) (models.TaskFlow, e.Error) {
+	// 内部任务类型(如 restore、unlock)不使用仓库中定义的流程
+	if tpl.FlowFile == "" || tpl.VcsId == "" || !models.IsCustomizableTaskFlow(typ) {
+		return defaultTaskFlow(typ)
+	}
+
+	vcs, err := QueryVcsByVcsId(tpl.VcsId, tx)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return models.TaskFlow{}, e.New(e.VcsNotExists, err)
+		}
+		return models.TaskFlow{}, e.New(e.DBError, err)
+	}
+	repo, er := vcsrv.GetRepo(vcs, tpl.RepoId)
+	if er != nil {
+		return models.TaskFlow{}, e.New(e.VcsError, er)
+	}
+	return getRepoTaskFlow(repo, revision, tpl.FlowFile, typ)
+}
+
+// getRepoTaskFlow 读取仓库中的流程文件，文件不存在或未定义该类型任务的流程时使用默认流程
+func getRepoTaskFlow(repo vcsrv.RepoIface, revision string, flowFile string, typ string) (models.TaskFlow, e.Error) {
+	content, er := repo.ReadFileContent(revision, flowFile)
+	if er != nil {
+		// 只有文件不存在时使用默认流程，其他错误(认证、网络等)直接返回，避免跳过仓库中定义的步骤
+		if vcsrv.IsNotFoundErr(er) {
+			logs.Get().WithField("func", "getRepoTaskFlow").
+				Infof("flow file '%s' not found, use default flow", flowFile)
+			return defaultTaskFlow(typ)
+		}
+		return models.TaskFlow{}, e.New(e.VcsError, fmt.Errorf("read flow file '%s': %v", flowFile, er))
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return defaultTaskFlow(typ)
+	}
+
+	flows, er := models.ParseTaskFlows(content)
+	if er != nil {
+		return models.TaskFlow{}, e.New(e.TaskFlowInvalid, fmt.Errorf("%s: %v", flowFile, er), http.StatusBadRequest)
+	}
+	flow, er := models.GetTaskFlow(flows, typ)
+	if er != nil {
+		return models.TaskFlow{}, e.New(e.InternalError, er)
+	}
+	if len(flow.Steps) == 0 {
+		return defaultTaskFlow(typ)
+	}
+	return flow, nil
+}
+
+func defaultTaskFlow(typ string) (models.TaskFlow, e.Error) {
+	flow, err := models.DefaultTaskFlow(typ)
+	if err != nil {
+		return flow, e.New(e.InternalError, err)
+	}
+	return flow, nil
+}
+
 func GetTaskRepoAddrAndCommitId(tx *db.Session, tpl *models.Template, revision string) (repoAddr, commitId string, err e.Error) {
 	var (
 		u         *url.URL
@@ -277,6 +364,7 @@ var stepStatus2TaskStatusMap = map[string]string{
 	models.TaskStepFailed:    models.TaskFailed,
 	models.TaskStepTimeout:   models.TaskFailed,
 	models.TaskStepComplete:  models.TaskComplete,
+	models.TaskStepCancelled: models.TaskCancelled,
 }
 
 func stepStatus2TaskStatus(s string) string {
@@ -330,6 +418,180 @@ func ChangeTaskStatus(dbSess *db.Session, task *models.Task, status, message str
 	return ChangeEnvStatusWithTaskAndStep(dbSess, task.EnvId, task, step)
 }
 
+// CancelTask 取消任务
+// pending 状态的任务直接置为 cancelled；己开始执行的任务只设置取消标识，
+// 由 task manager 停止当前步骤后再更新任务状态
+func CancelTask(dbSess *db.Session, task *models.Task, userId models.Id) e.Error {
+	if task.Exited() {
+		return e.New(e.TaskCannotCancel, http.StatusBadRequest)
+	}
+
+	logger := logs.Get().WithField("taskId", task.Id)
+	attrs := models.Attrs{
+		"cancel_requested": true,
+		"canceler_id":      userId,
+	}
+	if task.Status == models.TaskPending {
+		now := models.Time(time.Now())
+		pendingAttrs := models.Attrs{
+			"status": models.TaskCancelled,
+			"end_at": &now,
+		}
+		for k, v := range attrs {
+			pendingAttrs[k] = v
+		}
+		// 通过 status 条件保证任务在此期间未被 task manager 启动
+		n, err := dbSess.Model(&models.Task{}).
+			Where("id = ? AND status = ?", task.Id, models.TaskPending).UpdateAttrs(pendingAttrs)
+		if err != nil {
+			return e.New(e.DBError, err)
+		}
+		if n == 1 {
+			logger.Infof("change task to '%s'", models.TaskCancelled)
+			task.Status = models.TaskCancelled
+			task.EndAt = &now
+			task.CancelRequested = true
+			task.CancelerId = userId
+			TaskStatusChangeSendMessage(task, models.TaskCancelled)
+			return nil
+		}
+		// 任务己被启动，按执行中的任务处理
+	}
+
+	n, err := dbSess.Model(&models.Task{}).
+		Where("id = ? AND status NOT IN (?)", task.Id,
+			[]string{models.TaskFailed, models.TaskRejected, models.TaskComplete, models.TaskCancelled}).
+		UpdateAttrs(attrs)
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.TaskCannotCancel, http.StatusBadRequest)
+	}
+	logger.Infof("task cancel requested by %s", userId)
+	task.CancelRequested = true
+	task.CancelerId = userId
+	return nil
+}
+
+// ResumeTask 从失败步骤(或指定的更早的步骤)恢复执行失败或被取消的任务。
+// 该步骤及之后的步骤被重置为 pending，任务重新进入队列并在原 runner 上执行，复用之前的工作目录和 plan 文件
+func ResumeTask(tx *db.Session, task *models.Task, userId models.Id, fromStep *int) e.Error {
+	if !IsTaskResumable(task) {
+		return e.New(e.TaskCannotResume, fmt.Errorf("task status is '%s'", task.Status), http.StatusBadRequest)
+	}
+
+	if busy, err := IsEnvBusy(tx, task.EnvId); err != nil {
+		return e.New(e.DBError, err)
+	} else if busy {
+		return e.New(e.TaskCannotResume, fmt.Errorf("environment has unfinished task"), http.StatusBadRequest)
+	}
+	if task.IsEffectTask() {
+		// 环境在该任务之后执行过其他部署任务时 plan 文件已失效，不允许恢复
+		env, err := GetEnvById(tx, task.EnvId)
+		if err != nil {
+			return err
+		}
+		if env.LastTaskId != task.Id {
+			return e.New(e.TaskCannotResume, fmt.Errorf("task is not the last deploy task of environment"),
+				http.StatusBadRequest)
+		}
+	}
+
+	steps, er := GetTaskSteps(tx, task.Id)
+	if er != nil {
+		return e.New(e.DBError, er)
+	}
+	from, replan, resumeErr := getTaskResumeStep(task, steps, fromStep)
+	if resumeErr != nil {
+		return resumeErr
+	}
+
+	stepAttrs := models.Attrs{
+		"status":              models.TaskStepPending,
+		"message":             "",
+		"exit_code":           0,
+		"start_at":            nil,
+		"end_at":              nil,
+		"current_retry_count": 0,
+		"next_retry_time":     0,
+	}
+	if replan {
+		stepAttrs["approver_id"] = ""
+	}
+	if _, err := tx.Model(&models.TaskStep{}).Where("task_id = ? AND `index` >= ?", task.Id, from).
+		UpdateAttrs(stepAttrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	// 通过 status 条件保证任务不会被重复恢复
+	n, err := tx.Model(&models.Task{}).Where("id = ? AND status = ?", task.Id, task.Status).
+		UpdateAttrs(models.Attrs{
+			"status":           models.TaskPending,
+			"message":          "",
+			"curr_step":        from,
+			"end_at":           nil,
+			"cancel_requested": false,
+			"canceler_id":      "",
+			"resume_count":     task.ResumeCount + 1,
+		})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n != 1 {
+		return e.New(e.TaskCannotResume, fmt.Errorf("task status changed"), http.StatusConflict)
+	}
+
+	if err := models.Create(tx, &models.TaskResume{
+		TaskId:   task.Id,
+		UserId:   userId,
+		FromStep: from,
+		Message:  task.Message,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	logs.Get().WithField("taskId", task.Id).Infof("resume task from step %d", from)
+	return nil
+}
+
+// ResumableTaskStatus 可以恢复执行的任务状态
+var ResumableTaskStatus = []string{models.TaskFailed, models.TaskCancelled}
+
+// IsTaskResumable 任务是否为可以恢复执行的状态
+func IsTaskResumable(task *models.Task) bool {
+	return utils.StrInArray(task.Status, ResumableTaskStatus...)
+}
+
+// getTaskResumeStep 返回恢复执行的起始步骤(默认为失败或被取消的步骤)，
+// 以及是否需要重新执行 plan 步骤(重新执行 plan 后资源变更可能与审批时不同，需要重新审批)
+func getTaskResumeStep(task *models.Task, steps []*models.TaskStep, fromStep *int) (from int, replan bool, er e.Error) {
+	if !IsTaskResumable(task) {
+		return 0, false, e.New(e.TaskCannotResume, fmt.Errorf("task status is '%s'", task.Status), http.StatusBadRequest)
+	}
+	from = task.CurrStep
+	if fromStep != nil {
+		if *fromStep < 0 || *fromStep > task.CurrStep {
+			return 0, false, e.New(e.TaskCannotResume, fmt.Errorf("invalid step %d", *fromStep), http.StatusBadRequest)
+		}
+		from = *fromStep
+	}
+	for _, step := range steps {
+		if step.Index >= from && step.Type == models.TaskStepPlan {
+			replan = true
+		}
+	}
+	return from, replan, nil
+}
+
+func QueryTaskResume(query *db.Session, taskId models.Id) *db.Session {
+	return query.Model(&models.TaskResume{}).Where("task_id = ?", taskId)
+}
+
+// IsTaskCancelRequested 任务是否己被请求取消
+func IsTaskCancelRequested(dbSess *db.Session, taskId models.Id) (bool, error) {
+	return dbSess.Model(&models.Task{}).
+		Where("id = ? AND cancel_requested = ?", taskId, true).Exists()
+}
+
 type TfState struct {
 	FormVersion      string        `json:"form_version"`
 	TerraformVersion string        `json:"terraform_version"`
@@ -397,6 +659,12 @@ func traverseStateModule(module *TfStateModule) (rs []*models.Resource) {
 }
 
 func SaveTaskResources(tx *db.Session, task *models.Task, values TfStateValues, proMap runner.ProviderSensitiveAttrMap) error {
+	// 恢复执行的任务结束时会再次统计资源，先清除恢复前统计的结果(如 apply 成功后 play 步骤失败)，避免资源重复
+	if task.ResumeCount > 0 {
+		if _, err := tx.Where("task_id = ?", task.Id).Delete(&models.Resource{}); err != nil {
+			return err
+		}
+	}
 
 	bq := utils.NewBatchSQL(1024, "INSERT INTO", models.Resource{}.TableName(),
 		"id", "org_id", "project_id", "env_id", "task_id",
@@ -444,21 +712,68 @@ func SaveTaskOutputs(dbSess *db.Session, task *models.Task, vars map[string]TfSt
 	return nil
 }
 
+// SaveTaskImportResult 根据 import 步骤输出的结果文件记录每个资源的导入结果
+func SaveTaskImportResult(dbSess *db.Session, task *models.Task, content []byte) error {
+	results, err := ParseTaskImportResult(task.Extra.Imports, content)
+	if err != nil {
+		return err
+	}
+
+	task.Result.Imports = results
+	if _, err := dbSess.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("result", task.Result); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseTaskImportResult 解析 import 结果文件(每行一条 json)，返回与 items 一一对应的导入结果
+func ParseTaskImportResult(items []models.TaskImportItem, content []byte) ([]models.TaskImportResult, error) {
+	results := make([]models.TaskImportResult, 0, len(items))
+	for _, item := range items {
+		// 步骤未执行到的资源(如步骤超时或被取消)保持 -1
+		results = append(results, models.TaskImportResult{TaskImportItem: item, ExitCode: -1})
+	}
+
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		r := runner.TfImportResult{}
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, err
+		}
+		if r.Index < 0 || r.Index >= len(results) {
+			continue
+		}
+		results[r.Index].ExitCode = r.ExitCode
+		results[r.Index].Success = r.ExitCode == 0
+	}
+	return results, nil
+}
+
 // TfPlan doc: https://www.terraform.io/docs/internals/json-format.html#plan-representation
 type TfPlan struct {
-	FormatVersion string `json:"format_version"`
+	FormatVersion    string `json:"format_version"`
+	TerraformVersion string `json:"terraform_version"`
 
 	ResourceChanges []TfPlanResource `json:"resource_changes"`
+	// terraform 0.15.4 开始输出 refresh 过程中发现的 state 与实际资源的差异
+	ResourceDrift []TfPlanResource `json:"resource_drift"`
 }
 
 type TfPlanResource struct {
 	Address       string `json:"address"`
 	ModuleAddress string `json:"module_address,omitempty"`
 
-	Mode  string `json:"mode"` // managed、data
-	Type  string `json:"type"`
-	Name  string `json:"name"`
-	Index int    `json:"index"`
+	Mode  string      `json:"mode"` // managed、data
+	Type  string      `json:"type"`
+	Name  string      `json:"name"`
+	Index interface{} `json:"index,omitempty"` // count 为数字，for_each 为字符串
+
+	ProviderName string `json:"provider_name"`
+	// 资源需要变更的原因，如 replace_because_tainted，terraform 1.2 开始输出
+	ActionReason string `json:"action_reason,omitempty"`
 
 	Change TfPlanResourceChange `json:"change"`
 }
@@ -468,6 +783,12 @@ type TfPlanResourceChange struct {
 	Actions []string    `json:"actions"` // no-op, create, read, update, delete
 	Before  interface{} `json:"before"`
 	After   interface{} `json:"after"`
+
+	BeforeSensitive interface{} `json:"before_sensitive"` // 与 before 结构相同，敏感的值为 true
+	AfterSensitive  interface{} `json:"after_sensitive"`  // 与 after 结构相同，敏感的值为 true
+
+	AfterUnknown interface{}     `json:"after_unknown"` // 与 after 结构相同，apply 后才能确定的值为 true
+	ReplacePaths [][]interface{} `json:"replace_paths"` // 导致资源重建的属性路径
 }
 
 func UnmarshalPlanJson(bs []byte) (*TfPlan, error) {
@@ -604,6 +925,29 @@ func SaveTaskChanges(dbSess *db.Session, task *models.Task, rs []TfPlanResource)
 }
 
 func FetchTaskLog(ctx context.Context, task models.Tasker, stepType string, writer io.WriteCloser) (err error) {
+	return fetchTaskStepOutput(ctx, task, stepType, writer,
+		func(step *models.TaskStep) string { return step.LogPath },
+		func(w io.Writer) *TfOutputWriter { return NewTfLogRenderWriter(w) })
+}
+
+// FetchTaskEvents 获取任务步骤的 terraform 事件，每行一条 TaskStepEvent json，直到任务结束
+func FetchTaskEvents(ctx context.Context, task models.Tasker, stepType string, writer io.WriteCloser) (err error) {
+	return fetchTaskStepOutput(ctx, task, stepType, writer,
+		func(step *models.TaskStep) string { return step.EventsPath() },
+		func(w io.Writer) *TfOutputWriter { return NewTfEventWriter(w) })
+}
+
+// fetchTaskStepOutput 依次输出任务各步骤的内容:
+// 已结束的步骤从存储中读取 storagePath 返回的路径，执行中的步骤从 runner 获取实时日志并通过 convert 转换后输出
+func fetchTaskStepOutput(ctx context.Context, task models.Tasker, stepType string, writer io.WriteCloser,
+	storagePath func(step *models.TaskStep) string, convert func(w io.Writer) *TfOutputWriter) (err error) {
+	masker, err := GetTaskLogMasker(db.Get(), task)
+	if err != nil {
+		_ = writer.Close()
+		return err
+	}
+	// 历史日志及 runner 实时推送的日志在输出前都需要替换敏感信息
+	writer = utils.NewSecretMaskWriter(masker, writer)
 	// close 后 read 端会触发 EOF error
 	defer writer.Close()
 
@@ -652,22 +996,26 @@ func FetchTaskLog(ctx context.Context, task models.Tasker, stepType string, writ
 		}
 
 		if step.IsExited() {
-			var content []byte
-			if content, err = storage.Read(step.LogPath); err != nil {
+			var reader io.ReadCloser
+			if reader, err = storage.Reader(storagePath(step)); err != nil {
 				if os.IsNotExist(err) {
 					// 当前步骤没有日志文件，继续读下一步骤
 					continue
 				}
 				return err
-			} else if _, err = writer.Write(content); err != nil {
+			}
+			_, err = io.Copy(writer, reader)
+			_ = reader.Close()
+			if err != nil {
 				return err
 			}
 		} else if step.IsStarted() { // running
+			stepWriter := convert(writer)
 			for {
-				if err = fetchRunnerTaskStepLog(ctx, task.GetRunnerId(), step, writer); err != nil {
+				if err = fetchRunnerTaskStepLog(ctx, task.GetRunnerId(), step, stepWriter); err != nil {
 					if err == ErrRunnerTaskNotExists && step.StartAt != nil &&
-						time.Since(time.Time(*step.StartAt)) < consts.RunnerConnectTimeout*2 {
-						// 某些情况下可能步骤被标识为了 running 状态，但调用 runner 执行任务时因为网络等原因导致没有及时启动执行。
+						time.Since(time.Time(*step.StartAt)) < consts.RunnerRunTaskTimeout {
+						// 某些情况下可能步骤被标识为了 running 状态，但调用 runner 执行任务时因为网络或拉取镜像等原因导致没有及时启动执行。
 						// 所以这里加一个判断, 如果是刚启动的任务会进行重试
 						time.Sleep(sleepDuration)
 						continue
@@ -676,6 +1024,9 @@ func FetchTaskLog(ctx context.Context, task models.Tasker, stepType string, writ
 				}
 				break
 			}
+			if err = stepWriter.Flush(); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -692,6 +1043,12 @@ func fetchRunnerTaskStepLog(ctx context.Context, runnerId string, step *models.T
 		WithField("taskId", step.TaskId).
 		WithField("step", fmt.Sprintf("%d(%s)", step.Index, step.Type))
 
+	if r, err := GetPullRunner(db.Get(), runnerId); err != nil {
+		return err
+	} else if r != nil {
+		return fetchPullRunnerTaskStepLog(ctx, step, writer)
+	}
+
 	runnerAddr, err := GetRunnerAddress(runnerId)
 	if err != nil {
 		return errors.Wrapf(err, "get runner address")
@@ -701,7 +1058,7 @@ func fetchRunnerTaskStepLog(ctx context.Context, runnerId string, step *models.T
 	params.Add("envId", string(step.EnvId))
 	params.Add("taskId", string(step.TaskId))
 	params.Add("step", fmt.Sprintf("%d", step.Index))
-	wsConn, resp, err := utils.WebsocketDail(runnerAddr, consts.RunnerTaskLogFollowURL, params)
+	wsConn, resp, err := RunnerWebsocketDail(runnerId, runnerAddr, consts.RunnerTaskLogFollowURL, params)
 	if err != nil {
 		if resp != nil {
 			respBody, _ := io.ReadAll(resp.Body)
@@ -749,6 +1106,10 @@ func fetchRunnerTaskStepLog(ctx context.Context, runnerId string, step *models.T
 }
 
 func TaskStatusChangeSendMessage(task *models.Task, status string) {
+	// 漂移检测任务只在发现漂移时发送 env.drifted 通知
+	if task.Type == models.TaskTypeDrift {
+		return
+	}
 	// 非通知类型的状态直接跳过
 	if _, ok := consts.TaskStatusToEventType[status]; !ok {
 		logs.Get().WithField("taskId", task.Id).Infof("event don't need send message")
@@ -816,6 +1177,8 @@ func ChangeScanTaskStatusWithStep(dbSess *db.Session, task *models.ScanTask, ste
 		} else {
 			task.PolicyStatus = common.PolicyStatusFailed
 		}
+	case common.TaskCancelled:
+		task.PolicyStatus = common.PolicyStatusFailed
 	default: // "approving", "rejected", ...
 		panic(fmt.Errorf("invalid scan task status '%s'", taskStatus))
 	}
@@ -862,6 +1225,7 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 			Flow:        pt.Flow,
 			StepTimeout: pt.StepTimeout,
 			RunnerId:    pt.RunnerId,
+			Priority:    utils.FirstValueInt(pt.Priority, DefaultTaskPriority(pt.Type, pt.Extra.Source)),
 
 			Status:   models.TaskPending,
 			Message:  "",
@@ -0,0 +1,176 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const changeUnknownValue = "(known after apply)"
+
+// GetResourceChangeAction 将 plan 中资源的 actions 转换为变更类型，无变更时返回空字符串
+func GetResourceChangeAction(actions []string) string {
+	switch {
+	case utils.SliceEqualStr(actions, []string{"create"}):
+		return models.ResourceChangeCreate
+	case utils.SliceEqualStr(actions, []string{"update"}):
+		return models.ResourceChangeUpdate
+	case utils.SliceEqualStr(actions, []string{"delete"}):
+		return models.ResourceChangeDelete
+	case utils.SliceEqualStr(actions, []string{"delete", "create"}),
+		utils.SliceEqualStr(actions, []string{"create", "delete"}):
+		return models.ResourceChangeReplace
+	case utils.SliceEqualStr(actions, []string{"read"}):
+		return models.ResourceChangeRead
+	}
+	return ""
+}
+
+func planResourceIndex(r TfPlanResource) string {
+	if r.Index == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", r.Index)
+}
+
+// GetResourceChangeAttrs 对比资源变更前后的值得到发生变更的属性。
+// before_sensitive/after_sensitive 中标记的值及 provider schema 中定义的敏感属性都会被隐藏
+func GetResourceChangeAttrs(change TfPlanResourceChange, sensitiveKeys []string) models.ResourceChangeAttrs {
+	before, _ := change.Before.(map[string]interface{})
+	after, _ := change.After.(map[string]interface{})
+	unknown, _ := change.AfterUnknown.(map[string]interface{})
+
+	keys := make([]string, 0)
+	keySet := make(map[string]struct{})
+	for _, m := range []map[string]interface{}{before, after, unknown} {
+		for k := range m {
+			if _, ok := keySet[k]; !ok {
+				keySet[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	replaceKeys := make(map[string]struct{})
+	for _, p := range change.ReplacePaths {
+		if len(p) > 0 {
+			replaceKeys[fmt.Sprintf("%v", p[0])] = struct{}{}
+		}
+	}
+
+	attrs := models.ResourceChangeAttrs{}
+	for _, k := range keys {
+		b, a := before[k], after[k]
+		isUnknown := hasSensitiveValue(unknown[k])
+		if !isUnknown && reflect.DeepEqual(b, a) {
+			continue
+		}
+
+		attr := models.ResourceChangeAttr{Unknown: isUnknown}
+		if _, ok := replaceKeys[k]; ok {
+			attr.ForcesReplace = true
+		}
+		schemaSensitive := utils.StrInArray(k, sensitiveKeys...)
+		if b != nil && (schemaSensitive || isSensitiveAttr(change.BeforeSensitive, k)) {
+			b = driftSensitiveValue
+			attr.Sensitive = true
+		}
+		if v, ok := unknown[k].(bool); ok && v {
+			// 整个属性都需要 apply 后才能确定
+			a = changeUnknownValue
+		} else if a != nil && (schemaSensitive || isSensitiveAttr(change.AfterSensitive, k)) {
+			a = driftSensitiveValue
+			attr.Sensitive = true
+		}
+		attr.Before, attr.After = b, a
+		attrs[k] = attr
+	}
+	return attrs
+}
+
+// GetTaskResourceChanges 解析 plan 中各资源的变更，proMap 为 provider 中各资源类型的敏感属性
+func GetTaskResourceChanges(task *models.Task, rs []TfPlanResource, proMap runner.ProviderSensitiveAttrMap) []*models.ResourceChange {
+	changes := make([]*models.ResourceChange, 0)
+	for _, r := range rs {
+		action := GetResourceChangeAction(r.Change.Actions)
+		if action == "" {
+			continue
+		}
+
+		replacePaths := make([]string, 0, len(r.Change.ReplacePaths))
+		for _, p := range r.Change.ReplacePaths {
+			ss := make([]string, 0, len(p))
+			for _, s := range p {
+				ss = append(ss, fmt.Sprintf("%v", s))
+			}
+			replacePaths = append(replacePaths, strings.Join(ss, "."))
+		}
+
+		changes = append(changes, &models.ResourceChange{
+			OrgId:        task.OrgId,
+			ProjectId:    task.ProjectId,
+			EnvId:        task.EnvId,
+			TaskId:       task.Id,
+			Address:      r.Address,
+			Module:       r.ModuleAddress,
+			Provider:     r.ProviderName,
+			Mode:         r.Mode,
+			Type:         r.Type,
+			Name:         r.Name,
+			Index:        planResourceIndex(r),
+			Action:       action,
+			ActionReason: r.ActionReason,
+			ReplacePaths: replacePaths,
+			Changes:      GetResourceChangeAttrs(r.Change, proMap[strings.Join([]string{r.ProviderName, r.Type}, "-")]),
+		})
+	}
+	return changes
+}
+
+// SaveTaskResourceChanges 保存任务 plan 得到的资源变更，重复执行时会覆盖之前的结果
+func SaveTaskResourceChanges(tx *db.Session, task *models.Task, rs []TfPlanResource, proMap runner.ProviderSensitiveAttrMap) e.Error {
+	if _, err := tx.Where("task_id = ?", task.Id).Delete(&models.ResourceChange{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	bq := utils.NewBatchSQL(1024, "INSERT INTO", models.ResourceChange{}.TableName(),
+		"id", "org_id", "project_id", "env_id", "task_id",
+		"address", "module", "provider", "mode", "type", "name", "index",
+		"action", "action_reason", "replace_paths", "changes")
+	for _, c := range GetTaskResourceChanges(task, rs, proMap) {
+		c.Id = models.NewId("rc")
+		if err := bq.AddRow(c.Id, c.OrgId, c.ProjectId, c.EnvId, c.TaskId,
+			c.Address, c.Module, c.Provider, c.Mode, c.Type, c.Name, c.Index,
+			c.Action, c.ActionReason, c.ReplacePaths, c.Changes); err != nil {
+			return e.New(e.InternalError, err)
+		}
+	}
+	for bq.HasNext() {
+		sql, args := bq.Next()
+		if _, err := tx.Exec(sql, args...); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
+
+// QueryTaskResourceChanges 查询任务的资源变更，action 和 resType 为空时不过滤
+func QueryTaskResourceChanges(query *db.Session, taskId models.Id, action string, resType string) *db.Session {
+	query = query.Model(&models.ResourceChange{}).Where("task_id = ?", taskId)
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if resType != "" {
+		query = query.Where("type = ?", resType)
+	}
+	return query
+}
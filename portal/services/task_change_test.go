@@ -0,0 +1,104 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testChangesPlanJson = `
+{
+    "format_version": "0.2",
+    "terraform_version": "1.2.0",
+    "resource_changes": [
+        {
+            "address": "aws_db_instance.db",
+            "mode": "managed",
+            "type": "aws_db_instance",
+            "name": "db",
+            "provider_name": "registry.terraform.io/hashicorp/aws",
+            "action_reason": "replace_because_cannot_update",
+            "change": {
+                "actions": ["delete", "create"],
+                "before": {"engine": "mysql", "password": "old", "tags": {"env": "dev"}, "id": "db-1"},
+                "after": {"engine": "postgres", "password": "new", "tags": {"env": "dev"}},
+                "after_unknown": {"id": true},
+                "before_sensitive": {},
+                "after_sensitive": {},
+                "replace_paths": [["engine"]]
+            }
+        },
+        {
+            "address": "module.net.aws_vpc.vpc[0]",
+            "module_address": "module.net",
+            "mode": "managed",
+            "type": "aws_vpc",
+            "name": "vpc",
+            "index": 0,
+            "provider_name": "registry.terraform.io/hashicorp/aws",
+            "change": {
+                "actions": ["update"],
+                "before": {"cidr_block": "10.0.0.0/8", "tags": {"token": "t1"}},
+                "after": {"cidr_block": "10.0.0.0/8", "tags": {"token": "t2"}},
+                "after_unknown": {},
+                "before_sensitive": {"tags": {"token": true}},
+                "after_sensitive": {"tags": {"token": true}}
+            }
+        },
+        {
+            "address": "aws_subnet.a",
+            "mode": "managed",
+            "type": "aws_subnet",
+            "name": "a",
+            "provider_name": "registry.terraform.io/hashicorp/aws",
+            "change": {"actions": ["no-op"], "before": {"id": "s-1"}, "after": {"id": "s-1"}}
+        }
+    ]
+}
+`
+
+func TestGetTaskResourceChanges(t *testing.T) {
+	plan, err := UnmarshalPlanJson([]byte(testChangesPlanJson))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	proMap := runner.ProviderSensitiveAttrMap{
+		"registry.terraform.io/hashicorp/aws-aws_db_instance": {"password"},
+	}
+	changes := GetTaskResourceChanges(&models.Task{}, plan.ResourceChanges, proMap)
+	if !assert.Len(t, changes, 2) {
+		return
+	}
+
+	db := changes[0]
+	assert.Equal(t, models.ResourceChangeReplace, db.Action)
+	assert.Equal(t, "replace_because_cannot_update", db.ActionReason)
+	assert.Equal(t, models.StrSlice{"engine"}, db.ReplacePaths)
+	assert.Len(t, db.Changes, 3)
+	assert.Equal(t, models.ResourceChangeAttr{Before: "mysql", After: "postgres", ForcesReplace: true}, db.Changes["engine"])
+	// provider schema 中定义的敏感属性
+	assert.Equal(t, models.ResourceChangeAttr{
+		Before: driftSensitiveValue, After: driftSensitiveValue, Sensitive: true}, db.Changes["password"])
+	assert.Equal(t, models.ResourceChangeAttr{Before: "db-1", After: changeUnknownValue, Unknown: true}, db.Changes["id"])
+
+	vpc := changes[1]
+	assert.Equal(t, models.ResourceChangeUpdate, vpc.Action)
+	assert.Equal(t, "module.net", vpc.Module)
+	assert.Equal(t, "0", vpc.Index)
+	// 嵌套的敏感值整体隐藏
+	assert.Equal(t, models.ResourceChangeAttrs{"tags": {
+		Before: driftSensitiveValue, After: driftSensitiveValue, Sensitive: true}}, vpc.Changes)
+}
+
+func TestGetResourceChangeAction(t *testing.T) {
+	assert.Equal(t, models.ResourceChangeCreate, GetResourceChangeAction([]string{"create"}))
+	assert.Equal(t, models.ResourceChangeDelete, GetResourceChangeAction([]string{"delete"}))
+	assert.Equal(t, models.ResourceChangeReplace, GetResourceChangeAction([]string{"create", "delete"}))
+	assert.Equal(t, models.ResourceChangeRead, GetResourceChangeAction([]string{"read"}))
+	assert.Equal(t, "", GetResourceChangeAction([]string{"no-op"}))
+}
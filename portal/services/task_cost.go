@@ -0,0 +1,171 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// getAttrByPath 按 . 分隔的路径获取资源属性，路径中的数字表示列表下标
+func getAttrByPath(values interface{}, path string) (interface{}, bool) {
+	v := values
+	for _, key := range strings.Split(path, ".") {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = val[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(val) {
+				return nil, false
+			}
+			v = val[idx]
+		default:
+			return nil, false
+		}
+	}
+	return v, v != nil
+}
+
+func attrNumber(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// estimateResourceCost 计算资源的月费用，values 为 nil 表示资源不存在
+func estimateResourceCost(prices []models.ResourcePrice, values interface{}) float64 {
+	if values == nil {
+		return 0
+	}
+	cost := float64(0)
+	for i := range prices {
+		p := &prices[i]
+		switch {
+		case p.Attribute == "":
+			cost += p.MonthlyPrice()
+		case p.Value != "":
+			if v, ok := getAttrByPath(values, p.Attribute); ok && fmt.Sprintf("%v", v) == p.Value {
+				cost += p.MonthlyPrice()
+			}
+		default:
+			if v, ok := getAttrByPath(values, p.Attribute); ok {
+				if n, ok := attrNumber(v); ok {
+					cost += n * p.MonthlyPrice()
+				}
+			}
+		}
+	}
+	return cost
+}
+
+func roundCost(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// EstimateTaskCost 基于价格目录估算 plan 中资源变更前后的月费用，价格目录为空时返回 nil。
+// 没有价格配置的资源类型不计入费用，只统计数量
+func EstimateTaskCost(prices []models.ResourcePrice, rs []TfPlanResource) *models.TaskCost {
+	if len(prices) == 0 {
+		return nil
+	}
+	typePrices := make(map[string][]models.ResourcePrice)
+	for _, p := range prices {
+		typePrices[p.ResourceType] = append(typePrices[p.ResourceType], p)
+	}
+
+	cost := models.TaskCost{Resources: make([]models.ResourceCost, 0)}
+	for _, r := range rs {
+		if r.Mode != "managed" {
+			continue
+		}
+		ps, ok := typePrices[r.Type]
+		if !ok {
+			cost.Unpriced += 1
+			switch GetResourceChangeAction(r.Change.Actions) {
+			case models.ResourceChangeCreate, models.ResourceChangeUpdate, models.ResourceChangeReplace:
+				cost.UnpricedChanges += 1
+			}
+			continue
+		}
+		rc := models.ResourceCost{
+			Address:       r.Address,
+			Type:          r.Type,
+			Action:        GetResourceChangeAction(r.Change.Actions),
+			MonthlyBefore: estimateResourceCost(ps, r.Change.Before),
+			MonthlyAfter:  estimateResourceCost(ps, r.Change.After),
+		}
+		cost.MonthlyBefore += rc.MonthlyBefore
+		cost.MonthlyAfter += rc.MonthlyAfter
+		rc.MonthlyBefore, rc.MonthlyAfter = roundCost(rc.MonthlyBefore), roundCost(rc.MonthlyAfter)
+		cost.Resources = append(cost.Resources, rc)
+	}
+	cost.MonthlyDelta = roundCost(cost.MonthlyAfter - cost.MonthlyBefore)
+	cost.MonthlyBefore, cost.MonthlyAfter = roundCost(cost.MonthlyBefore), roundCost(cost.MonthlyAfter)
+	return &cost
+}
+
+// SaveTaskCost 估算任务 plan 的月费用并保存到任务结果中，组织未配置价格时不保存
+func SaveTaskCost(tx *db.Session, task *models.Task, plan *TfPlan) (*models.TaskCost, e.Error) {
+	prices, er := GetOrgResourcePrices(tx, task.OrgId)
+	if er != nil {
+		return nil, er
+	}
+	cost := EstimateTaskCost(prices, plan.ResourceChanges)
+	if cost == nil {
+		return nil, nil
+	}
+
+	task.Result.Cost = cost
+	if _, err := tx.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("result", task.Result); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return cost, nil
+}
+
+// GetCostDeltaThreshold 获取任务的月费用增加限制，环境的设置优先于组织，都未设置时返回 nil
+func GetCostDeltaThreshold(query *db.Session, task *models.Task) (*float64, e.Error) {
+	env, err := GetEnv(query, task.EnvId)
+	if err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+	if env.CostDeltaThreshold != nil {
+		return env.CostDeltaThreshold, nil
+	}
+	org, er := GetOrganizationById(query, task.OrgId)
+	if er != nil {
+		return nil, er
+	}
+	return org.CostDeltaThreshold, nil
+}
+
+// CheckTaskCostDelta 检查月费用增加是否超过限制，threshold 为 nil 表示不限制。
+// 有新建、修改或替换没有价格配置的资源时无法确定费用增加，返回错误
+func CheckTaskCostDelta(cost *models.TaskCost, threshold *float64) e.Error {
+	if cost == nil || threshold == nil {
+		return nil
+	}
+	if cost.UnpricedChanges > 0 {
+		return e.New(e.CostEstimateFailed, fmt.Errorf("Failed to estimate monthly cost: "+
+			"%d changed resources have no price configured", cost.UnpricedChanges))
+	}
+	if cost.MonthlyDelta <= *threshold {
+		return nil
+	}
+	return e.New(e.CostDeltaExceeded, fmt.Errorf("Estimated monthly cost delta %.2f exceeds the threshold %.2f",
+		cost.MonthlyDelta, *threshold))
+}
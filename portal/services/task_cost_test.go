@@ -0,0 +1,152 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCostPlanJson = `
+{
+    "format_version": "0.2",
+    "terraform_version": "1.0.6",
+    "resource_changes": [
+        {
+            "address": "alicloud_instance.web",
+            "mode": "managed",
+            "type": "alicloud_instance",
+            "name": "web",
+            "change": {
+                "actions": ["update"],
+                "before": {"instance_type": "ecs.g6.large", "system_disk_size": 40},
+                "after": {"instance_type": "ecs.g6.xlarge", "system_disk_size": 100}
+            }
+        },
+        {
+            "address": "alicloud_eip.ip",
+            "mode": "managed",
+            "type": "alicloud_eip",
+            "name": "ip",
+            "change": {"actions": ["create"], "before": null, "after": {"bandwidth": "5"}}
+        },
+        {
+            "address": "alicloud_vpc.vpc",
+            "mode": "managed",
+            "type": "alicloud_vpc",
+            "name": "vpc",
+            "change": {"actions": ["delete"], "before": {"cidr_block": "10.0.0.0/8"}, "after": null}
+        },
+        {
+            "address": "data.alicloud_zones.default",
+            "mode": "data",
+            "type": "alicloud_zones",
+            "name": "default",
+            "change": {"actions": ["read"], "before": null, "after": {}}
+        }
+    ]
+}
+`
+
+const testPriceCatalogCSV = `resourceType,attribute,value,unit,price,description
+alicloud_instance,instance_type,ecs.g6.large,hour,0.5,
+alicloud_instance,instance_type,ecs.g6.xlarge,hour,1,
+alicloud_instance,system_disk_size,,month,0.1,"系统盘, 按 GB 计费"
+alicloud_eip,,,month,10,
+alicloud_eip,bandwidth,,month,20,
+`
+
+const testPriceCatalogYAML = `
+- resourceType: alicloud_instance
+  attribute: instance_type
+  value: ecs.g6.large
+  unit: hour
+  price: 0.5
+- resourceType: alicloud_eip
+  price: 10
+`
+
+func TestParsePriceCatalog(t *testing.T) {
+	prices, err := ParsePriceCatalog(PriceCatalogCSV, []byte(testPriceCatalogCSV))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, prices, 5)
+	assert.Equal(t, models.ResourcePrice{
+		ResourceType: "alicloud_instance",
+		Attribute:    "system_disk_size",
+		Unit:         models.PriceUnitMonth,
+		Price:        0.1,
+		Description:  "系统盘, 按 GB 计费",
+	}, prices[2])
+
+	prices, err = ParsePriceCatalog(PriceCatalogYAML, []byte(testPriceCatalogYAML))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, prices, 2)
+	assert.Equal(t, models.PriceUnitHour, prices[0].Unit)
+	// 未指定计费周期时默认按月
+	assert.Equal(t, models.PriceUnitMonth, prices[1].Unit)
+
+	_, err = ParsePriceCatalog(PriceCatalogCSV, []byte("resourceType,price\naws_instance,abc\n"))
+	assert.Error(t, err)
+	_, err = ParsePriceCatalog(PriceCatalogCSV, []byte("resourceType,value,price\naws_instance,t3.micro,1\n"))
+	assert.Error(t, err)
+	_, err = ParsePriceCatalog("json", []byte("[]"))
+	assert.Error(t, err)
+}
+
+func TestEstimateTaskCost(t *testing.T) {
+	plan, err := UnmarshalPlanJson([]byte(testCostPlanJson))
+	if !assert.NoError(t, err) {
+		return
+	}
+	prices, err := ParsePriceCatalog(PriceCatalogCSV, []byte(testPriceCatalogCSV))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Nil(t, EstimateTaskCost(nil, plan.ResourceChanges))
+
+	cost := EstimateTaskCost(prices, plan.ResourceChanges)
+	if !assert.NotNil(t, cost) {
+		return
+	}
+	assert.Equal(t, []models.ResourceCost{
+		{Address: "alicloud_instance.web", Type: "alicloud_instance", Action: models.ResourceChangeUpdate,
+			MonthlyBefore: 369, MonthlyAfter: 740},
+		{Address: "alicloud_eip.ip", Type: "alicloud_eip", Action: models.ResourceChangeCreate,
+			MonthlyBefore: 0, MonthlyAfter: 110},
+	}, cost.Resources)
+	// 删除没有价格配置的资源不会增加费用
+	assert.Equal(t, 1, cost.Unpriced)
+	assert.Equal(t, 0, cost.UnpricedChanges)
+	assert.Equal(t, float64(369), cost.MonthlyBefore)
+	assert.Equal(t, float64(850), cost.MonthlyAfter)
+	assert.Equal(t, float64(481), cost.MonthlyDelta)
+	assert.Equal(t, "369.00 -> 850.00 (+481.00)", cost.Summary())
+
+	assert.Nil(t, CheckTaskCostDelta(cost, nil))
+	threshold := float64(500)
+	assert.Nil(t, CheckTaskCostDelta(cost, &threshold))
+	threshold = 100
+	er := CheckTaskCostDelta(cost, &threshold)
+	if assert.NotNil(t, er) {
+		assert.Equal(t, e.CostDeltaExceeded, er.Code())
+	}
+
+	// 新建没有价格配置的资源时无法确定费用增加，配置了限制时返回错误
+	plan.ResourceChanges[2].Change.Actions = []string{"create"}
+	cost = EstimateTaskCost(prices, plan.ResourceChanges)
+	assert.Equal(t, 1, cost.UnpricedChanges)
+	assert.Nil(t, CheckTaskCostDelta(cost, nil))
+	threshold = 500
+	er = CheckTaskCostDelta(cost, &threshold)
+	if assert.NotNil(t, er) {
+		assert.Equal(t, e.CostEstimateFailed, er.Code())
+	}
+}
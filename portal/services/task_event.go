@@ -0,0 +1,298 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+terraform plan、apply 使用 -json 参数执行时输出机器可读的事件流(每行一条 json)，
+参考文档: https://www.terraform.io/docs/internals/machine-readable-ui.html
+
+portal 保存步骤日志时将事件流解析为 TaskStepEvent 保存到步骤的事件文件中，
+日志中的事件则替换为可读的文本，保持与未使用 -json 参数时的日志兼容。
+*/
+
+// terraform 事件类型，其他类型如 apply_start、apply_complete、planned_change 等不需要特殊处理
+const (
+	TfEventChangeSummary = "change_summary"
+	TfEventDiagnostic    = "diagnostic"
+	TfEventOutputs       = "outputs"
+)
+
+type tfJsonResource struct {
+	Addr         string `json:"addr"`
+	Module       string `json:"module"`
+	ResourceType string `json:"resource_type"`
+	ResourceName string `json:"resource_name"`
+}
+
+type tfJsonMessage struct {
+	Level     string `json:"@level"`
+	Message   string `json:"@message"`
+	Timestamp string `json:"@timestamp"`
+	Type      string `json:"type"`
+
+	// apply_*、provision_*、refresh_* 事件
+	Hook *struct {
+		Resource       tfJsonResource `json:"resource"`
+		Action         string         `json:"action"`
+		IdKey          string         `json:"id_key"`
+		IdValue        string         `json:"id_value"`
+		ElapsedSeconds int            `json:"elapsed_seconds"`
+	} `json:"hook"`
+	// planned_change、resource_drift 事件
+	Change *struct {
+		Resource tfJsonResource `json:"resource"`
+		Action   string         `json:"action"`
+	} `json:"change"`
+	Diagnostic *struct {
+		Severity string `json:"severity"`
+		Summary  string `json:"summary"`
+		Detail   string `json:"detail"`
+		Address  string `json:"address"`
+		Range    *struct {
+			Filename string `json:"filename"`
+			Start    struct {
+				Line int `json:"line"`
+			} `json:"start"`
+		} `json:"range"`
+	} `json:"diagnostic"`
+	Changes *TfChangeSummary `json:"changes"`
+	Outputs map[string]struct {
+		Sensitive bool            `json:"sensitive"`
+		Value     json.RawMessage `json:"value"`
+	} `json:"outputs"`
+}
+
+// TfChangeSummary 资源变更统计
+type TfChangeSummary struct {
+	Add       int    `json:"add"`
+	Change    int    `json:"change"`
+	Remove    int    `json:"remove"`
+	Operation string `json:"operation"` // plan 或 apply
+}
+
+// TaskStepEvent 步骤执行过程中的 terraform 事件
+type TaskStepEvent struct {
+	Type      string `json:"type"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+
+	// 资源事件
+	Address        string `json:"address,omitempty"` // 资源地址，diagnostic 事件为关联的资源地址
+	Module         string `json:"module,omitempty"`
+	ResourceType   string `json:"resourceType,omitempty"`
+	ResourceName   string `json:"resourceName,omitempty"`
+	Action         string `json:"action,omitempty"` // create、update、delete、replace、read 等
+	ResourceId     string `json:"resourceId,omitempty"`
+	ElapsedSeconds int    `json:"elapsedSeconds,omitempty"` // 资源操作已执行的时间
+
+	// diagnostic 事件
+	Severity string `json:"severity,omitempty"` // error 或 warning
+	Summary  string `json:"summary,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+
+	// change_summary 事件
+	Changes *TfChangeSummary `json:"changes,omitempty"`
+}
+
+func parseTfJsonMessage(line []byte) *tfJsonMessage {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte(`{"@level"`)) {
+		return nil
+	}
+	msg := tfJsonMessage{}
+	if err := json.Unmarshal(line, &msg); err != nil || msg.Type == "" {
+		return nil
+	}
+	return &msg
+}
+
+func (m *tfJsonMessage) event() *TaskStepEvent {
+	ev := TaskStepEvent{
+		Type:      m.Type,
+		Level:     m.Level,
+		Message:   m.Message,
+		Timestamp: m.Timestamp,
+		Changes:   m.Changes,
+	}
+	setResource := func(r tfJsonResource) {
+		ev.Address = r.Addr
+		ev.Module = r.Module
+		ev.ResourceType = r.ResourceType
+		ev.ResourceName = r.ResourceName
+	}
+	if m.Hook != nil {
+		setResource(m.Hook.Resource)
+		ev.Action = m.Hook.Action
+		ev.ResourceId = m.Hook.IdValue
+		ev.ElapsedSeconds = m.Hook.ElapsedSeconds
+	}
+	if m.Change != nil {
+		setResource(m.Change.Resource)
+		ev.Action = m.Change.Action
+	}
+	if d := m.Diagnostic; d != nil {
+		ev.Severity = d.Severity
+		ev.Summary = d.Summary
+		ev.Detail = d.Detail
+		ev.Address = d.Address
+		if d.Range != nil {
+			ev.Filename = d.Range.Filename
+			ev.Line = d.Range.Start.Line
+		}
+	}
+	return &ev
+}
+
+// render 返回事件对应的可读文本，格式与未使用 -json 参数时的输出一致
+func (m *tfJsonMessage) render() string {
+	switch {
+	case m.Type == TfEventDiagnostic && m.Diagnostic != nil:
+		d := m.Diagnostic
+		buf := strings.Builder{}
+		fmt.Fprintf(&buf, "\n%s\n", m.Message)
+		if d.Range != nil {
+			fmt.Fprintf(&buf, "\n  on %s line %d", d.Range.Filename, d.Range.Start.Line)
+			if d.Address != "" {
+				fmt.Fprintf(&buf, ", in %s", d.Address)
+			}
+			buf.WriteString(":\n")
+		}
+		if d.Detail != "" {
+			fmt.Fprintf(&buf, "\n%s\n", d.Detail)
+		}
+		return buf.String()
+	case m.Type == TfEventOutputs:
+		if len(m.Outputs) == 0 {
+			return ""
+		}
+		names := make([]string, 0, len(m.Outputs))
+		for name := range m.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf := strings.Builder{}
+		buf.WriteString("\nOutputs:\n\n")
+		for _, name := range names {
+			o := m.Outputs[name]
+			if o.Sensitive {
+				fmt.Fprintf(&buf, "%s = <sensitive>\n", name)
+			} else {
+				fmt.Fprintf(&buf, "%s = %s\n", name, o.Value)
+			}
+		}
+		return buf.String()
+	case m.Type == TfEventChangeSummary:
+		return fmt.Sprintf("\n%s\n", m.Message)
+	default:
+		return m.Message + "\n"
+	}
+}
+
+// renderTfLogLine 将 terraform 事件替换为可读文本，其他内容原样返回
+func renderTfLogLine(line []byte) []byte {
+	if msg := parseTfJsonMessage(line); msg != nil {
+		return []byte(msg.render())
+	}
+	return line
+}
+
+// tfEventLine 将 terraform 事件转换为 TaskStepEvent json，忽略其他内容
+func tfEventLine(line []byte) []byte {
+	msg := parseTfJsonMessage(line)
+	if msg == nil {
+		return nil
+	}
+	bs, err := json.Marshal(msg.event())
+	if err != nil {
+		return nil
+	}
+	return append(bs, '\n')
+}
+
+// SplitTfEventLog 从步骤日志中分离出 terraform 事件，返回可读的日志内容及事件(每行一条 TaskStepEvent json)
+func SplitTfEventLog(content []byte) (logContent []byte, events []byte) {
+	logBuf := bytes.NewBuffer(make([]byte, 0, len(content)))
+	eventBuf := bytes.NewBuffer(nil)
+	for len(content) > 0 {
+		n := bytes.IndexByte(content, '\n') + 1
+		if n == 0 {
+			n = len(content)
+		}
+		line := content[:n]
+		content = content[n:]
+
+		if msg := parseTfJsonMessage(line); msg != nil {
+			logBuf.WriteString(msg.render())
+			if bs, err := json.Marshal(msg.event()); err == nil {
+				eventBuf.Write(append(bs, '\n'))
+			}
+		} else {
+			logBuf.Write(line)
+		}
+	}
+	return logBuf.Bytes(), eventBuf.Bytes()
+}
+
+// TfOutputWriter 按行转换 terraform 输出后写入 w
+type TfOutputWriter struct {
+	w       io.Writer
+	convert func(line []byte) []byte
+	pending []byte
+}
+
+// NewTfLogRenderWriter 返回将 terraform 事件替换为可读文本后写入 w 的 writer
+func NewTfLogRenderWriter(w io.Writer) *TfOutputWriter {
+	return &TfOutputWriter{w: w, convert: renderTfLogLine}
+}
+
+// NewTfEventWriter 返回只将 terraform 事件(转换为 TaskStepEvent json)写入 w 的 writer
+func NewTfEventWriter(w io.Writer) *TfOutputWriter {
+	return &TfOutputWriter{w: w, convert: tfEventLine}
+}
+
+func (w *TfOutputWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		n := bytes.IndexByte(w.pending, '\n') + 1
+		if n == 0 {
+			break
+		}
+		if err := w.writeLine(w.pending[:n]); err != nil {
+			return 0, err
+		}
+		w.pending = w.pending[n:]
+	}
+	// 避免已处理的内容一直占用缓存
+	w.pending = append(make([]byte, 0, len(w.pending)), w.pending...)
+	return len(p), nil
+}
+
+func (w *TfOutputWriter) writeLine(line []byte) error {
+	if out := w.convert(line); len(out) > 0 {
+		_, err := w.w.Write(out)
+		return err
+	}
+	return nil
+}
+
+// Flush 输出未换行的内容
+func (w *TfOutputWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	err := w.writeLine(w.pending)
+	w.pending = w.pending[:0]
+	return err
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTfJsonLog = `Terraform v1.0.6
+{"@level":"info","@message":"aws_instance.web: Creating...","@module":"terraform.ui","@timestamp":"2021-09-01T10:00:00.000000+08:00","hook":{"resource":{"addr":"aws_instance.web","module":"","resource":"aws_instance.web","implied_provider":"aws","resource_type":"aws_instance","resource_name":"web","resource_key":null},"action":"create"},"type":"apply_start"}
+{"@level":"info","@message":"aws_instance.web: Creation complete after 12s [id=i-123]","@module":"terraform.ui","@timestamp":"2021-09-01T10:00:12.000000+08:00","hook":{"resource":{"addr":"aws_instance.web","module":"","resource":"aws_instance.web","implied_provider":"aws","resource_type":"aws_instance","resource_name":"web","resource_key":null},"action":"create","id_key":"id","id_value":"i-123","elapsed_seconds":12},"type":"apply_complete"}
+{"@level":"error","@message":"Error: creating subnet","@module":"terraform.ui","@timestamp":"2021-09-01T10:00:13.000000+08:00","diagnostic":{"severity":"error","summary":"creating subnet","detail":"InvalidParameter","address":"aws_subnet.a","range":{"filename":"main.tf","start":{"line":3,"column":1,"byte":20},"end":{"line":3,"column":2,"byte":21}}},"type":"diagnostic"}
+{"@level":"info","@message":"Apply complete! Resources: 1 added, 0 changed, 0 destroyed.","@module":"terraform.ui","@timestamp":"2021-09-01T10:00:14.000000+08:00","changes":{"add":1,"change":0,"remove":0,"operation":"apply"},"type":"change_summary"}
+{"@level":"info","@message":"Outputs: 2","@module":"terraform.ui","@timestamp":"2021-09-01T10:00:14.000000+08:00","outputs":{"ip":{"sensitive":false,"type":"string","value":"10.0.0.1"},"password":{"sensitive":true,"type":"string"}},"type":"outputs"}
+`
+
+func TestSplitTfEventLog(t *testing.T) {
+	content, events := SplitTfEventLog([]byte(testTfJsonLog))
+	assert.Equal(t, `Terraform v1.0.6
+aws_instance.web: Creating...
+aws_instance.web: Creation complete after 12s [id=i-123]
+
+Error: creating subnet
+
+  on main.tf line 3, in aws_subnet.a:
+
+InvalidParameter
+
+Apply complete! Resources: 1 added, 0 changed, 0 destroyed.
+
+Outputs:
+
+ip = "10.0.0.1"
+password = <sensitive>
+`, string(content))
+
+	lines := strings.Split(strings.TrimSpace(string(events)), "\n")
+	assert.Len(t, lines, 5)
+	ev := TaskStepEvent{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &ev))
+	assert.Equal(t, "apply_complete", ev.Type)
+	assert.Equal(t, "aws_instance.web", ev.Address)
+	assert.Equal(t, "aws_instance", ev.ResourceType)
+	assert.Equal(t, "create", ev.Action)
+	assert.Equal(t, "i-123", ev.ResourceId)
+	assert.Equal(t, 12, ev.ElapsedSeconds)
+
+	ev = TaskStepEvent{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &ev))
+	assert.Equal(t, "error", ev.Severity)
+	assert.Equal(t, "main.tf", ev.Filename)
+	assert.Equal(t, 3, ev.Line)
+
+	ev = TaskStepEvent{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[3]), &ev))
+	assert.Equal(t, &TfChangeSummary{Add: 1, Operation: "apply"}, ev.Changes)
+
+	// 按任意长度分段写入时结果一致
+	logBuf, eventBuf := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	logWriter, eventWriter := NewTfLogRenderWriter(logBuf), NewTfEventWriter(eventBuf)
+	for s := testTfJsonLog; len(s) > 0; {
+		n := 37
+		if n > len(s) {
+			n = len(s)
+		}
+		_, _ = logWriter.Write([]byte(s[:n]))
+		_, _ = eventWriter.Write([]byte(s[:n]))
+		s = s[n:]
+	}
+	assert.NoError(t, logWriter.Flush())
+	assert.NoError(t, eventWriter.Flush())
+	assert.Equal(t, string(content), logBuf.String())
+	assert.Equal(t, string(events), eventBuf.String())
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flowFileRepo 模拟只实现了 ReadFileContent 的仓库
+type flowFileRepo struct {
+	vcsrv.RepoIface
+	content []byte
+	err     error
+}
+
+func (r *flowFileRepo) ReadFileContent(branch, path string) ([]byte, error) {
+	return r.content, r.err
+}
+
+func TestGetRepoTaskFlow(t *testing.T) {
+	defaultPlan, _ := models.DefaultTaskFlow(common.TaskTypePlan)
+
+	// 文件不存在或未定义该类型任务的流程时使用默认流程
+	repo := &flowFileRepo{err: e.New(e.VcsError, fmt.Errorf("read file: %w", vcsrv.ErrFileNotFound))}
+	flow, er := getRepoTaskFlow(repo, "master", "flow.yml", common.TaskTypePlan)
+	assert.Nil(t, er)
+	assert.Equal(t, defaultPlan, flow)
+
+	repo = &flowFileRepo{content: []byte("apply:\n  steps:\n    - type: plan\n    - type: apply\n")}
+	flow, er = getRepoTaskFlow(repo, "master", "flow.yml", common.TaskTypePlan)
+	assert.Nil(t, er)
+	assert.Equal(t, defaultPlan, flow)
+
+	flow, er = getRepoTaskFlow(repo, "master", "flow.yml", common.TaskTypeApply)
+	assert.Nil(t, er)
+	assert.Len(t, flow.Steps, 2)
+
+	// 其他读取错误及无效的流程文件不使用默认流程
+	repo = &flowFileRepo{err: e.New(e.VcsError, fmt.Errorf("502 Bad Gateway: upstream not found"))}
+	_, er = getRepoTaskFlow(repo, "master", "flow.yml", common.TaskTypePlan)
+	if assert.NotNil(t, er) {
+		assert.Equal(t, e.VcsError, er.Code())
+	}
+
+	repo = &flowFileRepo{content: []byte("plan:\n  steps:\n    - type: plan\n    - type: apply\n")}
+	_, er = getRepoTaskFlow(repo, "master", "flow.yml", common.TaskTypePlan)
+	if assert.NotNil(t, er) {
+		assert.Equal(t, e.TaskFlowInvalid, er.Code())
+	}
+}
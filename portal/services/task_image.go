@@ -0,0 +1,56 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NormalizeTaskImages 去除任务镜像列表中的空项及重复项
+func NormalizeTaskImages(images []string) []string {
+	result := make([]string, 0, len(images))
+	seen := make(map[string]bool)
+	for _, image := range images {
+		image = strings.TrimSpace(image)
+		if image == "" || seen[image] {
+			continue
+		}
+		seen[image] = true
+		result = append(result, image)
+	}
+	return result
+}
+
+// IsTaskImageAllowed 镜像是否在允许的镜像列表中，列表项以 * 结尾时按前缀匹配
+func IsTaskImageAllowed(allowlist []string, image string) bool {
+	for _, pattern := range allowlist {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(image, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == image {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTaskImage 检查组织是否允许使用该任务镜像，image 为空表示使用 runner 默认镜像，总是允许
+func CheckTaskImage(sess *db.Session, orgId models.Id, image string) e.Error {
+	if image == "" {
+		return nil
+	}
+	org, err := GetOrganizationById(sess, orgId)
+	if err != nil {
+		return err
+	}
+	if !IsTaskImageAllowed(org.TaskImages, image) {
+		return e.New(e.TaskImageNotAllowed, fmt.Errorf("image '%s' is not allowed", image), http.StatusBadRequest)
+	}
+	return nil
+}
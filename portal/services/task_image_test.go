@@ -0,0 +1,31 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTaskImageAllowed(t *testing.T) {
+	allowlist := NormalizeTaskImages([]string{
+		" cloudiac/ct-worker:k8s ", "", "registry.example.com/iac/*", "cloudiac/ct-worker:k8s",
+	})
+	assert.Equal(t, []string{"cloudiac/ct-worker:k8s", "registry.example.com/iac/*"}, allowlist)
+
+	cases := []struct {
+		image  string
+		expect bool
+	}{
+		{"cloudiac/ct-worker:k8s", true},
+		{"cloudiac/ct-worker:latest", false},
+		{"registry.example.com/iac/helm:3", true},
+		{"registry.example.com/other/helm:3", false},
+		{"registry.example.com/iac", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expect, IsTaskImageAllowed(allowlist, c.image), c.image)
+	}
+	assert.False(t, IsTaskImageAllowed(nil, "cloudiac/ct-worker:k8s"))
+}
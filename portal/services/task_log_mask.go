@@ -0,0 +1,77 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+)
+
+// GetTaskLogMasker 返回替换任务日志中敏感信息的 SecretMasker，敏感信息包括:
+// 敏感变量的值、任务使用的私钥、state backend 的认证信息，以及代码仓库地址中的 token
+func GetTaskLogMasker(sess *db.Session, task models.Tasker) (*utils.SecretMasker, error) {
+	var secrets []string
+	switch t := task.(type) {
+	case *models.Task:
+		s, err := taskSecrets(sess, t)
+		if err != nil {
+			return nil, err
+		}
+		secrets = s
+	case *models.ScanTask:
+		secrets = utils.RepoAddrSecrets(t.RepoAddr)
+	}
+	return utils.NewSecretMasker(secrets...), nil
+}
+
+func taskSecrets(sess *db.Session, task *models.Task) ([]string, error) {
+	logger := logs.Get().WithField("func", "taskSecrets").WithField("taskId", task.Id)
+	secrets := utils.RepoAddrSecrets(task.RepoAddr)
+	for _, v := range task.Variables {
+		if !v.Sensitive {
+			continue
+		}
+		value, err := utils.AesDecrypt(v.Value)
+		if err != nil {
+			// 解密失败时 runner 同样无法解密，该值不会出现在日志中
+			logger.Warnf("decrypt variable '%s' error: %v", v.Name, err)
+			continue
+		}
+		secrets = append(secrets, value)
+	}
+
+	if task.KeyId != "" {
+		key, err := GetKeyById(sess, task.KeyId, true)
+		if err != nil && err.Code() != e.KeyDecryptFail && err.Code() != e.KeyNotExist {
+			return nil, err
+		} else if err == nil {
+			secrets = append(secrets, key.Content)
+		}
+	}
+
+	if task.StateBackendId != "" {
+		backend, err := GetStateBackendById(sess, task.StateBackendId)
+		if err != nil && err.Code() != e.StateBackendNotExists {
+			return nil, err
+		} else if err == nil {
+			values, er := GetStateBackendSecretValues(backend, task.EnvId)
+			if er != nil {
+				logger.Warnf("decrypt state backend secrets error: %v", er)
+			}
+			secrets = append(secrets, values...)
+		}
+	}
+	return secrets, nil
+}
+
+// MaskTaskLog 替换任务日志中的敏感信息，获取敏感信息失败时返回错误，不返回日志内容
+func MaskTaskLog(sess *db.Session, task models.Tasker, content []byte) ([]byte, error) {
+	masker, err := GetTaskLogMasker(sess, task)
+	if err != nil {
+		return nil, err
+	}
+	return masker.Mask(content), nil
+}
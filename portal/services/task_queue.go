@@ -0,0 +1,306 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	QueueTaskKindDeploy = "deploy" // 部署任务(iac_task)
+	QueueTaskKindScan   = "scan"   // 合规扫描任务(iac_scan_task)
+)
+
+// 任务在队列中等待的原因，为空表示可以立即执行
+const (
+	QueueReasonEnvBusy      = "env_busy"      // 环境有其他任务在执行或排在前面
+	QueueReasonRunnerLimit  = "runner_limit"  // runner 已达并发限制
+	QueueReasonOrgLimit     = "org_limit"     // 组织已达并发限制
+	QueueReasonProjectLimit = "project_limit" // 项目已达并发限制
+	QueueReasonNoRunner     = "no_runner"     // 没有匹配标签的健康 runner
+)
+
+// QueueTask 任务队列中的任务
+type QueueTask struct {
+	Id         models.Id       `json:"id"`
+	Kind       string          `json:"kind" enums:"deploy,scan"` // 任务类别
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	OrgId      models.Id       `json:"orgId"`
+	ProjectId  models.Id       `json:"projectId"`
+	EnvId      models.Id       `json:"envId"`
+	RunnerId   string          `json:"runnerId"`   // 执行的 runner，按标签选择时为调度选中的 runner
+	RunnerTags models.StrSlice `json:"runnerTags"` // 部署通道标签选择器
+	CurrStep   int             `json:"-"`          // 部署任务当前步骤，大于 0 表示任务己在 runner 上执行过
+	Priority   int             `json:"priority"`
+	CreatedAt  models.Time     `json:"createdAt"`
+
+	Position int    `json:"position" gorm:"-"` // 在队列中的位置，从 1 开始
+	Reason   string `json:"reason" gorm:"-" enums:"env_busy,runner_limit,org_limit,project_limit,no_runner"`
+	Message  string `json:"message" gorm:"-"` // 等待原因描述
+}
+
+// TaskQueueLimits 任务并发限制，值为 0 表示不限制
+type TaskQueueLimits struct {
+	MaxPerRunner  int
+	MaxPerOrg     int
+	MaxPerProject int
+}
+
+func GetTaskQueueLimits() TaskQueueLimits {
+	return TaskQueueLimits{
+		MaxPerRunner:  GetRunnerMax(),
+		MaxPerOrg:     GetOrgTasksMax(),
+		MaxPerProject: GetProjectTasksMax(),
+	}
+}
+
+// DefaultTaskPriority 根据任务类型及来源计算任务默认优先级，
+// 销毁、解锁等紧急操作优先于定时 plan、漂移检测等后台任务
+func DefaultTaskPriority(typ string, source string) int {
+	switch typ {
+	case models.TaskTypeDestroy, models.TaskTypeUnlock:
+		return models.TaskPriorityHigh
+	case models.TaskTypeScan, models.TaskTypeParse, models.TaskTypeDrift:
+		return models.TaskPriorityLow
+	case models.TaskTypePlan:
+		if source == consts.TaskSourceSchedule || source == consts.TaskSourceDriftCheck {
+			return models.TaskPriorityLow
+		}
+	}
+	return models.TaskPriorityNormal
+}
+
+const queueTaskColumns = "id,name,type,org_id,project_id,env_id,runner_id,priority,created_at"
+
+// MaxQueueTasks 每次调度最多加载的等待任务数(部署任务及扫描任务分别计算)。
+// 等待任务按创建时间加载，保证同一环境中先创建的任务总是先被加载
+const MaxQueueTasks = 1000
+
+// GetTaskQueue 查询等待执行的任务并计算其调度顺序及等待原因。
+// started 为己由 task manager 启动但数据库中可能还未更新状态的任务。
+// 等待任务超过 MaxQueueTasks 时只调度最先创建的部分，其余任务在之后的调度中加载
+func GetTaskQueue(sess *db.Session, started []*QueueTask) ([]*QueueTask, error) {
+	pending, err := queryQueueTasks(sess, []string{models.TaskPending}, MaxQueueTasks)
+	if err != nil {
+		return nil, err
+	}
+	running, err := queryQueueTasks(sess, []string{models.TaskRunning, models.TaskApproving}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	startedIds := make(map[models.Id]bool)
+	runningIds := make(map[models.Id]bool)
+	for _, t := range running {
+		runningIds[t.Id] = true
+	}
+	for _, t := range started {
+		startedIds[t.Id] = true
+		if !runningIds[t.Id] {
+			running = append(running, t)
+		}
+	}
+	queue := make([]*QueueTask, 0, len(pending))
+	for _, t := range pending {
+		if !startedIds[t.Id] {
+			queue = append(queue, t)
+		}
+	}
+
+	busyEnvs := make(map[models.Id]bool)
+	for _, t := range running {
+		if t.Kind == QueueTaskKindDeploy {
+			busyEnvs[t.EnvId] = true
+		}
+	}
+
+	orgIds := make([]models.Id, 0)
+	for _, t := range queue {
+		orgIds = append(orgIds, t.OrgId)
+	}
+	weights := make(map[models.Id]int)
+	if len(orgIds) > 0 {
+		orgs := make([]models.Organization, 0)
+		if err := sess.Model(&models.Organization{}).Select("id,task_weight").
+			Where("id IN (?)", orgIds).Find(&orgs); err != nil {
+			return nil, err
+		}
+		for _, o := range orgs {
+			weights[o.Id] = o.TaskWeight
+		}
+	}
+
+	var runners []*RunnerInfo
+	for _, t := range queue {
+		if len(t.RunnerTags) > 0 {
+			// 查询失败时按标签选择 runner 的任务都无法调度，不影响其他任务
+			if runners, err = ListRunners(); err != nil {
+				logs.Get().Warnf("list runners error: %v", err)
+			}
+			break
+		}
+	}
+
+	return ScheduleTaskQueue(queue, running, busyEnvs, weights, runners, GetTaskQueueLimits()), nil
+}
+
+// queryQueueTasks 按创建时间查询指定状态的任务，limit 为 0 表示不限制数量
+func queryQueueTasks(sess *db.Session, status []string, limit int) ([]*QueueTask, error) {
+	limitQuery := func(query *db.Session) *db.Session {
+		query = query.Order("created_at, id")
+		if limit > 0 {
+			query = query.Limit(limit)
+		}
+		return query
+	}
+
+	deployTasks := make([]*QueueTask, 0)
+	if err := limitQuery(sess.Model(&models.Task{}).Select(queueTaskColumns+",runner_tags,curr_step").
+		Where("status IN (?)", status)).Scan(&deployTasks); err != nil {
+		return nil, err
+	}
+	for _, t := range deployTasks {
+		t.Kind = QueueTaskKindDeploy
+	}
+
+	scanTasks := make([]*QueueTask, 0)
+	if err := limitQuery(sess.Model(&models.ScanTask{}).Select(queueTaskColumns).
+		Where("status IN (?) AND mirror = 0", status)).Scan(&scanTasks); err != nil {
+		return nil, err
+	}
+	for _, t := range scanTasks {
+		t.Kind = QueueTaskKindScan
+	}
+	return append(deployTasks, scanTasks...), nil
+}
+
+// ScheduleTaskQueue 计算等待任务的执行顺序，返回按顺序排列的任务，并设置任务位置及等待原因。
+// 调度规则:
+//  1. 优先级高的任务先执行
+//  2. 同优先级的任务按组织权重公平调度，优先执行 "执行中任务数/权重" 较小的组织的任务
+//  3. 其他情况按创建时间先后执行
+//
+// 同一环境的部署任务始终按创建顺序依次执行，扫描任务不受环境限制。
+// 设置了部署通道标签的任务从 runners 中选择匹配标签、健康且负载最低的 runner，
+// 己执行过步骤的任务(如恢复执行的任务)依赖 runner 上的工作目录，始终使用原 runner
+func ScheduleTaskQueue(pending, running []*QueueTask, busyEnvs map[models.Id]bool,
+	weights map[models.Id]int, runners []*RunnerInfo, limits TaskQueueLimits) []*QueueTask {
+	envBusy := make(map[models.Id]bool)
+	for envId, busy := range busyEnvs {
+		envBusy[envId] = busy
+	}
+	runnerCount := make(map[string]int)
+	orgCount := make(map[models.Id]int)
+	projectCount := make(map[models.Id]int)
+	for _, t := range running {
+		runnerCount[t.RunnerId]++
+		orgCount[t.OrgId]++
+		projectCount[t.ProjectId]++
+	}
+
+	weight := func(orgId models.Id) int {
+		if w := weights[orgId]; w > 0 {
+			return w
+		}
+		return 1
+	}
+
+	remain := make([]*QueueTask, len(pending))
+	copy(remain, pending)
+	sort.SliceStable(remain, func(i, j int) bool {
+		return queueTaskBefore(remain[i], remain[j])
+	})
+
+	// 每个环境中最先创建的部署任务，环境中的其他任务需要等待其执行
+	envFirst := make(map[models.Id]*QueueTask)
+	for _, t := range remain {
+		if t.Kind == QueueTaskKindDeploy {
+			if _, ok := envFirst[t.EnvId]; !ok {
+				envFirst[t.EnvId] = t
+			}
+		}
+	}
+
+	result := make([]*QueueTask, 0, len(remain))
+	for len(remain) > 0 {
+		best := 0
+		for i := 1; i < len(remain); i++ {
+			a, b := remain[i], remain[best]
+			if a.Priority != b.Priority {
+				if a.Priority > b.Priority {
+					best = i
+				}
+				continue
+			}
+			// 比较 orgCount[a]/weight(a) 与 orgCount[b]/weight(b)
+			sa := orgCount[a.OrgId] * weight(b.OrgId)
+			sb := orgCount[b.OrgId] * weight(a.OrgId)
+			if sa < sb {
+				best = i
+			}
+		}
+		t := remain[best]
+		remain = append(remain[:best], remain[best+1:]...)
+
+		t.Position = len(result) + 1
+		t.Reason, t.Message = "", ""
+		runnerId := t.RunnerId
+		if len(t.RunnerTags) > 0 && t.CurrStep == 0 {
+			runnerId = ""
+			if r, matched := SelectRunner(runners, t.RunnerTags, runnerCount, limits.MaxPerRunner); r != nil {
+				runnerId = r.Id
+			} else if !matched {
+				t.Reason = QueueReasonNoRunner
+				t.Message = fmt.Sprintf("no healthy runner matches tags %v", []string(t.RunnerTags))
+			} else {
+				t.Reason = QueueReasonRunnerLimit
+				t.Message = fmt.Sprintf("runners with tags %v reached concurrent limit %d",
+					[]string(t.RunnerTags), limits.MaxPerRunner)
+			}
+		}
+		switch {
+		case t.Kind == QueueTaskKindDeploy && envFirst[t.EnvId] != t:
+			t.Reason = QueueReasonEnvBusy
+			t.Message = fmt.Sprintf("waiting for task %s in the same environment", envFirst[t.EnvId].Id)
+		case t.Kind == QueueTaskKindDeploy && envBusy[t.EnvId]:
+			t.Reason = QueueReasonEnvBusy
+			t.Message = "environment has running task"
+		case t.Reason != "":
+		case limits.MaxPerRunner > 0 && runnerCount[runnerId] >= limits.MaxPerRunner:
+			t.Reason = QueueReasonRunnerLimit
+			t.Message = fmt.Sprintf("runner %s reached concurrent limit %d", runnerId, limits.MaxPerRunner)
+		case limits.MaxPerOrg > 0 && orgCount[t.OrgId] >= limits.MaxPerOrg:
+			t.Reason = QueueReasonOrgLimit
+			t.Message = fmt.Sprintf("organization reached concurrent limit %d", limits.MaxPerOrg)
+		case t.ProjectId != "" && limits.MaxPerProject > 0 && projectCount[t.ProjectId] >= limits.MaxPerProject:
+			t.Reason = QueueReasonProjectLimit
+			t.Message = fmt.Sprintf("project reached concurrent limit %d", limits.MaxPerProject)
+		default:
+			t.RunnerId = runnerId
+			runnerCount[t.RunnerId]++
+			orgCount[t.OrgId]++
+			projectCount[t.ProjectId]++
+			if t.Kind == QueueTaskKindDeploy {
+				envBusy[t.EnvId] = true
+			}
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// queueTaskBefore 同等条件下任务的先后顺序: 创建时间，其次任务 id
+func queueTaskBefore(a, b *QueueTask) bool {
+	ta, tb := time.Time(a.CreatedAt), time.Time(b.CreatedAt)
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return a.Id < b.Id
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newQueueTask(id, org, env string, priority int, createdAt time.Time) *QueueTask {
+	return &QueueTask{
+		Id:        models.Id(id),
+		Kind:      QueueTaskKindDeploy,
+		OrgId:     models.Id(org),
+		ProjectId: models.Id(org + "-p"),
+		EnvId:     models.Id(env),
+		RunnerId:  "runner-01",
+		Priority:  priority,
+		CreatedAt: models.Time(createdAt),
+	}
+}
+
+func queueIds(tasks []*QueueTask) []models.Id {
+	ids := make([]models.Id, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.Id)
+	}
+	return ids
+}
+
+func TestScheduleTaskQueuePriority(t *testing.T) {
+	now := time.Now()
+	pending := []*QueueTask{
+		newQueueTask("plan", "org-a", "env-1", models.TaskPriorityLow, now),
+		newQueueTask("apply", "org-a", "env-2", models.TaskPriorityNormal, now.Add(time.Second)),
+		newQueueTask("destroy", "org-a", "env-3", models.TaskPriorityHigh, now.Add(2*time.Second)),
+	}
+	queue := ScheduleTaskQueue(pending, nil, nil, nil, nil, TaskQueueLimits{})
+	assert.Equal(t, []models.Id{"destroy", "apply", "plan"}, queueIds(queue))
+	for i, task := range queue {
+		assert.Equal(t, i+1, task.Position)
+		assert.Equal(t, "", task.Reason)
+	}
+}
+
+func TestScheduleTaskQueueFairShare(t *testing.T) {
+	now := time.Now()
+	pending := []*QueueTask{
+		newQueueTask("a1", "org-a", "env-a1", models.TaskPriorityNormal, now),
+		newQueueTask("a2", "org-a", "env-a2", models.TaskPriorityNormal, now.Add(time.Second)),
+		newQueueTask("a3", "org-a", "env-a3", models.TaskPriorityNormal, now.Add(2*time.Second)),
+		newQueueTask("b1", "org-b", "env-b1", models.TaskPriorityNormal, now.Add(3*time.Second)),
+		newQueueTask("b2", "org-b", "env-b2", models.TaskPriorityNormal, now.Add(4*time.Second)),
+	}
+	running := []*QueueTask{newQueueTask("a0", "org-a", "env-a0", models.TaskPriorityNormal, now)}
+
+	queue := ScheduleTaskQueue(pending, running, nil, nil, nil, TaskQueueLimits{})
+	assert.Equal(t, []models.Id{"b1", "a1", "b2", "a2", "a3"}, queueIds(queue))
+
+	// org-a 权重为 3 时可以占用更多的执行槽位
+	queue = ScheduleTaskQueue(pending, running, nil, map[models.Id]int{"org-a": 3}, nil, TaskQueueLimits{})
+	assert.Equal(t, []models.Id{"b1", "a1", "a2", "a3", "b2"}, queueIds(queue))
+}
+
+func TestScheduleTaskQueueLimits(t *testing.T) {
+	now := time.Now()
+	pending := []*QueueTask{
+		newQueueTask("a1", "org-a", "env-1", models.TaskPriorityNormal, now),
+		newQueueTask("a2", "org-a", "env-1", models.TaskPriorityHigh, now.Add(time.Second)),
+		newQueueTask("a3", "org-a", "env-2", models.TaskPriorityNormal, now.Add(2*time.Second)),
+		newQueueTask("a4", "org-a", "env-3", models.TaskPriorityNormal, now.Add(3*time.Second)),
+		newQueueTask("b1", "org-b", "env-4", models.TaskPriorityNormal, now.Add(4*time.Second)),
+		newQueueTask("b2", "org-b", "env-5", models.TaskPriorityNormal, now.Add(5*time.Second)),
+	}
+	busyEnvs := map[models.Id]bool{"env-2": true}
+
+	queue := ScheduleTaskQueue(pending, nil, busyEnvs, nil, nil,
+		TaskQueueLimits{MaxPerRunner: 3, MaxPerOrg: 2, MaxPerProject: 1})
+	reasons := make(map[models.Id]string)
+	for _, task := range queue {
+		reasons[task.Id] = task.Reason
+	}
+	assert.Equal(t, map[models.Id]string{
+		"a2": QueueReasonEnvBusy, // 同一环境中的任务按创建顺序执行
+		"a1": "",
+		"b1": "",
+		"a3": QueueReasonEnvBusy,
+		"a4": QueueReasonProjectLimit,
+		"b2": QueueReasonProjectLimit,
+	}, reasons)
+	assert.Equal(t, models.Id("a2"), queue[0].Id)
+
+	queue = ScheduleTaskQueue(pending, nil, nil, nil, nil, TaskQueueLimits{MaxPerRunner: 1})
+	for _, task := range queue {
+		if task.Id == "a1" {
+			assert.Equal(t, "", task.Reason)
+		} else if task.Id != "a2" {
+			assert.Equal(t, QueueReasonRunnerLimit, task.Reason)
+			assert.Equal(t, "runner runner-01 reached concurrent limit 1", task.Message)
+		}
+	}
+}
+
+func TestDefaultTaskPriority(t *testing.T) {
+	assert.Equal(t, models.TaskPriorityHigh, DefaultTaskPriority(models.TaskTypeDestroy, ""))
+	assert.Equal(t, models.TaskPriorityNormal, DefaultTaskPriority(models.TaskTypePlan, ""))
+	assert.Equal(t, models.TaskPriorityLow, DefaultTaskPriority(models.TaskTypePlan, "schedule"))
+	assert.Equal(t, models.TaskPriorityLow, DefaultTaskPriority(models.TaskTypeScan, ""))
+}
+
+func TestScheduleTaskQueueRunnerTags(t *testing.T) {
+	now := time.Now()
+	runners := []*RunnerInfo{
+		{Id: "runner-01", Tags: []string{"aws"}, Healthy: true},
+		{Id: "runner-02", Tags: []string{"aws", "gpu"}, Healthy: true},
+		{Id: "runner-03", Tags: []string{"aws", "gpu"}, Healthy: false},
+	}
+	newTagTask := func(id, env string, tags ...string) *QueueTask {
+		task := newQueueTask(id, "org-a", env, models.TaskPriorityNormal, now)
+		task.RunnerId = ""
+		task.RunnerTags = tags
+		return task
+	}
+	pending := []*QueueTask{
+		newTagTask("t1", "env-1", "aws"),
+		newTagTask("t2", "env-2", "aws"),
+		newTagTask("t3", "env-3", "gpu"),
+		newTagTask("t4", "env-4", "azure"),
+		newTagTask("t5", "env-5", "gpu"),
+	}
+	running := []*QueueTask{{Id: "r1", Kind: QueueTaskKindDeploy, RunnerId: "runner-01"}}
+
+	queue := ScheduleTaskQueue(pending, running, nil, nil, runners, TaskQueueLimits{MaxPerRunner: 2})
+	result := make(map[models.Id]*QueueTask)
+	for _, task := range queue {
+		result[task.Id] = task
+	}
+	// 优先选择负载最低的 runner，不健康的 runner 不参与调度
+	assert.Equal(t, "runner-02", result["t1"].RunnerId)
+	assert.Equal(t, "runner-01", result["t2"].RunnerId)
+	assert.Equal(t, "runner-02", result["t3"].RunnerId)
+	assert.Equal(t, QueueReasonNoRunner, result["t4"].Reason)
+	assert.Equal(t, QueueReasonRunnerLimit, result["t5"].Reason)
+	assert.Equal(t, "", result["t5"].RunnerId)
+
+	// 恢复执行的任务固定使用原 runner
+	resumed := newTagTask("t6", "env-6", "aws")
+	resumed.RunnerId, resumed.CurrStep = "runner-03", 2
+	queue = ScheduleTaskQueue([]*QueueTask{resumed}, running, nil, nil, runners, TaskQueueLimits{MaxPerRunner: 2})
+	assert.Equal(t, "", queue[0].Reason)
+	assert.Equal(t, "runner-03", queue[0].RunnerId)
+}
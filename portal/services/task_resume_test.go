@@ -0,0 +1,68 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTaskResumeStep(t *testing.T) {
+	steps := []*models.TaskStep{
+		{TaskStepBody: models.TaskStepBody{Type: models.TaskStepInit}, Index: 0},
+		{TaskStepBody: models.TaskStepBody{Type: models.TaskStepPlan}, Index: 1},
+		{TaskStepBody: models.TaskStepBody{Type: models.TaskStepApply}, Index: 2},
+		{TaskStepBody: models.TaskStepBody{Type: models.TaskStepPlay}, Index: 3},
+	}
+	intPtr := func(i int) *int { return &i }
+	newTask := func(status string, currStep int) *models.Task {
+		task := &models.Task{}
+		task.Status, task.CurrStep = status, currStep
+		return task
+	}
+
+	cases := []struct {
+		status   string
+		currStep int
+		fromStep *int
+		from     int
+		replan   bool
+	}{
+		// 默认从失败(或被取消)的步骤恢复，不需要重新审批
+		{models.TaskFailed, 2, nil, 2, false},
+		{models.TaskCancelled, 3, nil, 3, false},
+		// 从更早的步骤恢复时重新执行 plan 步骤，需要重新审批
+		{models.TaskFailed, 2, intPtr(1), 1, true},
+		{models.TaskCancelled, 2, intPtr(0), 0, true},
+	}
+	for _, c := range cases {
+		task := newTask(c.status, c.currStep)
+		from, replan, er := getTaskResumeStep(task, steps, c.fromStep)
+		if assert.Nil(t, er, c.status) {
+			assert.Equal(t, c.from, from)
+			assert.Equal(t, c.replan, replan)
+		}
+	}
+
+	// 不能从失败步骤之后的步骤恢复
+	task := newTask(models.TaskFailed, 2)
+	for _, fromStep := range []int{-1, 3} {
+		_, _, er := getTaskResumeStep(task, steps, &fromStep)
+		if assert.NotNil(t, er, fromStep) {
+			assert.Equal(t, e.TaskCannotResume, er.Code())
+		}
+	}
+
+	// 未结束或执行成功的任务不能恢复
+	for _, status := range []string{models.TaskPending, models.TaskRunning, models.TaskApproving,
+		models.TaskComplete, models.TaskRejected} {
+		task := newTask(status, 2)
+		_, _, er := getTaskResumeStep(task, steps, nil)
+		if assert.NotNil(t, er, status) {
+			assert.Equal(t, e.TaskCannotResume, er.Code())
+		}
+	}
+}
@@ -3,6 +3,7 @@
 package services
 
 import (
+	"cloudiac/portal/models"
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -320,3 +321,38 @@ func TestUnmarshalTfResultJson(t *testing.T) {
 		})
 	}
 }
+
+func TestStepStatus2TaskStatus(t *testing.T) {
+	cases := map[string]string{
+		models.TaskStepRunning:   models.TaskRunning,
+		models.TaskStepTimeout:   models.TaskFailed,
+		models.TaskStepCancelled: models.TaskCancelled,
+	}
+	for stepStatus, taskStatus := range cases {
+		assert.Equal(t, taskStatus, stepStatus2TaskStatus(stepStatus))
+	}
+	assert.Panics(t, func() { stepStatus2TaskStatus("unknown") })
+}
+
+func TestParseTaskImportResult(t *testing.T) {
+	items := []models.TaskImportItem{
+		{Address: "aws_instance.web", Id: "i-0001"},
+		{Address: "aws_instance.db", Id: "i-0002"},
+		{Address: "aws_s3_bucket.logs", Id: "logs"},
+	}
+	content := []byte("{\"index\":0,\"exitCode\":0}\n{\"index\":1,\"exitCode\":1}\n")
+
+	results, err := ParseTaskImportResult(items, content)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "aws_instance.web", results[0].Address)
+	assert.True(t, results[0].Success)
+	assert.False(t, results[1].Success)
+	assert.Equal(t, 1, results[1].ExitCode)
+	// 步骤中断时未执行到的资源
+	assert.False(t, results[2].Success)
+	assert.Equal(t, -1, results[2].ExitCode)
+
+	_, err = ParseTaskImportResult(items, []byte("invalid"))
+	assert.Error(t, err)
+}
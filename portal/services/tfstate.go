@@ -0,0 +1,104 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"path"
+	"strings"
+	"time"
+)
+
+// portal 提供的 http state backend，state 保存在 iac_storage 表中(不受日志存储配置影响)
+
+const TfStateStorageDir = "tfstate"
+
+func tfStateStoragePath(statePath string) string {
+	return path.Join(TfStateStorageDir, statePath)
+}
+
+// IsTfStateStoragePath 是否为 http state backend 保存的 state
+func IsTfStateStoragePath(p string) bool {
+	return strings.HasPrefix(p, TfStateStorageDir+"/")
+}
+
+// GetTfState 读取 state 内容，state 不存在时返回 nil
+func GetTfState(sess *db.Session, statePath string) ([]byte, e.Error) {
+	storage := models.DBStorage{}
+	if err := sess.Where("path = ?", tfStateStoragePath(statePath)).First(&storage); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return storage.Content, nil
+}
+
+func SaveTfState(tx *db.Session, statePath string, content []byte) e.Error {
+	if _, err := tx.Exec("REPLACE INTO iac_storage(path,content,created_at) VALUES (?,?,NOW())",
+		tfStateStoragePath(statePath), content); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func DeleteTfState(tx *db.Session, statePath string) e.Error {
+	if _, err := tx.Where("path = ?", tfStateStoragePath(statePath)).Delete(&models.DBStorage{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// GetTfStateLock 查询 state 锁，未加锁时返回 nil
+func GetTfStateLock(sess *db.Session, statePath string) (*models.StateLock, e.Error) {
+	lock := models.StateLock{}
+	if err := sess.Where("path = ?", statePath).First(&lock); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &lock, nil
+}
+
+// LockTfState 对 state 加锁，已被其他锁占用时返回 StateLocked 错误及当前的锁
+func LockTfState(tx *db.Session, statePath string, lockId string, info string) (*models.StateLock, e.Error) {
+	lock := models.StateLock{
+		Path:      statePath,
+		LockId:    lockId,
+		Info:      info,
+		CreatedAt: models.Time(time.Now()),
+	}
+	if err := models.Create(tx, &lock); err != nil {
+		if !e.IsDuplicate(err) {
+			return nil, e.New(e.DBError, err)
+		}
+		current, er := GetTfStateLock(tx, statePath)
+		if er != nil {
+			return nil, er
+		}
+		if current != nil && current.LockId != lockId {
+			return current, e.New(e.StateLocked)
+		}
+	}
+	return &lock, nil
+}
+
+// UnlockTfState 释放 state 锁，lockId 为空时强制释放
+func UnlockTfState(tx *db.Session, statePath string, lockId string) e.Error {
+	current, err := GetTfStateLock(tx, statePath)
+	if err != nil {
+		return err
+	} else if current == nil {
+		return nil
+	}
+	if lockId != "" && current.LockId != lockId {
+		return e.New(e.StateLocked)
+	}
+	if _, err := tx.Where("path = ? AND lock_id = ?", statePath, current.LockId).Delete(&models.StateLock{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
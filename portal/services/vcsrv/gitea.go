@@ -211,6 +211,11 @@ func (gitea *giteaRepoIface) ReadFileContent(branch, path string) (content []byt
 		return []byte{}, e.New(e.BadRequest, er)
 	}
 	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return []byte{}, e.New(e.BadRequest, fmt.Errorf("read file '%s': %w", path, ErrFileNotFound))
+	} else if response.StatusCode != http.StatusOK {
+		return []byte{}, e.New(e.BadRequest, fmt.Errorf("read file '%s': %s", path, response.Status))
+	}
 
 	return body[:], nil
 }
@@ -204,10 +204,15 @@ type giteeReadContent struct {
 func (gitee *giteeRepoIface) ReadFileContent(branch, path string) (content []byte, err error) {
 	pathAddr := gitee.vcs.Address +
 		fmt.Sprintf("/repos/%s/contents/%s?access_token=%s&ref=%s", gitee.repository.FullName, path, gitee.vcs.VcsToken, branch)
-	_, body, er := gitee.giteaRequest(pathAddr, "GET", nil)
+	response, body, er := gitee.giteaRequest(pathAddr, "GET", nil)
 	if er != nil {
 		return nil, e.New(e.BadRequest, er)
 	}
+	if response.StatusCode == http.StatusNotFound {
+		return nil, e.New(e.BadRequest, fmt.Errorf("read file '%s': %w", path, ErrFileNotFound))
+	} else if response.StatusCode != http.StatusOK {
+		return nil, e.New(e.BadRequest, fmt.Errorf("read file '%s': %s", path, response.Status))
+	}
 	grc := giteeReadContent{}
 	_ = json.Unmarshal(body[:], &grc)
 	decoded, err := base64.StdEncoding.DecodeString(grc.Content)
@@ -233,10 +233,15 @@ func (github *githubRepoIface) ReadFileContent(branch, path string) (content []b
 	urlParam.Set("ref", branch)
 	pathAddr := utils.GenQueryURL(github.vcs.Address,
 		fmt.Sprintf("/repos/%s/contents/%s", github.repository.FullName, path), urlParam)
-	_, body, er := github.githubRequest(pathAddr, "GET", github.vcs.VcsToken, nil)
+	response, body, er := github.githubRequest(pathAddr, "GET", github.vcs.VcsToken, nil)
 	if er != nil {
 		return nil, e.New(e.BadRequest, er)
 	}
+	if response.StatusCode == http.StatusNotFound {
+		return nil, e.New(e.BadRequest, fmt.Errorf("read file '%s': %w", path, ErrFileNotFound))
+	} else if response.StatusCode != http.StatusOK {
+		return nil, e.New(e.BadRequest, fmt.Errorf("read file '%s': %s", path, response.Status))
+	}
 	grc := githubReadContent{}
 	_ = json.Unmarshal(body[:], &grc)
 	decoded, err := base64.StdEncoding.DecodeString(grc.Content)
@@ -7,6 +7,7 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/utils"
 	"fmt"
+	"net/http"
 	"strconv"
 	"time"
 
@@ -145,9 +146,12 @@ func (git *gitlabRepoIface) ListFiles(option VcsIfaceOptions) ([]string, error)
 
 func (git *gitlabRepoIface) ReadFileContent(branch, path string) (content []byte, err error) {
 	opt := &gitlab.GetRawFileOptions{Ref: gitlab.String(branch)}
-	row, _, errs := git.gitConn.RepositoryFiles.GetRawFile(git.Project.ID, path, opt)
+	row, resp, errs := git.gitConn.RepositoryFiles.GetRawFile(git.Project.ID, path, opt)
 	if errs != nil {
-		return content, e.New(e.VcsError, err)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return content, e.New(e.VcsError, fmt.Errorf("read file '%s': %w", path, ErrFileNotFound))
+		}
+		return content, e.New(e.VcsError, errs)
 	}
 	return row, nil
 }
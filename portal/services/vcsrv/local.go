@@ -200,6 +200,9 @@ func (l *LocalRepo) ReadFileContent(revision string, path string) (content []byt
 
 	file, err := commit.File(path)
 	if err != nil {
+		if err == object.ErrFileNotFound {
+			return nil, fmt.Errorf("read file '%s': %w", path, ErrFileNotFound)
+		}
 		return nil, err
 	}
 
@@ -3,11 +3,13 @@
 package vcsrv
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -99,3 +101,11 @@ func TestLocalVcs(t *testing.T) {
 		t.Logf("%s content: %s", files[0], content)
 	}
 }
+
+func TestIsNotFoundErr(t *testing.T) {
+	assert.True(t, IsNotFoundErr(fmt.Errorf("read file 'a.yml': %w", ErrFileNotFound)))
+	assert.True(t, IsNotFoundErr(e.New(e.VcsError, fmt.Errorf("read file 'a.yml': %w", ErrFileNotFound))))
+	// 错误信息中包含 not found 的其他错误不是文件不存在
+	assert.False(t, IsNotFoundErr(e.New(e.VcsError, fmt.Errorf("502 Bad Gateway: upstream not found"))))
+	assert.False(t, IsNotFoundErr(nil))
+}
@@ -69,6 +69,7 @@ type RepoIface interface {
 	// ReadFileContent
 	// param path: 路径
 	// param branch: 分支
+	// 文件不存在时返回的错误可以通过 IsNotFoundErr 判断
 	ReadFileContent(branch, path string) (content []byte, err error)
 
 	// FormatRepoSearch 格式化输出前端需要的内容
@@ -198,3 +199,14 @@ func SetWebhook(vcs *models.Vcs, repoId string, triggers []string) error {
 		return nil
 	}
 }
+
+// ErrFileNotFound ReadFileContent 读取的文件不存在
+var ErrFileNotFound = errors.New("file not found")
+
+// IsNotFoundErr 判断 ReadFileContent 返回的错误是否为文件不存在
+func IsNotFoundErr(err error) bool {
+	if er, ok := err.(*e.MyError); ok {
+		err = er.Err()
+	}
+	return errors.Is(err, ErrFileNotFound)
+}
@@ -30,21 +30,19 @@ const (
 	TaskManagerLockKey = "task-manager-lock"
 )
 
-var (
-	ErrMaxTasksPerRunner = fmt.Errorf("concurrent limite")
-)
-
 type TaskManager struct {
 	id     string
 	db     *db.Session
 	logger logs.Logger
 
-	envRunningTask sync.Map       // 每个环境下正在执行的任务
-	runnerTaskNum  map[string]int // 每个 runner 正在执行的任务数量
+	envRunningTask  sync.Map // 每个环境下正在执行的任务
+	startedTasks    sync.Map // 己启动执行的任务(*services.QueueTask)，用于计算并发数量
+	cancellingTasks sync.Map // 己通知 runner 停止执行的任务
 
 	wg sync.WaitGroup // 等待执行任务协程退出的 wait group
 
-	maxTasksPerRunner int // 每个 runner 并发任务数量限制
+	lastDataPurgeAt     time.Time // 最后一次清理过期数据的时间
+	lastWorkspaceKeepAt time.Time // 最后一次向 runner 上报需要保留工作目录的任务的时间
 }
 
 func Start(serviceId string) {
@@ -71,9 +69,9 @@ func Start(serviceId string) {
 func (m *TaskManager) reset() {
 	m.db = db.Get()
 	m.envRunningTask = sync.Map{}
-	m.runnerTaskNum = make(map[string]int)
+	m.startedTasks = sync.Map{}
+	m.cancellingTasks = sync.Map{}
 	m.wg = sync.WaitGroup{}
-	m.maxTasksPerRunner = services.GetRunnerMax()
 }
 
 func (m *TaskManager) acquireLock(ctx context.Context) (<-chan struct{}, error) {
@@ -144,6 +142,22 @@ func (m *TaskManager) start() {
 			m.logger.Errorf("process auto destroy error: %v", err)
 		}
 
+		if err := m.processEnvSchedule(); err != nil {
+			m.logger.Errorf("process env schedule error: %v", err)
+		}
+
+		if err := m.processDriftCheck(); err != nil {
+			m.logger.Errorf("process drift check error: %v", err)
+		}
+
+		if err := m.processDataPurge(); err != nil {
+			m.logger.Errorf("process data purge error: %v", err)
+		}
+
+		m.processWorkspaceKeepReport()
+
+		m.processTaskCancel()
+
 		m.processPendingTask(ctx)
 
 		select {
@@ -198,110 +212,62 @@ func (m *TaskManager) recoverTask(ctx context.Context) error {
 	return nil
 }
 
-func (m *TaskManager) getPendingDeployTasks() []*models.Task {
-	logger := m.logger
-
-	runningEnvs := make([]models.Id, 0)
-	m.envRunningTask.Range(func(key, value interface{}) bool {
-		runningEnvs = append(runningEnvs, key.(models.Id))
+// getStartedTasks 返回己启动执行的任务，任务启动后数据库中的状态可能还未更新，需要计入并发数量
+func (m *TaskManager) getStartedTasks() []*services.QueueTask {
+	tasks := make([]*services.QueueTask, 0)
+	m.startedTasks.Range(func(key, value interface{}) bool {
+		tasks = append(tasks, value.(*services.QueueTask))
 		return true
 	})
-
-	// 查询每个环境中最先创建的且状态为 pending 的任务
-	firstPendingQuery := m.db.Raw(
-		"SELECT env_id, MIN(created_at) AS created_at FROM iac_task "+
-			"WHERE status = ? GROUP BY env_id", models.TaskPending)
-	// 根据上一步查询到的 env_id + created_at 查询符合条件的任务，并取每个 env 下 id 最小的一条 task 记录
-	// (注意：直接通过 env_id + created_at 匹配可能同一个 env 会返回多条记录)
-	firstPendingIdQuery := m.db.Raw("SELECT iac_task.env_id, MIN(iac_task.id) AS task_id FROM iac_task, (?) AS fpt "+
-		"WHERE iac_task.env_id = fpt.env_id AND iac_task.created_at = fpt.created_at "+
-		"AND iac_task.status = ? GROUP BY env_id", firstPendingQuery.Expr(), models.TaskPending)
-
-	// 通过 id 查询完整任务信息
-	query := m.db.Model(&models.Task{}).Joins("JOIN (?) AS t ON t.task_id = iac_task.id", firstPendingIdQuery.Expr())
-
-	if len(runningEnvs) > 0 {
-		// 过滤掉同一环境下有其他任务在执行的任务
-		query = query.Where("iac_task.env_id NOT IN (?)", runningEnvs)
-	}
-
-	limitedRunners := m.getLimitedRunner()
-	if len(limitedRunners) > 0 {
-		// 查询时过滤掉己达并发限制的 runner
-		query = query.Where("runner_id NOT IN (?)", limitedRunners)
-	}
-
-	queryTaskLimit := 64 // 单次查询任务数量限制
-	tasks := make([]*models.Task, 0)
-	if err := query.Limit(queryTaskLimit).Find(&tasks); err != nil {
-		logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
-	}
-
-	return tasks
-}
-
-func (m *TaskManager) getPendingScanTasks() []*models.ScanTask {
-	logger := m.logger
-
-	// 扫描类型任务支持多个并行执行，不会互相影响，这里获取所有处于 pending 状态的任务列表
-	query := m.db.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskPending)
-
-	limitedRunners := m.getLimitedRunner()
-	if len(limitedRunners) > 0 {
-		// 查询时过滤掉己达并发限制的 runner
-		query = query.Where("runner_id NOT IN (?)", limitedRunners)
-	}
-
-	queryTaskLimit := 64 // 单次查询任务数量限制
-	tasks := make([]*models.ScanTask, 0)
-	if err := query.Limit(queryTaskLimit).Find(&tasks); err != nil {
-		logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
-	}
-
 	return tasks
 }
 
-func (m *TaskManager) getLimitedRunner() []string {
-	limitedRunners := make([]string, 0)
-	for runnerId, count := range m.runnerTaskNum {
-		if count >= m.maxTasksPerRunner {
-			limitedRunners = append(limitedRunners, runnerId)
-		}
-	}
-	return limitedRunners
-}
-
 func (m *TaskManager) processPendingTask(ctx context.Context) {
 	logger := m.logger
 
-	scanTasks := m.getPendingScanTasks()
-	deployTasks := m.getPendingDeployTasks()
-	tasks := make([]models.Tasker, len(scanTasks)+len(deployTasks))
-
-	// 合并等待任务列表，扫描任务更轻量，我们先执行扫描任务
-	for idx := range scanTasks {
-		tasks[idx] = scanTasks[idx]
-	}
-	scanTasksLen := len(scanTasks)
-	for idx := range deployTasks {
-		tasks[scanTasksLen+idx] = deployTasks[idx]
+	// 按优先级及组织间公平调度计算任务执行顺序，只启动当前可以执行的任务
+	queue, err := services.GetTaskQueue(m.db, m.getStartedTasks())
+	if err != nil {
+		logger.Errorf("get task queue error: %v", err)
+		return
 	}
 
-	for i := range tasks {
+	for _, qt := range queue {
 		select {
 		case <-ctx.Done():
-			break
+			return
 		default:
 		}
 
-		task := tasks[i]
-		// 判断 runner 并发数量
-		n := m.runnerTaskNum[task.GetRunnerId()]
-		if n >= m.maxTasksPerRunner {
-			logger.WithField("count", n).Infof("runner %s: %v", task.GetRunnerId(), ErrMaxTasksPerRunner)
+		if qt.Reason != "" {
+			logger.WithField("taskId", qt.Id).Debugf("task is waiting: %s", qt.Message)
 			continue
 		}
 
+		var task models.Tasker
+		if qt.Kind == services.QueueTaskKindScan {
+			t, er := services.GetScanTaskById(m.db, qt.Id)
+			if er != nil {
+				logger.WithField("taskId", qt.Id).Errorf("get task error: %v", er)
+				continue
+			}
+			task = t
+		} else {
+			t, er := services.GetTaskById(m.db, qt.Id)
+			if er != nil {
+				logger.WithField("taskId", qt.Id).Errorf("get task error: %v", er)
+				continue
+			}
+			// 按标签选择 runner 的任务使用调度时选中的 runner，己执行过步骤的任务不切换 runner
+			if len(t.RunnerTags) > 0 && t.CurrStep == 0 && t.RunnerId != qt.RunnerId {
+				if er := services.ChangeTaskRunner(m.db, t, qt.RunnerId); er != nil {
+					logger.WithField("taskId", qt.Id).Errorf("change task runner error: %v", er)
+					continue
+				}
+			}
+			task = t
+		}
+
 		if err := m.runTask(ctx, task); err != nil {
 			if err == errHasRunningTask {
 				continue
@@ -327,11 +293,14 @@ func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 		}
 	}
 
+	m.startedTasks.Store(task.GetId(), newQueueTask(task))
 	m.wg.Add(1)
 	go func() {
 		defer func() {
+			m.startedTasks.Delete(task.GetId())
 			if t, ok := task.(*models.Task); ok {
 				m.envRunningTask.Delete(t.EnvId)
+				m.cancellingTasks.Delete(t.Id)
 			}
 			m.wg.Done()
 		}()
@@ -351,6 +320,57 @@ func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 	return nil
 }
 
+// failoverRunner 按标签选择 runner 的任务在 runner 健康检查失败时切换到其他匹配标签的健康 runner，
+// 返回是否切换成功
+func (m *TaskManager) failoverRunner(task *models.Task) bool {
+	if len(task.RunnerTags) == 0 {
+		return false
+	}
+	logger := m.logger.WithField("taskId", task.Id)
+
+	runners, err := services.ListRunners()
+	if err != nil {
+		logger.Errorf("list runners error: %v", err)
+		return false
+	}
+	for _, r := range runners {
+		if r.Id == task.RunnerId && r.Healthy {
+			return false
+		}
+	}
+
+	load := make(map[string]int)
+	for _, t := range m.getStartedTasks() {
+		load[t.RunnerId]++
+	}
+	r, _ := services.SelectRunner(runners, task.RunnerTags, load, services.GetRunnerMax(), task.RunnerId)
+	if r == nil {
+		logger.Warnf("runner '%s' is unhealthy, no other runner available", task.RunnerId)
+		return false
+	}
+
+	logger.Infof("runner '%s' is unhealthy, failover to runner '%s'", task.RunnerId, r.Id)
+	if err := services.ChangeTaskRunner(m.db, task, r.Id); err != nil {
+		logger.Errorf("change task runner error: %v", err)
+		return false
+	}
+	m.startedTasks.Store(task.Id, newQueueTask(task))
+	return true
+}
+
+func newQueueTask(task models.Tasker) *services.QueueTask {
+	switch t := task.(type) {
+	case *models.Task:
+		return &services.QueueTask{Id: t.Id, Kind: services.QueueTaskKindDeploy, OrgId: t.OrgId,
+			ProjectId: t.ProjectId, EnvId: t.EnvId, RunnerId: t.RunnerId, Priority: t.Priority,
+			CurrStep: t.CurrStep}
+	case *models.ScanTask:
+		return &services.QueueTask{Id: t.Id, Kind: services.QueueTaskKindScan, OrgId: t.OrgId,
+			ProjectId: t.ProjectId, EnvId: t.EnvId, RunnerId: t.RunnerId, Priority: t.Priority}
+	}
+	return &services.QueueTask{Id: task.GetId(), RunnerId: task.GetRunnerId()}
+}
+
 // doRunTask, startErr 只在任务启动出错时(执行步骤前出错)才会返回错误
 func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startErr error) {
 	logger := m.logger.WithField("taskId", task.Id)
@@ -379,6 +399,17 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 		}
 	}
 
+	if task.Type == models.TaskTypeUnlock {
+		// 强制解锁前再次确认环境中没有其他执行中的任务，避免释放正在使用的锁
+		if running, er := services.HasOtherRunningTask(m.db, task.EnvId, task.Id); er != nil {
+			taskStartFailed(errors.Wrap(er, "check running task"))
+			return
+		} else if running {
+			taskStartFailed(errHasRunningTask)
+			return
+		}
+	}
+
 	if task.IsEffectTask() {
 		if _, er := m.db.Model(&models.Env{}).Where("id = ?", task.EnvId).
 			Update(&models.Env{LastTaskId: task.Id}); er != nil {
@@ -410,6 +441,8 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 			break
 		}
 
+		// 首个步骤可能切换了 runner，后续步骤在新的 runner 上执行
+		runTaskReq.RunnerId = task.RunnerId
 		runErr := m.runTaskStep(ctx, *runTaskReq, task, step)
 
 		if err = m.processStepDone(task, step); err != nil {
@@ -418,7 +451,7 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 		}
 
 		if runErr != nil {
-			if step.Type == common.TaskStepTfScan && !task.StopOnViolation {
+			if step.Type == common.TaskStepTfScan && !task.StopOnViolation && runErr != ErrTaskCancelled {
 				// 合规任务失败不影响环境部署流程
 				logger.Warnf("run scan task step: %v", runErr)
 				continue
@@ -430,6 +463,7 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 
 	if task.IsEffectTask() && step != nil && !step.IsRejected() {
 		// 执行信息采集步骤
+		runTaskReq.RunnerId = task.RunnerId
 		if err := m.runTaskStep(ctx, *runTaskReq, task, &models.TaskStep{
 			TaskStepBody: models.TaskStepBody{
 				Type: models.TaskStepCollect,
@@ -492,9 +526,86 @@ func (m *TaskManager) processStepDone(task *models.Task, step *models.TaskStep)
 		return err
 	}
 
+	// 保存 plan 得到的资源变更及费用估算，供审批时查看。
+	// 部署任务估算的月费用增加超过限制，或配置了限制但无法估算费用时返回错误，中止任务执行
+	processPlan := func() error {
+		logger := m.logger.WithField("taskId", task.Id)
+		failStep := func(er e.Error) error {
+			if err := services.ChangeTaskStepStatusAndExitCode(
+				dbSess, task, step, models.TaskStepFailed, er.Error(), step.ExitCode); err != nil {
+				logger.Errorf("change task step status: %v", err)
+			}
+			return er
+		}
+
+		var threshold *float64
+		if task.Type == models.TaskTypeApply {
+			t, er := services.GetCostDeltaThreshold(dbSess, task)
+			if er != nil {
+				// 无法确定是否配置了限制，按配置了限制处理
+				return failStep(e.New(e.CostEstimateFailed, fmt.Errorf("get cost delta threshold: %v", er)))
+			}
+			threshold = t
+		}
+		// costFailed 无法估算费用，配置了限制时中止任务，否则不影响任务执行
+		costFailed := func(err error) error {
+			if threshold == nil {
+				logger.Errorf("%v", err)
+				return nil
+			}
+			return failStep(e.New(e.CostEstimateFailed, err))
+		}
+
+		bs, err := readIfExist(task.PlanJsonPath())
+		if err != nil {
+			return costFailed(fmt.Errorf("read plan json: %v", err))
+		} else if len(bs) == 0 {
+			if threshold == nil {
+				return nil
+			}
+			return costFailed(fmt.Errorf("plan json not found"))
+		}
+		tfPlan, err := services.UnmarshalPlanJson(bs)
+		if err != nil {
+			return costFailed(fmt.Errorf("unmarshal plan json: %v", err))
+		}
+
+		proMap := runner.ProviderSensitiveAttrMap{}
+		if ps, err := readIfExist(task.ProviderSchemaJsonPath()); err != nil {
+			logger.Errorf("read provider schema json: %v", err)
+		} else if len(ps) > 0 {
+			if err = json.Unmarshal(ps, &proMap); err != nil {
+				logger.Errorf("unmarshal provider schema json: %v", err)
+			}
+		}
+		// 变更记录保存失败不影响任务执行
+		if er := services.SaveTaskResourceChanges(dbSess, task, tfPlan.ResourceChanges, proMap); er != nil {
+			logger.Errorf("save task resource changes: %v", er)
+		}
+
+		cost, er := services.SaveTaskCost(dbSess, task, tfPlan)
+		if er != nil {
+			return costFailed(fmt.Errorf("save task cost: %v", er))
+		}
+		if cost == nil {
+			if threshold == nil {
+				return nil
+			}
+			return costFailed(fmt.Errorf("no resource prices configured in the organization"))
+		}
+		if er := services.CheckTaskCostDelta(cost, threshold); er != nil {
+			return failStep(er)
+		}
+		return nil
+	}
+
 	switch step.Type {
 	case common.TaskStepTfScan:
 		return processScanResult()
+	case common.TaskStepPlan:
+		if step.Status == models.TaskStepComplete {
+			return processPlan()
+		}
 	}
 	return nil
 }
@@ -550,6 +661,38 @@ func (m *TaskManager) processTaskDone(task *models.Task) {
 		return nil
 	}
 
+	// 保存任务采集到的 state 版本，state 操作任务会先保存操作前备份的 state
+	processStateVersion := func() error {
+		paths := []string{task.TfStatePath()}
+		if task.Type == models.TaskTypeStateOp {
+			paths = []string{task.TfStateBackupPath(), task.TfStatePath()}
+		}
+		for _, path := range paths {
+			bs, err := readIfExist(path)
+			if err != nil {
+				return fmt.Errorf("read state: %v", err)
+			} else if len(bs) == 0 {
+				continue
+			}
+			if _, err := services.CreateStateVersion(dbSess, task, path, bs); err != nil {
+				return errors.Wrap(err, "create state version")
+			}
+		}
+		return nil
+	}
+
+	// 记录 import 任务每个资源的导入结果
+	processImport := func() error {
+		bs, err := readIfExist(task.TfImportResultPath())
+		if err != nil {
+			return fmt.Errorf("read import result: %v", err)
+		}
+		if err = services.SaveTaskImportResult(dbSess, task, bs); err != nil {
+			return fmt.Errorf("save task import result: %v", err)
+		}
+		return nil
+	}
+
 	processPlan := func() error {
 		if bs, err := readIfExist(task.PlanJsonPath()); err != nil {
 			return fmt.Errorf("read plan json: %v", err)
@@ -565,6 +708,38 @@ func (m *TaskManager) processTaskDone(task *models.Task) {
 		return nil
 	}
 
+	// 漂移检测任务记录漂移资源，环境由未漂移变为漂移时发送通知
+	processDrift := func() error {
+		env, err := services.GetEnv(dbSess, task.EnvId)
+		if err != nil {
+			return errors.Wrapf(err, "get env '%s'", task.EnvId)
+		}
+		// 该步骤在任务状态更新之后执行，任务被取消时不修改漂移状态
+		if task.Status == models.TaskCancelled {
+			return nil
+		} else if task.Status != models.TaskComplete {
+			return services.UpdateEnvDriftStatus(dbSess, task, models.EnvDriftStatusFailed)
+		}
+
+		bs, err := readIfExist(task.PlanJsonPath())
+		if err != nil {
+			return fmt.Errorf("read plan json: %v", err)
+		}
+		tfPlan, err := services.UnmarshalPlanJson(bs)
+		if err != nil {
+			return fmt.Errorf("unmarshal plan json: %v", err)
+		}
+		drifts, er := services.SaveEnvDrift(dbSess, task, tfPlan)
+		if er != nil {
+			return errors.Wrap(er, "save env drift")
+		}
+		if len(drifts) > 0 && env.DriftStatus != models.EnvDriftStatusDrifted &&
+			env.LastDriftTaskId == task.Id {
+			services.EnvDriftedSendMessage(task, drifts)
+		}
+		return nil
+	}
+
 	// 设置 auto destroy
 	processAutoDestroy := func() error {
 		env, err := services.GetEnv(dbSess, task.EnvId)
@@ -621,6 +796,14 @@ func (m *TaskManager) processTaskDone(task *models.Task) {
 			if err := processState(); err != nil {
 				logger.Errorf("process task state: %v", err)
 			}
+			if err := processStateVersion(); err != nil {
+				logger.Errorf("process task state version: %v", err)
+			}
+			if task.Type == models.TaskTypeImport {
+				if err := processImport(); err != nil {
+					logger.Errorf("process task import: %v", err)
+				}
+			}
 
 			// 任务执行成功才会进行 changes 统计，失败的话基于 plan 文件进行变更统计是不准确的
 			// (terraform 执行 apply 失败也不会输出资源变更情况)
@@ -635,6 +818,12 @@ func (m *TaskManager) processTaskDone(task *models.Task) {
 			logger.Errorf("update task status error: %v", err)
 		}
 
+		if task.Type == models.TaskTypeDrift {
+			if err := processDrift(); err != nil {
+				logger.Errorf("process task drift: %v", err)
+			}
+		}
+
 		if task.IsEffectTask() {
 			// 注意: 该步骤需要在环境状态被更新之后执行
 			if err := processAutoDestroy(); err != nil {
@@ -677,7 +866,9 @@ func (m *TaskManager) runTaskStep(ctx context.Context, taskReq runner.RunTaskReq
 			}
 
 			logger.Errorf("wait task step approve error: %v", err)
-			if err != ErrTaskStepRejected {
+			if err == ErrTaskCancelled {
+				changeStepStatusAndStepRetryTimes(models.TaskStepCancelled, "", step)
+			} else if err != ErrTaskStepRejected {
 				changeStepStatusAndStepRetryTimes(models.TaskStepFailed, err.Error(), step)
 			}
 			return err
@@ -703,10 +894,26 @@ loop:
 
 		switch step.Status {
 		case models.TaskStepPending, models.TaskApproving:
+			// 信息采集步骤不受任务取消影响，保证被取消任务的资源数据被正确统计
+			if step.Id != "" {
+				if cancelled, er := services.IsTaskCancelRequested(m.db, task.Id); er != nil {
+					logger.Errorf("query task cancel requested error: %v", er)
+				} else if cancelled {
+					changeStepStatusAndStepRetryTimes(models.TaskStepCancelled, "", step)
+					break loop
+				}
+			}
 			// 先将步骤置为 running 状态，然后再发起调用，保证步骤不会重复执行
 			changeStepStatusAndStepRetryTimes(models.TaskStepRunning, "", step)
 			if err, retryAble := StartTaskStep(taskReq, *step); err != nil {
 				logger.Infof("start task step %d(%s)", step.Index, step.Type)
+				// 首个步骤启动失败且 runner 不可用时切换到其他匹配标签的 runner 重新执行，不计入重试次数
+				if retryAble && step.Index == 0 && m.failoverRunner(task) {
+					taskReq.RunnerId = task.RunnerId
+					message := fmt.Sprintf("Runner unavailable, re-dispatch task step to runner %s", task.RunnerId)
+					changeStepStatusAndStepRetryTimes(models.TaskStepPending, message, step)
+					continue
+				}
 				// 如果是可重试错误，并且任务设定可以重试, 则运行重试逻辑
 				if retryAble && task.RetryAble {
 					if step.RetryNumber > 0 && step.CurrentRetryCount < step.RetryNumber {
@@ -725,6 +932,12 @@ loop:
 			stepResult, err := WaitTaskStep(ctx, m.db, task, step)
 			if err != nil {
 				logger.Errorf("wait task result error: %v", err)
+				if ctx.Err() == nil && step.Index == 0 && m.failoverRunner(task) {
+					taskReq.RunnerId = task.RunnerId
+					message := fmt.Sprintf("Runner unavailable, re-dispatch task step to runner %s", task.RunnerId)
+					changeStepStatusAndStepRetryTimes(models.TaskStepPending, message, step)
+					continue
+				}
 				changeStepStatusAndStepRetryTimes(models.TaskStepFailed, err.Error(), step)
 				return err
 			}
@@ -758,11 +971,60 @@ loop:
 		return errors.New("failed")
 	case models.TaskStepTimeout:
 		return errors.New("timeout")
+	case models.TaskStepCancelled:
+		return ErrTaskCancelled
 	default:
 		return fmt.Errorf("unknown step status: %v", step.Status)
 	}
 }
 
+// processTaskCancel 通知 runner 停止己被请求取消的任务的当前步骤
+// (pending 状态的步骤在启动前会检查取消标识，不需要通知 runner)
+func (m *TaskManager) processTaskCancel() {
+	logger := m.logger.WithField("func", "processTaskCancel")
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic: %v", r)
+			logger.Debugf("%s", debug.Stack())
+		}
+	}()
+
+	tasks := make([]*models.Task, 0)
+	if err := m.db.Model(&models.Task{}).
+		Where("status IN (?) AND cancel_requested = ?", []string{models.TaskRunning, models.TaskApproving}, true).
+		Find(&tasks); err != nil {
+		logger.Errorf("find cancel requested tasks error: %v", err)
+		return
+	}
+
+	for _, task := range tasks {
+		if _, loaded := m.cancellingTasks.LoadOrStore(task.Id, true); loaded {
+			continue
+		}
+
+		logger := logger.WithField("taskId", task.Id)
+		step, err := services.GetTaskStep(m.db, task.Id, task.CurrStep)
+		if err != nil {
+			logger.Errorf("get task step(%d) error: %v", task.CurrStep, err)
+			m.cancellingTasks.Delete(task.Id)
+			continue
+		}
+		if step.Status != models.TaskStepRunning {
+			// 步骤未在 runner 执行，由执行任务的协程在步骤启动前处理取消
+			m.cancellingTasks.Delete(task.Id)
+			continue
+		}
+
+		logger.Infof("cancel task step %d(%s)", step.Index, step.Type)
+		if err := CancelTaskStep(task.RunnerId, *step); err != nil {
+			logger.Errorf("cancel task step error: %v", err)
+			// 下次循环重试
+			m.cancellingTasks.Delete(task.Id)
+		}
+	}
+}
+
 func (m *TaskManager) stop() {
 	logger := m.logger
 	logger.Infof("task manager stopping ...")
@@ -801,11 +1063,26 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		}
 	}
 
-	stateStore := runner.StateStore{
-		Backend: "consul",
-		Scheme:  "http",
-		Path:    task.StatePath,
-		Address: "",
+	var backend *models.StateBackend
+	if task.StateBackendId != "" {
+		if backend, err = services.GetStateBackendById(dbSess, task.StateBackendId); err != nil {
+			return nil, errors.Wrapf(err, "get state backend '%s'", task.StateBackendId)
+		}
+	}
+	stateStore, err := services.BuildStateStore(backend, task.EnvId, task.StatePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "build state store")
+	}
+	// backend 认证信息通过加密的环境变量传递，不允许与任务变量冲突，避免使用错误的认证信息访问 state
+	stateEnv, err := services.BuildStateStoreEnv(backend, task.EnvId)
+	if err != nil {
+		return nil, errors.Wrap(err, "build state store env")
+	}
+	for k, v := range stateEnv {
+		if _, ok := runnerEnv.EnvironmentVars[k]; ok {
+			return nil, fmt.Errorf("environment variable '%s' conflicts with the state backend credentials", k)
+		}
+		runnerEnv.EnvironmentVars[k] = v
 	}
 
 	pk := ""
@@ -821,7 +1098,7 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		Env:             runnerEnv,
 		RunnerId:        task.RunnerId,
 		TaskId:          string(task.Id),
-		DockerImage:     "",
+		DockerImage:     task.Image,
 		StateStore:      stateStore,
 		RepoAddress:     task.RepoAddr,
 		RepoRevision:    task.CommitId,
@@ -840,6 +1117,34 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		taskReq.PrivateKey = utils.EncodeSecretVar(pk, true)
 	}
 
+	if taskReq.Resources, err = buildTaskResources(dbSess, task.TplId); err != nil {
+		return nil, errors.Wrapf(err, "get template '%s' resource limits", task.TplId)
+	}
+
+	if task.Type == models.TaskTypeRestore {
+		version, err := services.GetStateVersionById(dbSess, task.Extra.StateVersionId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get state version '%s'", task.Extra.StateVersionId)
+		}
+		if taskReq.StateContent, err = services.GetStateVersionContent(version); err != nil {
+			return nil, errors.Wrapf(err, "read state version '%s'", version.Id)
+		}
+	} else if task.Type == models.TaskTypeUnlock {
+		taskReq.LockId = task.Extra.LockId
+	} else if task.Type == models.TaskTypeImport {
+		for _, item := range task.Extra.Imports {
+			taskReq.Imports = append(taskReq.Imports, runner.TfImport{Address: item.Address, Id: item.Id})
+		}
+	} else if task.Type == models.TaskTypeStateOp {
+		for _, op := range task.Extra.StateOps {
+			taskReq.StateOps = append(taskReq.StateOps, runner.TfStateOp{
+				Op:          op.Op,
+				Address:     op.Address,
+				Destination: op.Destination,
+			})
+		}
+	}
+
 	return taskReq, nil
 }
 
@@ -943,6 +1248,232 @@ func (m *TaskManager) processAutoDestroy() error {
 	return nil
 }
 
+func (m *TaskManager) processEnvSchedule() error {
+	logger := m.logger.WithField("func", "processEnvSchedule")
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic: %v", r)
+			logger.Debugf("%s", debug.Stack())
+		}
+	}()
+
+	dbSess := m.db
+	limit := 64
+	now := time.Now()
+	schedules := make([]*models.EnvSchedule, 0, limit)
+	err := dbSess.Model(&models.EnvSchedule{}).
+		Where("enabled = ?", true).
+		Where("next_run_at <= ?", now).
+		Order("next_run_at").Limit(limit).Find(&schedules)
+	if err != nil {
+		return errors.Wrapf(err, "query env schedules: %v", err)
+	}
+
+	for _, schedule := range schedules {
+		if err := m.runEnvSchedule(schedule, now); err != nil {
+			logger.WithField("scheduleId", schedule.Id).Errorf("run env schedule error: %v", err)
+			break
+		}
+	}
+	return nil
+}
+
+// processDriftCheck 为开启了定期漂移检测的活跃环境创建漂移检测任务
+func (m *TaskManager) processDriftCheck() error {
+	logger := m.logger.WithField("func", "processDriftCheck")
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic: %v", r)
+			logger.Debugf("%s", debug.Stack())
+		}
+	}()
+
+	interval := configs.Get().Portal.DriftCheckInterval.Duration
+	if interval <= 0 {
+		return nil
+	}
+
+	dbSess := m.db
+	limit := 64
+	envs := make([]*models.Env, 0, limit)
+	err := dbSess.Model(&models.Env{}).
+		Where("drift_check = ? AND archived = ? AND deploying = ?", true, false, false).
+		Where("status = ?", models.EnvStatusActive).
+		Where("(drift_checked_at IS NULL OR drift_checked_at <= ?)", time.Now().Add(-interval)).
+		// 排除有任务在执行的环境，否则长时间执行任务的环境会一直排在前面，导致其他环境无法被检测
+		Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s AS t WHERE t.env_id = %s.id AND t.status IN (?))",
+			models.Task{}.TableName(), models.Env{}.TableName()), services.EnvBusyTaskStatus).
+		Order("drift_checked_at").Limit(limit).Find(&envs)
+	if err != nil {
+		return errors.Wrapf(err, "query drift check envs: %v", err)
+	}
+
+	for _, env := range envs {
+		logger := logger.WithField("envId", env.Id)
+		if busy, err := services.IsEnvBusy(dbSess, env.Id); err != nil {
+			return err
+		} else if busy {
+			// 查询之后环境有了新的任务，延后检测
+			continue
+		}
+
+		err := func() error {
+			tx := dbSess.Begin()
+			defer func() {
+				if r := recover(); r != nil {
+					_ = tx.Rollback()
+					panic(r)
+				}
+			}()
+
+			task, err := services.CreateDriftTask(tx, env, consts.SysUserId, consts.TaskSourceDriftCheck)
+			if err != nil {
+				_ = tx.Rollback()
+				if err.Code() == e.TemplateDisabled || err.Code() == e.TemplateNotExists {
+					// 模板不可用时只更新检测时间，避免每次循环都重复尝试
+					now := models.Time(time.Now())
+					_, er := services.UpdateEnv(dbSess, env.Id, models.Attrs{"drift_checked_at": &now})
+					logger.Warnf("create drift task: %v", err)
+					return er
+				}
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+			logger.Infof("created drift task %s", task.Id)
+			return nil
+		}()
+		if err != nil {
+			logger.Errorf("create drift task error: %v", err)
+			break
+		}
+	}
+	return nil
+}
+
+// runEnvSchedule 执行一次定时任务: 创建任务(或跳过)、记录执行结果并计算下次执行时间。
+// 错过的执行时间点(如服务停止期间)不会补偿执行，只会基于当前时间计算下次执行时间
+func (m *TaskManager) runEnvSchedule(schedule *models.EnvSchedule, now time.Time) error {
+	logger := m.logger.WithField("scheduleId", schedule.Id).WithField("envId", schedule.EnvId)
+
+	run := models.EnvScheduleRun{
+		ScheduleId:  schedule.Id,
+		EnvId:       schedule.EnvId,
+		ScheduledAt: *schedule.NextRunAt,
+	}
+	lastRunAt := models.Time(now)
+	attrs := models.Attrs{"last_run_at": &lastRunAt}
+	if nextRunAt, err := services.EnvScheduleNextRunAt(schedule.Cron, schedule.Timezone, now); err != nil {
+		// cron 表达式或时区失效，禁用该定时任务
+		logger.Warnf("compute next run time error: %v, disable it", err)
+		attrs["next_run_at"] = nil
+		attrs["enabled"] = false
+	} else {
+		attrs["next_run_at"] = nextRunAt
+	}
+
+	tx := m.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	task, skipMsg, err := m.createScheduleTask(tx, schedule)
+	if err != nil {
+		_ = tx.Rollback()
+		logger.Errorf("create task error: %v", err)
+		run.Status = models.EnvScheduleRunFailed
+		run.Message = err.Error()
+		// 创建任务失败时在新的事务中保存执行记录
+		tx = m.db.Begin()
+	} else if task == nil {
+		logger.Infof("skip schedule: %s", skipMsg)
+		run.Status = models.EnvScheduleRunSkipped
+		run.Message = skipMsg
+	} else {
+		logger.Infof("created schedule task: %s", task.Id)
+		run.Status = models.EnvScheduleRunCreated
+		run.TaskId = task.Id
+		attrs["last_task_id"] = task.Id
+	}
+
+	if _, err := services.CreateEnvScheduleRun(tx, run); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.Model(&models.EnvSchedule{}).Where("id = ?", schedule.Id).UpdateAttrs(attrs); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// createScheduleTask 创建定时任务的 task，环境不可部署或者有未结束的任务时跳过，返回 task=nil 及跳过原因
+func (m *TaskManager) createScheduleTask(tx *db.Session, schedule *models.EnvSchedule) (
+	task *models.Task, skipMsg string, err error) {
+	env, err := services.GetEnv(tx, schedule.EnvId)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, "environment not exists", nil
+		}
+		return nil, "", err
+	}
+	if env.Archived {
+		return nil, "environment archived", nil
+	}
+	if busy, err := services.IsEnvBusy(tx, env.Id); err != nil {
+		return nil, "", err
+	} else if busy {
+		return nil, "environment has unfinished task", nil
+	}
+
+	tpl, er := services.GetTemplateById(tx, env.TplId)
+	if er != nil {
+		return nil, "", er
+	}
+	if tpl.Status == models.Disable {
+		return nil, "template disabled", nil
+	}
+
+	vars, er, _ := services.GetValidVariables(tx, consts.ScopeEnv, env.OrgId, env.ProjectId, env.TplId, env.Id, true)
+	if er != nil {
+		return nil, "", er
+	}
+	taskVars := services.MergeTaskVariables(services.GetVariableBody(vars), schedule.Variables)
+
+	task, er = services.CreateTask(tx, tpl, env, models.Task{
+		Name:            models.Task{}.GetTaskNameByType(schedule.TaskType),
+		Targets:         nil,
+		CreatorId:       schedule.CreatorId,
+		KeyId:           env.KeyId,
+		Variables:       taskVars,
+		AutoApprove:     env.AutoApproval,
+		Revision:        env.Revision,
+		StopOnViolation: env.StopOnViolation,
+		Extra:           models.TaskExtra{Source: consts.TaskSourceSchedule},
+		BaseTask: models.BaseTask{
+			Type:        schedule.TaskType,
+			Flow:        models.TaskFlow{},
+			StepTimeout: env.Timeout,
+			RunnerId:    env.RunnerId,
+		},
+	})
+	if er != nil {
+		return nil, "", er
+	}
+	return task, "", nil
+}
+
 // ===================================================================================
 // 扫描任务逻辑
 //
@@ -1090,6 +1621,22 @@ func (m *TaskManager) processScanTaskDone(task *models.ScanTask) {
 	}
 }
 
+// buildTaskResources 获取模板设置的任务容器资源限制，未设置时返回 nil
+func buildTaskResources(dbSess *db.Session, tplId models.Id) (*runner.ResourceLimits, error) {
+	tpl, err := services.GetTemplateById(dbSess.Unscoped(), tplId)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.ContainerCpus <= 0 && tpl.ContainerMemory <= 0 && tpl.ContainerPids <= 0 {
+		return nil, nil
+	}
+	return &runner.ResourceLimits{
+		Cpus:   tpl.ContainerCpus,
+		Memory: tpl.ContainerMemory,
+		Pids:   tpl.ContainerPids,
+	}, nil
+}
+
 // buildScanTaskReq 构建扫描任务 RunTaskReq 对象
 func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.TaskStep) (taskReq *runner.RunTaskReq, err error) {
 	taskReq = &runner.RunTaskReq{
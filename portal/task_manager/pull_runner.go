@@ -0,0 +1,87 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package task_manager
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"cloudiac/runner"
+	"cloudiac/utils/logs"
+	"context"
+	"fmt"
+	"time"
+)
+
+// startPullTaskStep 为拉取模式 runner 创建 job，由 runner 拉取后执行
+func startPullTaskStep(pullRunner *models.PullRunner, taskReq runner.RunTaskReq, step models.TaskStep) (
+	err error, reTryAble bool) {
+	if !services.IsPullRunnerOnline(pullRunner) {
+		return fmt.Errorf("runner '%s' is offline", pullRunner.RunnerId), true
+	}
+	if _, er := services.CreateRunnerJob(db.Get(), taskReq, &step); er != nil {
+		return er, true
+	}
+	return nil, false
+}
+
+// pullRunnerTaskStepStatus 轮询拉取模式 runner 上报的步骤状态，直到步骤结束(或 ctx cancel)。
+// runner 离线时返回错误，由调用方重试或将任务切换到其他 runner
+func pullRunnerTaskStepStatus(ctx context.Context, task models.Tasker, step *models.TaskStep, deadline time.Time) (
+	*waitStepResult, error) {
+	logger := logs.Get().WithField("action", "PullRunnerTaskState").WithField("taskId", task.GetId())
+
+	now := time.Now()
+	var timeout *time.Timer
+	if deadline.Before(now) {
+		// 即使任务己超时也保证进行一次状态获取
+		timeout = time.NewTimer(time.Second)
+	} else {
+		timeout = time.NewTimer(deadline.Sub(now))
+	}
+	defer timeout.Stop()
+
+	ticker := time.NewTicker(consts.DbTaskPollInterval)
+	defer ticker.Stop()
+
+	logger.Infof("pulling step %s status from runner job ...", step.Name)
+	stepResult := &waitStepResult{}
+	for {
+		job, err := services.GetRunnerJob(db.Get(), step.TaskId, step.Index)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status == models.RunnerJobExited {
+			msg, err := services.GetRunnerJobResult(job)
+			if err != nil {
+				return nil, err
+			}
+			stepResult.Result = *msg
+			if msg.ExitCode == 0 {
+				stepResult.Status = models.TaskComplete
+			} else {
+				stepResult.Status = models.TaskFailed
+			}
+			logger.Infof("pull step %s status done, status=%v code=%d", step.Name, stepResult.Status, msg.ExitCode)
+			return stepResult, nil
+		}
+
+		pullRunner, err := services.GetPullRunner(db.Get(), job.RunnerId)
+		if err != nil {
+			return nil, err
+		} else if pullRunner == nil || !services.IsPullRunnerOnline(pullRunner) {
+			return nil, fmt.Errorf("runner '%s' is offline", job.RunnerId)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Infof("context done with: %v", ctx.Err())
+			return stepResult, nil
+		case <-timeout.C:
+			stepResult.Status = models.TaskStepTimeout
+			return stepResult, nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package task_manager
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/services"
+	"runtime/debug"
+	"time"
+)
+
+// processDataPurge 按日志保存周期定期清理过期的任务日志及执行结果
+func (m *TaskManager) processDataPurge() error {
+	logger := m.logger.WithField("func", "processDataPurge")
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic: %v", r)
+			logger.Debugf("%s", debug.Stack())
+		}
+	}()
+
+	now := time.Now()
+	if now.Sub(m.lastDataPurgeAt) < consts.DataPurgeInterval {
+		return nil
+	}
+	m.lastDataPurgeAt = now
+
+	report, err := services.PurgeExpiredData(m.db, now, false)
+	if err != nil {
+		return err
+	}
+	if report.Storages > 0 || report.RunnerJobs > 0 {
+		logger.Infof("purged %d storages(%d bytes) of %d tasks, %d runner jobs, cutoff: %v",
+			report.Storages, report.StorageSize, report.Tasks, report.RunnerJobs, report.Cutoff)
+	}
+	return nil
+}
+
+// processWorkspaceKeepReport 定期向 runner 上报需要保留工作目录的任务(等待审批、可以恢复执行的任务等)。
+// 拉取模式 runner 无法主动访问，由 runner 清理工作目录前从 portal 获取
+func (m *TaskManager) processWorkspaceKeepReport() {
+	now := time.Now()
+	if now.Sub(m.lastWorkspaceKeepAt) < consts.WorkspaceKeepReportInterval {
+		return
+	}
+	m.lastWorkspaceKeepAt = now
+
+	logger := m.logger.WithField("func", "processWorkspaceKeepReport")
+	// 请求 runner 可能较慢，不阻塞任务调度
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Errorf("panic: %v", r)
+				logger.Debugf("%s", debug.Stack())
+			}
+		}()
+
+		runners, err := services.ListRunners()
+		if err != nil {
+			logger.Errorf("list runners error: %v", err)
+			return
+		}
+		for _, r := range runners {
+			if !r.Healthy {
+				continue
+			}
+			if pullRunner, er := services.GetPullRunner(m.db, r.Id); er != nil {
+				logger.Errorf("get pull runner error: %v", er)
+				continue
+			} else if pullRunner != nil {
+				continue
+			}
+			if err := services.ReportRunnerKeepTasks(m.db, r.Id); err != nil {
+				logger.WithField("runnerId", r.Id).Warnf("report keep tasks error: %v", err)
+			}
+		}
+	}()
+}
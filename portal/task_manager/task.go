@@ -7,7 +7,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"time"
 
@@ -32,8 +31,15 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (err error,
 		WithField("taskId", taskReq.TaskId).
 		WithField("step", step.Index)
 
-	header := &http.Header{}
-	header.Set("Content-Type", "application/json")
+	taskReq.Step = step.Index
+	taskReq.StepType = step.Type
+	taskReq.StepArgs = step.Args
+
+	if pullRunner, er := services.GetPullRunner(db.Get(), taskReq.RunnerId); er != nil {
+		return er, true
+	} else if pullRunner != nil {
+		return startPullTaskStep(pullRunner, taskReq, step)
+	}
 
 	var runnerAddr string
 	runnerAddr, err = services.GetRunnerAddress(taskReq.RunnerId)
@@ -44,12 +50,9 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (err error,
 	requestUrl := utils.JoinURL(runnerAddr, consts.RunnerRunTaskURL)
 	logger.Debugf("request runner: %s", requestUrl)
 
-	taskReq.Step = step.Index
-	taskReq.StepType = step.Type
-	taskReq.StepArgs = step.Args
-
-	respData, err := utils.HttpService(requestUrl, "POST", header, taskReq,
-		int(consts.RunnerConnectTimeout.Seconds()), int(consts.RunnerConnectTimeout.Seconds()))
+	// runner 在启动步骤前会拉取本地不存在的镜像，所以使用较长的超时时间，避免镜像拉取中请求超时导致重复启动
+	respData, err := services.RunnerRequest(taskReq.RunnerId, runnerAddr, consts.RunnerRunTaskURL, taskReq,
+		consts.RunnerRunTaskTimeout)
 	if err != nil {
 		return err, true
 	}
@@ -66,6 +69,50 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (err error,
 	return nil, false
 }
 
+// CancelTaskStep 通知 runner 停止正在执行的任务步骤
+func CancelTaskStep(runnerId string, step models.TaskStep) error {
+	logger := logs.Get().
+		WithField("action", "CancelTaskStep").
+		WithField("taskId", step.TaskId).
+		WithField("step", step.Index)
+
+	if pullRunner, er := services.GetPullRunner(db.Get(), runnerId); er != nil {
+		return er
+	} else if pullRunner != nil {
+		return services.RequestCancelRunnerJob(db.Get(), step.TaskId, step.Index)
+	}
+
+	runnerAddr, err := services.GetRunnerAddress(runnerId)
+	if err != nil {
+		return errors.Wrapf(err, "get runner '%s' address", runnerId)
+	}
+
+	requestUrl := utils.JoinURL(runnerAddr, consts.RunnerTaskCancelURL)
+	logger.Debugf("request runner: %s", requestUrl)
+
+	req := runner.TaskCancelReq{
+		EnvId:  string(step.EnvId),
+		TaskId: string(step.TaskId),
+		Step:   step.Index,
+	}
+	respData, err := services.RunnerRequest(runnerId, runnerAddr, consts.RunnerTaskCancelURL, req,
+		consts.RunnerConnectTimeout)
+	if err != nil {
+		return err
+	}
+
+	resp := runner.Response{}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return fmt.Errorf("unexpected response: %s", respData)
+	}
+	logger.Debugf("runner response: %s", respData)
+
+	if resp.Error != "" {
+		return fmt.Errorf(resp.Error)
+	}
+	return nil
+}
+
 type waitStepResult struct {
 	Status string
 	Result runner.TaskStatusMessage
@@ -107,11 +154,23 @@ func WaitTaskStep(ctx context.Context, sess *db.Session, task *models.Task, step
 		}
 	}
 	if len(stepResult.Result.LogContent) > 0 {
-		content := stepResult.Result.LogContent
-		content = logstorage.CutLogContent(content)
-		if err := logstorage.Get().Write(step.LogPath, content); err != nil {
+		// plan、apply 步骤的 terraform 事件保存到单独的文件中，日志中替换为可读的文本。
+		// 拆分后再替换敏感信息，事件中的敏感值为 json 转义形式，替换为可读文本后为原始值
+		content, events := services.SplitTfEventLog(stepResult.Result.LogContent)
+		masker, err := services.GetTaskLogMasker(sess, task)
+		if err != nil {
+			logger.Errorf("mask task log error: %v", err)
+			content = utils.TaskLogMsgBytes("Failed to mask secrets in task log: %v", err)
+			events = nil
+		}
+		content, events = masker.Mask(content), masker.Mask(events)
+		if err := logstorage.WriteLog(step.LogPath, content); err != nil {
 			logger.WithField("path", step.LogPath).Errorf("write task log error: %v", err)
-			logger.Infof("task log content: %s", content)
+		}
+		if len(events) > 0 {
+			if err := logstorage.WriteLog(step.EventsPath(), events); err != nil {
+				logger.WithField("path", step.EventsPath()).Errorf("write task events error: %v", err)
+			}
 		}
 	}
 	if len(stepResult.Result.TfStateJson) > 0 {
@@ -120,6 +179,24 @@ func WaitTaskStep(ctx context.Context, sess *db.Session, task *models.Task, step
 			logger.WithField("path", path).Errorf("write task state json error: %v", err)
 		}
 	}
+	if len(stepResult.Result.TfState) > 0 {
+		path := task.TfStatePath()
+		if err := logstorage.Get().Write(path, stepResult.Result.TfState); err != nil {
+			logger.WithField("path", path).Errorf("write task state error: %v", err)
+		}
+	}
+	if len(stepResult.Result.TfStateBackup) > 0 {
+		path := task.TfStateBackupPath()
+		if err := logstorage.Get().Write(path, stepResult.Result.TfStateBackup); err != nil {
+			logger.WithField("path", path).Errorf("write task state backup error: %v", err)
+		}
+	}
+	if len(stepResult.Result.TfImportJson) > 0 {
+		path := task.TfImportResultPath()
+		if err := logstorage.Get().Write(path, stepResult.Result.TfImportJson); err != nil {
+			logger.WithField("path", path).Errorf("write task import result error: %v", err)
+		}
+	}
 	if len(stepResult.Result.TFProviderSchemaJson) > 0 {
 		path := task.ProviderSchemaJsonPath()
 		if err := logstorage.Get().Write(path, stepResult.Result.TFProviderSchemaJson); err != nil {
@@ -144,19 +221,41 @@ func WaitTaskStep(ctx context.Context, sess *db.Session, task *models.Task, step
 			logger.WithField("path", path).Errorf("write task scan result json error: %v", err)
 		}
 	}
+	if stepResult.Status == models.TaskStepFailed && step.Id != "" {
+		// 任务被取消时 runner 会停止步骤容器，步骤以失败状态退出，这里将其修正为 cancelled
+		if cancelled, er := services.IsTaskCancelRequested(sess, task.Id); er != nil {
+			logger.Errorf("query task cancel requested error: %v", er)
+		} else if cancelled {
+			stepResult.Status = models.TaskStepCancelled
+		}
+	}
 	if er := services.ChangeTaskStepStatusAndExitCode(
-		sess, task, step, stepResult.Status, "", stepResult.Result.ExitCode); er != nil {
+		sess, task, step, stepResult.Status, stepExitMessage(stepResult), stepResult.Result.ExitCode); er != nil {
 		return stepResult, er
 	}
 	return stepResult, err
 }
 
+// stepExitMessage 步骤异常退出的提示信息
+func stepExitMessage(stepResult *waitStepResult) string {
+	if stepResult.Status == models.TaskStepFailed && stepResult.Result.OOMKilled {
+		return "Step killed: out of memory, the container memory limit was exceeded"
+	}
+	return ""
+}
+
 // pullTaskStepStatus 获取任务最新状态，直到任务结束(或 ctx cancel)
 // 该函数允许重复调用，即使任务己结束 (runner 会在本地保存近期(约7天)任务执行信息)，如果任务结束则写入全量日志到存储
 func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.TaskStep, deadline time.Time) (
 	stepResult *waitStepResult, err error) {
 	logger := logs.Get().WithField("action", "PullTaskState").WithField("taskId", task.GetId())
 
+	if pullRunner, er := services.GetPullRunner(db.Get(), task.GetRunnerId()); er != nil {
+		return nil, er
+	} else if pullRunner != nil {
+		return pullRunnerTaskStepStatus(ctx, task, step, deadline)
+	}
+
 	runnerAddr, err := services.GetRunnerAddress(task.GetRunnerId())
 	if err != nil {
 		return nil, errors.Wrapf(err, "get runner address")
@@ -166,7 +265,7 @@ func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.Ta
 	params.Add("envId", string(step.EnvId))
 	params.Add("taskId", string(step.TaskId))
 	params.Add("step", fmt.Sprintf("%d", step.Index))
-	wsConn, resp, err := utils.WebsocketDail(runnerAddr, consts.RunnerTaskStateURL, params)
+	wsConn, resp, err := services.RunnerWebsocketDail(task.GetRunnerId(), runnerAddr, consts.RunnerTaskStateURL, params)
 	if err != nil {
 		logger.Errorf("connect error: %v", err)
 		if resp != nil && resp.StatusCode >= 300 {
@@ -275,6 +374,7 @@ func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.Ta
 
 var (
 	ErrTaskStepRejected = fmt.Errorf("rejected")
+	ErrTaskCancelled    = fmt.Errorf("cancelled")
 )
 
 // WaitTaskStepApprove
@@ -295,6 +395,12 @@ func WaitTaskStepApprove(ctx context.Context, dbSess *db.Session, taskId models.
 				return nil, err
 			}
 
+			if cancelled, err := services.IsTaskCancelRequested(dbSess, taskId); err != nil {
+				return nil, err
+			} else if cancelled {
+				return nil, ErrTaskCancelled
+			}
+
 			if taskStep.Status == models.TaskStepRejected {
 				return nil, ErrTaskStepRejected
 			} else if taskStep.IsApproved() {
@@ -345,11 +451,13 @@ func WaitScanTaskStep(ctx context.Context, sess *db.Session, task *models.ScanTa
 	}
 
 	if len(stepResult.Result.LogContent) > 0 {
-		content := stepResult.Result.LogContent
-		content = logstorage.CutLogContent(content)
-		if err := logstorage.Get().Write(step.LogPath, content); err != nil {
+		content, err := services.MaskTaskLog(sess, task, stepResult.Result.LogContent)
+		if err != nil {
+			logger.Errorf("mask task log error: %v", err)
+			content = utils.TaskLogMsgBytes("Failed to mask secrets in task log: %v", err)
+		}
+		if err := logstorage.WriteLog(step.LogPath, content); err != nil {
 			logger.WithField("path", step.LogPath).Errorf("write task log error: %v", err)
-			logger.Infof("task log content: %s", content)
 		}
 	}
 	if len(stepResult.Result.TfScanJson) > 0 {
@@ -366,7 +474,7 @@ func WaitScanTaskStep(ctx context.Context, sess *db.Session, task *models.ScanTa
 	}
 
 	if er := services.ChangeTaskStepStatusAndExitCode(
-		sess, task, step, stepResult.Status, "", stepResult.Result.ExitCode); er != nil {
+		sess, task, step, stepResult.Status, stepExitMessage(stepResult), stepResult.Result.ExitCode); er != nil {
 		return stepResult, er
 	}
 	return stepResult, err
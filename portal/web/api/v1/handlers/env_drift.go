@@ -0,0 +1,49 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// Drift 环境漂移检测结果
+// @Tags 环境
+// @Summary 环境漂移检测结果
+// @Description 返回环境最近一次漂移检测的状态及发生漂移的资源和属性
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/drift [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.EnvDriftResp}
+func (Env) Drift(c *ctx.GinRequest) {
+	form := &forms.EnvDriftForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvDrift(c.Service(), form))
+}
+
+// CheckDrift 发起环境漂移检测
+// @Tags 环境
+// @Summary 发起环境漂移检测
+// @Description 创建漂移检测任务，任务执行 plan 对比实际资源与 state 的差异，不会修改资源
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/drift [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Env) CheckDrift(c *ctx.GinRequest) {
+	form := &forms.EnvDriftForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CheckEnvDrift(c.Service(), form))
+}
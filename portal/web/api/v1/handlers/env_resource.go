@@ -0,0 +1,51 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// ResourceDiff 对比环境资源
+// @Tags 环境
+// @Summary 对比环境两次任务统计的资源
+// @Description 返回新增、删除及修改的资源，修改的资源包含属性级别的差异，敏感属性值会被隐藏。
+// @Description 未指定任务时对比开始时间及结束时间时的资源列表
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.EnvResourceDiffForm true "parameter"
+// @router /envs/{envId}/resources/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=services.TaskResourceDiff}
+func (Env) ResourceDiff(c *ctx.GinRequest) {
+	form := &forms.EnvResourceDiffForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvResourceDiff(c.Service(), form))
+}
+
+// ResourceTimeline 资源变更记录
+// @Tags 环境
+// @Summary 资源在各次部署任务中的创建、修改及销毁记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.EnvResourceTimelineForm true "parameter"
+// @router /envs/{envId}/resources/timeline [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.ResourceEvent}
+func (Env) ResourceTimeline(c *ctx.GinRequest) {
+	form := &forms.EnvResourceTimelineForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvResourceTimeline(c.Service(), form))
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchSchedules 环境定时任务列表
+// @Tags 环境
+// @Summary 环境定时任务列表
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvScheduleForm true "parameter"
+// @router /envs/{envId}/schedules [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvSchedule}}
+func (Env) SearchSchedules(c *ctx.GinRequest) {
+	form := &forms.SearchEnvScheduleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvSchedule(c.Service(), form))
+}
+
+// CreateSchedule 创建环境定时任务
+// @Tags 环境
+// @Summary 创建环境定时任务
+// @Description 按 cron 表达式定期为环境创建 plan/apply/destroy 任务，环境有未结束的任务时跳过本次执行
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form formData forms.CreateEnvScheduleForm true "parameter"
+// @router /envs/{envId}/schedules [post]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvSchedule}
+func (Env) CreateSchedule(c *ctx.GinRequest) {
+	form := &forms.CreateEnvScheduleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateEnvSchedule(c.Service(), form))
+}
+
+// DetailSchedule 环境定时任务详情
+// @Tags 环境
+// @Summary 环境定时任务详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param scheduleId path string true "定时任务ID"
+// @router /envs/{envId}/schedules/{scheduleId} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvSchedule}
+func (Env) DetailSchedule(c *ctx.GinRequest) {
+	form := &forms.DetailEnvScheduleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DetailEnvSchedule(c.Service(), form))
+}
+
+// UpdateSchedule 修改环境定时任务
+// @Tags 环境
+// @Summary 修改环境定时任务
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param scheduleId path string true "定时任务ID"
+// @Param form formData forms.UpdateEnvScheduleForm true "parameter"
+// @router /envs/{envId}/schedules/{scheduleId} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvSchedule}
+func (Env) UpdateSchedule(c *ctx.GinRequest) {
+	form := &forms.UpdateEnvScheduleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateEnvSchedule(c.Service(), form))
+}
+
+// DeleteSchedule 删除环境定时任务
+// @Tags 环境
+// @Summary 删除环境定时任务
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param scheduleId path string true "定时任务ID"
+// @router /envs/{envId}/schedules/{scheduleId} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Env) DeleteSchedule(c *ctx.GinRequest) {
+	form := &forms.DeleteEnvScheduleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteEnvSchedule(c.Service(), form))
+}
+
+// SearchScheduleRuns 环境定时任务执行记录
+// @Tags 环境
+// @Summary 环境定时任务执行记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param scheduleId path string true "定时任务ID"
+// @Param form query forms.SearchEnvScheduleRunForm true "parameter"
+// @router /envs/{envId}/schedules/{scheduleId}/runs [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvScheduleRun}}
+func (Env) SearchScheduleRuns(c *ctx.GinRequest) {
+	form := &forms.SearchEnvScheduleRunForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvScheduleRun(c.Service(), form))
+}
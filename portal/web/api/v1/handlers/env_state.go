@@ -0,0 +1,118 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"fmt"
+	"net/http"
+)
+
+// SearchStates 环境 state 版本列表
+// @Tags 环境
+// @Summary 环境 state 版本列表
+// @Description 每次部署类任务执行结束后会保存一份 state 版本
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvStateForm true "parameter"
+// @router /envs/{envId}/states [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]apps.StateVersionResp}}
+func (Env) SearchStates(c *ctx.GinRequest) {
+	form := &forms.SearchEnvStateForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvState(c.Service(), form))
+}
+
+// DownloadState 下载环境 state 版本
+// @Tags 环境
+// @Summary 下载环境 state 版本
+// @Produce application/octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param versionId path string true "state 版本ID"
+// @router /envs/{envId}/states/{versionId}/download [get]
+// @Success 200 {string} string "state 文件内容"
+func (Env) DownloadState(c *ctx.GinRequest) {
+	form := &forms.EnvStateVersionForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	version, content, err := apps.EnvStateContent(c.Service(), form)
+	if err != nil {
+		c.JSONError(err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%d.tfstate\"", version.EnvId, version.Serial))
+	c.Data(http.StatusOK, "application/octet-stream", content)
+}
+
+// RestoreState 恢复环境 state 版本
+// @Tags 环境
+// @Summary 恢复环境 state 版本
+// @Description 创建 restore 任务将指定版本的 state 写入环境的 state backend，需要审批者权限
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param versionId path string true "state 版本ID"
+// @router /envs/{envId}/states/{versionId}/restore [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Env) RestoreState(c *ctx.GinRequest) {
+	form := &forms.EnvStateVersionForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RestoreEnvState(c.Service(), form))
+}
+
+// StateLock 查询环境 state 锁
+// @Tags 环境
+// @Summary 查询环境 state 锁
+// @Description 返回锁的持有者、加锁时间及加锁时环境正在执行的任务，目前支持 consul 及 portal 内置 http backend
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/state_lock [get]
+// @Success 200 {object} ctx.JSONResult{result=services.StateLockInfo}
+func (Env) StateLock(c *ctx.GinRequest) {
+	form := &forms.EnvStateLockForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvStateLock(c.Service(), form))
+}
+
+// UnlockState 强制释放环境 state 锁
+// @Tags 环境
+// @Summary 强制释放环境 state 锁
+// @Description 创建 unlock 任务执行 terraform force-unlock，环境有执行中的任务时不允许解锁
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param data body forms.EnvStateUnlockForm true "parameter"
+// @router /envs/{envId}/state_lock/unlock [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Env) UnlockState(c *ctx.GinRequest) {
+	form := &forms.EnvStateUnlockForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UnlockEnvState(c.Service(), form))
+}
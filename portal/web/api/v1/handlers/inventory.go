@@ -0,0 +1,69 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type Inventory struct {
+	ctrl.GinController
+}
+
+// Search 查询资源清单
+// @Summary 查询资源清单
+// @Description 查询组织下各环境最后一次部署的资源，支持按 provider、资源类型、模块、环境及属性过滤，敏感属性值会被隐藏。
+// @Description 指定 export=true 时以 csv 格式导出全部资源
+// @Tags 资源清单
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Produce text/csv
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.SearchInventoryForm true "parameter"
+// @Router /inventory/resources [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]services.InventoryResource}}
+func (Inventory) Search(c *ctx.GinRequest) {
+	form := &forms.SearchInventoryForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	if !form.Export() {
+		c.JSONResult(apps.SearchInventory(c.Service(), form))
+		return
+	}
+
+	filter, err := apps.GetInventoryFilter(c.Service(), &form.InventoryFilterForm)
+	if err != nil {
+		c.JSONError(err)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=\"inventory.csv\"")
+	// 开始输出后无法再返回错误信息，导出失败只记录日志
+	_ = apps.ExportInventory(c.Service(), filter, c.Writer)
+}
+
+// Stats 资源清单统计
+// @Summary 资源清单统计
+// @Description 按资源类型及 provider 统计资源清单中的资源数量，支持的过滤条件与资源清单查询相同
+// @Tags 资源清单
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.InventoryStatsForm true "parameter"
+// @Router /inventory/stats [get]
+// @Success 200 {object} ctx.JSONResult{result=services.InventoryStats}
+func (Inventory) Stats(c *ctx.GinRequest) {
+	form := &forms.InventoryStatsForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.InventoryStats(c.Service(), form))
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type ResourcePrice struct {
+	ctrl.GinController
+}
+
+// Create 创建价格配置
+// @Summary 创建价格配置
+// @Description 组织的价格目录用于估算部署任务 plan 的月费用
+// @Tags 价格目录
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param data body forms.CreateResourcePriceForm true "价格配置"
+// @Router /resource_prices [post]
+// @Success 200 {object} ctx.JSONResult{result=models.ResourcePrice}
+func (ResourcePrice) Create(c *ctx.GinRequest) {
+	form := &forms.CreateResourcePriceForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateResourcePrice(c.Service(), form))
+}
+
+// Search 查询价格配置
+// @Summary 查询价格配置
+// @Tags 价格目录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchResourcePriceForm true "parameter"
+// @Router /resource_prices [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ResourcePrice}}
+func (ResourcePrice) Search(c *ctx.GinRequest) {
+	form := &forms.SearchResourcePriceForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchResourcePrice(c.Service(), form))
+}
+
+// Update 修改价格配置
+// @Summary 修改价格配置
+// @Tags 价格目录
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "价格ID"
+// @Param data body forms.UpdateResourcePriceForm true "价格配置"
+// @Router /resource_prices/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.ResourcePrice}
+func (ResourcePrice) Update(c *ctx.GinRequest) {
+	form := &forms.UpdateResourcePriceForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateResourcePrice(c.Service(), form))
+}
+
+// Delete 删除价格配置
+// @Summary 删除价格配置
+// @Tags 价格目录
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "价格ID"
+// @Router /resource_prices/{id} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (ResourcePrice) Delete(c *ctx.GinRequest) {
+	form := &forms.DeleteResourcePriceForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteResourcePrice(c.Service(), form))
+}
+
+// Detail 价格配置详情
+// @Summary 价格配置详情
+// @Tags 价格目录
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "价格ID"
+// @Router /resource_prices/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.ResourcePrice}
+func (ResourcePrice) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailResourcePriceForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DetailResourcePrice(c.Service(), form))
+}
+
+// Import 导入价格目录
+// @Summary 导入价格目录
+// @Description 支持 csv 和 yaml 格式，csv 首行为列名: resourceType,attribute,value,unit,price,description。
+// @Description 资源类型、属性及属性值相同的价格配置会被更新
+// @Tags 价格目录
+// @Accept multipart/form-data
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param file formData file false "价格目录文件"
+// @Param form formData forms.ImportResourcePriceForm true "parameter"
+// @Router /resource_prices/import [post]
+// @Success 200 {object} ctx.JSONResult{result=apps.ImportResourcePriceResp}
+func (ResourcePrice) Import(c *ctx.GinRequest) {
+	form := &forms.ImportResourcePriceForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ImportResourcePrice(c.Service(), form))
+}
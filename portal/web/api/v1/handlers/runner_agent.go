@@ -0,0 +1,129 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"cloudiac/runner"
+	"net/http"
+	"strings"
+)
+
+// RunnerAgent 拉取模式 runner 访问的接口，使用 runner token 单独认证
+type RunnerAgent struct{}
+
+// runnerAgentAuth 校验请求中的 runner token，返回 runner id
+func runnerAgentAuth(c *ctx.GinRequest) (string, bool) {
+	runnerId := c.GetHeader(runner.PullRunnerIdHeader)
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !apps.CheckRunnerAgentAuth(runnerId, token) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return "", false
+	}
+	c.Service().AddLogField("runnerId", runnerId)
+	return runnerId, true
+}
+
+// Register 拉取模式 runner 注册
+// @Tags runner
+// @Summary 拉取模式 runner 注册
+// @Accept application/json
+// @Produce json
+// @Param X-Runner-Id header string true "runner ID"
+// @Param json body forms.RunnerAgentRegisterForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.PullRunner}
+// @Router /runner_agent/register [post]
+func (RunnerAgent) Register(c *ctx.GinRequest) {
+	runnerId, ok := runnerAgentAuth(c)
+	if !ok {
+		return
+	}
+	form := forms.RunnerAgentRegisterForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RunnerAgentRegister(c.Service(), runnerId, &form))
+}
+
+// Jobs 拉取模式 runner 拉取待执行的任务步骤，没有任务时等待至多 wait 秒
+// @Tags runner
+// @Summary 拉取模式 runner 拉取任务步骤
+// @Accept application/json
+// @Produce json
+// @Param X-Runner-Id header string true "runner ID"
+// @Param form query forms.RunnerAgentJobsForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=runner.PullJobsResp}
+// @Router /runner_agent/jobs [get]
+func (RunnerAgent) Jobs(c *ctx.GinRequest) {
+	runnerId, ok := runnerAgentAuth(c)
+	if !ok {
+		return
+	}
+	form := forms.RunnerAgentJobsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RunnerAgentJobs(c.Request.Context(), c.Service(), runnerId, &form))
+}
+
+// JobStatus 拉取模式 runner 上报任务步骤状态
+// @Tags runner
+// @Summary 拉取模式 runner 上报任务步骤状态
+// @Accept application/json
+// @Produce json
+// @Param X-Runner-Id header string true "runner ID"
+// @Param id path string true "job ID"
+// @Param json body forms.RunnerAgentJobStatusForm true "parameter"
+// @Success 200 {object} ctx.JSONResult
+// @Router /runner_agent/jobs/{id}/status [post]
+func (RunnerAgent) JobStatus(c *ctx.GinRequest) {
+	runnerId, ok := runnerAgentAuth(c)
+	if !ok {
+		return
+	}
+	form := forms.RunnerAgentJobStatusForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RunnerAgentJobStatus(c.Service(), runnerId, &form))
+}
+
+// JobLog 拉取模式 runner 推送任务步骤增量日志
+// @Tags runner
+// @Summary 拉取模式 runner 推送任务步骤日志
+// @Accept application/json
+// @Produce json
+// @Param X-Runner-Id header string true "runner ID"
+// @Param id path string true "job ID"
+// @Param json body forms.RunnerAgentJobLogForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=runner.PullJobLogResp}
+// @Router /runner_agent/jobs/{id}/log [post]
+func (RunnerAgent) JobLog(c *ctx.GinRequest) {
+	runnerId, ok := runnerAgentAuth(c)
+	if !ok {
+		return
+	}
+	form := forms.RunnerAgentJobLogForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RunnerAgentJobLog(c.Service(), runnerId, &form))
+}
+
+// KeepTasks 拉取模式 runner 获取需要保留工作目录的任务
+// @Tags runner
+// @Summary 拉取模式 runner 获取需要保留工作目录的任务
+// @Accept application/json
+// @Produce json
+// @Param X-Runner-Id header string true "runner ID"
+// @Success 200 {object} ctx.JSONResult{result=runner.WorkspaceKeepTasks}
+// @Router /runner_agent/workspaces/keep [get]
+func (RunnerAgent) KeepTasks(c *ctx.GinRequest) {
+	runnerId, ok := runnerAgentAuth(c)
+	if !ok {
+		return
+	}
+	c.JSONResult(apps.RunnerAgentKeepTasks(c.Service(), runnerId))
+}
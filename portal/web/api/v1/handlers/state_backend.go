@@ -0,0 +1,106 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type StateBackend struct {
+	ctrl.GinController
+}
+
+// Create 创建 state backend 配置
+// @Summary 创建 state backend 配置
+// @Description 可以在组织、项目或云模板级别设置，创建环境时按 云模板 > 项目 > 组织 的优先级选择，未设置时使用 consul
+// @Tags state backend
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param data body forms.CreateStateBackendForm true "state backend 配置"
+// @Router /state_backends [post]
+// @Success 200 {object} ctx.JSONResult{result=models.StateBackend}
+func (StateBackend) Create(c *ctx.GinRequest) {
+	form := &forms.CreateStateBackendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateStateBackend(c.Service(), form))
+}
+
+// Search 查询 state backend 配置
+// @Summary 查询 state backend 配置
+// @Tags state backend
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchStateBackendForm true "parameter"
+// @Router /state_backends [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.StateBackend}}
+func (StateBackend) Search(c *ctx.GinRequest) {
+	form := &forms.SearchStateBackendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchStateBackend(c.Service(), form))
+}
+
+// Update 修改 state backend 配置
+// @Summary 修改 state backend 配置
+// @Tags state backend
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "state backend ID"
+// @Param data body forms.UpdateStateBackendForm true "state backend 配置"
+// @Router /state_backends/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.StateBackend}
+func (StateBackend) Update(c *ctx.GinRequest) {
+	form := &forms.UpdateStateBackendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateStateBackend(c.Service(), form))
+}
+
+// Delete 删除 state backend 配置
+// @Summary 删除 state backend 配置
+// @Tags state backend
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "state backend ID"
+// @Router /state_backends/{id} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (StateBackend) Delete(c *ctx.GinRequest) {
+	form := &forms.DeleteStateBackendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteStateBackend(c.Service(), form))
+}
+
+// Detail state backend 配置详情
+// @Summary state backend 配置详情
+// @Tags state backend
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "state backend ID"
+// @Router /state_backends/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.StateBackend}
+func (StateBackend) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailStateBackendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DetailStateBackend(c.Service(), form))
+}
@@ -52,3 +52,16 @@ func (SystemConfig) Update(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.UpdateSystemConfig(c.Service(), &form))
 }
+
+// RetentionReport 过期数据清理报告
+// @Summary 过期数据清理报告
+// @Description 按日志保存周期统计将要清理的任务日志及执行结果，只统计不清理，需要平台管理员权限
+// @Tags 系统配置
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Success 200 {object} ctx.JSONResult{result=services.RetentionReport}
+// @Router /systems/retention [get]
+func (SystemConfig) RetentionReport(c *ctx.GinRequest) {
+	c.JSONResult(apps.DataRetentionReport(c.Service()))
+}
@@ -32,6 +32,26 @@ func (Task) Search(c *ctx.GinRequest) {
 	c.JSONResult(apps.SearchTask(c.Service(), &form))
 }
 
+// Queue 任务队列
+// @Tags 环境
+// @Summary 查询等待执行的任务队列
+// @Description 按调度顺序返回等待执行的任务，以及任务在队列中的位置和等待原因
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.SearchTaskQueueForm true "parameter"
+// @router /task_queue [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.QueueTask}
+func (Task) Queue(c *ctx.GinRequest) {
+	form := forms.SearchTaskQueueForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskQueue(c.Service(), &form))
+}
+
 // Detail 任务信息详情
 // @Tags 环境
 // @Summary 任务信息详情
@@ -75,6 +95,31 @@ func (Task) FollowLogSse(c *ctx.GinRequest) {
 	}
 }
 
+// FollowEventsSse 任务步骤的 terraform 事件流
+// @Tags 环境
+// @Summary 任务步骤的 terraform 事件流
+// @Description terraform 0.15.3 及以上版本执行的 plan、apply 步骤会记录资源开始、完成、出错及变更统计等事件，每条消息为一个事件 json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.TaskLogForm true "parameter"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/events [get]
+// @Success 200 {object} services.TaskStepEvent "事件实时数据流"
+func (Task) FollowEventsSse(c *ctx.GinRequest) {
+	defer c.SSEvent("end", "end")
+
+	form := forms.TaskLogForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	if err := apps.FollowTaskEvents(c, form); err != nil {
+		c.SSEvent("error", err.Error())
+	}
+}
+
 // TaskApprove 审批执行计划
 // @Tags 环境
 // @Summary 审批执行计划
@@ -95,6 +140,69 @@ func (Task) TaskApprove(c *ctx.GinRequest) {
 	c.JSONResult(apps.ApproveTask(c.Service(), form))
 }
 
+// Cancel 取消任务
+// @Tags 环境
+// @Summary 取消任务
+// @Description 取消排队中或执行中的任务，执行中的任务会在当前步骤停止后变为 cancelled 状态
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/cancel [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Task) Cancel(c *ctx.GinRequest) {
+	form := &forms.CancelTaskForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CancelTask(c.Service(), form))
+}
+
+// Resume 恢复执行任务
+// @Tags 环境
+// @Summary 恢复执行失败或被取消的任务
+// @Description 将失败(或被取消)的步骤及之后的步骤重置为 pending 并在原 runner 上重新执行，复用之前的工作目录和 plan 文件。
+// @Description 若指定的步骤包含 plan 步骤则需要重新审批
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param form formData forms.ResumeTaskForm true "parameter"
+// @router /tasks/{taskId}/resume [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Task) Resume(c *ctx.GinRequest) {
+	form := &forms.ResumeTaskForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ResumeTask(c.Service(), form))
+}
+
+// SearchResumes 任务恢复执行记录
+// @Tags 环境
+// @Summary 任务恢复执行记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param form query forms.SearchTaskResumeForm true "parameter"
+// @router /tasks/{taskId}/resumes [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.TaskResume}}
+func (Task) SearchResumes(c *ctx.GinRequest) {
+	form := &forms.SearchTaskResumeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskResume(c.Service(), form))
+}
+
 // Log 任务日志
 // @Tags 环境
 // @Summary 任务日志
@@ -154,3 +262,25 @@ func (Task) Resource(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.SearchTaskResources(c.Service(), &form))
 }
+
+// Changes 获取任务的资源变更
+// @Tags 环境
+// @Summary 获取任务 plan 得到的资源变更
+// @Description 返回每个资源的变更类型及变更的属性，敏感属性的值会被隐藏
+// @Accept multipart/form-data
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchTaskChangesForm true "parameter"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/changes [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ResourceChange}}
+func (Task) Changes(c *ctx.GinRequest) {
+	form := forms.SearchTaskChangesForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskChanges(c.Service(), &form))
+}
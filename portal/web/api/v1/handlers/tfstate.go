@@ -0,0 +1,68 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"net/http"
+)
+
+// TfStateHandler portal 提供的 terraform http state backend，
+// 支持 GET/POST/DELETE/LOCK/UNLOCK 方法，使用 basic auth 认证
+func TfStateHandler(c *ctx.GinRequest) {
+	envId := models.Id(c.Param("id"))
+	username, password, ok := c.Request.BasicAuth()
+	if !ok || !apps.CheckTfStateAuth(envId, username, password) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	body, er := c.GetRawData()
+	if er != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	sc := c.Service()
+	var (
+		content []byte
+		err     e.Error
+	)
+	switch c.Request.Method {
+	case http.MethodGet:
+		content, err = apps.GetTfState(sc, envId)
+		if err == nil && content == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+	case http.MethodPost:
+		err = apps.UpdateTfState(sc, envId, c.Query("ID"), body)
+	case http.MethodDelete:
+		err = apps.DeleteTfState(sc, envId)
+	case "LOCK":
+		content, err = apps.LockTfState(sc, envId, body)
+	case "UNLOCK":
+		err = apps.UnlockTfState(sc, envId, body)
+	default:
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		status := err.Status()
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		if content != nil {
+			// 加锁失败时返回当前锁信息
+			c.Data(status, "application/json", content)
+		} else {
+			c.String(status, err.Error())
+		}
+		return
+	}
+	c.Data(http.StatusOK, "application/json", content)
+}
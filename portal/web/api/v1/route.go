@@ -43,6 +43,18 @@ func Register(g *gin.RouterGroup) {
 	g.POST("/webhooks/:vcsType/:vcsId", w(handlers.WebhooksApiHandler))
 	g.POST("/auth/login", w(handlers.Auth{}.Login))
 
+	// portal 提供的 terraform http state backend，使用 basic auth 单独认证
+	for _, method := range []string{"GET", "POST", "DELETE", "LOCK", "UNLOCK"} {
+		g.Handle(method, "/tfstate/:id", w(handlers.TfStateHandler))
+	}
+
+	// 拉取模式 runner 注册、拉取任务及上报状态，使用 runner token 单独认证
+	g.POST("/runner_agent/register", w(handlers.RunnerAgent{}.Register))
+	g.GET("/runner_agent/jobs", w(handlers.RunnerAgent{}.Jobs))
+	g.POST("/runner_agent/jobs/:id/status", w(handlers.RunnerAgent{}.JobStatus))
+	g.POST("/runner_agent/jobs/:id/log", w(handlers.RunnerAgent{}.JobLog))
+	g.GET("/runner_agent/workspaces/keep", w(handlers.RunnerAgent{}.KeepTasks))
+
 	// Authorization Header 鉴权
 	g.Use(w(middleware.Auth)) // 解析 header token
 
@@ -63,6 +75,7 @@ func Register(g *gin.RouterGroup) {
 	// 系统配置
 	g.PUT("/systems", ac(), w(handlers.SystemConfig{}.Update))
 	g.GET("/systems", ac(), w(handlers.SystemConfig{}.Search))
+	g.GET("/systems/retention", ac(), w(handlers.SystemConfig{}.RetentionReport))
 	// 系统状态
 	g.GET("/systems/status", w(handlers.PortalSystemStatusSearch))
 
@@ -123,6 +136,14 @@ func Register(g *gin.RouterGroup) {
 	ctrl.Register(g.Group("tokens", ac()), &handlers.Token{})
 	//密钥管理
 	ctrl.Register(g.Group("keys", ac()), &handlers.Key{})
+	// state backend 管理
+	ctrl.Register(g.Group("state_backends", ac()), &handlers.StateBackend{})
+	// 价格目录
+	ctrl.Register(g.Group("resource_prices", ac()), &handlers.ResourcePrice{})
+	g.POST("/resource_prices/import", ac(), w(handlers.ResourcePrice{}.Import))
+	// 资源清单
+	g.GET("/inventory/resources", ac(), w(handlers.Inventory{}.Search))
+	g.GET("/inventory/stats", ac(), w(handlers.Inventory{}.Stats))
 
 	ctrl.Register(g.Group("vcs", ac()), &handlers.Vcs{})
 	g.GET("/vcs/:id/repo", ac(), w(handlers.Vcs{}.ListRepos))
@@ -138,8 +159,12 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/vcs/:id/file", ac(), w(handlers.Vcs{}.SearchVcsFileContent))
 	ctrl.Register(g.Group("notifications", ac()), &handlers.Notification{})
 
+	// 任务队列，项目ID 可选
+	g.GET("/task_queue", ac(), w(handlers.Task{}.Queue))
+
 	// 任务实时日志（云模板检测无项目ID）
 	g.GET("/tasks/:id/log/sse", ac(), w(handlers.Task{}.FollowLogSse))
+	g.GET("/tasks/:id/events", ac(), w(handlers.Task{}.FollowEventsSse))
 
 	// 项目资源
 	g.Use(w(middleware.AuthProjectId))
@@ -153,9 +178,24 @@ func Register(g *gin.RouterGroup) {
 	g.POST("/envs/:id/destroy", ac("envs", "destroy"), w(handlers.Env{}.Destroy))
 	g.GET("/envs/:id/resources", ac(), w(handlers.Env{}.SearchResources))
 	g.GET("/envs/:id/output", ac(), w(handlers.Env{}.Output))
+	g.GET("/envs/:id/resources/diff", ac(), w(handlers.Env{}.ResourceDiff))
+	g.GET("/envs/:id/resources/timeline", ac(), w(handlers.Env{}.ResourceTimeline))
 	g.GET("/envs/:id/resources/:resourceId", ac(), w(handlers.Env{}.ResourceDetail))
 	g.GET("/envs/:id/variables", ac(), w(handlers.Env{}.Variables))
 	g.GET("/envs/:id/policy_result", ac(), w(handlers.Env{}.PolicyResult))
+	g.GET("/envs/:id/schedules", ac(), w(handlers.Env{}.SearchSchedules))
+	g.POST("/envs/:id/schedules", ac("envs", "update"), w(handlers.Env{}.CreateSchedule))
+	g.GET("/envs/:id/schedules/:scheduleId", ac(), w(handlers.Env{}.DetailSchedule))
+	g.PUT("/envs/:id/schedules/:scheduleId", ac("envs", "update"), w(handlers.Env{}.UpdateSchedule))
+	g.DELETE("/envs/:id/schedules/:scheduleId", ac("envs", "update"), w(handlers.Env{}.DeleteSchedule))
+	g.GET("/envs/:id/schedules/:scheduleId/runs", ac(), w(handlers.Env{}.SearchScheduleRuns))
+	g.GET("/envs/:id/drift", ac(), w(handlers.Env{}.Drift))
+	g.POST("/envs/:id/drift", ac("envs", "deploy"), w(handlers.Env{}.CheckDrift))
+	g.GET("/envs/:id/states", ac(), w(handlers.Env{}.SearchStates))
+	g.GET("/envs/:id/states/:versionId/download", ac("envs", "deploy"), w(handlers.Env{}.DownloadState))
+	g.POST("/envs/:id/states/:versionId/restore", ac("envs", "restore"), w(handlers.Env{}.RestoreState))
+	g.GET("/envs/:id/state_lock", ac(), w(handlers.Env{}.StateLock))
+	g.POST("/envs/:id/state_lock/unlock", ac("envs", "unlock"), w(handlers.Env{}.UnlockState))
 
 	// 任务管理
 	g.GET("/tasks", ac(), w(handlers.Task{}.Search))
@@ -163,7 +203,11 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/tasks/:id/log", ac(), w(handlers.Task{}.Log))
 	g.GET("/tasks/:id/output", ac(), w(handlers.Task{}.Output))
 	g.GET("/tasks/:id/resources", ac(), w(handlers.Task{}.Resource))
+	g.GET("/tasks/:id/changes", ac(), w(handlers.Task{}.Changes))
 	g.POST("/tasks/:id/approve", ac("tasks", "approve"), w(handlers.Task{}.TaskApprove))
+	g.POST("/tasks/:id/cancel", ac("tasks", "cancel"), w(handlers.Task{}.Cancel))
+	g.POST("/tasks/:id/resume", ac("tasks", "resume"), w(handlers.Task{}.Resume))
+	g.GET("/tasks/:id/resumes", ac(), w(handlers.Task{}.SearchResumes))
 	g.POST("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Create))
 	g.GET("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Search))
 
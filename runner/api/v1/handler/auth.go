@@ -0,0 +1,44 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handler
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"cloudiac/runner/api/ctx"
+	"io"
+	"net/http"
+	"time"
+)
+
+// authNonces 记录己校验通过的请求 nonce
+var authNonces = runner.NewNonceCache()
+
+// Auth 校验 portal 的请求签名，并在响应中返回 runner 签名。runner 未配置 auth_keys 时不校验
+func Auth(c *ctx.Context) {
+	conf := configs.Get().Runner
+	if len(conf.AuthKeys) == 0 {
+		return
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			c.Error(err, http.StatusBadRequest)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	key, sign, err := runner.VerifyRequest(conf.FindAuthKey, authNonces, c.Request, body, time.Now())
+	if err != nil {
+		c.Error(err, http.StatusUnauthorized)
+		c.Abort()
+		return
+	}
+	// websocket 接口在 upgrade 时会将该 header 写入握手响应
+	c.Header(runner.AuthRunnerSignatureHeader, runner.RunnerSignature(key, sign))
+}
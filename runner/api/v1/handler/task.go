@@ -5,6 +5,7 @@ package handler
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"os"
 
 	"cloudiac/runner"
 	"cloudiac/runner/api/ctx"
@@ -25,3 +26,29 @@ func RunTask(c *ctx.Context) {
 		c.Result(gin.H{"cid": cid})
 	}
 }
+
+// CancelTask 停止正在执行的任务步骤
+func CancelTask(c *ctx.Context) {
+	req := runner.TaskCancelReq{}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	task, err := runner.LoadCommittedTask(req.EnvId, req.TaskId, req.Step)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.Error(err, http.StatusNotFound)
+		} else {
+			c.Error(err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.Logger.WithField("taskId", task.TaskId).Infof("cancel task step %d", task.Step)
+	if err := task.Cancel(); err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(nil)
+}
@@ -39,7 +39,7 @@ func TaskLogFollow(c *ctx.Context) {
 	}
 
 	logger := logger.WithField("taskId", task.TaskId)
-	wsConn, peerClosed, err := ws.UpgradeWithNotifyClosed(c.Writer, c.Request, nil)
+	wsConn, peerClosed, err := ws.UpgradeWithNotifyClosed(c.Writer, c.Request, c.Writer.Header())
 	if err != nil {
 		logger.Warnln(err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
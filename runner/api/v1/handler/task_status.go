@@ -36,7 +36,7 @@ func TaskStatus(c *ctx.Context) {
 	}
 
 	logger := logger.WithField("taskId", task.TaskId)
-	wsConn, peerClosed, err := ws.UpgradeWithNotifyClosed(c.Writer, c.Request, nil)
+	wsConn, peerClosed, err := ws.UpgradeWithNotifyClosed(c.Writer, c.Request, c.Writer.Header())
 	if err != nil {
 		logger.Warnln(err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -60,57 +60,10 @@ func doTaskStatus(wsConn *websocket.Conn, task *runner.CommittedTaskStep, closed
 
 	// 获取任务最新状态并通过 websocket 发送
 	sendStatus := func(withLog bool) error {
-		containerJSON, err := task.Status()
+		msg, err := task.StatusMessage(withLog)
 		if err != nil {
 			return err
 		}
-
-		state := containerJSON.State
-		msg := runner.TaskStatusMessage{
-			Exited:   !state.Running,
-			ExitCode: state.ExitCode,
-		}
-
-		// 由于任务退出的时候 portal 会断开连接，所以如果判断已经退出，则直接发送全量日志
-		if withLog || msg.Exited {
-			logContent, err := runner.FetchTaskStepLog(task.EnvId, task.TaskId, task.Step)
-			if err != nil {
-				logger.Errorf("fetch task log error: %v", err)
-				msg.LogContent = utils.TaskLogMsgBytes("Fetch task log error: %v", err)
-			} else {
-				msg.LogContent = logContent
-			}
-
-			if stateJson, err := runner.FetchStateJson(task.EnvId, task.TaskId); err != nil {
-				logger.Errorf("fetch terraform state json error: %v", err)
-			} else {
-				msg.TfStateJson = stateJson
-			}
-
-			if providerJson, err := runner.FetchProviderJson(task.EnvId, task.TaskId); err != nil {
-				logger.Errorf("fetch terraform provider json error: %v", err)
-			} else {
-				msg.TFProviderSchemaJson = providerJson
-			}
-
-			if planJson, err := runner.FetchPlanJson(task.EnvId, task.TaskId); err != nil {
-				logger.Errorf("fetch terraform state json error: %v", err)
-			} else {
-				msg.TfPlanJson = planJson
-			}
-
-			if parseJson, err := runner.FetchJson(task.EnvId, task.TaskId, runner.TerrascanJsonFile); err != nil {
-				logger.Errorf("fetch terrascan parsed json error: %v", err)
-			} else {
-				msg.TfScanJson = parseJson
-			}
-			if resultJson, err := runner.FetchJson(task.EnvId, task.TaskId, runner.TerrascanResultFile); err != nil {
-				logger.Errorf("fetch terrascan scan result json error: %v", err)
-			} else {
-				msg.TfResultJson = resultJson
-			}
-		}
-
 		if err := wsConn.WriteJSON(msg); err != nil {
 			logger.Errorf("write message error: %v", err)
 			return err
@@ -0,0 +1,24 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package handler
+
+import (
+	"net/http"
+
+	"cloudiac/runner"
+	"cloudiac/runner/api/ctx"
+)
+
+// KeepWorkspaces 保存 portal 上报的需要保留工作目录的任务，清理过期工作目录时跳过这些任务
+func KeepWorkspaces(c *ctx.Context) {
+	req := runner.WorkspaceKeepTasks{}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	}
+	if err := runner.SaveWorkspaceKeepTasks(req.TaskIds); err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(nil)
+}
@@ -21,7 +21,11 @@ func RegisterRoute(apiV1 *gin.RouterGroup) {
 	})
 
 	apiV1.Use(gin.Logger())
+	// 除健康检查外的接口都需要校验 portal 的请求签名
+	apiV1.Use(w(handler.Auth))
 	apiV1.POST("/task/run", w(handler.RunTask))
 	apiV1.GET("/task/status", w(handler.TaskStatus))
 	apiV1.GET("/task/log/follow", w(handler.TaskLogFollow))
+	apiV1.POST("/task/cancel", w(handler.CancelTask))
+	apiV1.POST("/workspace/keep", w(handler.KeepWorkspaces))
 }
@@ -0,0 +1,145 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"cloudiac/configs"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+portal 调用 runner 接口的签名认证:
+1. portal 使用 runner 对应的密钥对请求签名，签名内容为 method、path、query、时间戳、随机 nonce 及 body 的 sha256，
+   通过 AuthKeyIdHeader、AuthTimestampHeader、AuthNonceHeader、AuthSignatureHeader 四个 header 传递
+2. runner 按 key id 查找密钥校验签名及时间戳，并记录时间窗口内己使用的 nonce，拒绝重放的请求。
+   校验通过后在响应中返回 AuthRunnerSignatureHeader，
+   其值为使用同一密钥对请求签名再次签名的结果，portal 校验该值以确认 runner 身份
+
+runner 可以同时配置新旧多个密钥，portal 切换到新密钥后再从 runner 删除旧密钥，实现密钥轮换
+*/
+
+const (
+	AuthKeyIdHeader           = "X-Cloudiac-Key-Id"
+	AuthTimestampHeader       = "X-Cloudiac-Timestamp"
+	AuthNonceHeader           = "X-Cloudiac-Nonce"
+	AuthSignatureHeader       = "X-Cloudiac-Signature"
+	AuthRunnerSignatureHeader = "X-Cloudiac-Runner-Signature"
+
+	AuthMaxClockSkew = 5 * time.Minute // 请求时间戳与 runner 当前时间允许的最大偏差
+)
+
+func hmacSha256Hex(secret string, content string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func requestSignature(secret, method, path, rawQuery, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return hmacSha256Hex(secret, strings.Join([]string{
+		method, path, rawQuery, timestamp, nonce, hex.EncodeToString(bodyHash[:]),
+	}, "\n"))
+}
+
+// SignRequest 对请求签名并设置认证 header，返回请求签名，用于校验 runner 的响应
+func SignRequest(header http.Header, key *configs.RunnerAuthKey, method, path, rawQuery string, body []byte) string {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	nonce := hex.EncodeToString(buf)
+	sign := requestSignature(key.Secret, method, path, rawQuery, ts, nonce, body)
+	header.Set(AuthKeyIdHeader, key.KeyId)
+	header.Set(AuthTimestampHeader, ts)
+	header.Set(AuthNonceHeader, nonce)
+	header.Set(AuthSignatureHeader, sign)
+	return sign
+}
+
+// NonceCache 记录时间窗口内己使用的请求 nonce，用于拒绝重放的请求
+type NonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	cleanedAt time.Time
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{expires: make(map[string]time.Time)}
+}
+
+// Use 记录 nonce，nonce 己被使用过时返回 false。
+// 请求时间戳超出 AuthMaxClockSkew 后请求本身会被拒绝，所以 nonce 只需要保存到该时间
+func (c *NonceCache) Use(nonce string, ts time.Time, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.cleanedAt) > time.Minute {
+		for n, expire := range c.expires {
+			if now.After(expire) {
+				delete(c.expires, n)
+			}
+		}
+		c.cleanedAt = now
+	}
+	if expire, ok := c.expires[nonce]; ok && !now.After(expire) {
+		return false
+	}
+	c.expires[nonce] = ts.Add(AuthMaxClockSkew)
+	return true
+}
+
+// VerifyRequest 校验 portal 请求签名，签名通过后在 nonces 中记录请求的 nonce，返回请求使用的密钥及签名
+func VerifyRequest(findKey func(keyId string) *configs.RunnerAuthKey, nonces *NonceCache, r *http.Request,
+	body []byte, now time.Time) (*configs.RunnerAuthKey, string, error) {
+	keyId := r.Header.Get(AuthKeyIdHeader)
+	sign := r.Header.Get(AuthSignatureHeader)
+	nonce := r.Header.Get(AuthNonceHeader)
+	if keyId == "" || sign == "" || nonce == "" {
+		return nil, "", fmt.Errorf("missing request signature")
+	}
+	key := findKey(keyId)
+	if key == nil {
+		return nil, "", fmt.Errorf("unknown key id '%s'", keyId)
+	}
+
+	ts := r.Header.Get(AuthTimestampHeader)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid timestamp '%s'", ts)
+	}
+	reqTime := time.Unix(unix, 0)
+	if skew := now.Sub(reqTime); skew > AuthMaxClockSkew || skew < -AuthMaxClockSkew {
+		return nil, "", fmt.Errorf("request timestamp expired")
+	}
+
+	expected := requestSignature(key.Secret, r.Method, r.URL.Path, r.URL.RawQuery, ts, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(sign)) {
+		return nil, "", fmt.Errorf("invalid request signature")
+	}
+	if !nonces.Use(nonce, reqTime, now) {
+		return nil, "", fmt.Errorf("request nonce already used")
+	}
+	return key, sign, nil
+}
+
+// RunnerSignature runner 对请求签名的响应签名
+func RunnerSignature(key *configs.RunnerAuthKey, requestSign string) string {
+	return hmacSha256Hex(key.Secret, "runner\n"+requestSign)
+}
+
+// VerifyRunnerSignature 校验 runner 响应中的签名
+func VerifyRunnerSignature(key *configs.RunnerAuthKey, requestSign string, header http.Header) error {
+	expected := RunnerSignature(key, requestSign)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(AuthRunnerSignatureHeader))) {
+		return fmt.Errorf("invalid runner signature")
+	}
+	return nil
+}
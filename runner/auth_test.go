@@ -0,0 +1,94 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	keys := []configs.RunnerAuthKey{
+		{KeyId: "new", Secret: "new-secret"},
+		{KeyId: "old", Secret: "old-secret"},
+	}
+	findKey := func(keyId string) *configs.RunnerAuthKey {
+		for i := range keys {
+			if keys[i].KeyId == keyId {
+				return &keys[i]
+			}
+		}
+		return nil
+	}
+	body := []byte(`{"taskId":"run-xxx"}`)
+	newRequest := func(key *configs.RunnerAuthKey, body []byte) (*http.Request, string) {
+		req, _ := http.NewRequest(http.MethodPost, "http://runner:19030/api/v1/task/run?step=1", bytes.NewReader(body))
+		sign := SignRequest(req.Header, key, req.Method, req.URL.Path, req.URL.RawQuery, body)
+		return req, sign
+	}
+
+	// 新旧密钥签名的请求都可以通过校验
+	for i := range keys {
+		req, sign := newRequest(&keys[i], body)
+		key, reqSign, err := VerifyRequest(findKey, NewNonceCache(), req, body, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, keys[i].KeyId, key.KeyId)
+		assert.Equal(t, sign, reqSign)
+
+		header := http.Header{}
+		header.Set(AuthRunnerSignatureHeader, RunnerSignature(key, reqSign))
+		assert.NoError(t, VerifyRunnerSignature(&keys[i], sign, header))
+		assert.Error(t, VerifyRunnerSignature(&configs.RunnerAuthKey{Secret: "other"}, sign, header))
+	}
+
+	// 未知密钥
+	req, _ := newRequest(&configs.RunnerAuthKey{KeyId: "removed", Secret: "removed-secret"}, body)
+	_, _, err := VerifyRequest(findKey, NewNonceCache(), req, body, time.Now())
+	assert.Error(t, err)
+
+	// body 被修改
+	req, _ = newRequest(&keys[0], body)
+	_, _, err = VerifyRequest(findKey, NewNonceCache(), req, []byte(`{"taskId":"run-yyy"}`), time.Now())
+	assert.Error(t, err)
+
+	// 时间戳过期
+	req, _ = newRequest(&keys[0], body)
+	_, _, err = VerifyRequest(findKey, NewNonceCache(), req, body, time.Now().Add(AuthMaxClockSkew+time.Minute))
+	assert.Error(t, err)
+
+	// 重放的请求
+	nonces := NewNonceCache()
+	req, _ = newRequest(&keys[0], body)
+	_, _, err = VerifyRequest(findKey, nonces, req, body, time.Now())
+	assert.NoError(t, err)
+	_, _, err = VerifyRequest(findKey, nonces, req, body, time.Now().Add(time.Minute))
+	assert.Error(t, err)
+
+	// 修改 nonce
+	req.Header.Set(AuthNonceHeader, "other-nonce")
+	_, _, err = VerifyRequest(findKey, nonces, req, body, time.Now())
+	assert.Error(t, err)
+
+	// 未签名
+	req, _ = http.NewRequest(http.MethodGet, "http://runner:19030/api/v1/task/status", nil)
+	_, _, err = VerifyRequest(findKey, NewNonceCache(), req, nil, time.Now())
+	assert.Error(t, err)
+}
+
+func TestNonceCache(t *testing.T) {
+	c := NewNonceCache()
+	now := time.Now()
+	assert.True(t, c.Use("n1", now, now))
+	assert.False(t, c.Use("n1", now, now.Add(AuthMaxClockSkew)))
+	assert.True(t, c.Use("n2", now, now))
+
+	// 过期的 nonce 会被清理
+	later := now.Add(AuthMaxClockSkew + time.Minute + time.Second)
+	assert.True(t, c.Use("n3", later, later))
+	assert.Equal(t, 1, len(c.expires))
+}
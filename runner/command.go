@@ -3,21 +3,13 @@
 package runner
 
 import (
-	"context"
-	"path/filepath"
-
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
-
-	"cloudiac/common"
 	"cloudiac/configs"
-	"cloudiac/utils"
+	"context"
 )
 
-// Command to run docker image
+// Command 任务步骤的执行命令，由 Executor 启动
 type Command struct {
+	Executor   string // 执行器，为空时使用 docker 执行器
 	Image      string
 	Env        []string
 	Timeout    int
@@ -27,6 +19,11 @@ type Command struct {
 	Commands         []string
 	HostWorkdir      string // 宿主机目录
 	Workdir          string // 容器目录
+	HostStateDir     string // 宿主机 state 目录，使用 local state backend 时挂载到容器
+	StepDir          string // 宿主机上的步骤目录，保存步骤脚本、日志及执行信息
+
+	Resources configs.ResourceLimits // 容器资源限制
+	Network   string                 // 容器使用的 docker 网络
 	// for container
 	//ContainerInstance *Container
 }
@@ -39,89 +36,9 @@ type Container struct {
 }
 
 func (cmd *Command) Start() (string, error) {
-	logger := logger.WithField("taskId", filepath.Base(cmd.HostWorkdir))
-	cli, err := client.NewClientWithOpts()
-	if err != nil {
-		logger.Errorf("unable to create docker client")
-		return "", err
-	}
-	cli.NegotiateAPIVersion(context.Background())
-
-	conf := configs.Get()
-	mountConfigs := []mount.Mount{
-		{
-			Type:   mount.TypeBind,
-			Source: cmd.HostWorkdir,
-			Target: ContainerWorkspace,
-		},
-		{
-			Type:   mount.TypeBind,
-			Source: conf.Runner.AbsPluginCachePath(),
-			Target: ContainerPluginCachePath,
-		},
-		{
-			Type:   mount.TypeBind,
-			Source: "/var/run/docker.sock",
-			Target: "/var/run/docker.sock",
-		},
-	}
-
-	// assets_path 配置为空则表示直接使用 worker 容器中打包的 assets。
-	// 在 runner 容器化部署时运行 runner 的宿主机(docker host)并没有 assets 目录，
-	// 如果配置了 assets 路径，进行 bind mount 时会因为源目录不存在而报错。
-	if conf.Runner.AssetsPath != "" {
-		mountConfigs = append(mountConfigs, mount.Mount{
-			Type:     mount.TypeBind,
-			Source:   conf.Runner.AbsAssetsPath(),
-			Target:   ContainerAssetsDir,
-			ReadOnly: true,
-		})
-		mountConfigs = append(mountConfigs, mount.Mount{
-			// providers 需要挂载到指定目录才能被 terraform 查找到，所以单独做一次挂载
-			Type:     mount.TypeBind,
-			Source:   conf.Runner.ProviderPath(),
-			Target:   ContainerPluginPath,
-			ReadOnly: true,
-		})
-	}
-
-	// 内置 tf 版本列表中无该版本，我们挂载缓存目录到容器，下载后会保存到宿主机，下次可以直接使用。
-	// 注意，该方案有个问题：客户无法自定义镜像预先安装需要的 terraform 版本，
-	// 因为判断版本不在 TerraformVersions 列表中就会挂载目录，客户自定义镜像安装的版本会被覆盖
-	//（考虑把版本列表写到配置文件？）
-	if !utils.StrInArray(cmd.TerraformVersion, common.TerraformVersions...) {
-		mountConfigs = append(mountConfigs, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: conf.Runner.AbsTfenvVersionsCachePath(),
-			Target: "/root/.tfenv/versions",
-		})
-	}
-
-	c, err := cli.ContainerCreate(
-		context.Background(),
-		&container.Config{
-			Image:        cmd.Image,
-			WorkingDir:   cmd.Workdir,
-			Cmd:          cmd.Commands,
-			Env:          cmd.Env,
-			AttachStdin:  false,
-			AttachStdout: true,
-			AttachStderr: true,
-		},
-		&container.HostConfig{
-			AutoRemove: false,
-			Mounts:     mountConfigs,
-		},
-		nil,
-		nil,
-		"")
+	executor, err := GetExecutor(cmd.Executor)
 	if err != nil {
-		logger.Errorf("create container err: %v", err)
 		return "", err
 	}
-
-	cid := utils.ShortContainerId(c.ID)
-	logger.Infof("container id: %s", cid)
-	err = cli.ContainerStart(context.Background(), c.ID, types.ContainerStartOptions{})
-	return cid, err
+	return executor.Start(cmd)
 }
@@ -7,16 +7,9 @@ import (
 	"cloudiac/utils/logs"
 	"context"
 	"encoding/json"
-	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
-
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/errdefs"
 )
 
 var logger = logs.Get()
@@ -25,7 +18,8 @@ type CommittedTaskStep struct {
 	EnvId       string `json:"envId"`
 	TaskId      string `json:"taskId"`
 	Step        int    `json:"step"`
-	ContainerId string `json:"containerId"`
+	Executor    string `json:"executor,omitempty"` // 执行器，为空表示 docker 执行器
+	ContainerId string `json:"containerId"`        // 执行器内的步骤 id，docker 执行器为容器 id，local 执行器为进程 id
 
 	containerInfoLock sync.RWMutex
 }
@@ -45,47 +39,34 @@ func LoadCommittedTask(envId string, taskId string, step int) (*CommittedTaskSte
 	return &task, nil
 }
 
+func (task *CommittedTaskStep) executor() (Executor, error) {
+	return GetExecutor(task.Executor)
+}
+
+// Cancel 停止任务步骤
 func (task *CommittedTaskStep) Cancel() error {
-	cli, err := client.NewClientWithOpts()
-	cli.NegotiateAPIVersion(context.Background())
-	if err != nil {
-		logger.Warnf("unable to create docker client, error: %v", err)
-		return err
+	if task.hasContainerInfo() {
+		// 步骤己退出
+		return nil
 	}
 
-	containerRemoveOpts := types.ContainerRemoveOptions{
-		RemoveVolumes: true,
-		Force:         true,
-	}
-	if err := cli.ContainerRemove(context.Background(), task.ContainerId, containerRemoveOpts); err != nil {
-		if _, ok := err.(errdefs.ErrNotFound); ok {
-			return nil
-		}
+	executor, err := task.executor()
+	if err != nil {
 		return err
 	}
-	return nil
+	return executor.Cancel(task)
 }
 
-func (task *CommittedTaskStep) Status() (types.ContainerJSON, error) {
+func (task *CommittedTaskStep) Status() (StepState, error) {
 	if task.hasContainerInfo() {
 		return task.readContainerInfo()
 	}
 
-	cli, err := client.NewClientWithOpts()
-	if err != nil {
-		logger.Warnf("unable to create docker client, error: %v", err)
-		return types.ContainerJSON{}, err
-	}
-
-	cli.NegotiateAPIVersion(context.Background())
-	containerInfo, err := cli.ContainerInspect(context.Background(), task.ContainerId)
+	executor, err := task.executor()
 	if err != nil {
-		logger.Errorf("failed to inspect for container: %s, error: %v ",
-			utils.ShortContainerId(task.ContainerId), err)
-		return types.ContainerJSON{}, err
+		return StepState{}, err
 	}
-
-	return containerInfo, nil
+	return executor.Status(task)
 }
 
 func (task *CommittedTaskStep) TaskStepDir() string {
@@ -96,7 +77,7 @@ func (task *CommittedTaskStep) containerInfoPath() string {
 	return filepath.Join(task.TaskStepDir(), TaskStepContainerInfoFileName)
 }
 
-func (task *CommittedTaskStep) writeContainerInfo(info *types.ContainerJSON) error {
+func (task *CommittedTaskStep) writeContainerInfo(info *StepState) error {
 	task.containerInfoLock.Lock()
 	defer task.containerInfoLock.Unlock()
 
@@ -122,7 +103,7 @@ func (task *CommittedTaskStep) hasContainerInfo() bool {
 	return true
 }
 
-func (task *CommittedTaskStep) readContainerInfo() (info types.ContainerJSON, err error) {
+func (task *CommittedTaskStep) readContainerInfo() (info StepState, err error) {
 	task.containerInfoLock.RLock()
 	defer task.containerInfoLock.RUnlock()
 
@@ -137,7 +118,7 @@ func (task *CommittedTaskStep) readContainerInfo() (info types.ContainerJSON, er
 }
 
 // Wait 等待任务结束返回退出码，若超时返回 error=context.DeadlineExceeded
-// 如果等待到任务结束则会将容器状态信息写入到文件，然后删除容器
+// 如果等待到任务结束则会将步骤状态信息写入到文件，然后清理执行器资源(如删除容器)
 func (task *CommittedTaskStep) Wait(ctx context.Context) (int64, error) {
 	logger := logger.WithField("taskId", task.TaskId).
 		WithField("containerId", utils.ShortContainerId(task.ContainerId))
@@ -150,54 +131,112 @@ func (task *CommittedTaskStep) Wait(ctx context.Context) (int64, error) {
 		return int64(info.State.ExitCode), nil
 	}
 
-	cli, err := client.NewClientWithOpts()
+	executor, err := task.executor()
 	if err != nil {
 		return 0, err
 	}
+	code, err := executor.Wait(ctx, task)
+	if err != nil {
+		if err == errStepNotFound {
+			return 0, nil
+		}
+		return code, err
+	}
 
-	cli.NegotiateAPIVersion(ctx)
-	respCh, errCh := cli.ContainerWait(ctx, task.ContainerId, container.WaitConditionNotRunning)
-	select {
-	case resp := <-respCh:
-		if resp.Error != nil {
-			logger.Warnf("wait container response status: %v, error: %v", resp.StatusCode, resp.Error)
-			return resp.StatusCode, fmt.Errorf(resp.Error.Message)
-		} else {
-			{ // 执行结束后的处理
-				// 调用 Status() 获取一次任务最新状态，并保存状态到文件
-				if info, err := task.Status(); err != nil {
-					logger.Warnf("get task status error: %v", err)
-				} else if err := task.writeContainerInfo(&info); err != nil {
-					logger.Warnf("write container info error: %v", err)
-				}
-
-				autoRemove := utils.GetBoolEnv("IAC_AUTO_REMOVE", true)
-				if autoRemove {
-					// 删除容器
-					err := cli.ContainerRemove(context.Background(), task.ContainerId,
-						types.ContainerRemoveOptions{
-							RemoveVolumes: true,
-							RemoveLinks:   false,
-							Force:         false,
-						})
-					if err != nil {
-						// 有可能其他协程己经提交了删除，这里忽略掉这些报错
-						if !strings.Contains(err.Error(), "already in progress") &&
-							!strings.Contains(err.Error(), "No such container") {
-							logger.Warnf("remove container error: %v", err)
-						}
-					}
-				}
+	{ // 执行结束后的处理
+		// 调用 Status() 获取一次任务最新状态，并保存状态到文件
+		if info, err := task.Status(); err != nil {
+			logger.Warnf("get task status error: %v", err)
+		} else if err := task.writeContainerInfo(&info); err != nil {
+			logger.Warnf("write container info error: %v", err)
+		}
+
+		autoRemove := utils.GetBoolEnv("IAC_AUTO_REMOVE", true)
+		if autoRemove {
+			if err := executor.Cleanup(task); err != nil {
+				logger.Warnf("cleanup task step error: %v", err)
 			}
+		}
+	}
+	return code, nil
+}
+
+// StatusMessage 获取任务步骤最新状态，withLog 为 true 或任务己退出时附带全量日志及执行结果文件
+func (task *CommittedTaskStep) StatusMessage(withLog bool) (*TaskStatusMessage, error) {
+	logger := logger.WithField("taskId", task.TaskId).WithField("step", task.Step)
 
-			return resp.StatusCode, nil
+	stepState, err := task.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	state := stepState.State
+	msg := TaskStatusMessage{
+		Exited:    !state.Running,
+		ExitCode:  state.ExitCode,
+		OOMKilled: state.OOMKilled,
+	}
+
+	// 由于任务退出的时候 portal 会断开连接，所以如果判断已经退出，则直接发送全量日志
+	if withLog || msg.Exited {
+		var logContent []byte
+		executor, err := task.executor()
+		if err == nil {
+			logContent, err = executor.Logs(task)
 		}
-	case err := <-errCh:
-		if errdefs.IsNotFound(err) {
-			logger.Infof("container not found, Id: %s", task.ContainerId)
-			return 0, nil
+		if err != nil {
+			logger.Errorf("fetch task log error: %v", err)
+			msg.LogContent = utils.TaskLogMsgBytes("Fetch task log error: %v", err)
+		} else {
+			msg.LogContent = logContent
+		}
+
+		if stateJson, err := FetchStateJson(task.EnvId, task.TaskId); err != nil {
+			logger.Errorf("fetch terraform state json error: %v", err)
+		} else {
+			msg.TfStateJson = stateJson
+		}
+
+		if state, err := FetchJson(task.EnvId, task.TaskId, TFStateFile); err != nil {
+			logger.Errorf("fetch terraform state error: %v", err)
+		} else {
+			msg.TfState = state
+		}
+
+		if backup, err := FetchJson(task.EnvId, task.TaskId, TFStateBackupFile); err != nil {
+			logger.Errorf("fetch terraform state backup error: %v", err)
+		} else {
+			msg.TfStateBackup = backup
+		}
+
+		if importJson, err := FetchJson(task.EnvId, task.TaskId, TFImportResultFile); err != nil {
+			logger.Errorf("fetch terraform import result error: %v", err)
+		} else {
+			msg.TfImportJson = importJson
+		}
+
+		if providerJson, err := FetchProviderJson(task.EnvId, task.TaskId); err != nil {
+			logger.Errorf("fetch terraform provider json error: %v", err)
+		} else {
+			msg.TFProviderSchemaJson = providerJson
+		}
+
+		if planJson, err := FetchPlanJson(task.EnvId, task.TaskId); err != nil {
+			logger.Errorf("fetch terraform state json error: %v", err)
+		} else {
+			msg.TfPlanJson = planJson
+		}
+
+		if parseJson, err := FetchJson(task.EnvId, task.TaskId, TerrascanJsonFile); err != nil {
+			logger.Errorf("fetch terrascan parsed json error: %v", err)
+		} else {
+			msg.TfScanJson = parseJson
+		}
+		if resultJson, err := FetchJson(task.EnvId, task.TaskId, TerrascanResultFile); err != nil {
+			logger.Errorf("fetch terrascan scan result json error: %v", err)
+		} else {
+			msg.TfResultJson = resultJson
 		}
-		logger.Warnf("wait container error: %v", err)
-		return 0, err
 	}
+	return &msg, nil
 }
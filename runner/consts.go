@@ -25,11 +25,13 @@ const (
 	ContainerAssetsDir       = "/cloudiac/assets"             // 挂载依赖资源，如 terraform.py 等(可以考虑打包到镜像?)
 	ContainerPluginPath      = "/usr/share/terraform/plugins" // 预置 providers 目录(可以考虑打包到镜像?)
 	ContainerPluginCachePath = "/terraform/plugins-cache"     // terraform plugins 缓存目录
+	ContainerStatePath       = "/cloudiac/state"              // local state backend 的 state 文件目录
 )
 
 const (
 	TaskStepScriptName = "run.sh"
 	TaskStepLogName    = "output.log"
+	TaskStepEventsName = "events.jsonl" // 从 terraform -json 输出中解析出的步骤事件，每行一条 json
 
 	TaskStepInfoFileName          = "info.json"
 	TaskStepContainerInfoFileName = "container.json"
@@ -37,9 +39,13 @@ const (
 	CloudIacTfFile   = "_cloudiac.tf"
 	CloudIacPlayVars = "_cloudiac_play_vars.yml"
 
-	TFStateJsonFile  = "tfstate.json"
-	TFPlanJsonFile   = "tfplan.json"
-	TFProviderSchema = "tfproviderschema.json"
+	TFStateJsonFile    = "tfstate.json"
+	TFStateFile        = "terraform.tfstate.pull" // terraform state pull 得到的原始 state
+	TFRestoreFile      = "terraform.tfstate.restore"
+	TFStateBackupFile  = "terraform.tfstate.backup" // state 操作前备份的 state
+	TFImportResultFile = "tfimport.json" // import 步骤每个资源的执行结果，每行一条 json
+	TFPlanJsonFile     = "tfplan.json"
+	TFProviderSchema   = "tfproviderschema.json"
 
 	AnsibleStateAnalysisName = "terraform.py"
 
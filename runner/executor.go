@@ -0,0 +1,66 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	ExecutorDocker = "docker" // 在 docker 容器中执行任务步骤(默认)
+	ExecutorLocal  = "local"  // 在 runner 所在主机上以独立进程执行任务步骤，适用于无法运行 docker 的主机
+)
+
+// errStepNotFound 执行器中找不到步骤(如容器己被删除)
+var errStepNotFound = errors.New("task step not found")
+
+// StepState 任务步骤执行状态。
+// 该结构会被保存到 container.json，序列化格式与 docker 的 ContainerJSON 兼容，以便读取旧版本保存的文件
+type StepState struct {
+	State ProcessState `json:"State"`
+}
+
+type ProcessState struct {
+	Running    bool   `json:"Running"`
+	ExitCode   int    `json:"ExitCode"`
+	Pid        int    `json:"Pid"`
+	StartedAt  string `json:"StartedAt"`
+	FinishedAt string `json:"FinishedAt"`
+	OOMKilled  bool   `json:"OOMKilled"` // 因超出内存限制被 kill
+}
+
+// Executor 任务步骤执行器，负责启动步骤进程(容器)并管理其生命周期。
+// 除 Start 外的方法都通过 CommittedTaskStep 定位步骤，以保证 runner 重启后仍可以继续管理己启动的步骤
+type Executor interface {
+	// Start 启动步骤，返回执行器内的步骤 id(容器 id 或进程 id)
+	Start(cmd *Command) (string, error)
+	// Status 获取步骤当前状态
+	Status(task *CommittedTaskStep) (StepState, error)
+	// Wait 等待步骤结束，返回退出码
+	Wait(ctx context.Context, task *CommittedTaskStep) (int64, error)
+	// Cancel 强制停止步骤
+	Cancel(task *CommittedTaskStep) error
+	// Cleanup 步骤结束后清理资源(如删除容器)
+	Cleanup(task *CommittedTaskStep) error
+	// Logs 读取步骤日志
+	Logs(task *CommittedTaskStep) ([]byte, error)
+}
+
+// GetExecutor 获取指定名称的执行器，name 为空时使用 docker 执行器
+func GetExecutor(name string) (Executor, error) {
+	switch name {
+	case "", ExecutorDocker:
+		return dockerExecutor{}, nil
+	case ExecutorLocal:
+		return localExecutor{}, nil
+	default:
+		return nil, fmt.Errorf("unknown executor '%s'", name)
+	}
+}
+
+// fetchStepLog 读取步骤日志文件，步骤命令会将输出重定向到该文件，所以各执行器的日志读取方式相同
+func fetchStepLog(task *CommittedTaskStep) ([]byte, error) {
+	return FetchTaskStepLog(task.EnvId, task.TaskId, task.Step)
+}
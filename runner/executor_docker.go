@@ -0,0 +1,322 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+// dockerExecutor 在 docker 容器中执行任务步骤
+type dockerExecutor struct{}
+
+func newDockerClient(ctx context.Context) (*client.Client, error) {
+	cli, err := client.NewClientWithOpts()
+	if err != nil {
+		logger.Warnf("unable to create docker client, error: %v", err)
+		return nil, err
+	}
+	cli.NegotiateAPIVersion(ctx)
+	return cli, nil
+}
+
+// imagePullTimeout 拉取任务镜像的超时时间
+const imagePullTimeout = 10 * time.Minute
+
+// imageRegistry 获取镜像所在的镜像仓库地址，未指定仓库的镜像返回 docker.io
+func imageRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return "docker.io"
+	}
+	host := image[:i]
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return host
+	}
+	return "docker.io"
+}
+
+// pullImageIfNotExists 本地不存在镜像时从镜像仓库拉取，私有仓库使用 registry_auths 中配置的认证信息
+func pullImageIfNotExists(cli *client.Client, image string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), imagePullTimeout)
+	defer cancel()
+
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	opts := types.ImagePullOptions{}
+	if auth := configs.Get().Runner.FindRegistryAuth(imageRegistry(image)); auth != nil {
+		authJson, err := json.Marshal(types.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.Registry,
+		})
+		if err != nil {
+			return err
+		}
+		opts.RegistryAuth = base64.URLEncoding.EncodeToString(authJson)
+	}
+
+	logger.Infof("pulling image %s", image)
+	reader, err := cli.ImagePull(ctx, image, opts)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// 拉取过程中的错误通过消息流返回
+	decoder := json.NewDecoder(reader)
+	for {
+		msg := struct {
+			Error string `json:"error"`
+		}{}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("pull image '%s': %s", image, msg.Error)
+		}
+	}
+}
+
+func (dockerExecutor) Start(cmd *Command) (string, error) {
+	logger := logger.WithField("taskId", filepath.Base(cmd.HostWorkdir))
+	cli, err := client.NewClientWithOpts()
+	if err != nil {
+		logger.Errorf("unable to create docker client")
+		return "", err
+	}
+	cli.NegotiateAPIVersion(context.Background())
+
+	conf := configs.Get()
+	mountConfigs := []mount.Mount{
+		{
+			Type:   mount.TypeBind,
+			Source: cmd.HostWorkdir,
+			Target: ContainerWorkspace,
+		},
+		{
+			Type:   mount.TypeBind,
+			Source: conf.Runner.AbsPluginCachePath(),
+			Target: ContainerPluginCachePath,
+		},
+		{
+			Type:   mount.TypeBind,
+			Source: "/var/run/docker.sock",
+			Target: "/var/run/docker.sock",
+		},
+	}
+
+	// assets_path 配置为空则表示直接使用 worker 容器中打包的 assets。
+	// 在 runner 容器化部署时运行 runner 的宿主机(docker host)并没有 assets 目录，
+	// 如果配置了 assets 路径，进行 bind mount 时会因为源目录不存在而报错。
+	if conf.Runner.AssetsPath != "" {
+		mountConfigs = append(mountConfigs, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   conf.Runner.AbsAssetsPath(),
+			Target:   ContainerAssetsDir,
+			ReadOnly: true,
+		})
+		mountConfigs = append(mountConfigs, mount.Mount{
+			// providers 需要挂载到指定目录才能被 terraform 查找到，所以单独做一次挂载
+			Type:     mount.TypeBind,
+			Source:   conf.Runner.ProviderPath(),
+			Target:   ContainerPluginPath,
+			ReadOnly: true,
+		})
+	}
+
+	if cmd.HostStateDir != "" {
+		mountConfigs = append(mountConfigs, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: cmd.HostStateDir,
+			Target: ContainerStatePath,
+		})
+	}
+
+	// 内置 tf 版本列表中无该版本，我们挂载缓存目录到容器，下载后会保存到宿主机，下次可以直接使用。
+	// 注意，该方案有个问题：客户无法自定义镜像预先安装需要的 terraform 版本，
+	// 因为判断版本不在 TerraformVersions 列表中就会挂载目录，客户自定义镜像安装的版本会被覆盖
+	//（考虑把版本列表写到配置文件？）
+	if !utils.StrInArray(cmd.TerraformVersion, common.TerraformVersions...) {
+		mountConfigs = append(mountConfigs, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: conf.Runner.AbsTfenvVersionsCachePath(),
+			Target: "/root/.tfenv/versions",
+		})
+	}
+
+	if err := pullImageIfNotExists(cli, cmd.Image); err != nil {
+		logger.Errorf("pull image error: %v", err)
+		return "", err
+	}
+
+	c, err := cli.ContainerCreate(
+		context.Background(),
+		&container.Config{
+			Image:        cmd.Image,
+			WorkingDir:   cmd.Workdir,
+			Cmd:          cmd.Commands,
+			Env:          cmd.Env,
+			AttachStdin:  false,
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+		&container.HostConfig{
+			AutoRemove:  false,
+			Mounts:      mountConfigs,
+			Resources:   dockerResources(cmd.Resources),
+			NetworkMode: container.NetworkMode(cmd.Network),
+		},
+		nil,
+		nil,
+		"")
+	if err != nil {
+		logger.Errorf("create container err: %v", err)
+		return "", err
+	}
+
+	cid := utils.ShortContainerId(c.ID)
+	logger.Infof("container id: %s", cid)
+	err = cli.ContainerStart(context.Background(), c.ID, types.ContainerStartOptions{})
+	return cid, err
+}
+
+// dockerResources 将资源限制转为 docker 容器配置，为 0 的项不限制
+func dockerResources(limits configs.ResourceLimits) container.Resources {
+	resources := container.Resources{}
+	if limits.Cpus > 0 {
+		resources.NanoCPUs = int64(limits.Cpus * 1e9)
+	}
+	if limits.Memory > 0 {
+		resources.Memory = limits.Memory * 1024 * 1024
+		// 与内存限制相同，即不允许使用 swap
+		resources.MemorySwap = resources.Memory
+	}
+	if limits.Pids > 0 {
+		pids := limits.Pids
+		resources.PidsLimit = &pids
+	}
+	return resources
+}
+
+func (dockerExecutor) Status(task *CommittedTaskStep) (StepState, error) {
+	cli, err := newDockerClient(context.Background())
+	if err != nil {
+		return StepState{}, err
+	}
+
+	containerInfo, err := cli.ContainerInspect(context.Background(), task.ContainerId)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return StepState{}, errStepNotFound
+		}
+		logger.Errorf("failed to inspect for container: %s, error: %v ",
+			utils.ShortContainerId(task.ContainerId), err)
+		return StepState{}, err
+	}
+
+	state := StepState{}
+	if containerInfo.State != nil {
+		state.State = ProcessState{
+			Running:    containerInfo.State.Running,
+			ExitCode:   containerInfo.State.ExitCode,
+			Pid:        containerInfo.State.Pid,
+			StartedAt:  containerInfo.State.StartedAt,
+			FinishedAt: containerInfo.State.FinishedAt,
+			OOMKilled:  containerInfo.State.OOMKilled,
+		}
+	}
+	return state, nil
+}
+
+// Cancel 这里只 kill 容器而不直接删除，以保证 Wait() 可以获取到容器的退出状态，容器会在 Wait() 结束后被删除
+func (dockerExecutor) Cancel(task *CommittedTaskStep) error {
+	cli, err := newDockerClient(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := cli.ContainerKill(context.Background(), task.ContainerId, "SIGKILL"); err != nil {
+		if errdefs.IsNotFound(err) || errdefs.IsConflict(err) || strings.Contains(err.Error(), "is not running") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (dockerExecutor) Wait(ctx context.Context, task *CommittedTaskStep) (int64, error) {
+	logger := logger.WithField("taskId", task.TaskId).
+		WithField("containerId", utils.ShortContainerId(task.ContainerId))
+
+	cli, err := newDockerClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	respCh, errCh := cli.ContainerWait(ctx, task.ContainerId, container.WaitConditionNotRunning)
+	select {
+	case resp := <-respCh:
+		if resp.Error != nil {
+			logger.Warnf("wait container response status: %v, error: %v", resp.StatusCode, resp.Error)
+			return resp.StatusCode, fmt.Errorf(resp.Error.Message)
+		}
+		return resp.StatusCode, nil
+	case err := <-errCh:
+		if errdefs.IsNotFound(err) {
+			logger.Infof("container not found, Id: %s", task.ContainerId)
+			return 0, errStepNotFound
+		}
+		logger.Warnf("wait container error: %v", err)
+		return 0, err
+	}
+}
+
+// Cleanup 删除容器
+func (dockerExecutor) Cleanup(task *CommittedTaskStep) error {
+	cli, err := newDockerClient(context.Background())
+	if err != nil {
+		return err
+	}
+
+	err = cli.ContainerRemove(context.Background(), task.ContainerId,
+		types.ContainerRemoveOptions{
+			RemoveVolumes: true,
+			RemoveLinks:   false,
+			Force:         false,
+		})
+	if err != nil {
+		// 有可能其他协程己经提交了删除，这里忽略掉这些报错
+		if !strings.Contains(err.Error(), "already in progress") &&
+			!strings.Contains(err.Error(), "No such container") {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dockerExecutor) Logs(task *CommittedTaskStep) ([]byte, error) {
+	return fetchStepLog(task)
+}
@@ -0,0 +1,23 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageRegistry(t *testing.T) {
+	cases := map[string]string{
+		"ubuntu":                               "docker.io",
+		"cloudiac/ct-worker:latest":            "docker.io",
+		"registry.example.com/iac/worker:v1":   "registry.example.com",
+		"registry.example.com:5000/worker:v1":  "registry.example.com:5000",
+		"localhost/worker":                     "localhost",
+		"ghcr.io/org/worker@sha256:0123456789": "ghcr.io",
+	}
+	for image, registry := range cases {
+		assert.Equal(t, registry, imageRegistry(image), image)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"cloudiac/configs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	TaskStepProcessFileName  = "process.json" // local 执行器保存步骤进程信息的文件
+	TaskStepExitCodeFileName = "exit_code"    // local 执行器保存步骤退出码的文件
+
+	localExitCodeKilled = 137 // 进程被 kill 时没有写入退出码，按 SIGKILL 的退出码处理
+)
+
+// 允许传递给步骤进程的 runner 环境变量，其他环境变量(如 runner 的配置及密钥)不会传递给步骤
+var localPassEnvs = []string{"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TMPDIR"}
+
+// localExecutor 在 runner 所在主机上以独立进程组执行任务步骤。
+// 步骤进程的 pid、启动时间及退出码保存在步骤目录下，runner 重启后可以继续获取步骤状态
+type localExecutor struct{}
+
+type localProcessInfo struct {
+	Pid       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	Timeout   int       `json:"timeout"` // 超时时间(秒)，为 0 表示不限制
+}
+
+func readLocalProcessInfo(stepDir string) (*localProcessInfo, error) {
+	content, err := os.ReadFile(filepath.Join(stepDir, TaskStepProcessFileName))
+	if err != nil {
+		return nil, err
+	}
+	info := localProcessInfo{}
+	if err := json.Unmarshal(content, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// readLocalExitCode 读取步骤退出码，步骤未退出时返回 ok=false
+func readLocalExitCode(stepDir string) (code int, finishedAt time.Time, ok bool, err error) {
+	path := filepath.Join(stepDir, TaskStepExitCodeFileName)
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, finishedAt, false, nil
+		}
+		return 0, finishedAt, false, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, finishedAt, false, err
+	}
+	code, err = strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, finishedAt, false, fmt.Errorf("invalid exit code '%s'", content)
+	}
+	return code, stat.ModTime(), true, nil
+}
+
+// isLocalProcessAlive 步骤进程是否还在运行。
+// 步骤进程是独立进程组的 leader，通过检查进程组 id 避免 runner 重启后 pid 被其他进程复用导致误判
+func isLocalProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	pgid, err := syscall.Getpgid(pid)
+	return err == nil && pgid == pid
+}
+
+func localProcessEnv(cmdEnv []string) []string {
+	env := make([]string, 0, len(localPassEnvs)+len(cmdEnv))
+	for _, name := range localPassEnvs {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, fmt.Sprintf("%s=%s", name, v))
+		}
+	}
+	return append(env, cmdEnv...)
+}
+
+func localProcessCredential(username string) (*syscall.Credential, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// localStepCredential 获取运行步骤进程的用户，步骤进程不允许以 root 运行。
+// 配置了 local_user 时使用该用户(runner 需要以 root 运行才能切换用户)，否则使用 runner 进程的用户
+func localStepCredential() (*syscall.Credential, error) {
+	username := configs.Get().Runner.LocalUser
+	if username == "" {
+		if os.Geteuid() == 0 {
+			return nil, fmt.Errorf("local executor refuses to run task steps as root, runner.local_user is required")
+		}
+		return nil, nil
+	}
+
+	cred, err := localProcessCredential(username)
+	if err != nil {
+		return nil, fmt.Errorf("lookup local user '%s': %v", username, err)
+	}
+	if cred.Uid == 0 {
+		return nil, fmt.Errorf("local executor refuses to run task steps as root, runner.local_user '%s' is root", username)
+	}
+	return cred, nil
+}
+
+// checkLocalLimits local 执行器不支持资源限制及网络配置，设置了这些限制时拒绝执行，避免步骤在不受限制的情况下运行
+func checkLocalLimits(limits configs.ResourceLimits, network string) error {
+	if limits != (configs.ResourceLimits{}) {
+		return fmt.Errorf("local executor does not support resource limits")
+	}
+	if network != "" {
+		return fmt.Errorf("local executor does not support network '%s'", network)
+	}
+	return nil
+}
+
+// CheckLocalExecutor 检查 local 执行器的配置，runner 启动时调用
+func CheckLocalExecutor() error {
+	conf := configs.Get().Runner
+	if err := checkLocalLimits(conf.Resources, conf.Network); err != nil {
+		return fmt.Errorf("runner.resources and runner.network are not supported: %v", err)
+	}
+	if err := checkLocalLimits(conf.MaxResources, ""); err != nil {
+		return fmt.Errorf("runner.max_resources is not supported: %v", err)
+	}
+	_, err := localStepCredential()
+	return err
+}
+
+// chownTree 将目录及其中的文件属主修改为步骤进程的用户，使步骤进程可以读写工作目录
+func chownTree(root string, cred *syscall.Credential) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(cred.Uid), int(cred.Gid))
+	})
+}
+
+func (localExecutor) Start(cmd *Command) (string, error) {
+	logger := logger.WithField("taskId", filepath.Base(cmd.HostWorkdir))
+
+	if err := checkLocalLimits(cmd.Resources, cmd.Network); err != nil {
+		return "", err
+	}
+	cred, err := localStepCredential()
+	if err != nil {
+		return "", err
+	}
+
+	exitCodeFile := filepath.Join(cmd.StepDir, TaskStepExitCodeFileName)
+	// 删除上次执行保存的信息，以支持步骤重试
+	for _, path := range []string{exitCodeFile, filepath.Join(cmd.StepDir, TaskStepProcessFileName)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	args := make([]string, 0, len(cmd.Commands))
+	for _, arg := range cmd.Commands {
+		args = append(args, shellQuote(arg))
+	}
+	// 由 shell 在步骤命令结束后写入退出码，runner 重启后仍可以获取到
+	script := fmt.Sprintf("%s; echo $? > %s.tmp && mv %s.tmp %s", strings.Join(args, " "),
+		shellQuote(exitCodeFile), shellQuote(exitCodeFile), shellQuote(exitCodeFile))
+
+	c := exec.Command("sh", "-c", script)
+	c.Dir = cmd.Workdir
+	c.Env = localProcessEnv(cmd.Env)
+	// 使用独立进程组，取消或超时时 kill 整个进程组
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if cred != nil {
+		// 工作目录由 runner 创建，需要修改属主后步骤进程才能写入
+		if err := chownTree(cmd.HostWorkdir, cred); err != nil {
+			return "", fmt.Errorf("chown workspace: %v", err)
+		}
+		c.SysProcAttr.Credential = cred
+	}
+
+	if err := c.Start(); err != nil {
+		logger.Errorf("start process error: %v", err)
+		return "", err
+	}
+	// 回收子进程，退出状态通过退出码文件获取
+	go func() { _ = c.Wait() }()
+
+	pid := c.Process.Pid
+	info, _ := json.Marshal(localProcessInfo{
+		Pid:       pid,
+		StartedAt: time.Now(),
+		Timeout:   cmd.Timeout,
+	})
+	if err := os.WriteFile(filepath.Join(cmd.StepDir, TaskStepProcessFileName), info, 0644); err != nil {
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+		return "", err
+	}
+	logger.Infof("process id: %d", pid)
+	return strconv.Itoa(pid), nil
+}
+
+func (localExecutor) Status(task *CommittedTaskStep) (StepState, error) {
+	stepDir := task.TaskStepDir()
+	info, err := readLocalProcessInfo(stepDir)
+	if err != nil {
+		return StepState{}, err
+	}
+
+	state := ProcessState{
+		Pid:       info.Pid,
+		StartedAt: info.StartedAt.Format(time.RFC3339Nano),
+	}
+	code, finishedAt, exited, err := readLocalExitCode(stepDir)
+	if err != nil {
+		return StepState{}, err
+	}
+	if exited {
+		state.ExitCode = code
+		state.FinishedAt = finishedAt.Format(time.RFC3339Nano)
+	} else if isLocalProcessAlive(info.Pid) {
+		state.Running = true
+	} else {
+		state.ExitCode = localExitCodeKilled
+	}
+	return StepState{State: state}, nil
+}
+
+// Wait 轮询步骤进程状态直到退出，步骤超时后 kill 进程组
+func (e localExecutor) Wait(ctx context.Context, task *CommittedTaskStep) (int64, error) {
+	info, err := readLocalProcessInfo(task.TaskStepDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, errStepNotFound
+		}
+		return 0, err
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	killed := false
+	for {
+		state, err := e.Status(task)
+		if err != nil {
+			return 0, err
+		}
+		if !state.State.Running {
+			return int64(state.State.ExitCode), nil
+		}
+
+		if !killed && info.Timeout > 0 && time.Since(info.StartedAt) > time.Duration(info.Timeout)*time.Second {
+			logger.WithField("taskId", task.TaskId).Infof("task step timeout, kill process %d", info.Pid)
+			if err := e.Cancel(task); err != nil {
+				return 0, err
+			}
+			killed = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (localExecutor) Cancel(task *CommittedTaskStep) error {
+	info, err := readLocalProcessInfo(task.TaskStepDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !isLocalProcessAlive(info.Pid) {
+		return nil
+	}
+	if err := syscall.Kill(-info.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// Cleanup 步骤进程退出后没有需要清理的资源，步骤目录随任务工作目录一起保留
+func (localExecutor) Cleanup(*CommittedTaskStep) error {
+	return nil
+}
+
+func (localExecutor) Logs(task *CommittedTaskStep) ([]byte, error) {
+	return fetchStepLog(task)
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"cloudiac/configs"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initLocalExecutorConfig(t *testing.T) string {
+	storage := t.TempDir()
+	confFile := filepath.Join(t.TempDir(), "config-runner.yml")
+	content := fmt.Sprintf("secretKey: test\nrunner:\n  storage_path: %q\n  executor: local\n", storage)
+	if os.Geteuid() == 0 {
+		// 步骤进程不允许以 root 运行，以 root 执行测试时使用 nobody 用户运行步骤
+		content += "  local_user: nobody\n"
+		if err := os.Chmod(filepath.Dir(storage), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(confFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := configs.ParseRunnerConfig(confFile); err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+func startLocalStep(t *testing.T, step int, timeout int, command string) *CommittedTaskStep {
+	task := &CommittedTaskStep{EnvId: "env-test", TaskId: "run-test", Step: step, Executor: ExecutorLocal}
+	workspace := GetTaskWorkspace(task.EnvId, task.TaskId)
+	stepDir := task.TaskStepDir()
+	assert.NoError(t, os.MkdirAll(stepDir, 0755))
+
+	cmd := Command{
+		Executor:    ExecutorLocal,
+		Timeout:     timeout,
+		Commands:    []string{"sh", "-c", command},
+		Workdir:     workspace,
+		HostWorkdir: workspace,
+		StepDir:     stepDir,
+	}
+	pid, err := cmd.Start()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pid)
+	task.ContainerId = pid
+	return task
+}
+
+func TestLocalStepCredential(t *testing.T) {
+	initLocalExecutorConfig(t)
+	cred, err := localStepCredential()
+	assert.NoError(t, err)
+	if os.Geteuid() == 0 {
+		assert.NotEqual(t, uint32(0), cred.Uid)
+	}
+
+	configs.Get().Runner.LocalUser = "root"
+	_, err = localStepCredential()
+	assert.Error(t, err)
+}
+
+func TestLocalExecutorLimits(t *testing.T) {
+	storage := initLocalExecutorConfig(t)
+	assert.NoError(t, CheckLocalExecutor())
+
+	cmd := Command{
+		Executor:    ExecutorLocal,
+		Commands:    []string{"true"},
+		Workdir:     storage,
+		HostWorkdir: storage,
+		StepDir:     storage,
+		Resources:   configs.ResourceLimits{Memory: 512},
+	}
+	_, err := cmd.Start()
+	assert.Error(t, err)
+
+	cmd.Resources, cmd.Network = configs.ResourceLimits{}, "iac-net"
+	_, err = cmd.Start()
+	assert.Error(t, err)
+
+	configs.Get().Runner.MaxResources.Cpus = 1
+	assert.Error(t, CheckLocalExecutor())
+}
+
+func TestLocalExecutor(t *testing.T) {
+	initLocalExecutorConfig(t)
+
+	// 正常退出，进程环境中只有白名单变量及步骤变量
+	t.Setenv("CLOUDIAC_TEST_SECRET", "secret")
+	task := startLocalStep(t, 0, 0, "test -z \"$CLOUDIAC_TEST_SECRET\" && exit 3")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	code, err := task.Wait(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), code)
+
+	state, err := task.Status()
+	assert.NoError(t, err)
+	assert.False(t, state.State.Running)
+	assert.Equal(t, 3, state.State.ExitCode)
+
+	// 取消
+	task = startLocalStep(t, 1, 0, "sleep 30")
+	state, err = task.Status()
+	assert.NoError(t, err)
+	assert.True(t, state.State.Running)
+	assert.NoError(t, task.Cancel())
+	code, err = task.Wait(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(localExitCodeKilled), code)
+
+	// 超时
+	task = startLocalStep(t, 2, 1, "sleep 30")
+	code, err = task.Wait(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(localExitCodeKilled), code)
+}
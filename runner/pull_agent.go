@@ -0,0 +1,288 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 拉取模式 runner 访问的 portal 接口
+const (
+	PullRunnerIdHeader    = "X-Runner-Id"
+	PullAgentRegisterURL  = "/api/v1/runner_agent/register"
+	PullAgentJobsURL      = "/api/v1/runner_agent/jobs"
+	PullAgentJobStatusURL = "/api/v1/runner_agent/jobs/%s/status"
+	PullAgentJobLogURL    = "/api/v1/runner_agent/jobs/%s/log"
+	PullAgentKeepTasksURL = "/api/v1/runner_agent/workspaces/keep"
+)
+
+const (
+	pullAgentWaitSeconds    = 20               // 拉取任务时 portal 最长等待时间
+	pullAgentReportInterval = time.Second * 2  // 推送日志及心跳的间隔
+	pullAgentRetryInterval  = time.Second * 5  // 请求 portal 失败后的重试间隔
+	pullAgentLogChunkSize   = 512 * 1024       // 单次推送的最大日志长度
+	pullAgentTimeout        = time.Second * 30 // 普通请求的超时时间
+)
+
+type pullAgent struct {
+	portalAddress string
+	runnerId      string
+	token         string
+	tags          []string
+	logger        logs.Logger
+}
+
+func newPullAgent() (*pullAgent, error) {
+	conf := configs.Get()
+	agent := &pullAgent{
+		portalAddress: conf.Runner.PortalAddress,
+		runnerId:      conf.Consul.ServiceID,
+		token:         conf.Runner.Token,
+		tags:          make([]string, 0),
+		logger:        logs.Get().WithField("action", "PullAgent"),
+	}
+	if conf.Consul.ServiceTags != "" {
+		agent.tags = strings.Split(conf.Consul.ServiceTags, ";")
+	}
+	if agent.portalAddress == "" || agent.token == "" || agent.runnerId == "" {
+		return nil, fmt.Errorf("runner.portal_address, runner.token and consul.id are required in pull mode")
+	}
+	return agent, nil
+}
+
+// StartPullAgent 以拉取模式运行 runner: 注册到 portal 后循环拉取任务步骤执行，并推送执行状态及日志
+func StartPullAgent() error {
+	agent, err := newPullAgent()
+	if err != nil {
+		return err
+	}
+
+	agent.logger.Infof("starting pull agent, portal: %s, runner: %s", agent.portalAddress, agent.runnerId)
+	registered := false
+	for {
+		if !registered {
+			if err := agent.register(); err != nil {
+				agent.logger.Errorf("register to portal error: %v", err)
+				time.Sleep(pullAgentRetryInterval)
+				continue
+			}
+			registered = true
+			agent.logger.Infof("registered to portal")
+		}
+
+		resp := PullJobsResp{}
+		url := fmt.Sprintf("%s?wait=%d", PullAgentJobsURL, pullAgentWaitSeconds)
+		if err := agent.request(http.MethodGet, url, nil, &resp, pullAgentTimeout+pullAgentWaitSeconds*time.Second); err != nil {
+			// portal 重启或 runner 记录被删除后需要重新注册
+			agent.logger.Errorf("pull jobs error: %v", err)
+			registered = false
+			time.Sleep(pullAgentRetryInterval)
+			continue
+		}
+		for i := range resp.Jobs {
+			go agent.runJob(resp.Jobs[i])
+		}
+		for i := range resp.Cancels {
+			go agent.cancelJob(resp.Cancels[i])
+		}
+	}
+}
+
+func (a *pullAgent) register() error {
+	return a.request(http.MethodPost, PullAgentRegisterURL,
+		PullRegisterReq{Tags: a.tags, Version: common.VERSION}, nil, pullAgentTimeout)
+}
+
+// request 请求 portal 接口，result 不为空时解析响应中的 result 字段
+func (a *pullAgent) request(method string, path string, data interface{}, result interface{}, timeout time.Duration) error {
+	header := &http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", "Bearer "+a.token)
+	header.Set(PullRunnerIdHeader, a.runnerId)
+
+	respData, err := utils.HttpService(utils.JoinURL(a.portalAddress, path), method, header, data,
+		int(pullAgentTimeout.Seconds()), int(timeout.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	resp := struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}{}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return fmt.Errorf("unexpected response: %s", respData)
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("portal error: %d %s", resp.Code, resp.Message)
+	}
+	if result != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
+
+// syncWorkspaceKeepTasks 从 portal 获取需要保留工作目录的任务，拉取模式下 portal 无法主动上报
+func syncWorkspaceKeepTasks() error {
+	agent, err := newPullAgent()
+	if err != nil {
+		return err
+	}
+	keep := WorkspaceKeepTasks{}
+	if err := agent.request(http.MethodGet, PullAgentKeepTasksURL, nil, &keep, pullAgentTimeout); err != nil {
+		return err
+	}
+	return SaveWorkspaceKeepTasks(keep.TaskIds)
+}
+
+// runJob 执行任务步骤，定时推送增量日志及心跳，步骤结束后推送全量日志及执行结果
+func (a *pullAgent) runJob(job PullJob) {
+	logger := a.logger.WithField("taskId", job.TaskId).WithField("step", job.Step)
+	logger.Infof("run task step")
+
+	if job.Request == nil {
+		a.reportExited(job, &TaskStatusMessage{Exited: true, ExitCode: 1,
+			LogContent: utils.TaskLogMsgBytes("Invalid job: empty request")})
+		return
+	}
+	if _, err := NewTask(*job.Request, logger).Run(); err != nil {
+		logger.Errorf("run task step error: %v", err)
+		a.reportExited(job, &TaskStatusMessage{Exited: true, ExitCode: 1,
+			LogContent: utils.TaskLogMsgBytes("Run task step error: %v", err)})
+		return
+	}
+	task, err := LoadCommittedTask(job.EnvId, job.TaskId, job.Step)
+	if err != nil {
+		logger.Errorf("load task step error: %v", err)
+		a.reportExited(job, &TaskStatusMessage{Exited: true, ExitCode: 1,
+			LogContent: utils.TaskLogMsgBytes("Load task step error: %v", err)})
+		return
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		defer close(waitCh)
+		_, err := task.Wait(context.Background())
+		waitCh <- err
+	}()
+
+	ticker := time.NewTicker(pullAgentReportInterval)
+	defer ticker.Stop()
+
+	offset := 0
+	for {
+		select {
+		case <-ticker.C:
+			offset = a.pushLog(job, offset)
+			// 心跳只上报运行中状态，退出状态在 Wait() 返回后统一上报
+			if err := a.request(http.MethodPost, fmt.Sprintf(PullAgentJobStatusURL, job.Id),
+				TaskStatusMessage{}, nil, pullAgentTimeout); err != nil {
+				logger.Warnf("report status error: %v", err)
+			}
+		case err := <-waitCh:
+			if err != nil {
+				logger.Errorf("wait task step error: %v", err)
+			}
+			a.pushLog(job, offset)
+
+			msg, err := task.StatusMessage(true)
+			if err != nil {
+				logger.Errorf("get task step status error: %v", err)
+				msg = &TaskStatusMessage{Exited: true, ExitCode: 1,
+					LogContent: utils.TaskLogMsgBytes("Get task step status error: %v", err)}
+			}
+			a.reportExited(job, msg)
+			logger.Infof("task step exited, code=%d", msg.ExitCode)
+			return
+		}
+	}
+}
+
+// pushLog 推送 offset 之后的步骤日志，返回 portal 己保存的日志长度
+func (a *pullAgent) pushLog(job PullJob, offset int) int {
+	content, err := FetchTaskStepLog(job.EnvId, job.TaskId, job.Step)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			a.logger.Warnf("read task step log error: %v", err)
+		}
+		return offset
+	}
+
+	for offset < len(content) {
+		end := offset + pullAgentLogChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		// 不推送不完整的多字节字符，剩余部分在下次推送
+		if end = utf8Boundary(content, offset, end); end == offset {
+			return offset
+		}
+		resp := PullJobLogResp{}
+		if err := a.request(http.MethodPost, fmt.Sprintf(PullAgentJobLogURL, job.Id),
+			PullJobLogReq{Offset: offset, Content: content[offset:end]}, &resp, pullAgentTimeout); err != nil {
+			a.logger.Warnf("push task step log error: %v", err)
+			return offset
+		}
+		if resp.Offset == offset {
+			// portal 没有保存本次推送的日志(如最后一行还未输出完整)，等待下次推送
+			return offset
+		}
+		offset = resp.Offset
+	}
+	return offset
+}
+
+// utf8Boundary 返回 content[start:end] 中最后一个完整 utf-8 字符的结束位置，
+// 末尾的字符不完整时返回该字符的起始位置
+func utf8Boundary(content []byte, start, end int) int {
+	for i := end - 1; i >= start && end-i <= utf8.UTFMax; i-- {
+		if utf8.RuneStart(content[i]) {
+			if utf8.FullRune(content[i:end]) {
+				return end
+			}
+			return i
+		}
+	}
+	return end
+}
+
+// reportExited 上报步骤退出状态，失败时进行重试(约 5 分钟)
+func (a *pullAgent) reportExited(job PullJob, msg *TaskStatusMessage) {
+	msg.Exited = true
+	err := utils.RetryFunc(60, pullAgentRetryInterval, func(retryN int) (bool, error) {
+		err := a.request(http.MethodPost, fmt.Sprintf(PullAgentJobStatusURL, job.Id), msg, nil, pullAgentTimeout)
+		return err != nil, err
+	})
+	if err != nil {
+		a.logger.WithField("taskId", job.TaskId).Errorf("report step exited status error: %v", err)
+	}
+}
+
+// cancelJob 停止正在执行的任务步骤，步骤容器可能还未启动，所以步骤不存在时会重试
+func (a *pullAgent) cancelJob(job PullJob) {
+	logger := a.logger.WithField("taskId", job.TaskId).WithField("step", job.Step)
+	err := utils.RetryFunc(10, pullAgentReportInterval, func(retryN int) (bool, error) {
+		task, err := LoadCommittedTask(job.EnvId, job.TaskId, job.Step)
+		if err != nil {
+			return os.IsNotExist(err), err
+		}
+		return false, task.Cancel()
+	})
+	if err != nil {
+		logger.Errorf("cancel task step error: %v", err)
+		return
+	}
+	logger.Infof("task step cancelled")
+}
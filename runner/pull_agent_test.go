@@ -0,0 +1,22 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUtf8Boundary(t *testing.T) {
+	content := []byte("ab中文")
+	assert.Equal(t, 2, utf8Boundary(content, 0, 2))
+	assert.Equal(t, 5, utf8Boundary(content, 0, 5))
+	// 截断在多字节字符中间时退回到字符起始位置
+	assert.Equal(t, 5, utf8Boundary(content, 0, 6))
+	assert.Equal(t, 5, utf8Boundary(content, 0, 7))
+	assert.Equal(t, 8, utf8Boundary(content, 0, 8))
+	assert.Equal(t, 5, utf8Boundary(content, 5, 7))
+	// 无效的字节不影响推送
+	assert.Equal(t, 3, utf8Boundary([]byte{'a', 0xff, 0xfe}, 0, 3))
+}
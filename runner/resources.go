@@ -0,0 +1,34 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import "cloudiac/configs"
+
+// resolveResourceLimits 计算任务容器的资源限制。
+// 模板设置了限制时使用模板的值，否则使用 runner 的默认配置，结果不会超过 runner 配置的上限
+func resolveResourceLimits(conf configs.RunnerConfig, req *ResourceLimits) configs.ResourceLimits {
+	limits := conf.Resources
+	if req != nil {
+		if req.Cpus > 0 {
+			limits.Cpus = req.Cpus
+		}
+		if req.Memory > 0 {
+			limits.Memory = req.Memory
+		}
+		if req.Pids > 0 {
+			limits.Pids = req.Pids
+		}
+	}
+
+	max := conf.MaxResources
+	if max.Cpus > 0 && (limits.Cpus <= 0 || limits.Cpus > max.Cpus) {
+		limits.Cpus = max.Cpus
+	}
+	if max.Memory > 0 && (limits.Memory <= 0 || limits.Memory > max.Memory) {
+		limits.Memory = max.Memory
+	}
+	if max.Pids > 0 && (limits.Pids <= 0 || limits.Pids > max.Pids) {
+		limits.Pids = max.Pids
+	}
+	return limits
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"cloudiac/configs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveResourceLimits(t *testing.T) {
+	conf := configs.RunnerConfig{
+		Resources:    configs.ResourceLimits{Cpus: 1, Memory: 1024},
+		MaxResources: configs.ResourceLimits{Cpus: 2, Pids: 512},
+	}
+
+	cases := []struct {
+		req    *ResourceLimits
+		expect configs.ResourceLimits
+	}{
+		// 未设置时使用默认配置，默认配置不限制的项使用上限
+		{nil, configs.ResourceLimits{Cpus: 1, Memory: 1024, Pids: 512}},
+		// 在上限内覆盖默认配置
+		{&ResourceLimits{Cpus: 1.5, Memory: 4096, Pids: 100}, configs.ResourceLimits{Cpus: 1.5, Memory: 4096, Pids: 100}},
+		// 超过上限时使用上限
+		{&ResourceLimits{Cpus: 8, Pids: 10000}, configs.ResourceLimits{Cpus: 2, Memory: 1024, Pids: 512}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expect, resolveResourceLimits(conf, c.req))
+	}
+
+	// 未配置时不限制
+	assert.Equal(t, configs.ResourceLimits{}, resolveResourceLimits(configs.RunnerConfig{}, nil))
+}
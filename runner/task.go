@@ -16,6 +16,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -60,19 +61,31 @@ func (t *Task) Run() (cid string, err error) {
 	}
 
 	conf := configs.Get().Runner
+	stepDir := GetTaskStepDir(t.req.Env.Id, t.req.TaskId, t.req.Step)
 	cmd := Command{
+		Executor:    conf.Executor,
 		Image:       conf.DefaultImage,
 		Env:         nil,
 		Commands:    nil,
 		Timeout:     t.req.Timeout,
 		Workdir:     ContainerWorkspace,
 		HostWorkdir: t.workspace,
+		StepDir:     stepDir,
+		Resources:   resolveResourceLimits(conf, t.req.Resources),
+		Network:     conf.Network,
+	}
+	if t.isLocalExecutor() {
+		cmd.Workdir = t.workspace
 	}
 
 	if t.req.DockerImage != "" {
 		cmd.Image = t.req.DockerImage
 	}
 
+	if t.req.StateStore.Backend == StateBackendLocal {
+		cmd.HostStateDir = conf.AbsStatePath()
+	}
+
 	tfPluginCacheDir := ""
 	for k, v := range t.req.Env.EnvironmentVars {
 		if k == "TF_PLUGIN_CACHE_DIR" {
@@ -82,7 +95,7 @@ func (t *Task) Run() (cid string, err error) {
 	}
 
 	if tfPluginCacheDir == "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("TF_PLUGIN_CACHE_DIR=%s", ContainerPluginCachePath))
+		cmd.Env = append(cmd.Env, fmt.Sprintf("TF_PLUGIN_CACHE_DIR=%s", t.pluginCachePath()))
 	}
 
 	for k, v := range t.req.Env.TerraformVars {
@@ -105,7 +118,6 @@ func (t *Task) Run() (cid string, err error) {
 	)
 	cmd.Commands = []string{"sh", "-c", shellCommand}
 
-	stepDir := GetTaskStepDir(t.req.Env.Id, t.req.TaskId, t.req.Step)
 	containerInfoFile := filepath.Join(stepDir, TaskStepContainerInfoFileName)
 	// 启动容器前先删除可能存在的 containerInfoFile，以支持步骤重试，
 	// 否则 containerInfoFile 文件存在 CommittedTaskStep.Wait() 会直接返回
@@ -123,6 +135,7 @@ func (t *Task) Run() (cid string, err error) {
 		TaskId:      t.req.TaskId,
 		Step:        t.req.Step,
 		ContainerId: cid,
+		Executor:    conf.Executor,
 	})
 	stepInfoFile := filepath.Join(stepDir, TaskStepInfoFileName)
 	if er := os.WriteFile(stepInfoFile, infoJson, 0644); er != nil {
@@ -175,11 +188,36 @@ func (t *Task) initWorkspace() (workspace string, err error) {
 
 var iacTerraformTpl = template.Must(template.New("").Parse(` terraform {
   backend "{{.State.Backend}}" {
+{{- if eq .State.Backend "consul"}}
     address = "{{.State.Address}}"
     scheme  = "{{.State.Scheme}}"
     path    = "{{.State.Path}}"
     lock    = true
     gzip    = false
+{{- else if eq .State.Backend "s3"}}
+    bucket = {{printf "%q" .State.S3.Bucket}}
+    key    = {{printf "%q" .State.Path}}
+    region = {{printf "%q" .State.S3.Region}}
+  {{- if .State.S3.Endpoint}}
+    endpoint = {{printf "%q" .State.S3.Endpoint}}
+    # 非 aws 的 s3 兼容存储(如 minio)不支持以下校验
+    skip_credentials_validation = true
+    skip_metadata_api_check     = true
+    skip_region_validation      = true
+  {{- end}}
+    force_path_style = {{.State.S3.ForcePathStyle}}
+{{- else if eq .State.Backend "local"}}
+    path = {{printf "%q" .LocalStatePath}}
+{{- else if eq .State.Backend "http"}}
+    address = {{printf "%q" .State.Http.Address}}
+  {{- if .State.Http.LockAddress}}
+    lock_address   = {{printf "%q" .State.Http.LockAddress}}
+    unlock_address = {{printf "%q" .State.Http.UnlockAddress}}
+  {{- end}}
+  {{- if .State.Http.Username}}
+    username = {{printf "%q" .State.Http.Username}}
+  {{- end}}
+{{- end}}
   }
 }
 
@@ -200,17 +238,48 @@ func execTpl2File(tpl *template.Template, data interface{}, savePath string) err
 }
 
 func (t *Task) genIacTfFile(workspace string) error {
-	if t.req.StateStore.Address == "" {
-		if os.Getenv("IAC_WORKER_CONSUL") != "" {
-			t.req.StateStore.Address = os.Getenv("IAC_WORKER_CONSUL")
-		} else {
-			t.req.StateStore.Address = configs.Get().Consul.Address
+	store := &t.req.StateStore
+	switch store.Backend {
+	case "", StateBackendConsul:
+		// 未指定 backend 的任务(如升级前创建的任务)使用 consul
+		store.Backend = StateBackendConsul
+		if store.Scheme == "" {
+			store.Scheme = "http"
+		}
+		if store.Address == "" {
+			if os.Getenv("IAC_WORKER_CONSUL") != "" {
+				store.Address = os.Getenv("IAC_WORKER_CONSUL")
+			} else {
+				store.Address = configs.Get().Consul.Address
+			}
+		}
+	case StateBackendS3:
+		if store.S3 == nil {
+			return fmt.Errorf("missing s3 state backend config")
+		}
+	case StateBackendHttp:
+		if store.Http == nil {
+			return fmt.Errorf("missing http state backend config")
+		}
+	case StateBackendLocal:
+		if t.config.StatePath == "" {
+			return fmt.Errorf("runner state_path is not configured")
+		}
+		if strings.HasPrefix(filepath.Clean(store.Path), "..") {
+			return fmt.Errorf("invalid state path '%s'", store.Path)
 		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(t.config.AbsStatePath(), store.Path)), 0755); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported state backend '%s'", store.Backend)
 	}
+
 	ctx := map[string]interface{}{
 		"Workspace":      workspace,
 		"PrivateKeyPath": t.up2Workspace("ssh_key"),
-		"State":          t.req.StateStore,
+		"State":          store,
+		"LocalStatePath": filepath.Join(t.statePath(), store.Path),
 	}
 	if err := execTpl2File(iacTerraformTpl, ctx, filepath.Join(workspace, CloudIacTfFile)); err != nil {
 		return err
@@ -263,6 +332,34 @@ func (t *Task) executeTpl(tpl *template.Template, data interface{}) (string, err
 	return buffer.String(), nil
 }
 
+func (t *Task) isLocalExecutor() bool {
+	return t.config.Executor == ExecutorLocal
+}
+
+// 以下路径在 docker 执行器中为容器内的挂载路径，在 local 执行器中为 runner 主机上的路径
+
+func (t *Task) pluginCachePath() string {
+	if t.isLocalExecutor() {
+		return t.config.AbsPluginCachePath()
+	}
+	return ContainerPluginCachePath
+}
+
+func (t *Task) statePath() string {
+	if t.isLocalExecutor() {
+		return t.config.AbsStatePath()
+	}
+	return ContainerStatePath
+}
+
+func (t *Task) assetsPath() string {
+	// assets_path 为空时使用预置在执行环境中的 assets
+	if t.isLocalExecutor() && t.config.AssetsPath != "" {
+		return t.config.AbsAssetsPath()
+	}
+	return ContainerAssetsDir
+}
+
 func (t *Task) stepDirName(step int) string {
 	return GetTaskStepDirName(step)
 }
@@ -294,6 +391,14 @@ func (t *Task) genStepScript() error {
 		command, err = t.stepTfParse()
 	case common.TaskStepTfScan:
 		command, err = t.stepTfScan()
+	case common.TaskStepStatePush:
+		command, err = t.stepStatePush()
+	case common.TaskStepUnlock:
+		command, err = t.stepUnlock()
+	case common.TaskStepImport:
+		command, err = t.stepImport()
+	case common.TaskStepStateOp:
+		command, err = t.stepStateOp()
 	default:
 		return fmt.Errorf("unknown step type '%s'", t.req.StepType)
 	}
@@ -343,18 +448,21 @@ func (t *Task) up2Workspace(name string) string {
 func (t *Task) stepInit() (command string, err error) {
 	return t.executeTpl(initCommandTpl, map[string]interface{}{
 		"Req":             t.req,
-		"PluginCachePath": ContainerPluginCachePath,
+		"PluginCachePath": t.pluginCachePath(),
 		"IacTfFile":       t.up2Workspace(CloudIacTfFile),
 	})
 }
 
+// 启用 -json 输出时 plan 日志中没有变更详情，所以再执行一次 terraform show 输出可读的执行计划
 var planCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd 'code/{{.Req.Env.Workdir}}' && \
 tfenv use $TFENV_TERRAFORM_VERSION && \
-terraform plan -input=false -out=_cloudiac.tfplan \
+terraform plan -input=false -out=_cloudiac.tfplan {{if .JsonOutput}}-json {{end}}\
 {{if .TfVars}}-var-file={{.TfVars}}{{end}} \
 {{ range $arg := .Req.StepArgs }}{{$arg}} {{ end }}&& \
-terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}}
+{{if .JsonOutput}}terraform show -no-color _cloudiac.tfplan && \
+{{end}}terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}} && \
+{ terraform providers schema -json >{{.TFProviderSchema}} || true; }
 `))
 
 func (t *Task) stepPlan() (command string, err error) {
@@ -362,6 +470,8 @@ func (t *Task) stepPlan() (command string, err error) {
 		"Req":                t.req,
 		"TfVars":             t.req.Env.TfVarsFile,
 		"TFPlanJsonFilePath": t.up2Workspace(TFPlanJsonFile),
+		"TFProviderSchema":   t.up2Workspace(TFProviderSchema),
+		"JsonOutput":         tfJsonOutputSupported(t.req.Env.TfVersion),
 	})
 }
 
@@ -369,13 +479,14 @@ func (t *Task) stepPlan() (command string, err error) {
 var applyCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd 'code/{{.Req.Env.Workdir}}' && \
 tfenv use $TFENV_TERRAFORM_VERSION && \
-terraform apply -input=false -auto-approve \
+terraform apply -input=false -auto-approve {{if .JsonOutput}}-json {{end}}\
 {{ range $arg := .Req.StepArgs}}{{$arg}} {{ end }}_cloudiac.tfplan
 `))
 
 func (t *Task) stepApply() (command string, err error) {
 	return t.executeTpl(applyCommandTpl, map[string]interface{}{
-		"Req": t.req,
+		"Req":        t.req,
+		"JsonOutput": tfJsonOutputSupported(t.req.Env.TfVersion),
 	})
 }
 
@@ -383,10 +494,25 @@ func (t *Task) stepDestroy() (command string, err error) {
 	// destroy 任务通过会先执行 plan(传入 --destroy 参数)，然后再 apply plan 文件实现。
 	// 这样可以保证 destroy 时执行的是用户审批时看到的 plan 内容
 	return t.executeTpl(applyCommandTpl, map[string]interface{}{
-		"Req": t.req,
+		"Req":        t.req,
+		"JsonOutput": tfJsonOutputSupported(t.req.Env.TfVersion),
 	})
 }
 
+// terraform 从 0.15.3 版本开始 plan、apply 命令支持 -json 参数输出机器可读的事件流
+var tfJsonOutputVersion = semver.MustParse("0.15.3")
+
+func tfJsonOutputSupported(tfVersion string) bool {
+	if tfVersion == "" {
+		tfVersion = consts.DefaultTerraformVersion
+	}
+	v, err := semver.NewVersion(tfVersion)
+	if err != nil {
+		return false
+	}
+	return !v.LessThan(tfJsonOutputVersion)
+}
+
 var playCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 export ANSIBLE_HOST_KEY_CHECKING="False"
 export ANSIBLE_TF_DIR="."
@@ -409,7 +535,7 @@ func (t *Task) stepPlay() (command string, err error) {
 		"Req":                  t.req,
 		"IacPlayVars":          t.up2Workspace(CloudIacPlayVars),
 		"PrivateKeyPath":       t.up2Workspace("ssh_key"),
-		"AnsibleStateAnalysis": filepath.Join(ContainerAssetsDir, AnsibleStateAnalysisName),
+		"AnsibleStateAnalysis": filepath.Join(t.assetsPath(), AnsibleStateAnalysisName),
 	})
 }
 
@@ -433,11 +559,49 @@ func (t *Task) stepCommand() (command string, err error) {
 	})
 }
 
+// state 操作前先备份当前 state，操作按顺序执行，任一操作失败则中止
+var stateOpCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+tfenv use $TFENV_TERRAFORM_VERSION && \
+terraform state pull >{{.TFStateBackupFilePath}} && \
+{{ range $command := .Commands -}}
+echo {{$command}} && {{$command}} && \
+{{ end -}}
+sleep 0
+`))
+
+func (t *Task) stepStateOp() (command string, err error) {
+	if len(t.req.StateOps) == 0 {
+		return "", fmt.Errorf("state operations is empty")
+	}
+	commands := make([]string, 0, len(t.req.StateOps))
+	for _, op := range t.req.StateOps {
+		switch op.Op {
+		case "mv":
+			commands = append(commands, fmt.Sprintf("terraform state mv %s %s",
+				shellQuote(op.Address), shellQuote(op.Destination)))
+		case "rm":
+			commands = append(commands, fmt.Sprintf("terraform state rm %s", shellQuote(op.Address)))
+		case "replace":
+			// taint 后资源会在下次部署时被重建
+			commands = append(commands, fmt.Sprintf("terraform taint %s", shellQuote(op.Address)))
+		default:
+			return "", fmt.Errorf("unknown state operation '%s'", op.Op)
+		}
+	}
+	return t.executeTpl(stateOpCommandTpl, map[string]interface{}{
+		"Req":                   t.req,
+		"Commands":              commands,
+		"TFStateBackupFilePath": t.up2Workspace(TFStateBackupFile),
+	})
+}
+
 // collect command 失败不影响任务状态
 var collectCommandTpl = template.Must(template.New("").Parse(`# state collect command
 cd 'code/{{.Req.Env.Workdir}}' && \
 terraform show -no-color -json >{{.TFStateJsonFilePath}} && \
-terraform providers schema -json > {{.TFProviderSchema}}
+terraform providers schema -json > {{.TFProviderSchema}} && \
+terraform state pull >{{.TFStateFilePath}}
 `))
 
 func (t *Task) collectCommand() (string, error) {
@@ -445,6 +609,84 @@ func (t *Task) collectCommand() (string, error) {
 		"Req":                 t.req,
 		"TFStateJsonFilePath": t.up2Workspace(TFStateJsonFile),
 		"TFProviderSchema":    t.up2Workspace(TFProviderSchema),
+		"TFStateFilePath":     t.up2Workspace(TFStateFile),
+	})
+}
+
+// state 版本可能比 backend 中的 state 旧(serial 更小)，需要使用 -force 写入
+var statePushCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+tfenv use $TFENV_TERRAFORM_VERSION && \
+terraform state push -force {{.TFRestoreFilePath}}
+`))
+
+func (t *Task) stepStatePush() (command string, err error) {
+	if len(t.req.StateContent) == 0 {
+		return "", fmt.Errorf("state content is empty")
+	}
+	if err = os.WriteFile(filepath.Join(t.workspace, TFRestoreFile), t.req.StateContent, 0600); err != nil {
+		return "", err
+	}
+	return t.executeTpl(statePushCommandTpl, map[string]interface{}{
+		"Req":               t.req,
+		"TFRestoreFilePath": t.up2Workspace(TFRestoreFile),
+	})
+}
+
+var unlockCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+tfenv use $TFENV_TERRAFORM_VERSION && \
+terraform force-unlock -force '{{.Req.LockId}}'
+`))
+
+// 逐个导入资源，单个资源导入失败不影响后续资源，每个资源的退出码写入结果文件，有资源导入失败时步骤失败
+var importCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+tfenv use $TFENV_TERRAFORM_VERSION || exit $?
+
+: >{{.TFImportResultFilePath}}
+failed=0
+{{ range $item := .Imports -}}
+echo terraform import {{$item.Address}} {{$item.Id}}
+terraform import -input=false {{if $.TfVars}}-var-file={{$.TfVars}} {{end}}{{$item.Address}} {{$item.Id}}
+code=$?
+echo "{\"index\":{{$item.Index}},\"exitCode\":$code}" >>{{$.TFImportResultFilePath}}
+if [ $code -ne 0 ]; then failed=1; fi
+{{ end -}}
+exit $failed
+`))
+
+func (t *Task) stepImport() (command string, err error) {
+	if len(t.req.Imports) == 0 {
+		return "", fmt.Errorf("import resources is empty")
+	}
+	imports := make([]map[string]interface{}, 0, len(t.req.Imports))
+	for i, item := range t.req.Imports {
+		imports = append(imports, map[string]interface{}{
+			"Index":   i,
+			"Address": shellQuote(item.Address),
+			"Id":      shellQuote(item.Id),
+		})
+	}
+	return t.executeTpl(importCommandTpl, map[string]interface{}{
+		"Req":                    t.req,
+		"TfVars":                 t.req.Env.TfVarsFile,
+		"Imports":                imports,
+		"TFImportResultFilePath": t.up2Workspace(TFImportResultFile),
+	})
+}
+
+// shellQuote 将字符串转为 shell 单引号字符串
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (t *Task) stepUnlock() (command string, err error) {
+	if t.req.LockId == "" || strings.ContainsAny(t.req.LockId, "'\n") {
+		return "", fmt.Errorf("invalid lock id '%s'", t.req.LockId)
+	}
+	return t.executeTpl(unlockCommandTpl, map[string]interface{}{
+		"Req": t.req,
 	})
 }
 
@@ -494,7 +736,7 @@ git checkout -q '{{.Req.RepoRevision}}' && echo check out $(git rev-parse --shor
 func (t *Task) stepScanInit() (command string, err error) {
 	return t.executeTpl(scanInitCommandTpl, map[string]interface{}{
 		"Req":             t.req,
-		"PluginCachePath": ContainerPluginCachePath,
+		"PluginCachePath": t.pluginCachePath(),
 		"IacTfFile":       t.up2Workspace(CloudIacTfFile),
 	})
 }
@@ -22,11 +22,38 @@ type TaskEnv struct {
 	AnsibleVars     map[string]string `json:"ansible"`
 }
 
+const (
+	StateBackendConsul = "consul"
+	StateBackendS3     = "s3"
+	StateBackendLocal  = "local"
+	StateBackendHttp   = "http"
+)
+
+// StateStore terraform state 存储配置，Backend 为空时使用 consul
 type StateStore struct {
-	Backend string `json:"backend" binding:""`
+	Backend string `json:"backend" binding:""` // consul, s3, local, http
 	Scheme  string `json:"scheme" binding:""`
-	Path    string `json:"path" binding:""`
+	Path    string `json:"path" binding:""`    // state 文件路径，s3 backend 作为 key 使用
 	Address string `json:"address" binding:""` // consul 地址 runner 会自动设置
+
+	S3   *S3StateBackend   `json:"s3,omitempty"`
+	Http *HttpStateBackend `json:"http,omitempty"`
+}
+
+// S3StateBackend s3 兼容的对象存储(如 minio)，
+// 认证信息通过加密的环境变量 AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY 传递
+type S3StateBackend struct {
+	Bucket         string `json:"bucket"`
+	Region         string `json:"region"`
+	Endpoint       string `json:"endpoint"`
+	ForcePathStyle bool   `json:"forcePathStyle"`
+}
+
+type HttpStateBackend struct {
+	Address       string `json:"address"`
+	LockAddress   string `json:"lockAddress"`
+	UnlockAddress string `json:"unlockAddress"`
+	Username      string `json:"username"`
 }
 
 type RunTaskReq struct {
@@ -48,6 +75,38 @@ type RunTaskReq struct {
 	StopOnViolation bool         `json:"stopOnViolation"`
 
 	Repos []Repository `json:"repos"` // 待扫描仓库列表
+
+	StateContent []byte `json:"stateContent,omitempty"` // state 恢复任务写入 backend 的 state 内容
+	LockId       string `json:"lockId,omitempty"`       // state 解锁任务要释放的锁 ID
+
+	Imports  []TfImport  `json:"imports,omitempty"`  // import 任务要导入的资源列表
+	StateOps []TfStateOp `json:"stateOps,omitempty"` // state 操作任务要执行的操作列表
+
+	Resources *ResourceLimits `json:"resources,omitempty"` // 模板设置的容器资源限制，runner 会限制在其配置的上限内
+}
+
+// ResourceLimits 任务容器资源限制，各项为 0 表示使用 runner 的默认配置
+type ResourceLimits struct {
+	Cpus   float64 `json:"cpus,omitempty"`   // cpu 核数
+	Memory int64   `json:"memory,omitempty"` // 内存(MB)
+	Pids   int64   `json:"pids,omitempty"`   // 最大进程数
+}
+
+type TfStateOp struct {
+	Op          string `json:"op"` // mv, rm, replace
+	Address     string `json:"address"`
+	Destination string `json:"destination,omitempty"`
+}
+
+type TfImport struct {
+	Address string `json:"address"`
+	Id      string `json:"id"`
+}
+
+// TfImportResult import 步骤中单个资源的执行结果
+type TfImportResult struct {
+	Index    int `json:"index"`
+	ExitCode int `json:"exitCode"`
 }
 
 type Repository struct {
@@ -69,13 +128,19 @@ type TaskPolicy struct {
 
 type TaskLogReq TaskStatusReq
 
+type TaskCancelReq TaskStatusReq
+
 // TaskStatusMessage runner 通知任务状态到 portal
 type TaskStatusMessage struct {
-	Exited   bool `json:"exited"`
-	ExitCode int  `json:"status_code"`
+	Exited    bool `json:"exited"`
+	ExitCode  int  `json:"status_code"`
+	OOMKilled bool `json:"oomKilled,omitempty"` // 步骤因超出内存限制被 kill
 
 	LogContent           []byte `json:"logContent"`
 	TfStateJson          []byte `json:"tfStateJson"`
+	TfState              []byte `json:"tfState"`
+	TfImportJson         []byte `json:"tfImportJson"`
+	TfStateBackup        []byte `json:"tfStateBackup"`
 	TfPlanJson           []byte `json:"tfPlanJson"`
 	TfScanJson           []byte `json:"tfScanJson"`
 	TfResultJson         []byte `json:"tfResultJson"`
@@ -90,3 +155,40 @@ type Response struct {
 	Error  string      `json:"error,omitempty"`
 	Result interface{} `json:"result"`
 }
+
+// PullRegisterReq 拉取模式 runner 注册请求
+type PullRegisterReq struct {
+	Tags    []string `json:"tags"`
+	Version string   `json:"version"`
+}
+
+// PullJob 拉取模式 runner 领取到的任务步骤
+type PullJob struct {
+	Id      string      `json:"id"`
+	EnvId   string      `json:"envId"`
+	TaskId  string      `json:"taskId"`
+	Step    int         `json:"step"`
+	Request *RunTaskReq `json:"request,omitempty"` // 取消请求中该字段为空
+}
+
+// PullJobsResp 拉取模式 runner 拉取任务的响应，包含待执行的步骤及需要停止的步骤
+type PullJobsResp struct {
+	Jobs    []PullJob `json:"jobs"`
+	Cancels []PullJob `json:"cancels"`
+}
+
+// WorkspaceKeepTasks portal 上报的 runner 上需要保留工作目录的任务，包括未结束的任务及可以恢复执行的失败任务
+type WorkspaceKeepTasks struct {
+	TaskIds []string `json:"taskIds"`
+}
+
+// PullJobLogReq 拉取模式 runner 推送步骤增量日志，Offset 为 Content 在日志文件中的起始位置
+type PullJobLogReq struct {
+	Offset  int    `json:"offset"`
+	Content []byte `json:"content"`
+}
+
+// PullJobLogResp 返回 portal 己保存的日志长度，runner 从该位置继续推送
+type PullJobLogResp struct {
+	Offset int `json:"offset"`
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	// WorkspaceGCInterval 清理过期任务工作目录的间隔
+	WorkspaceGCInterval = time.Hour
+	// WorkspaceKeepFileName portal 上报的需要保留工作目录的任务列表，保存在 storage_path 下
+	WorkspaceKeepFileName = "keep_tasks.json"
+	// WorkspaceKeepMaxAge 任务列表超过该时间没有更新时认为 portal 没有正常上报，不清理工作目录
+	WorkspaceKeepMaxAge = 3 * time.Hour
+)
+
+var stepDirNameRegex = regexp.MustCompile(`^step\d+$`)
+
+func isStepDirName(name string) bool {
+	return stepDirNameRegex.MatchString(name) || name == GetTaskStepDirName(common.CollectTaskStepIndex)
+}
+
+// StartWorkspaceGC 定期清理超过保存时间的任务工作目录，未配置 workspace_retention 时不清理
+func StartWorkspaceGC() {
+	retention := configs.Get().Runner.WorkspaceRetention.Duration
+	if retention <= 0 {
+		return
+	}
+
+	logger := logger.WithField("func", "WorkspaceGC")
+	ticker := time.NewTicker(WorkspaceGCInterval)
+	defer ticker.Stop()
+	for {
+		if configs.Get().Runner.IsPullMode() {
+			if err := syncWorkspaceKeepTasks(); err != nil {
+				logger.Warnf("sync keep tasks from portal error: %v", err)
+			}
+		}
+		removed, err := CleanupWorkspaces(time.Now(), retention)
+		if err != nil {
+			logger.Errorf("cleanup workspaces error: %v", err)
+		}
+		if len(removed) > 0 {
+			logger.Infof("removed %d expired task workspaces", len(removed))
+		}
+		<-ticker.C
+	}
+}
+
+func workspaceKeepFile() string {
+	return filepath.Join(configs.Get().Runner.AbsStoragePath(), WorkspaceKeepFileName)
+}
+
+// SaveWorkspaceKeepTasks 保存 portal 上报的需要保留工作目录的任务(未结束或可以恢复执行的任务)
+func SaveWorkspaceKeepTasks(taskIds []string) error {
+	content, err := json.Marshal(WorkspaceKeepTasks{TaskIds: taskIds})
+	if err != nil {
+		return err
+	}
+	path := workspaceKeepFile()
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// loadWorkspaceKeepTasks 读取需要保留工作目录的任务，
+// 任务列表不存在或长时间没有更新时无法确定哪些任务可以清理，返回错误
+func loadWorkspaceKeepTasks(now time.Time) (map[string]bool, error) {
+	path := workspaceKeepFile()
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("keep tasks have not been reported by portal")
+		}
+		return nil, err
+	}
+	if now.Sub(info.ModTime()) > WorkspaceKeepMaxAge {
+		return nil, fmt.Errorf("keep tasks have not been updated since %s", info.ModTime().Format(time.RFC3339))
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keep := WorkspaceKeepTasks{}
+	if err := json.Unmarshal(content, &keep); err != nil {
+		return nil, err
+	}
+	tasks := make(map[string]bool, len(keep.TaskIds))
+	for _, id := range keep.TaskIds {
+		tasks[id] = true
+	}
+	return tasks, nil
+}
+
+// CleanupWorkspaces 删除所有步骤都已结束且最后活动时间早于 now-retention 的任务工作目录，返回被删除的目录。
+// 等待审批、可以恢复执行等 portal 上报需要保留的任务的工作目录不会被删除，没有可用的任务列表时不清理。
+// 目录结构为 {storage_path}/{envId}/{taskId}/{stepDir}
+func CleanupWorkspaces(now time.Time, retention time.Duration) ([]string, error) {
+	keepTasks, err := loadWorkspaceKeepTasks(now)
+	if err != nil {
+		return nil, err
+	}
+
+	storagePath := configs.Get().Runner.AbsStoragePath()
+	envDirs, err := os.ReadDir(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0)
+	for _, envDir := range envDirs {
+		if !envDir.IsDir() {
+			continue
+		}
+		envPath := filepath.Join(storagePath, envDir.Name())
+		taskDirs, err := os.ReadDir(envPath)
+		if err != nil {
+			return removed, err
+		}
+
+		remains := len(taskDirs)
+		for _, taskDir := range taskDirs {
+			if !taskDir.IsDir() || keepTasks[taskDir.Name()] {
+				continue
+			}
+			workspace := filepath.Join(envPath, taskDir.Name())
+			expired, err := isWorkspaceExpired(workspace, now.Add(-retention))
+			if err != nil {
+				logger.WithField("workspace", workspace).Warnf("check workspace error: %v", err)
+				continue
+			} else if !expired {
+				continue
+			}
+
+			if err := os.RemoveAll(workspace); err != nil {
+				return removed, err
+			}
+			removed = append(removed, workspace)
+			remains -= 1
+		}
+
+		if remains == 0 {
+			// 环境下没有任务时删除环境目录，目录非空(如期间有新任务)时删除会失败，忽略该错误
+			_ = os.Remove(envPath)
+		}
+	}
+	return removed, nil
+}
+
+// isWorkspaceExpired 任务工作目录是否可以清理:
+// 所有步骤目录中文件的最后修改时间都早于 cutoff，且所有己启动的步骤都已结束
+func isWorkspaceExpired(workspace string, cutoff time.Time) (bool, error) {
+	info, err := os.Stat(workspace)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().After(cutoff) {
+		return false, nil
+	}
+
+	entries, err := os.ReadDir(workspace)
+	if err != nil {
+		return false, err
+	}
+	committedSteps := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || !isStepDirName(entry.Name()) {
+			continue
+		}
+		stepDir := filepath.Join(workspace, entry.Name())
+		files, err := os.ReadDir(stepDir)
+		if err != nil {
+			return false, err
+		}
+		for _, f := range files {
+			fi, err := f.Info()
+			if err != nil {
+				return false, err
+			}
+			if fi.ModTime().After(cutoff) {
+				return false, nil
+			}
+			if f.Name() == TaskStepInfoFileName {
+				committedSteps = append(committedSteps, stepDir)
+			}
+		}
+	}
+
+	for _, stepDir := range committedSteps {
+		if running, err := isStepRunning(stepDir); err != nil || running {
+			// 无法确定步骤状态时不清理
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func isStepRunning(stepDir string) (bool, error) {
+	content, err := os.ReadFile(filepath.Join(stepDir, TaskStepInfoFileName))
+	if err != nil {
+		return false, err
+	}
+	task := CommittedTaskStep{}
+	if err := json.Unmarshal(content, &task); err != nil {
+		return false, err
+	}
+	state, err := task.Status()
+	if err != nil {
+		if err == errStepNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return state.State.Running, nil
+}
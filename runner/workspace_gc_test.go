@@ -0,0 +1,82 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package runner
+
+import (
+	"cloudiac/utils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupWorkspaces(t *testing.T) {
+	initLocalExecutorConfig(t)
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	newStep := func(envId, taskId string, running bool) *CommittedTaskStep {
+		task := &CommittedTaskStep{EnvId: envId, TaskId: taskId, Step: 0, Executor: ExecutorLocal}
+		stepDir := task.TaskStepDir()
+		assert.NoError(t, os.MkdirAll(stepDir, 0755))
+		if running {
+			workspace := GetTaskWorkspace(envId, taskId)
+			cmd := Command{
+				Executor:    ExecutorLocal,
+				Commands:    []string{"sleep", "30"},
+				Workdir:     workspace,
+				HostWorkdir: workspace,
+				StepDir:     stepDir,
+			}
+			pid, err := cmd.Start()
+			assert.NoError(t, err)
+			task.ContainerId = pid
+		} else {
+			assert.NoError(t, task.writeContainerInfo(&StepState{}))
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(stepDir, TaskStepInfoFileName), utils.MustJSON(task), 0644))
+		return task
+	}
+	setModTime := func(task *CommittedTaskStep, mtime time.Time) {
+		workspace := GetTaskWorkspace(task.EnvId, task.TaskId)
+		err := filepath.Walk(workspace, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(path, mtime, mtime)
+		})
+		assert.NoError(t, err)
+	}
+
+	expired := newStep("env-a", "run-expired", false)
+	setModTime(expired, old)
+	recent := newStep("env-b", "run-recent", false)
+	running := newStep("env-b", "run-running", true)
+	defer running.Cancel()
+	setModTime(running, old)
+	approving := newStep("env-b", "run-approving", false)
+	setModTime(approving, old)
+
+	// portal 没有上报需要保留的任务时不清理
+	_, err := CleanupWorkspaces(now, 24*time.Hour)
+	assert.Error(t, err)
+
+	assert.NoError(t, SaveWorkspaceKeepTasks([]string{approving.TaskId}))
+	removed, err := CleanupWorkspaces(now, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{GetTaskWorkspace(expired.EnvId, expired.TaskId)}, removed)
+
+	// 没有任务的环境目录也会被删除
+	_, err = os.Stat(filepath.Dir(GetTaskWorkspace(expired.EnvId, expired.TaskId)))
+	assert.True(t, os.IsNotExist(err))
+	for _, task := range []*CommittedTaskStep{recent, running, approving} {
+		_, err = os.Stat(task.TaskStepDir())
+		assert.NoError(t, err)
+	}
+
+	// 任务列表长时间没有更新时不清理
+	_, err = CleanupWorkspaces(now.Add(WorkspaceKeepMaxAge+time.Minute), 24*time.Hour)
+	assert.Error(t, err)
+}
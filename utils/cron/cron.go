@@ -0,0 +1,273 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+// Package cron 实现标准 5 字段 cron 表达式(分 时 日 月 周)的解析和执行时间计算
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 解析后的 cron 表达式，每个字段使用位图记录允许的取值
+type Schedule struct {
+	Minute, Hour, Dom, Month, Dow uint64
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBound = bounds{0, 59, nil}
+	hourBound   = bounds{0, 23, nil}
+	domBound    = bounds{1, 31, nil}
+	monthBound  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 周字段允许 0-7，0 和 7 都表示周日
+	dowBound = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// starBit 标识字段为 "*"(或 "?")，用于处理日和周字段同时设置时的匹配规则
+const starBit = 1 << 63
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse 解析 cron 表达式，支持 "*"、"?"、列表(1,2)、范围(1-5)、步长(*/10, 1-30/5)，
+// 月和周字段支持英文缩写(JAN, MON)，以及 @daily 等预定义表达式
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@") {
+		s, ok := descriptors[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized descriptor: %s", spec)
+		}
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected exactly 5 fields, found %d: %s", len(fields), spec)
+	}
+
+	var (
+		s   Schedule
+		err error
+	)
+	if s.Minute, err = parseField(fields[0], minuteBound); err != nil {
+		return nil, err
+	}
+	if s.Hour, err = parseField(fields[1], hourBound); err != nil {
+		return nil, err
+	}
+	if s.Dom, err = parseField(fields[2], domBound); err != nil {
+		return nil, err
+	}
+	if s.Month, err = parseField(fields[3], monthBound); err != nil {
+		return nil, err
+	}
+	if s.Dow, err = parseField(fields[4], dowBound); err != nil {
+		return nil, err
+	}
+	// 周日统一使用 0 表示
+	if s.Dow&(1<<7) != 0 {
+		s.Dow = (s.Dow | 1) &^ (1 << 7)
+	}
+	return &s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		bit, err := parseRange(expr, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= bit
+	}
+	return bits, nil
+}
+
+func parseRange(expr string, b bounds) (uint64, error) {
+	var (
+		start, end, step uint
+		err              error
+		extra            uint64
+	)
+
+	rangeAndStep := strings.Split(expr, "/")
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	singleDigit := len(lowAndHigh) == 1
+
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if !singleDigit {
+			return 0, fmt.Errorf("invalid range: %s", expr)
+		}
+		start, end = b.min, b.max
+		extra = starBit
+	} else {
+		if start, err = parseValue(lowAndHigh[0], b); err != nil {
+			return 0, err
+		}
+		switch len(lowAndHigh) {
+		case 1:
+			end = start
+		case 2:
+			if end, err = parseValue(lowAndHigh[1], b); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("too many hyphens: %s", expr)
+		}
+	}
+
+	switch len(rangeAndStep) {
+	case 1:
+		step = 1
+	case 2:
+		if step, err = parseUint(rangeAndStep[1]); err != nil {
+			return 0, err
+		}
+		// "N/step" 表示从 N 开始到最大值
+		if singleDigit {
+			end = b.max
+		}
+		if step > 1 {
+			extra = 0
+		}
+	default:
+		return 0, fmt.Errorf("too many slashes: %s", expr)
+	}
+
+	if start < b.min {
+		return 0, fmt.Errorf("beginning of range (%d) below minimum (%d): %s", start, b.min, expr)
+	}
+	if end > b.max {
+		return 0, fmt.Errorf("end of range (%d) above maximum (%d): %s", end, b.max, expr)
+	}
+	if start > end {
+		return 0, fmt.Errorf("beginning of range (%d) beyond end of range (%d): %s", start, end, expr)
+	}
+	if step == 0 {
+		return 0, fmt.Errorf("step of range should be a positive number: %s", expr)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits | extra, nil
+}
+
+func parseValue(expr string, b bounds) (uint, error) {
+	if b.names != nil {
+		if v, ok := b.names[strings.ToLower(expr)]; ok {
+			return v, nil
+		}
+	}
+	return parseUint(expr)
+}
+
+func parseUint(expr string) (uint, error) {
+	n, err := strconv.Atoi(expr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse int from %s: %v", expr, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative number (%d) not allowed: %s", n, expr)
+	}
+	return uint(n), nil
+}
+
+// Next 返回 t 之后(不包含 t)的下一个执行时间，时间计算基于 t 的时区。
+// 若 5 年内没有满足条件的时间(如 "0 0 30 2 *")则返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+
+	added := false
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.Month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// 夏令时切换可能导致当天 0 点不存在，这里修正到整点
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.Hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.Minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	return t.In(loc)
+}
+
+// dayMatches 日和周字段都设置了非 "*" 值时，满足任一条件即匹配(与 crontab 行为一致)
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.Dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.Dow > 0
+	if s.Dom&starBit > 0 || s.Dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
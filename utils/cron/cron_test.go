@@ -0,0 +1,76 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package cron
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseError(t *testing.T) {
+	cases := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every",
+	}
+	for _, c := range cases {
+		_, err := Parse(c)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestNext(t *testing.T) {
+	layout := "2006-01-02 15:04"
+	cases := []struct {
+		spec   string
+		from   string
+		expect string
+	}{
+		{"* * * * *", "2021-10-01 10:00", "2021-10-01 10:01"},
+		{"*/15 * * * *", "2021-10-01 10:07", "2021-10-01 10:15"},
+		{"0 2 * * *", "2021-10-01 10:00", "2021-10-02 02:00"},
+		{"30 8 * * 1-5", "2021-10-01 09:00", "2021-10-04 08:30"}, // 2021-10-01 为周五
+		{"0 0 * * SUN", "2021-10-01 00:00", "2021-10-03 00:00"},
+		{"0 0 * * 7", "2021-10-01 00:00", "2021-10-03 00:00"},
+		{"0 0 1 JAN *", "2021-10-01 00:00", "2022-01-01 00:00"},
+		{"0 0 29 2 *", "2021-10-01 00:00", "2024-02-29 00:00"},
+		{"0 0 13 * 5", "2021-10-02 00:00", "2021-10-08 00:00"}, // 日和周同时设置时满足任一即可
+		{"@daily", "2021-10-01 10:00", "2021-10-02 00:00"},
+		{"@hourly", "2021-10-01 10:00", "2021-10-01 11:00"},
+		{"0 0 30 2 *", "2021-10-01 00:00", ""},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if !assert.NoError(t, err, c.spec) {
+			continue
+		}
+		from, _ := time.ParseInLocation(layout, c.from, time.UTC)
+		next := s.Next(from)
+		if c.expect == "" {
+			assert.True(t, next.IsZero(), c.spec)
+		} else {
+			assert.Equal(t, c.expect, next.Format(layout), c.spec)
+		}
+	}
+}
+
+func TestNextWithLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	s, err := Parse("0 9 * * *")
+	assert.NoError(t, err)
+
+	from := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC) // UTC+8 08:00
+	next := s.Next(from.In(loc))
+	assert.Equal(t, time.Date(2021, 10, 1, 1, 0, 0, 0, time.UTC), next.UTC())
+}
@@ -121,6 +121,18 @@ func HttpService(reqUrl, method string, header *http.Header, data interface{}, c
 	return returndata, err
 }
 
+// HttpDo 发送自定义请求，返回响应及响应内容，用于需要设置请求 body 或读取响应 header 的场景
+func HttpDo(req *http.Request, conntimeout, deadline int) (*http.Response, []byte, error) {
+	resp, err := httpClient(conntimeout, deadline).Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	return resp, data, err
+}
+
 type FormPart struct {
 	Key  string
 	Name string
@@ -0,0 +1,178 @@
+// Copyright 2021 CloudJ Company Limited. All rights reserved.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	SecretMask = "***"
+
+	// 过短的值容易误匹配日志中的正常内容，不做替换
+	minSecretLength = 4
+	// 多行敏感值(如私钥)会按行替换，只替换长度达到该值的行
+	minSecretLineLength = 16
+	// SecretMaskWriter 缓存的未换行内容超过该长度时直接输出
+	maxMaskPendingSize = 64 * 1024
+)
+
+// SecretMasker 将内容中的敏感值(及其 base64、url、json 编码形式)替换为 ***
+type SecretMasker struct {
+	replacer *strings.Replacer
+}
+
+func secretVariants(secret string) []string {
+	return []string{
+		secret,
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+		base64.RawStdEncoding.EncodeToString([]byte(secret)),
+		base64.URLEncoding.EncodeToString([]byte(secret)),
+		base64.RawURLEncoding.EncodeToString([]byte(secret)),
+		url.QueryEscape(secret),
+		url.PathEscape(secret),
+		jsonEscape(secret),
+	}
+}
+
+// jsonEscape 返回 json 字符串中转义后的内容(不包括引号)，
+// 与 terraform -json 输出一致，<、>、& 会被转义为 \u003c、\u003e、\u0026
+func jsonEscape(s string) string {
+	bs, _ := json.Marshal(s)
+	return string(bs[1 : len(bs)-1])
+}
+
+// NewSecretMasker 创建 SecretMasker，空值及过短的值会被忽略
+func NewSecretMasker(secrets ...string) *SecretMasker {
+	set := make(map[string]bool)
+	add := func(s string) {
+		if len(s) < minSecretLength {
+			return
+		}
+		for _, v := range secretVariants(s) {
+			set[v] = true
+		}
+	}
+
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		add(secret)
+		if strings.Contains(secret, "\n") {
+			// 日志可能是逐行输出的，多行内容同时按行替换
+			for _, line := range strings.Split(secret, "\n") {
+				if line = strings.TrimSpace(line); len(line) >= minSecretLineLength {
+					add(line)
+				}
+			}
+		}
+	}
+
+	if len(set) == 0 {
+		return &SecretMasker{}
+	}
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	// Replacer 按参数顺序匹配，长的值优先，避免只替换了部分内容
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	oldnew := make([]string, 0, len(values)*2)
+	for _, v := range values {
+		oldnew = append(oldnew, v, SecretMask)
+	}
+	return &SecretMasker{replacer: strings.NewReplacer(oldnew...)}
+}
+
+// Mask 返回替换敏感值后的内容
+func (m *SecretMasker) Mask(content []byte) []byte {
+	if m == nil || m.replacer == nil || len(content) == 0 {
+		return content
+	}
+	return []byte(m.replacer.Replace(string(content)))
+}
+
+// MaskString 返回替换敏感值后的字符串
+func (m *SecretMasker) MaskString(s string) string {
+	if m == nil || m.replacer == nil {
+		return s
+	}
+	return m.replacer.Replace(s)
+}
+
+// SecretMaskWriter 替换敏感值后写入 w。内容按行处理，未换行的内容会缓存到下次写入或 Close() 时输出，
+// 保证被分多次写入的敏感值也能被替换
+type SecretMaskWriter struct {
+	masker  *SecretMasker
+	w       io.Writer
+	pending []byte
+}
+
+func NewSecretMaskWriter(masker *SecretMasker, w io.Writer) *SecretMaskWriter {
+	return &SecretMaskWriter{masker: masker, w: w}
+}
+
+// SecretMaskBoundary 返回 content 中可以单独替换敏感值的内容长度。
+// 最后一行未换行时可能只包含敏感值的一部分，需要与后续内容一起替换，未换行的内容过长时直接返回全部长度
+func SecretMaskBoundary(content []byte) int {
+	n := bytes.LastIndexByte(content, '\n') + 1
+	if n == 0 && len(content) > maxMaskPendingSize {
+		n = len(content)
+	}
+	return n
+}
+
+func (w *SecretMaskWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	if n := SecretMaskBoundary(w.pending); n > 0 {
+		if _, err := w.w.Write(w.masker.Mask(w.pending[:n])); err != nil {
+			return 0, err
+		}
+		w.pending = append(w.pending[:0], w.pending[n:]...)
+	}
+	return len(p), nil
+}
+
+// Flush 输出缓存的内容
+func (w *SecretMaskWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.masker.Mask(w.pending))
+	w.pending = w.pending[:0]
+	return err
+}
+
+// Close 输出缓存的内容，w 实现了 io.Closer 时同时关闭 w
+func (w *SecretMaskWriter) Close() error {
+	err := w.Flush()
+	if c, ok := w.w.(io.Closer); ok {
+		if er := c.Close(); err == nil {
+			err = er
+		}
+	}
+	return err
+}
+
+// RepoAddrSecrets 返回代码仓库地址中包含的认证信息(如 https://token@host/repo.git 中的 token)
+func RepoAddrSecrets(repoAddr string) []string {
+	u, err := url.Parse(repoAddr)
+	if err != nil || u.User == nil {
+		return nil
+	}
+	if password, ok := u.User.Password(); ok {
+		return []string{password}
+	}
+	// 只有用户名时一般为 token
+	return []string{u.User.Username()}
+}